@@ -26,6 +26,16 @@ type ServerProperties struct {
 	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`
 	ReplTimeout       int    `cfg:"repl-timeout"`
 
+	// thresholds of compact encodings, see OBJECT ENCODING
+	HashMaxListpackEntries int `cfg:"hash-max-listpack-entries"`
+	HashMaxListpackValue   int `cfg:"hash-max-listpack-value"`
+	SetMaxIntsetEntries    int `cfg:"set-max-intset-entries"`
+	SetMaxListpackEntries  int `cfg:"set-max-listpack-entries"`
+	SetMaxListpackValue    int `cfg:"set-max-listpack-value"`
+	ZSetMaxListpackEntries int `cfg:"zset-max-listpack-entries"`
+	ZSetMaxListpackValue   int `cfg:"zset-max-listpack-value"`
+	ListMaxListpackSize    int `cfg:"list-max-listpack-size"`
+
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
 }
@@ -40,10 +50,24 @@ func init() {
 		Port:       6379,
 		AppendOnly: false,
 	}
+	Properties.setEncodingDefaults()
+}
+
+// setEncodingDefaults sets the thresholds of compact encodings to the defaults of redis
+func (p *ServerProperties) setEncodingDefaults() {
+	p.HashMaxListpackEntries = 128
+	p.HashMaxListpackValue = 64
+	p.SetMaxIntsetEntries = 512
+	p.SetMaxListpackEntries = 128
+	p.SetMaxListpackValue = 64
+	p.ZSetMaxListpackEntries = 128
+	p.ZSetMaxListpackValue = 64
+	p.ListMaxListpackSize = -2
 }
 
 func parse(src io.Reader) *ServerProperties {
 	config := &ServerProperties{}
+	config.setEncodingDefaults()
 
 	// read config file
 	rawMap := make(map[string]string)
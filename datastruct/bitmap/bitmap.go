@@ -18,7 +18,7 @@ func (b *bitmap) SetBit(offset int64, val byte) {
 		(*b)[byteIndex] |= mask
 	} else {
 		//clear bit
-		(*b)[byteIndex] = ^mask
+		(*b)[byteIndex] &^= mask
 	}
 }
 
@@ -33,7 +33,7 @@ func (b *bitmap) ToBytes() []byte {
 func (b *bitmap) GetBit(offset int64) byte {
 	bytesIndex := offset >> 3
 	bitIndex := offset % 8
-	if bytesIndex > int64(len(*b)) {
+	if bytesIndex >= int64(len(*b)) {
 		return 0
 	}
 	return ((*b)[bytesIndex] >> bitIndex) & 0x01
@@ -76,11 +76,7 @@ func (b *bitmap) ForEachByte(s, e int, cb Callback) {
 }
 
 func (b *bitmap) grow(bitSize int64) {
-	var byteSize int64
-	if bitSize%8 == 0 {
-		byteSize = bitSize / 8
-	}
-	byteSize = bitSize/8 + 1
+	byteSize := (bitSize + 7) / 8
 	gap := byteSize - int64(len(*b))
 	if gap <= 0 {
 		return
@@ -58,6 +58,23 @@ func TestFromBytes(t *testing.T) {
 	}
 }
 
+func TestClearBit(t *testing.T) {
+	bm := FromBytes([]byte{0x0f, 0xf0})
+	bm.SetBit(1, 0)
+	bm.SetBit(12, 0)
+	expect := []byte{0x0d, 0xe0}
+	if !bytes.Equal(bm.ToBytes(), expect) {
+		t.Errorf("expect %v, actual %v", expect, bm.ToBytes())
+	}
+	bm.SetBit(7, 0)
+	if len(bm.ToBytes()) != 2 {
+		t.Error("clearing bit should not grow bitmap")
+	}
+	if bm.GetBit(16) != 0 {
+		t.Error("wrong value")
+	}
+}
+
 func TestForEachBit(t *testing.T) {
 	bm := NewBitmap()
 	for i := 0; i < 1000; i++ {
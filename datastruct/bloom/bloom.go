@@ -0,0 +1,276 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/pluming/aurora/lib/murmur"
+)
+
+/*
+ * Filter is a scalable bloom filter like RedisBloom, made of a chain of bloom filters.
+ * A new filter is appended when the last one is full, its capacity is expansion times larger
+ * and its error rate is tighter, so that the error rate of the whole chain converges.
+ */
+
+const (
+	// tighteningRatio is the ratio of error rate of a new filter to the last one
+	tighteningRatio = 0.5
+	hashSeed        = 0xc6a4a7935bd1e995
+
+	headerFixedSize = 4 + 8 + 4
+	layerHeaderSize = 8 + 8 + 4 + 8 + 8
+)
+
+var (
+	// ErrFull is returned when adding into a full non scaling filter
+	ErrFull = errors.New("ERR non scaling filter is full")
+	// ErrBadData is returned when restoring from corrupted data
+	ErrBadData = errors.New("ERR received bad data")
+)
+
+// layer is a standard bloom filter
+type layer struct {
+	capacity  uint64
+	errorRate float64
+	hashes    uint32
+	bitCount  uint64
+	items     uint64
+	bits      []byte
+}
+
+func makeLayer(capacity uint64, errorRate float64) *layer {
+	bitsPerEntry := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	bitCount := uint64(math.Ceil(float64(capacity) * bitsPerEntry))
+	if bitCount < 8 {
+		bitCount = 8
+	}
+	// round up to whole bytes
+	bitCount = (bitCount + 7) &^ 7
+	return &layer{
+		capacity:  capacity,
+		errorRate: errorRate,
+		hashes:    uint32(math.Ceil(math.Ln2 * bitsPerEntry)),
+		bitCount:  bitCount,
+		bits:      make([]byte, bitCount/8),
+	}
+}
+
+// hashPair is the base hashes of an item, the i-th hash is a + i*b as Kirsch and Mitzenmacher suggested
+type hashPair struct {
+	a, b uint64
+}
+
+func hashItem(item []byte) hashPair {
+	a := murmur.Hash64A(item, hashSeed)
+	return hashPair{a: a, b: murmur.Hash64A(item, a)}
+}
+
+func (l *layer) test(h hashPair) bool {
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		bit := (h.a + i*h.b) % l.bitCount
+		if l.bits[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *layer) add(h hashPair) {
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		bit := (h.a + i*h.b) % l.bitCount
+		l.bits[bit>>3] |= 1 << (bit & 7)
+	}
+	l.items++
+}
+
+// Filter is a scalable bloom filter
+type Filter struct {
+	layers []*layer
+	// expansion is the capacity ratio of a new filter to the last one, 0 means non scaling
+	expansion uint32
+}
+
+// New creates a filter holding capacity items at errorRate, expansion 0 means the filter never scales
+func New(capacity uint64, errorRate float64, expansion uint32) *Filter {
+	return &Filter{
+		layers:    []*layer{makeLayer(capacity, errorRate)},
+		expansion: expansion,
+	}
+}
+
+// Exists returns whether item may have been added
+func (f *Filter) Exists(item []byte) bool {
+	h := hashItem(item)
+	for _, l := range f.layers {
+		if l.test(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds item, added is false if it may have been added
+func (f *Filter) Add(item []byte) (added bool, err error) {
+	h := hashItem(item)
+	for _, l := range f.layers {
+		if l.test(h) {
+			return false, nil
+		}
+	}
+	last := f.layers[len(f.layers)-1]
+	if last.items >= last.capacity {
+		if f.expansion == 0 {
+			return false, ErrFull
+		}
+		last = makeLayer(last.capacity*uint64(f.expansion), last.errorRate*tighteningRatio)
+		f.layers = append(f.layers, last)
+	}
+	last.add(h)
+	return true, nil
+}
+
+// Capacity returns the number of items the filter can hold before scaling
+func (f *Filter) Capacity() uint64 {
+	var capacity uint64
+	for _, l := range f.layers {
+		capacity += l.capacity
+	}
+	return capacity
+}
+
+// Size returns the number of bytes used by the filter
+func (f *Filter) Size() int {
+	size := headerFixedSize
+	for _, l := range f.layers {
+		size += layerHeaderSize + len(l.bits)
+	}
+	return size
+}
+
+// FilterCount returns the number of chained filters
+func (f *Filter) FilterCount() int {
+	return len(f.layers)
+}
+
+// Items returns the number of items added
+func (f *Filter) Items() uint64 {
+	var items uint64
+	for _, l := range f.layers {
+		items += l.items
+	}
+	return items
+}
+
+// Expansion returns the expansion rate, 0 means non scaling
+func (f *Filter) Expansion() uint32 {
+	return f.expansion
+}
+
+/* ---- dump and restore ----
+ * a filter is dumped as a header describing all filters, followed by the bits of all filters
+ */
+
+// Header returns the encoded parameters of the filter
+func (f *Filter) Header() []byte {
+	buf := make([]byte, headerFixedSize, headerFixedSize+len(f.layers)*layerHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:], f.expansion)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(f.DataLen()))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(f.layers)))
+	var tmp [layerHeaderSize]byte
+	for _, l := range f.layers {
+		binary.LittleEndian.PutUint64(tmp[0:], l.capacity)
+		binary.LittleEndian.PutUint64(tmp[8:], math.Float64bits(l.errorRate))
+		binary.LittleEndian.PutUint32(tmp[16:], l.hashes)
+		binary.LittleEndian.PutUint64(tmp[20:], l.bitCount)
+		binary.LittleEndian.PutUint64(tmp[28:], l.items)
+		buf = append(buf, tmp[:]...)
+	}
+	return buf
+}
+
+// FromHeader creates a filter of the given header with all bits unset, which are filled by WriteData
+func FromHeader(header []byte) (*Filter, error) {
+	if len(header) < headerFixedSize {
+		return nil, ErrBadData
+	}
+	f := &Filter{expansion: binary.LittleEndian.Uint32(header[0:])}
+	dataLen := binary.LittleEndian.Uint64(header[4:])
+	layerCount := int(binary.LittleEndian.Uint32(header[12:]))
+	if layerCount == 0 || len(header) != headerFixedSize+layerCount*layerHeaderSize {
+		return nil, ErrBadData
+	}
+	var total uint64
+	for i := 0; i < layerCount; i++ {
+		b := header[headerFixedSize+i*layerHeaderSize:]
+		l := &layer{
+			capacity:  binary.LittleEndian.Uint64(b[0:]),
+			errorRate: math.Float64frombits(binary.LittleEndian.Uint64(b[8:])),
+			hashes:    binary.LittleEndian.Uint32(b[16:]),
+			bitCount:  binary.LittleEndian.Uint64(b[20:]),
+			items:     binary.LittleEndian.Uint64(b[28:]),
+		}
+		if l.hashes == 0 || l.bitCount == 0 || l.bitCount%8 != 0 || l.bitCount/8 > dataLen-total {
+			return nil, ErrBadData
+		}
+		l.bits = make([]byte, l.bitCount/8)
+		total += l.bitCount / 8
+		f.layers = append(f.layers, l)
+	}
+	if total != dataLen {
+		return nil, ErrBadData
+	}
+	return f, nil
+}
+
+// DataLen returns the number of bytes of bits of all filters
+func (f *Filter) DataLen() int {
+	size := 0
+	for _, l := range f.layers {
+		size += len(l.bits)
+	}
+	return size
+}
+
+// ReadData returns a copy of at most size bytes of bits from offset
+func (f *Filter) ReadData(offset, size int) []byte {
+	var data []byte
+	for _, l := range f.layers {
+		if size <= 0 {
+			break
+		}
+		if offset >= len(l.bits) {
+			offset -= len(l.bits)
+			continue
+		}
+		end := offset + size
+		if end > len(l.bits) {
+			end = len(l.bits)
+		}
+		data = append(data, l.bits[offset:end]...)
+		size -= end - offset
+		offset = 0
+	}
+	return data
+}
+
+// WriteData overwrites bits from offset
+func (f *Filter) WriteData(offset int, data []byte) error {
+	if offset < 0 || offset+len(data) > f.DataLen() {
+		return ErrBadData
+	}
+	for _, l := range f.layers {
+		if len(data) == 0 {
+			break
+		}
+		if offset >= len(l.bits) {
+			offset -= len(l.bits)
+			continue
+		}
+		n := copy(l.bits[offset:], data)
+		data = data[n:]
+		offset = 0
+	}
+	return nil
+}
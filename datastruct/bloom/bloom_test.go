@@ -0,0 +1,75 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAddAndExists(t *testing.T) {
+	f := New(1000, 0.01, 2)
+	for i := 0; i < 5000; i++ {
+		if added, err := f.Add([]byte(strconv.Itoa(i))); err != nil || !added && i < 100 {
+			t.Fatalf("add %d failed", i)
+		}
+	}
+	for i := 0; i < 5000; i++ {
+		if !f.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("%d should exist", i)
+		}
+	}
+	if f.FilterCount() != 3 || f.Capacity() != 7000 {
+		t.Errorf("unexpected filters %d capacity %d", f.FilterCount(), f.Capacity())
+	}
+	falsePositive := 0
+	for i := 5000; i < 15000; i++ {
+		if f.Exists([]byte(strconv.Itoa(i))) {
+			falsePositive++
+		}
+	}
+	// the error rate of chain is at most 0.01 / (1 - 0.5)
+	if falsePositive > 200 {
+		t.Errorf("too many false positives %d", falsePositive)
+	}
+}
+
+func TestNonScaling(t *testing.T) {
+	f := New(10, 0.01, 0)
+	for i := 0; i < 10; i++ {
+		if _, err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.Add([]byte("x")); err != ErrFull {
+		t.Error("expect full")
+	}
+}
+
+func TestDump(t *testing.T) {
+	f := New(100, 0.001, 4)
+	for i := 0; i < 300; i++ {
+		_, _ = f.Add([]byte(strconv.Itoa(i)))
+	}
+	restored, err := FromHeader(f.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < f.DataLen(); offset += 100 {
+		if err := restored.WriteData(offset, f.ReadData(offset, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if restored.Items() != f.Items() || restored.Size() != f.Size() {
+		t.Error("wrong meta")
+	}
+	for i := 0; i < 300; i++ {
+		if !restored.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("%d should exist", i)
+		}
+	}
+	if _, err := FromHeader(f.Header()[1:]); err == nil {
+		t.Error("expect bad data")
+	}
+	if err := restored.WriteData(f.DataLen(), []byte{1}); err == nil {
+		t.Error("expect bad data")
+	}
+}
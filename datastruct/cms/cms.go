@@ -0,0 +1,189 @@
+package cms
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/pluming/aurora/lib/murmur"
+)
+
+/*
+ * Sketch is a Count-Min Sketch like RedisBloom: depth rows of width counters.
+ * An item increases a counter in each row located by a hash seeded with the row number,
+ * the estimated count of an item is the min of its counters, which never underestimates.
+ */
+
+const (
+	counterSize = 4
+	headerSize  = 4 + 4 + 8
+)
+
+var (
+	// ErrOverflow is returned when a counter overflows
+	ErrOverflow = errors.New("ERR CMS: INCRBY overflow")
+	// ErrDimension is returned when merging sketches of different width or depth
+	ErrDimension = errors.New("ERR CMS: width/depth is not equal")
+	// ErrBadData is returned when restoring from corrupted data
+	ErrBadData = errors.New("ERR received bad data")
+)
+
+// Sketch is a Count-Min Sketch
+type Sketch struct {
+	width uint32
+	depth uint32
+	// count is the sum of all increments
+	count uint64
+	// counters are little endian uint32, row by row
+	counters []byte
+}
+
+// New creates a sketch of depth rows of width counters
+func New(width, depth uint32) *Sketch {
+	return &Sketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]byte, int(width)*int(depth)*counterSize),
+	}
+}
+
+// Width returns the number of counters per row
+func (s *Sketch) Width() uint32 {
+	return s.width
+}
+
+// Depth returns the number of rows
+func (s *Sketch) Depth() uint32 {
+	return s.depth
+}
+
+// Count returns the sum of all increments
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// offset returns the offset of the counter of item in row
+func (s *Sketch) offset(item []byte, row uint32) int {
+	col := murmur.Hash64A(item, uint64(row)) % uint64(s.width)
+	return (int(row)*int(s.width) + int(col)) * counterSize
+}
+
+func (s *Sketch) counter(offset int) uint32 {
+	return binary.LittleEndian.Uint32(s.counters[offset:])
+}
+
+// IncrBy increases the counters of item, returns the estimated count after increasing
+func (s *Sketch) IncrBy(item []byte, increment uint32) (uint32, error) {
+	if s.count+uint64(increment) < s.count {
+		return 0, ErrOverflow
+	}
+	offsets := make([]int, s.depth)
+	for row := range offsets {
+		offsets[row] = s.offset(item, uint32(row))
+		if s.counter(offsets[row]) > math.MaxUint32-increment {
+			return 0, ErrOverflow
+		}
+	}
+	min := uint32(math.MaxUint32)
+	for _, offset := range offsets {
+		c := s.counter(offset) + increment
+		binary.LittleEndian.PutUint32(s.counters[offset:], c)
+		if c < min {
+			min = c
+		}
+	}
+	s.count += uint64(increment)
+	return min, nil
+}
+
+// Query returns the estimated count of item
+func (s *Sketch) Query(item []byte) uint32 {
+	min := uint32(math.MaxUint32)
+	for row := uint32(0); row < s.depth; row++ {
+		if c := s.counter(s.offset(item, row)); c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Merge overwrites the sketch with the weighted sum of sources, sources may include the sketch itself
+func (s *Sketch) Merge(sources []*Sketch, weights []int64) error {
+	for _, src := range sources {
+		if src.width != s.width || src.depth != s.depth {
+			return ErrDimension
+		}
+	}
+	merged := make([]byte, len(s.counters))
+	for offset := 0; offset < len(merged); offset += counterSize {
+		var sum int64
+		for i, src := range sources {
+			sum += int64(src.counter(offset)) * weights[i]
+		}
+		if sum < 0 || sum > math.MaxUint32 {
+			return ErrOverflow
+		}
+		binary.LittleEndian.PutUint32(merged[offset:], uint32(sum))
+	}
+	var count int64
+	for i, src := range sources {
+		count += int64(src.count) * weights[i]
+	}
+	if count < 0 {
+		return ErrOverflow
+	}
+	s.counters = merged
+	s.count = uint64(count)
+	return nil
+}
+
+/* ---- dump and restore ----
+ * a sketch is dumped as a header of its dimensions, followed by counters
+ */
+
+// Header returns the encoded parameters of the sketch
+func (s *Sketch) Header() []byte {
+	buf := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(buf[0:], s.width)
+	binary.LittleEndian.PutUint32(buf[4:], s.depth)
+	binary.LittleEndian.PutUint64(buf[8:], s.count)
+	return buf
+}
+
+// FromHeader creates a sketch of the given header with all counters zero, which are filled by WriteData
+func FromHeader(header []byte) (*Sketch, error) {
+	if len(header) != headerSize {
+		return nil, ErrBadData
+	}
+	width := binary.LittleEndian.Uint32(header[0:])
+	depth := binary.LittleEndian.Uint32(header[4:])
+	if width == 0 || depth == 0 {
+		return nil, ErrBadData
+	}
+	s := New(width, depth)
+	s.count = binary.LittleEndian.Uint64(header[8:])
+	return s, nil
+}
+
+// DataLen returns the number of bytes of counters
+func (s *Sketch) DataLen() int {
+	return len(s.counters)
+}
+
+// ReadData returns a copy of at most size bytes of counters from offset
+func (s *Sketch) ReadData(offset, size int) []byte {
+	end := offset + size
+	if end > len(s.counters) {
+		end = len(s.counters)
+	}
+	return append([]byte(nil), s.counters[offset:end]...)
+}
+
+// WriteData overwrites counters from offset
+func (s *Sketch) WriteData(offset int, data []byte) error {
+	if offset < 0 || offset+len(data) > len(s.counters) {
+		return ErrBadData
+	}
+	copy(s.counters[offset:], data)
+	return nil
+}
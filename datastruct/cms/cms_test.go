@@ -0,0 +1,66 @@
+package cms
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestIncrAndQuery(t *testing.T) {
+	s := New(2000, 5)
+	for i := 0; i < 1000; i++ {
+		for j := 0; j <= i%10; j++ {
+			if _, err := s.IncrBy([]byte(strconv.Itoa(i)), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if s.Count() != 5500 {
+		t.Errorf("wrong count %d", s.Count())
+	}
+	exact := 0
+	for i := 0; i < 1000; i++ {
+		c := s.Query([]byte(strconv.Itoa(i)))
+		if c < uint32(i%10+1) {
+			t.Fatalf("%d is underestimated: %d", i, c)
+		}
+		if c == uint32(i%10+1) {
+			exact++
+		}
+	}
+	if exact < 950 {
+		t.Errorf("too many overestimated: %d exact", exact)
+	}
+	if _, err := s.IncrBy([]byte("0"), 1<<32-1); err != ErrOverflow {
+		t.Errorf("expect overflow, actual %v", err)
+	}
+}
+
+func TestMergeAndDump(t *testing.T) {
+	a, b := New(100, 4), New(100, 4)
+	_, _ = a.IncrBy([]byte("x"), 3)
+	_, _ = b.IncrBy([]byte("x"), 5)
+	_, _ = b.IncrBy([]byte("y"), 1)
+	dst := New(100, 4)
+	if err := dst.Merge([]*Sketch{a, b}, []int64{2, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Query([]byte("x")) != 11 || dst.Query([]byte("y")) < 1 || dst.Count() != 12 {
+		t.Errorf("wrong merged result %d %d", dst.Query([]byte("x")), dst.Count())
+	}
+	if err := dst.Merge([]*Sketch{New(10, 4)}, []int64{1}); err != ErrDimension {
+		t.Errorf("expect dimension error, actual %v", err)
+	}
+
+	restored, err := FromHeader(dst.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < dst.DataLen(); offset += 300 {
+		if err := restored.WriteData(offset, dst.ReadData(offset, 300)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if restored.Query([]byte("x")) != 11 || restored.Count() != 12 {
+		t.Error("wrong restored sketch")
+	}
+}
@@ -0,0 +1,372 @@
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pluming/aurora/lib/murmur"
+)
+
+/*
+ * Filter is a scalable cuckoo filter like RedisBloom, made of a chain of cuckoo filters.
+ * An item is stored as an 8-bit fingerprint in one of its two candidate buckets,
+ * the index of the alternate bucket is computed from the fingerprint and the index of the other one.
+ * Items are inserted into the last filter, a larger filter is appended when it is full.
+ */
+
+const (
+	altHashFactor = 0x5bd1e995
+
+	headerFixedSize  = 8 + 8 + 8 + 2 + 2 + 2 + 2
+	filterHeaderSize = 8
+)
+
+var (
+	// ErrFull is returned when the filter is full and can not expand
+	ErrFull = errors.New("ERR Filter is full")
+	// ErrBadData is returned when restoring from corrupted data
+	ErrBadData = errors.New("ERR received bad data")
+)
+
+type subFilter struct {
+	numBuckets uint64 // always power of 2
+	slots      []uint8
+}
+
+func (sf *subFilter) bucket(index uint64, bucketSize uint16) []uint8 {
+	start := index * uint64(bucketSize)
+	return sf.slots[start : start+uint64(bucketSize)]
+}
+
+// Filter is a scalable cuckoo filter
+type Filter struct {
+	filters       []*subFilter
+	capacity      uint64
+	bucketSize    uint16
+	maxIterations uint16
+	// expansion is the buckets ratio of a new filter to the last one, 0 means non scaling
+	expansion uint16
+	items     uint64
+	deletes   uint64
+}
+
+func nextPowerOf2(n uint64) uint64 {
+	p := uint64(1)
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// New creates a filter for capacity items, bucketSize is the number of fingerprints per bucket,
+// maxIterations limits the times of relocating fingerprints, expansion 0 means the filter never scales
+func New(capacity uint64, bucketSize, maxIterations, expansion uint16) *Filter {
+	if expansion > 0 {
+		// keeps the number of buckets power of 2
+		expansion = uint16(nextPowerOf2(uint64(expansion)))
+	}
+	f := &Filter{
+		capacity:      capacity,
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+	}
+	f.appendFilter(nextPowerOf2(capacity / uint64(bucketSize)))
+	return f
+}
+
+func (f *Filter) appendFilter(numBuckets uint64) *subFilter {
+	sf := &subFilter{
+		numBuckets: numBuckets,
+		slots:      make([]uint8, numBuckets*uint64(f.bucketSize)),
+	}
+	f.filters = append(f.filters, sf)
+	return sf
+}
+
+// hashItem returns the fingerprint of item and the hash locating its first bucket
+func hashItem(item []byte) (fp uint8, hash uint64) {
+	hash = murmur.Hash64A(item, 0)
+	return uint8(hash%255 + 1), hash
+}
+
+// altIndex returns the other candidate bucket of fingerprint, it is reversible: altIndex(altIndex(i)) == i
+func altIndex(fp uint8, index uint64, numBuckets uint64) uint64 {
+	return (index ^ uint64(fp)*altHashFactor) & (numBuckets - 1)
+}
+
+func (f *Filter) candidates(sf *subFilter, fp uint8, hash uint64) (i1, i2 uint64) {
+	i1 = hash & (sf.numBuckets - 1)
+	return i1, altIndex(fp, i1, sf.numBuckets)
+}
+
+func (f *Filter) insertIntoBucket(sf *subFilter, index uint64, fp uint8) bool {
+	bucket := sf.bucket(index, f.bucketSize)
+	for i, slot := range bucket {
+		if slot == 0 {
+			bucket[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+type kick struct {
+	index  uint64
+	slot   int
+	victim uint8
+}
+
+// insert relocates fingerprints to make room if both candidates are full,
+// relocations are undone if no room is found in maxIterations.
+// Victims are chosen in turn from the first candidate like RedisBloom, so that insertion is deterministic
+func (f *Filter) insert(sf *subFilter, fp uint8, hash uint64) bool {
+	i1, i2 := f.candidates(sf, fp, hash)
+	if f.insertIntoBucket(sf, i1, fp) || f.insertIntoBucket(sf, i2, fp) {
+		return true
+	}
+	index := i1
+	slot := 0
+	path := make([]kick, 0, f.maxIterations)
+	for n := uint16(0); n < f.maxIterations; n++ {
+		bucket := sf.bucket(index, f.bucketSize)
+		path = append(path, kick{index: index, slot: slot, victim: bucket[slot]})
+		fp, bucket[slot] = bucket[slot], fp
+		index = altIndex(fp, index, sf.numBuckets)
+		if f.insertIntoBucket(sf, index, fp) {
+			return true
+		}
+		slot = (slot + 1) % int(f.bucketSize)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		sf.bucket(path[i].index, f.bucketSize)[path[i].slot] = path[i].victim
+	}
+	return false
+}
+
+// Add adds item even if it exists
+func (f *Filter) Add(item []byte) error {
+	fp, hash := hashItem(item)
+	last := f.filters[len(f.filters)-1]
+	if !f.insert(last, fp, hash) {
+		if f.expansion == 0 {
+			return ErrFull
+		}
+		last = f.appendFilter(last.numBuckets * uint64(f.expansion))
+		if !f.insert(last, fp, hash) {
+			return ErrFull
+		}
+	}
+	f.items++
+	return nil
+}
+
+// AddNX adds item only if it does not exist, returns whether it is added
+func (f *Filter) AddNX(item []byte) (bool, error) {
+	if f.Exists(item) {
+		return false, nil
+	}
+	if err := f.Add(item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Exists returns whether item may have been added
+func (f *Filter) Exists(item []byte) bool {
+	fp, hash := hashItem(item)
+	for _, sf := range f.filters {
+		i1, i2 := f.candidates(sf, fp, hash)
+		for _, index := range [2]uint64{i1, i2} {
+			for _, slot := range sf.bucket(index, f.bucketSize) {
+				if slot == fp {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Count returns the number of times item may have been added
+func (f *Filter) Count(item []byte) int64 {
+	fp, hash := hashItem(item)
+	var count int64
+	for _, sf := range f.filters {
+		i1, i2 := f.candidates(sf, fp, hash)
+		indexes := []uint64{i1}
+		if i2 != i1 {
+			indexes = append(indexes, i2)
+		}
+		for _, index := range indexes {
+			for _, slot := range sf.bucket(index, f.bucketSize) {
+				if slot == fp {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// Delete removes one occurrence of item, returns whether it is found.
+// Deleting an item never added may remove another item sharing the same fingerprint
+func (f *Filter) Delete(item []byte) bool {
+	fp, hash := hashItem(item)
+	for i := len(f.filters) - 1; i >= 0; i-- {
+		sf := f.filters[i]
+		i1, i2 := f.candidates(sf, fp, hash)
+		for _, index := range [2]uint64{i1, i2} {
+			bucket := sf.bucket(index, f.bucketSize)
+			for j, slot := range bucket {
+				if slot == fp {
+					bucket[j] = 0
+					f.items--
+					f.deletes++
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Size returns the number of bytes used by the filter
+func (f *Filter) Size() int {
+	return headerFixedSize + len(f.filters)*filterHeaderSize + f.DataLen()
+}
+
+// NumBuckets returns the number of buckets of the first filter
+func (f *Filter) NumBuckets() uint64 {
+	return f.filters[0].numBuckets
+}
+
+// FilterCount returns the number of chained filters
+func (f *Filter) FilterCount() int {
+	return len(f.filters)
+}
+
+// Items returns the number of items added and not deleted
+func (f *Filter) Items() uint64 {
+	return f.items
+}
+
+// Deletes returns the number of items deleted
+func (f *Filter) Deletes() uint64 {
+	return f.deletes
+}
+
+// BucketSize returns the number of fingerprints per bucket
+func (f *Filter) BucketSize() uint16 {
+	return f.bucketSize
+}
+
+// Expansion returns the expansion rate, 0 means non scaling
+func (f *Filter) Expansion() uint16 {
+	return f.expansion
+}
+
+// MaxIterations returns the max times of relocating fingerprints
+func (f *Filter) MaxIterations() uint16 {
+	return f.maxIterations
+}
+
+/* ---- dump and restore ----
+ * a filter is dumped as a header describing all filters, followed by the buckets of all filters
+ */
+
+// Header returns the encoded parameters of the filter
+func (f *Filter) Header() []byte {
+	buf := make([]byte, headerFixedSize, headerFixedSize+len(f.filters)*filterHeaderSize)
+	binary.LittleEndian.PutUint64(buf[0:], f.capacity)
+	binary.LittleEndian.PutUint64(buf[8:], f.items)
+	binary.LittleEndian.PutUint64(buf[16:], f.deletes)
+	binary.LittleEndian.PutUint16(buf[24:], f.bucketSize)
+	binary.LittleEndian.PutUint16(buf[26:], f.maxIterations)
+	binary.LittleEndian.PutUint16(buf[28:], f.expansion)
+	binary.LittleEndian.PutUint16(buf[30:], uint16(len(f.filters)))
+	var tmp [filterHeaderSize]byte
+	for _, sf := range f.filters {
+		binary.LittleEndian.PutUint64(tmp[:], sf.numBuckets)
+		buf = append(buf, tmp[:]...)
+	}
+	return buf
+}
+
+// FromHeader creates a filter of the given header with all buckets empty, which are filled by WriteData
+func FromHeader(header []byte) (*Filter, error) {
+	if len(header) < headerFixedSize {
+		return nil, ErrBadData
+	}
+	f := &Filter{
+		capacity:      binary.LittleEndian.Uint64(header[0:]),
+		items:         binary.LittleEndian.Uint64(header[8:]),
+		deletes:       binary.LittleEndian.Uint64(header[16:]),
+		bucketSize:    binary.LittleEndian.Uint16(header[24:]),
+		maxIterations: binary.LittleEndian.Uint16(header[26:]),
+		expansion:     binary.LittleEndian.Uint16(header[28:]),
+	}
+	filterCount := int(binary.LittleEndian.Uint16(header[30:]))
+	if filterCount == 0 || f.bucketSize == 0 || len(header) != headerFixedSize+filterCount*filterHeaderSize {
+		return nil, ErrBadData
+	}
+	for i := 0; i < filterCount; i++ {
+		numBuckets := binary.LittleEndian.Uint64(header[headerFixedSize+i*filterHeaderSize:])
+		if numBuckets == 0 || numBuckets&(numBuckets-1) != 0 {
+			return nil, ErrBadData
+		}
+		f.appendFilter(numBuckets)
+	}
+	return f, nil
+}
+
+// DataLen returns the number of bytes of buckets of all filters
+func (f *Filter) DataLen() int {
+	size := 0
+	for _, sf := range f.filters {
+		size += len(sf.slots)
+	}
+	return size
+}
+
+// ReadData returns a copy of at most size bytes of buckets from offset
+func (f *Filter) ReadData(offset, size int) []byte {
+	var data []byte
+	for _, sf := range f.filters {
+		if size <= 0 {
+			break
+		}
+		if offset >= len(sf.slots) {
+			offset -= len(sf.slots)
+			continue
+		}
+		end := offset + size
+		if end > len(sf.slots) {
+			end = len(sf.slots)
+		}
+		data = append(data, sf.slots[offset:end]...)
+		size -= end - offset
+		offset = 0
+	}
+	return data
+}
+
+// WriteData overwrites buckets from offset
+func (f *Filter) WriteData(offset int, data []byte) error {
+	if offset < 0 || offset+len(data) > f.DataLen() {
+		return ErrBadData
+	}
+	for _, sf := range f.filters {
+		if len(data) == 0 {
+			break
+		}
+		if offset >= len(sf.slots) {
+			offset -= len(sf.slots)
+			continue
+		}
+		n := copy(sf.slots[offset:], data)
+		data = data[n:]
+		offset = 0
+	}
+	return nil
+}
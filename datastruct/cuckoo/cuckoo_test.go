@@ -0,0 +1,106 @@
+package cuckoo
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAddAndDelete(t *testing.T) {
+	f := New(1000, 2, 20, 1)
+	for i := 0; i < 3000; i++ {
+		if err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.FilterCount() < 2 || f.Items() != 3000 {
+		t.Errorf("unexpected filters %d items %d", f.FilterCount(), f.Items())
+	}
+	for i := 0; i < 3000; i++ {
+		if !f.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("%d should exist", i)
+		}
+	}
+	_ = f.Add([]byte("dup"))
+	_ = f.Add([]byte("dup"))
+	if f.Count([]byte("dup")) < 2 {
+		t.Error("dup should be counted twice")
+	}
+	if added, _ := f.AddNX([]byte("dup")); added {
+		t.Error("dup exists")
+	}
+	for i := 0; i < 3000; i++ {
+		if !f.Delete([]byte(strconv.Itoa(i))) {
+			t.Fatalf("%d should be deleted", i)
+		}
+	}
+	if f.Items() != 2 || f.Deletes() != 3000 {
+		t.Error("wrong counters")
+	}
+	if !f.Exists([]byte("dup")) {
+		t.Error("dup should exist")
+	}
+}
+
+func TestFull(t *testing.T) {
+	f := New(8, 2, 10, 0)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = f.Add([]byte(strconv.Itoa(i)))
+	}
+	if err != ErrFull {
+		t.Error("expect full")
+	}
+	// failed relocations are undone
+	for i := uint64(0); i < f.Items(); i++ {
+		if !f.Exists([]byte(strconv.Itoa(int(i)))) {
+			t.Fatalf("%d should exist", i)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	f := New(100, 4, 20, 3)
+	if f.Expansion() != 4 {
+		t.Error("expansion should be rounded to power of 2")
+	}
+	for i := 0; i < 500; i++ {
+		_ = f.Add([]byte(strconv.Itoa(i)))
+	}
+	f.Delete([]byte("0"))
+	restored, err := FromHeader(f.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < f.DataLen(); offset += 100 {
+		if err := restored.WriteData(offset, f.ReadData(offset, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if restored.Items() != 499 || restored.Deletes() != 1 || restored.Size() != f.Size() {
+		t.Error("wrong meta")
+	}
+	for i := 1; i < 500; i++ {
+		if !restored.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("%d should exist", i)
+		}
+	}
+	if _, err := FromHeader(f.Header()[1:]); err == nil {
+		t.Error("expect bad data")
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	f1, f2 := New(100, 2, 20, 1), New(100, 2, 20, 1)
+	for i := 0; i < 1000; i++ {
+		_ = f1.Add([]byte(strconv.Itoa(i)))
+		_ = f2.Add([]byte(strconv.Itoa(i)))
+	}
+	if f1.FilterCount() != f2.FilterCount() || f1.Size() != f2.Size() {
+		t.Fatal("filters with same inputs should be expanded the same")
+	}
+	for offset := 0; offset < f1.DataLen(); offset += 100 {
+		if string(f1.ReadData(offset, 100)) != string(f2.ReadData(offset, 100)) {
+			t.Fatalf("data differs at %d", offset)
+		}
+	}
+}
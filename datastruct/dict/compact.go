@@ -0,0 +1,215 @@
+package dict
+
+import (
+	"math/rand"
+
+	"github.com/pluming/aurora/datastruct/listpack"
+)
+
+// Encodings of CompactDict
+const (
+	EncodingListPack  = "listpack"
+	EncodingHashTable = "hashtable"
+)
+
+// CompactDict stores small dicts of []byte values in a listpack of alternate keys and values,
+// and converts into a SimpleDict once the number of entries or the length of a key or value exceeds the limits.
+// A converted dict never converts back. It is not thread safe.
+type CompactDict struct {
+	// lp is nil after converting
+	lp    *listpack.ListPack
+	table *SimpleDict
+
+	maxEntries int
+	maxValue   int
+}
+
+// MakeCompact makes a new dict in listpack encoding
+func MakeCompact(maxEntries, maxValue int) *CompactDict {
+	dict := &CompactDict{
+		maxEntries: maxEntries,
+		maxValue:   maxValue,
+	}
+	if maxEntries > 0 {
+		dict.lp = listpack.New()
+	} else {
+		dict.table = MakeSimple()
+	}
+	return dict
+}
+
+// Encoding returns the current encoding of dict
+func (dict *CompactDict) Encoding() string {
+	if dict.lp != nil {
+		return EncodingListPack
+	}
+	return EncodingHashTable
+}
+
+func (dict *CompactDict) convert() {
+	dict.table = MakeSimple()
+	for i := 0; i < dict.lp.Len(); i += 2 {
+		dict.table.Put(string(dict.lp.Get(i)), dict.lp.Get(i+1))
+	}
+	dict.lp = nil
+}
+
+// fits returns whether the listpack can hold key and val after adding n entries
+func (dict *CompactDict) fits(key string, val interface{}, n int) bool {
+	bytes, ok := val.([]byte)
+	return ok && len(key) <= dict.maxValue && len(bytes) <= dict.maxValue && dict.lp.Len()/2+n <= dict.maxEntries
+}
+
+// find returns the index of key in listpack or -1
+func (dict *CompactDict) find(key string) int {
+	return dict.lp.Find([]byte(key), 0, 2)
+}
+
+// Get returns the binding value and whether the key is exist
+func (dict *CompactDict) Get(key string) (val interface{}, exists bool) {
+	if dict.lp == nil {
+		return dict.table.Get(key)
+	}
+	i := dict.find(key)
+	if i < 0 {
+		return nil, false
+	}
+	return dict.lp.Get(i + 1), true
+}
+
+// Len returns the number of dict
+func (dict *CompactDict) Len() int {
+	if dict.lp == nil {
+		return dict.table.Len()
+	}
+	return dict.lp.Len() / 2
+}
+
+// Put puts key value into dict and returns the number of new inserted key-value
+func (dict *CompactDict) Put(key string, val interface{}) (result int) {
+	if dict.lp == nil {
+		return dict.table.Put(key, val)
+	}
+	i := dict.find(key)
+	n := 0
+	if i < 0 {
+		n = 1
+	}
+	if !dict.fits(key, val, n) {
+		dict.convert()
+		return dict.table.Put(key, val)
+	}
+	if i >= 0 {
+		dict.lp.Set(i+1, val.([]byte))
+		return 0
+	}
+	dict.lp.Append([]byte(key), val.([]byte))
+	return 1
+}
+
+// PutIfAbsent puts value if the key is not exists and returns the number of updated key-value
+func (dict *CompactDict) PutIfAbsent(key string, val interface{}) (result int) {
+	if _, exists := dict.Get(key); exists {
+		return 0
+	}
+	return dict.Put(key, val)
+}
+
+// PutIfExists puts value if the key is exist and returns the number of inserted key-value
+func (dict *CompactDict) PutIfExists(key string, val interface{}) (result int) {
+	if _, exists := dict.Get(key); !exists {
+		return 0
+	}
+	dict.Put(key, val)
+	return 1
+}
+
+// Remove removes the key and return the number of deleted key-value
+func (dict *CompactDict) Remove(key string) (result int) {
+	if dict.lp == nil {
+		return dict.table.Remove(key)
+	}
+	i := dict.find(key)
+	if i < 0 {
+		return 0
+	}
+	dict.lp.Remove(i, 2)
+	return 1
+}
+
+// ForEach traversal the dict in the order of insertion if it is in listpack encoding
+func (dict *CompactDict) ForEach(consumer Consumer) {
+	if dict.lp == nil {
+		dict.table.ForEach(consumer)
+		return
+	}
+	var key string
+	dict.lp.ForEach(func(i int, val []byte) bool {
+		if i%2 == 0 {
+			key = string(val)
+			return true
+		}
+		return consumer(key, val)
+	})
+}
+
+// Scan visits keys from cursor like SimpleDict.Scan, a listpack is visited in one call
+func (dict *CompactDict) Scan(cursor uint64, count int, consumer Consumer) uint64 {
+	if dict.lp == nil {
+		return dict.table.Scan(cursor, count, consumer)
+	}
+	dict.ForEach(func(key string, val interface{}) bool {
+		consumer(key, val)
+		return true
+	})
+	return 0
+}
+
+// Keys returns all keys in dict
+func (dict *CompactDict) Keys() []string {
+	if dict.lp == nil {
+		return dict.table.Keys()
+	}
+	result := make([]string, 0, dict.Len())
+	dict.ForEach(func(key string, val interface{}) bool {
+		result = append(result, key)
+		return true
+	})
+	return result
+}
+
+// RandomKeys randomly returns keys of the given number, may contain duplicated key
+func (dict *CompactDict) RandomKeys(limit int) []string {
+	if dict.lp == nil {
+		return dict.table.RandomKeys(limit)
+	}
+	if dict.Len() == 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = string(dict.lp.Get(rand.Intn(dict.Len()) * 2))
+	}
+	return result
+}
+
+// RandomDistinctKeys randomly returns keys of the given number, won't contain duplicated key
+func (dict *CompactDict) RandomDistinctKeys(limit int) []string {
+	if dict.lp == nil {
+		return dict.table.RandomDistinctKeys(limit)
+	}
+	size := limit
+	if size > dict.Len() {
+		size = dict.Len()
+	}
+	result := make([]string, size)
+	for i, j := range rand.Perm(dict.Len())[:size] {
+		result[i] = string(dict.lp.Get(j * 2))
+	}
+	return result
+}
+
+// Clear removes all keys in dict, the encoding is reset to listpack
+func (dict *CompactDict) Clear() {
+	*dict = *MakeCompact(dict.maxEntries, dict.maxValue)
+}
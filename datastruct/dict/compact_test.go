@@ -0,0 +1,55 @@
+package dict
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompactDict(t *testing.T) {
+	d := MakeCompact(8, 16)
+	for i := 0; i < 8; i++ {
+		if d.Put("k"+strconv.Itoa(i), []byte(strconv.Itoa(i))) != 1 {
+			t.Fatal("expect 1")
+		}
+	}
+	if d.Put("k0", []byte("v0")) != 0 || d.PutIfAbsent("k0", []byte("x")) != 0 || d.PutIfExists("k9", []byte("x")) != 0 {
+		t.Fatal("expect 0")
+	}
+	if d.Remove("k1") != 1 || d.Remove("k1") != 0 {
+		t.Fatal("wrong result of remove")
+	}
+	if d.Encoding() != EncodingListPack || d.Len() != 7 {
+		t.Fatalf("expect 7 entries in listpack, actual %d in %s", d.Len(), d.Encoding())
+	}
+	if v, ok := d.Get("k0"); !ok || string(v.([]byte)) != "v0" {
+		t.Fatal("wrong value of k0")
+	}
+	if len(d.RandomDistinctKeys(10)) != 7 || len(d.RandomKeys(10)) != 10 {
+		t.Fatal("wrong number of random keys")
+	}
+
+	// too long value
+	d.Put("k1", []byte(strings.Repeat("a", 17)))
+	if d.Encoding() != EncodingHashTable || d.Len() != 8 {
+		t.Fatalf("expect 8 entries in hashtable, actual %d in %s", d.Len(), d.Encoding())
+	}
+	for i := 0; i < 8; i++ {
+		if _, ok := d.Get("k" + strconv.Itoa(i)); !ok {
+			t.Fatalf("k%d is lost after converting", i)
+		}
+	}
+
+	// too many entries
+	d = MakeCompact(8, 16)
+	for i := 0; i < 9; i++ {
+		d.Put("k"+strconv.Itoa(i), []byte("v"))
+	}
+	if d.Encoding() != EncodingHashTable {
+		t.Fatal("expect hashtable")
+	}
+	d.Clear()
+	if d.Encoding() != EncodingListPack || d.Len() != 0 {
+		t.Fatal("expect empty listpack")
+	}
+}
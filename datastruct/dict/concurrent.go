@@ -2,6 +2,7 @@ package dict
 
 import (
 	"math"
+	"math/bits"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -205,6 +206,37 @@ func (dict *ConcurrentDict) ForEach(consumer Consumer) {
 	}
 }
 
+// Scan visits shards from cursor until count keys are visited or all shards are visited,
+// and returns the cursor of the next call, 0 means the scan is finished. A scan starts with cursor 0.
+// Every key in dict during the whole scan is visited at least once.
+// The cursor is the shard index increased in reverse binary like redis SCAN, so that cursors keep valid
+// if the number of shards is doubled or halved during the scan.
+// Empty shards are cheap to visit, so they are not limited by count.
+// A shard is always visited entirely, so the result of consumer is ignored.
+func (dict *ConcurrentDict) Scan(cursor uint64, count int, consumer Consumer) uint64 {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	mask := uint64(len(dict.table) - 1)
+	visited := 0
+	for {
+		shard := dict.getShard(uint32(cursor & mask))
+		shard.mutex.RLock()
+		for key, value := range shard.m {
+			consumer(key, value)
+		}
+		visited += len(shard.m)
+		shard.mutex.RUnlock()
+
+		// increase the reversed cursor: set unmasked bits to carry over them
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || visited >= count {
+			return cursor
+		}
+	}
+}
+
 // Keys returns all keys in dict
 func (dict *ConcurrentDict) Keys() []string {
 	keys := make([]string, dict.Len())
@@ -291,3 +323,22 @@ func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 func (dict *ConcurrentDict) Clear() {
 	*dict = *MakeConcurrent(dict.shardCount)
 }
+
+// Detach moves all keys into a new dict and returns it, leaving dict empty.
+// Each shard is swapped with an empty map under its lock, so it is safe with concurrent operations
+// and takes no time proportional to the number of keys.
+func (dict *ConcurrentDict) Detach() *ConcurrentDict {
+	detached := MakeConcurrent(dict.shardCount)
+	for i, shard := range dict.table {
+		shard.mutex.Lock()
+		m := shard.m
+		if len(m) > 0 {
+			shard.m = make(map[string]interface{})
+			atomic.AddInt32(&dict.count, -int32(len(m)))
+			detached.table[i].m = m
+			detached.count += int32(len(m))
+		}
+		shard.mutex.Unlock()
+	}
+	return detached
+}
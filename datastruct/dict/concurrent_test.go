@@ -288,3 +288,63 @@ func TestConcurrentDict_Keys(t *testing.T) {
 		t.Errorf("expect %d keys, actual: %d", size, len(d.Keys()))
 	}
 }
+
+func TestConcurrentScan(t *testing.T) {
+	d := MakeConcurrent(64)
+	for i := 0; i < 1000; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	done := make(chan struct{})
+	go func() {
+		// keys which are not present during the whole scan
+		for i := 0; i < 1000; i++ {
+			d.Put("tmp"+strconv.Itoa(i), i)
+			d.Remove("tmp" + strconv.Itoa(i/2))
+		}
+		close(done)
+	}()
+	seen := make(map[string]int)
+	calls := 0
+	for cursor := uint64(0); ; {
+		cursor = d.Scan(cursor, 10, func(key string, val interface{}) bool {
+			seen[key]++
+			return true
+		})
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+	<-done
+	for i := 0; i < 1000; i++ {
+		if seen["k"+strconv.Itoa(i)] != 1 {
+			t.Fatalf("k%d is visited %d times", i, seen["k"+strconv.Itoa(i)])
+		}
+	}
+	if calls < 10 || calls > 64 {
+		t.Errorf("unexpected calls %d", calls)
+	}
+}
+
+func TestConcurrentDetach(t *testing.T) {
+	d := MakeConcurrent(0)
+	for i := 0; i < 100; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	detached := d.Detach()
+	if d.Len() != 0 || len(d.Keys()) != 0 {
+		t.Error("dict is not empty after detach")
+	}
+	if detached.Len() != 100 {
+		t.Errorf("expect 100 detached keys, actual: %d", detached.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if val, ok := detached.Get("k" + strconv.Itoa(i)); !ok || val != i {
+			t.Errorf("wrong value of k%d: %v", i, val)
+		}
+	}
+	d.Put("k0", 0)
+	if _, ok := detached.Get("k0"); !ok || detached.Len() != 100 {
+		t.Error("detached dict is affected by dict")
+	}
+}
@@ -12,6 +12,7 @@ type Dict interface {
 	PutIfExists(key string, val interface{}) (result int)
 	Remove(key string) (result int)
 	ForEach(consumer Consumer)
+	Scan(cursor uint64, count int, consumer Consumer) uint64
 	Keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
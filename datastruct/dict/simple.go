@@ -1,56 +1,97 @@
 package dict
 
-// SimpleDict wraps a map, it is not thread safe
+import (
+	"math/bits"
+	"math/rand"
+)
+
+// simpleBucketLoad is the average number of keys per bucket, buckets are doubled once it is exceeded
+const simpleBucketLoad = 16
+
+// SimpleDict splits keys into buckets of maps by hash, so that it can be scanned by a cursor of bucket index.
+// It is not thread safe
 type SimpleDict struct {
-	m map[string]interface{}
+	// the number of buckets is a power of 2, a key is in the bucket indexed by the low bits of its hash
+	buckets []map[string]interface{}
+	count   int
 }
 
 // MakeSimple makes a new map
 func MakeSimple() *SimpleDict {
 	return &SimpleDict{
-		m: make(map[string]interface{}),
+		buckets: []map[string]interface{}{make(map[string]interface{})},
 	}
 }
 
+func (dict *SimpleDict) bucketOf(key string) map[string]interface{} {
+	return dict.buckets[fnv32(key)&uint32(len(dict.buckets)-1)]
+}
+
+// grow doubles buckets if there are too many keys, keys of bucket i are split into bucket i and i+n
+func (dict *SimpleDict) grow() {
+	n := len(dict.buckets)
+	if dict.count <= n*simpleBucketLoad {
+		return
+	}
+	buckets := make([]map[string]interface{}, 2*n)
+	mask := uint32(2*n - 1)
+	for i := range buckets {
+		buckets[i] = make(map[string]interface{})
+	}
+	for _, bucket := range dict.buckets {
+		for k, v := range bucket {
+			buckets[fnv32(k)&mask][k] = v
+		}
+	}
+	dict.buckets = buckets
+}
+
 // Get returns the binding value and whether the key is exist
 func (dict *SimpleDict) Get(key string) (val interface{}, exists bool) {
-	val, ok := dict.m[key]
+	val, ok := dict.bucketOf(key)[key]
 	return val, ok
 }
 
 // Len returns the number of dict
 func (dict *SimpleDict) Len() int {
-	if dict.m == nil {
+	if dict.buckets == nil {
 		panic("m is nil")
 	}
-	return len(dict.m)
+	return dict.count
 }
 
 // Put puts key value into dict and returns the number of new inserted key-value
 func (dict *SimpleDict) Put(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
-	dict.m[key] = val
+	bucket := dict.bucketOf(key)
+	_, existed := bucket[key]
+	bucket[key] = val
 	if existed {
 		return 0
 	}
+	dict.count++
+	dict.grow()
 	return 1
 }
 
 // PutIfAbsent puts value if the key is not exists and returns the number of updated key-value
 func (dict *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
+	bucket := dict.bucketOf(key)
+	_, existed := bucket[key]
 	if existed {
 		return 0
 	}
-	dict.m[key] = val
+	bucket[key] = val
+	dict.count++
+	dict.grow()
 	return 1
 }
 
 // PutIfExists puts value if the key is exist and returns the number of inserted key-value
 func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
+	bucket := dict.bucketOf(key)
+	_, existed := bucket[key]
 	if existed {
-		dict.m[key] = val
+		bucket[key] = val
 		return 1
 	}
 	return 0
@@ -58,9 +99,11 @@ func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
 
 // Remove removes the key and return the number of deleted key-value
 func (dict *SimpleDict) Remove(key string) (result int) {
-	_, existed := dict.m[key]
-	delete(dict.m, key)
+	bucket := dict.bucketOf(key)
+	_, existed := bucket[key]
 	if existed {
+		delete(bucket, key)
+		dict.count--
 		return 1
 	}
 	return 0
@@ -68,33 +111,70 @@ func (dict *SimpleDict) Remove(key string) (result int) {
 
 // Keys returns all keys in dict
 func (dict *SimpleDict) Keys() []string {
-	result := make([]string, len(dict.m))
+	result := make([]string, dict.count)
 	i := 0
-	for k := range dict.m {
-		result[i] = k
+	for _, bucket := range dict.buckets {
+		for k := range bucket {
+			result[i] = k
+			i++
+		}
 	}
 	return result
 }
 
 // ForEach traversal the dict
 func (dict *SimpleDict) ForEach(consumer Consumer) {
-	for k, v := range dict.m {
-		if !consumer(k, v) {
-			break
+	for _, bucket := range dict.buckets {
+		for k, v := range bucket {
+			if !consumer(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Scan visits buckets from cursor until count keys are visited or all buckets are visited,
+// and returns the cursor of the next call like ConcurrentDict.Scan.
+// The cursor keeps valid after buckets are doubled, since a bucket is split into buckets of the same reversed prefix.
+// A small dict has only one bucket, so it is visited in one call.
+// The result of consumer is ignored like ConcurrentDict.Scan
+func (dict *SimpleDict) Scan(cursor uint64, count int, consumer Consumer) uint64 {
+	mask := uint64(len(dict.buckets) - 1)
+	visited := 0
+	for {
+		bucket := dict.buckets[cursor&mask]
+		for k, v := range bucket {
+			consumer(k, v)
+		}
+		visited += len(bucket)
+
+		// increase the reversed cursor: set unmasked bits to carry over them
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || visited >= count {
+			return cursor
+		}
+	}
+}
+
+// randomKey returns a key of a random non-empty bucket, dict must not be empty
+func (dict *SimpleDict) randomKey() string {
+	n := len(dict.buckets)
+	for i := rand.Intn(n); ; i = (i + 1) % n {
+		for k := range dict.buckets[i] {
+			return k
 		}
 	}
 }
 
 // RandomKeys randomly returns keys of the given number, may contain duplicated key
 func (dict *SimpleDict) RandomKeys(limit int) []string {
-	result := make([]string, 0, limit)
-	i := 0
-	for k := range dict.m {
-		if i < limit {
-			i++
-			result = append(result, k)
-		}
-		break
+	if dict.count == 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := 0; i < limit; i++ {
+		result[i] = dict.randomKey()
 	}
 	return result
 }
@@ -102,17 +182,22 @@ func (dict *SimpleDict) RandomKeys(limit int) []string {
 // RandomDistinctKeys randomly returns keys of the given number, won't contain duplicated key
 func (dict *SimpleDict) RandomDistinctKeys(limit int) []string {
 	size := limit
-	if size > len(dict.m) {
-		size = len(dict.m)
+	if size > dict.count {
+		size = dict.count
 	}
-	result := make([]string, size)
-	i := 0
-	for k := range dict.m {
-		if i == limit {
-			break
+	result := make([]string, 0, size)
+	if size == 0 {
+		return result
+	}
+	n := len(dict.buckets)
+	start := rand.Intn(n)
+	for i := 0; i < n && len(result) < size; i++ {
+		for k := range dict.buckets[(start+i)%n] {
+			if len(result) == size {
+				break
+			}
+			result = append(result, k)
 		}
-		result[i] = k
-		i++
 	}
 	return result
 }
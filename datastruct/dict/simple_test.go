@@ -2,6 +2,8 @@ package dict
 
 import (
 	"github.com/pluming/aurora/lib/utils"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +39,82 @@ func TestSimpleDict_PutIfExists(t *testing.T) {
 		return
 	}
 }
+
+func TestSimpleDict_RandomKeys(t *testing.T) {
+	d := MakeSimple()
+	size := 10
+	keys := make(map[string]struct{})
+	for i := 0; i < size; i++ {
+		key := utils.RandString(5)
+		keys[key] = struct{}{}
+		d.Put(key, key)
+	}
+	for _, key := range d.Keys() {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("unexpected key %s", key)
+		}
+	}
+	result := d.RandomKeys(2 * size)
+	if len(result) != 2*size {
+		t.Errorf("expect %d keys, actual: %d", 2*size, len(result))
+	}
+	for _, key := range result {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("unexpected key %s", key)
+		}
+	}
+	if len(MakeSimple().RandomKeys(3)) != 0 {
+		t.Error("expect no keys from empty dict")
+	}
+}
+
+func TestSimpleDict_Scan(t *testing.T) {
+	d := MakeSimple()
+	d.Put("a", 1)
+	d.Put("b", 2)
+	calls := 0
+	if cursor := d.Scan(0, 1, func(key string, val interface{}) bool {
+		calls++
+		return true
+	}); cursor != 0 || calls != 2 {
+		t.Errorf("expect a small dict is scanned in one call, got cursor %d", cursor)
+	}
+
+	d = MakeSimple()
+	for i := 0; i < 1000; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	calls = 0
+	for cursor := uint64(0); ; {
+		cursor = d.Scan(cursor, 10, func(key string, val interface{}) bool {
+			seen[key]++
+			return true
+		})
+		calls++
+		// buckets are doubled during the scan
+		for i := 0; i < 50; i++ {
+			d.Put("tmp"+strconv.Itoa(calls*50+i), i)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if seen["k"+strconv.Itoa(i)] != 1 {
+			t.Fatalf("k%d is visited %d times", i, seen["k"+strconv.Itoa(i)])
+		}
+	}
+	if calls < 10 {
+		t.Errorf("unexpected calls %d", calls)
+	}
+	if d.Len() != 1000+calls*50 || len(d.Keys()) != d.Len() {
+		t.Errorf("wrong len %d", d.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		d.Remove("k" + strconv.Itoa(i))
+	}
+	if keys := d.RandomDistinctKeys(10); len(keys) != 10 || !strings.HasPrefix(keys[0], "tmp") {
+		t.Errorf("wrong random keys %v", keys)
+	}
+}
@@ -0,0 +1,395 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/pluming/aurora/lib/murmur"
+)
+
+/*
+ * HLL is a HyperLogLog in the format of redis, so that it can be stored as a string value.
+ *
+ * +------+---+-----+----------+
+ * | HYLL | E | N/U | Cardin.  |
+ * +------+---+-----+----------+
+ *
+ * The 16 bytes header contains magic "HYLL", 1 byte encoding, 3 unused bytes and 8 bytes cached
+ * cardinality in little endian, whose most significant bit set means the cache is invalid.
+ *
+ * Dense encoding stores 16384 registers of 6 bits, 12288 bytes in total.
+ * Sparse encoding stores run-length encoded registers with opcodes:
+ *   ZERO  00xxxxxx:          (xxxxxx+1) registers are 0
+ *   XZERO 01xxxxxx yyyyyyyy: (xxxxxx yyyyyyyy + 1) registers are 0
+ *   VAL   1vvvvvxx:          (xx+1) registers are (vvvvv+1)
+ */
+
+const (
+	precision     = 14
+	q             = 64 - precision
+	registerCount = 1 << precision
+	registerMask  = registerCount - 1
+	registerBits  = 6
+	registerMax   = 1<<registerBits - 1
+
+	headerSize     = 16
+	denseSize      = headerSize + (registerCount*registerBits+7)/8
+	encodingDense  = 0
+	encodingSparse = 1
+
+	sparseValMax      = 32
+	sparseValMaxLen   = 4
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = registerCount
+
+	alphaInf = 0.721347520444481703680
+	hashSeed = 0xadc83b19
+)
+
+// SparseMaxBytes is the max size of sparse registers, HLL exceeds it is converted into dense encoding
+var SparseMaxBytes = 3000
+
+var magic = []byte("HYLL")
+
+var (
+	// ErrInvalid means the value is not a HyperLogLog
+	ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrCorrupted means the sparse registers are broken
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HLL is a HyperLogLog sharing bytes with its string value
+type HLL struct {
+	data []byte
+}
+
+// New creates an empty HLL in sparse encoding
+func New() *HLL {
+	data := make([]byte, headerSize, headerSize+2)
+	copy(data, magic)
+	data[4] = encodingSparse
+	// a XZERO opcode covers all registers
+	data = append(data, 0x40|byte((sparseXZeroMaxLen-1)>>8), byte((sparseXZeroMaxLen-1)&0xff))
+	return &HLL{data: data}
+}
+
+// FromBytes creates HLL from string value, bytes is not copied
+func FromBytes(b []byte) (*HLL, error) {
+	if len(b) < headerSize || !bytes.Equal(b[:4], magic) {
+		return nil, ErrInvalid
+	}
+	switch b[4] {
+	case encodingDense:
+		if len(b) != denseSize {
+			return nil, ErrInvalid
+		}
+	case encodingSparse:
+	default:
+		return nil, ErrInvalid
+	}
+	return &HLL{data: b}, nil
+}
+
+// FromRegisters creates HLL of the given registers, sparse encoding is used if possible
+func FromRegisters(registers []uint8) *HLL {
+	h := New()
+	h.setRegisters(registers)
+	h.invalidateCache()
+	return h
+}
+
+// Bytes returns the string value of HLL
+func (h *HLL) Bytes() []byte {
+	return h.data
+}
+
+// Clone returns a deep copy
+func (h *HLL) Clone() *HLL {
+	data := make([]byte, len(h.data))
+	copy(data, h.data)
+	return &HLL{data: data}
+}
+
+func (h *HLL) isSparse() bool {
+	return h.data[4] == encodingSparse
+}
+
+func (h *HLL) invalidateCache() {
+	h.data[15] |= 1 << 7
+}
+
+// Cached returns the cached cardinality, ok is false if the cache is invalid
+func (h *HLL) Cached() (count uint64, ok bool) {
+	if h.data[15]&(1<<7) != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(h.data[8:headerSize]), true
+}
+
+// Add adds elements into HLL, changed is true if any register is updated
+func (h *HLL) Add(elements ...[]byte) (changed bool, err error) {
+	if len(elements) == 0 {
+		return false, nil
+	}
+	if !h.isSparse() {
+		payload := h.data[headerSize:]
+		for _, element := range elements {
+			index, count := patLen(element)
+			if denseGet(payload, index) < count {
+				denseSet(payload, index, count)
+				changed = true
+			}
+		}
+	} else {
+		registers, err := h.Registers()
+		if err != nil {
+			return false, err
+		}
+		for _, element := range elements {
+			index, count := patLen(element)
+			if registers[index] < count {
+				registers[index] = count
+				changed = true
+			}
+		}
+		if changed {
+			h.setRegisters(registers)
+		}
+	}
+	if changed {
+		h.invalidateCache()
+	}
+	return changed, nil
+}
+
+// Count returns the estimated cardinality and caches it
+func (h *HLL) Count() (uint64, error) {
+	if count, ok := h.Cached(); ok {
+		return count, nil
+	}
+	var histogram [64]int
+	if !h.isSparse() {
+		payload := h.data[headerSize:]
+		for i := 0; i < registerCount; i++ {
+			histogram[denseGet(payload, i)]++
+		}
+	} else {
+		err := forEachSparseRun(h.data[headerSize:], func(value uint8, runLen int) {
+			histogram[value] += runLen
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	count := estimate(&histogram)
+	binary.LittleEndian.PutUint64(h.data[8:headerSize], count)
+	return count, nil
+}
+
+// Registers returns values of all registers
+func (h *HLL) Registers() ([]uint8, error) {
+	registers := make([]uint8, registerCount)
+	if !h.isSparse() {
+		payload := h.data[headerSize:]
+		for i := range registers {
+			registers[i] = denseGet(payload, i)
+		}
+		return registers, nil
+	}
+	index := 0
+	err := forEachSparseRun(h.data[headerSize:], func(value uint8, runLen int) {
+		for end := index + runLen; index < end; index++ {
+			registers[index] = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return registers, nil
+}
+
+// setRegisters writes registers, sparse HLL is converted into dense encoding if registers do not fit sparse one
+func (h *HLL) setRegisters(registers []uint8) {
+	if h.isSparse() {
+		if payload, ok := encodeSparse(registers); ok && len(payload) <= SparseMaxBytes {
+			h.data = append(h.data[:headerSize], payload...)
+			return
+		}
+		data := make([]byte, denseSize)
+		copy(data, h.data[:headerSize])
+		data[4] = encodingDense
+		h.data = data
+	}
+	payload := h.data[headerSize:]
+	for i, value := range registers {
+		denseSet(payload, i, value)
+	}
+}
+
+// Estimate returns estimated cardinality of registers, e.g. registers merged from multiple HLL
+func Estimate(registers []uint8) uint64 {
+	var histogram [64]int
+	for _, value := range registers {
+		histogram[value]++
+	}
+	return estimate(&histogram)
+}
+
+/* ---- registers ---- */
+
+// patLen returns the register index of element and the length of the pattern 000..1 of its hash
+func patLen(element []byte) (index int, count uint8) {
+	hash := murmur.Hash64A(element, hashSeed)
+	index = int(hash & registerMask)
+	hash >>= precision
+	hash |= 1 << q // make sure the loop terminates
+	count = 1
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func denseGet(payload []byte, index int) uint8 {
+	byteIndex := index * registerBits / 8
+	fb := uint(index * registerBits & 7)
+	b0 := uint(payload[byteIndex])
+	var b1 uint
+	if byteIndex+1 < len(payload) {
+		b1 = uint(payload[byteIndex+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & registerMax)
+}
+
+func denseSet(payload []byte, index int, value uint8) {
+	byteIndex := index * registerBits / 8
+	fb := uint(index * registerBits & 7)
+	v, mask := uint(value), uint(registerMax)
+	payload[byteIndex] &^= byte(mask << fb)
+	payload[byteIndex] |= byte(v << fb)
+	if byteIndex+1 < len(payload) {
+		payload[byteIndex+1] &^= byte(mask >> (8 - fb))
+		payload[byteIndex+1] |= byte(v >> (8 - fb))
+	}
+}
+
+// forEachSparseRun iterates runs of registers having the same value
+func forEachSparseRun(payload []byte, cb func(value uint8, runLen int)) error {
+	index := 0
+	for i := 0; i < len(payload); i++ {
+		b := payload[i]
+		var value uint8
+		var runLen int
+		switch {
+		case b&0xc0 == 0: // ZERO
+			runLen = int(b&0x3f) + 1
+		case b&0xc0 == 0x40: // XZERO
+			if i+1 >= len(payload) {
+				return ErrCorrupted
+			}
+			runLen = (int(b&0x3f)<<8 | int(payload[i+1])) + 1
+			i++
+		default: // VAL
+			value = (b>>2)&0x1f + 1
+			runLen = int(b&0x03) + 1
+		}
+		if index+runLen > registerCount {
+			return ErrCorrupted
+		}
+		cb(value, runLen)
+		index += runLen
+	}
+	if index != registerCount {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// encodeSparse encodes registers in sparse encoding, ok is false if any register exceeds the max value of VAL opcode
+func encodeSparse(registers []uint8) (payload []byte, ok bool) {
+	for i := 0; i < len(registers); {
+		value := registers[i]
+		j := i + 1
+		for j < len(registers) && registers[j] == value {
+			j++
+		}
+		runLen := j - i
+		i = j
+		if value > sparseValMax {
+			return nil, false
+		}
+		for runLen > 0 {
+			switch {
+			case value > 0:
+				n := runLen
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				payload = append(payload, 0x80|(value-1)<<2|byte(n-1))
+				runLen -= n
+			case runLen > sparseZeroMaxLen:
+				n := runLen
+				if n > sparseXZeroMaxLen {
+					n = sparseXZeroMaxLen
+				}
+				payload = append(payload, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				runLen -= n
+			default:
+				payload = append(payload, byte(runLen-1))
+				runLen = 0
+			}
+		}
+	}
+	return payload, true
+}
+
+/* ---- cardinality estimation ----
+ * the improved estimator of Otmar Ertl, "New cardinality estimation algorithms for HyperLogLog sketches"
+ */
+
+func estimate(histogram *[64]int) uint64 {
+	m := float64(registerCount)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHLLCount(t *testing.T) {
+	h := New()
+	if count, _ := h.Count(); count != 0 {
+		t.Errorf("expect 0, actual %d", count)
+	}
+	for _, size := range []int{10, 1000, 100000} {
+		h = New()
+		for i := 0; i < size; i++ {
+			if _, err := h.Add([]byte(strconv.Itoa(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		count, err := h.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(float64(count)-float64(size))/float64(size) > 0.02 {
+			t.Errorf("expect about %d, actual %d", size, count)
+		}
+		if size == 100000 && h.isSparse() {
+			t.Error("expect dense encoding")
+		}
+		if len(h.Bytes()) > denseSize {
+			t.Error("HLL is too large")
+		}
+	}
+}
+
+func TestHLLAdd(t *testing.T) {
+	h := New()
+	changed, _ := h.Add([]byte("a"), []byte("b"))
+	if !changed {
+		t.Error("expect changed")
+	}
+	if _, ok := h.Cached(); ok {
+		t.Error("cache should be invalidated")
+	}
+	count, _ := h.Count()
+	if cached, ok := h.Cached(); !ok || cached != count {
+		t.Error("count should be cached")
+	}
+	changed, _ = h.Add([]byte("a"))
+	if changed {
+		t.Error("expect unchanged")
+	}
+}
+
+func TestSparseAndDense(t *testing.T) {
+	sparse := New()
+	for i := 0; i < 500; i++ {
+		_, _ = sparse.Add([]byte(strconv.Itoa(i)))
+	}
+	if !sparse.isSparse() {
+		t.Fatal("expect sparse encoding")
+	}
+	dense := &HLL{data: make([]byte, denseSize)}
+	copy(dense.data, magic)
+	dense.data[4] = encodingDense
+	for i := 0; i < 500; i++ {
+		_, _ = dense.Add([]byte(strconv.Itoa(i)))
+	}
+	sparseRegisters, err := sparse.Registers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	denseRegisters, _ := dense.Registers()
+	for i := range sparseRegisters {
+		if sparseRegisters[i] != denseRegisters[i] {
+			t.Fatalf("register %d mismatch", i)
+		}
+	}
+	c1, _ := sparse.Count()
+	c2, _ := dense.Count()
+	if c1 != c2 {
+		t.Errorf("sparse count %d, dense count %d", c1, c2)
+	}
+
+	restored, err := FromBytes(sparse.Clone().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3, _ := restored.Count(); c3 != c1 {
+		t.Error("wrong count of restored HLL")
+	}
+	if _, err := FromBytes([]byte("HYLL")); err != ErrInvalid {
+		t.Error("expect invalid")
+	}
+	corrupted := New()
+	corrupted.data = append(corrupted.data, 0x00)
+	corrupted.invalidateCache()
+	if _, err := corrupted.Count(); err != ErrCorrupted {
+		t.Error("expect corrupted")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	h1, h2 := New(), New()
+	for i := 0; i < 3000; i++ {
+		_, _ = h1.Add([]byte(strconv.Itoa(i)))
+		_, _ = h2.Add([]byte(strconv.Itoa(i + 1500)))
+	}
+	r1, _ := h1.Registers()
+	r2, _ := h2.Registers()
+	for i := range r1 {
+		if r2[i] > r1[i] {
+			r1[i] = r2[i]
+		}
+	}
+	merged := FromRegisters(r1)
+	count, _ := merged.Count()
+	if count != Estimate(r1) {
+		t.Error("wrong count of merged HLL")
+	}
+	if math.Abs(float64(count)-4500)/4500 > 0.02 {
+		t.Errorf("expect about 4500, actual %d", count)
+	}
+}
@@ -0,0 +1,136 @@
+package intset
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+/*
+ * IntSet is a sorted array of distinct integers like the intset of redis, used to encode small sets of integers.
+ * All integers are stored in the same width of 2, 4 or 8 bytes in little endian, the width is upgraded when
+ * an integer out of range is added, and never downgraded.
+ */
+
+// IntSet is a set of int64 in a compact sorted array, it is not thread safe
+type IntSet struct {
+	width    int
+	contents []byte
+}
+
+// New creates an empty IntSet
+func New() *IntSet {
+	return &IntSet{width: 2}
+}
+
+func widthOf(v int64) int {
+	if v >= -1<<15 && v < 1<<15 {
+		return 2
+	}
+	if v >= -1<<31 && v < 1<<31 {
+		return 4
+	}
+	return 8
+}
+
+// Len returns the number of integers
+func (set *IntSet) Len() int {
+	return len(set.contents) / set.width
+}
+
+// Bytes returns the size of contents in bytes
+func (set *IntSet) Bytes() int {
+	return len(set.contents)
+}
+
+// Get returns the integer at index in ascending order
+func (set *IntSet) Get(index int) int64 {
+	return load(set.contents, set.width, index)
+}
+
+func load(contents []byte, width, index int) int64 {
+	offset := index * width
+	switch width {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(contents[offset:])))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(contents[offset:])))
+	default:
+		return int64(binary.LittleEndian.Uint64(contents[offset:]))
+	}
+}
+
+func (set *IntSet) write(index int, v int64) {
+	offset := index * set.width
+	switch set.width {
+	case 2:
+		binary.LittleEndian.PutUint16(set.contents[offset:], uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(set.contents[offset:], uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(set.contents[offset:], uint64(v))
+	}
+}
+
+// search returns the index of v or the index to insert it
+func (set *IntSet) search(v int64) (int, bool) {
+	n := set.Len()
+	i := sort.Search(n, func(i int) bool {
+		return set.Get(i) >= v
+	})
+	return i, i < n && set.Get(i) == v
+}
+
+// Has returns whether v is in the set
+func (set *IntSet) Has(v int64) bool {
+	_, ok := set.search(v)
+	return ok
+}
+
+// upgrade re-encodes contents in the given width
+func (set *IntSet) upgrade(width int) {
+	n := set.Len()
+	old, oldWidth := set.contents, set.width
+	set.width = width
+	set.contents = make([]byte, n*width)
+	for i := 0; i < n; i++ {
+		set.write(i, load(old, oldWidth, i))
+	}
+}
+
+// Add adds v into the set and returns whether v is new
+func (set *IntSet) Add(v int64) bool {
+	if width := widthOf(v); width > set.width {
+		set.upgrade(width)
+	}
+	i, ok := set.search(v)
+	if ok {
+		return false
+	}
+	offset := i * set.width
+	set.contents = append(set.contents, make([]byte, set.width)...)
+	copy(set.contents[offset+set.width:], set.contents[offset:])
+	set.write(i, v)
+	return true
+}
+
+// Remove removes v from the set and returns whether v existed
+func (set *IntSet) Remove(v int64) bool {
+	i, ok := set.search(v)
+	if !ok {
+		return false
+	}
+	offset := i * set.width
+	copy(set.contents[offset:], set.contents[offset+set.width:])
+	set.contents = set.contents[:len(set.contents)-set.width]
+	return true
+}
+
+// ForEach visits integers in ascending order until consumer returns false
+func (set *IntSet) ForEach(consumer func(v int64) bool) {
+	n := set.Len()
+	for i := 0; i < n; i++ {
+		if !consumer(set.Get(i)) {
+			return
+		}
+	}
+}
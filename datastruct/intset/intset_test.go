@@ -0,0 +1,53 @@
+package intset
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestIntSet(t *testing.T) {
+	set := New()
+	expect := make(map[int64]struct{})
+	for i := 0; i < 1000; i++ {
+		v := int64(rand.Intn(2000) - 1000)
+		_, existed := expect[v]
+		if set.Add(v) == existed {
+			t.Fatalf("wrong result of adding %d", v)
+		}
+		expect[v] = struct{}{}
+	}
+	if set.Bytes() != 2*set.Len() {
+		t.Error("expect width 2")
+	}
+	for _, v := range []int64{math.MaxInt32, math.MinInt64} {
+		set.Add(v)
+		expect[v] = struct{}{}
+	}
+	if set.Len() != len(expect) || set.Bytes() != 8*set.Len() {
+		t.Fatalf("expect %d integers in width 8", len(expect))
+	}
+	var sorted []int64
+	for v := range expect {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	set.ForEach(func(v int64) bool {
+		if v != sorted[0] {
+			t.Fatalf("expect %d, actual %d", sorted[0], v)
+		}
+		sorted = sorted[1:]
+		return true
+	})
+	for v := range expect {
+		if !set.Has(v) || !set.Remove(v) || set.Has(v) || set.Remove(v) {
+			t.Fatalf("wrong result of removing %d", v)
+		}
+	}
+	if set.Len() != 0 {
+		t.Error("expect empty set")
+	}
+}
@@ -0,0 +1,137 @@
+package jsondoc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format controls the layout of marshalled JSON, like the INDENT, NEWLINE and SPACE options of JSON.GET
+type Format struct {
+	Indent  string
+	Newline string
+	Space   string
+}
+
+// Marshal encodes value tree into compact JSON text
+func Marshal(val interface{}) []byte {
+	return MarshalFormat(val, Format{})
+}
+
+// MarshalFormat encodes value tree into JSON text in format
+func MarshalFormat(val interface{}, format Format) []byte {
+	e := &encoder{format: format}
+	e.encode(val, 0)
+	return e.buf
+}
+
+type encoder struct {
+	buf    []byte
+	format Format
+}
+
+func (e *encoder) newline(depth int) {
+	e.buf = append(e.buf, e.format.Newline...)
+	for i := 0; i < depth; i++ {
+		e.buf = append(e.buf, e.format.Indent...)
+	}
+}
+
+func (e *encoder) encode(val interface{}, depth int) {
+	switch v := val.(type) {
+	case *Object:
+		if v.Len() == 0 {
+			e.buf = append(e.buf, "{}"...)
+			return
+		}
+		e.buf = append(e.buf, '{')
+		for i, key := range v.keys {
+			if i > 0 {
+				e.buf = append(e.buf, ',')
+			}
+			e.newline(depth + 1)
+			e.buf = appendString(e.buf, key)
+			e.buf = append(e.buf, ':')
+			e.buf = append(e.buf, e.format.Space...)
+			e.encode(v.values[key], depth+1)
+		}
+		e.newline(depth)
+		e.buf = append(e.buf, '}')
+	case *Array:
+		if v.Len() == 0 {
+			e.buf = append(e.buf, "[]"...)
+			return
+		}
+		e.buf = append(e.buf, '[')
+		for i, item := range v.items {
+			if i > 0 {
+				e.buf = append(e.buf, ',')
+			}
+			e.newline(depth + 1)
+			e.encode(item, depth+1)
+		}
+		e.newline(depth)
+		e.buf = append(e.buf, ']')
+	case string:
+		e.buf = appendString(e.buf, v)
+	case int64:
+		e.buf = strconv.AppendInt(e.buf, v, 10)
+	case float64:
+		e.buf = append(e.buf, FormatFloat(v)...)
+	case bool:
+		e.buf = strconv.AppendBool(e.buf, v)
+	default:
+		e.buf = append(e.buf, "null"...)
+	}
+}
+
+// FormatFloat formats float number which is always distinguishable from integers, e.g. 3.0 rather than 3
+func FormatFloat(f float64) string {
+	abs := math.Abs(f)
+	var s string
+	if abs == 0 || (abs >= 1e-5 && abs < 1e16) {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	} else {
+		s = strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+const hexDigits = "0123456789abcdef"
+
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
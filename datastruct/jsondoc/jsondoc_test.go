@@ -0,0 +1,108 @@
+package jsondoc
+
+import (
+	"testing"
+)
+
+func mustParse(t *testing.T, text string) interface{} {
+	val, err := Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func TestParseAndMarshal(t *testing.T) {
+	cases := map[string]string{
+		`{"b":1,"a":[true,false,null],"c":{}}`: `{"b":1,"a":[true,false,null],"c":{}}`,
+		` [ 1 , -2.5 , 3e2 , "x" ] `:           `[1,-2.5,300.0,"x"]`,
+		`"a\"\\\né😀"`:                          `"a\"\\\né😀"`,
+		`{"a":1,"a":2}`:                        `{"a":2}`,
+		`9223372036854775808`:                  `9.223372036854776e+18`,
+	}
+	for text, expect := range cases {
+		actual := string(Marshal(mustParse(t, text)))
+		if actual != expect {
+			t.Errorf("parse %s: expect %s, actual %s", text, expect, actual)
+		}
+	}
+	for _, text := range []string{``, `{`, `[1,]`, `{"a" 1}`, `01`, `tru`, `"a`, `1 2`, `"\x"`} {
+		if _, err := Parse([]byte(text)); err == nil {
+			t.Errorf("expect error parsing %q", text)
+		}
+	}
+	pretty := string(MarshalFormat(mustParse(t, `{"a":[1,{}]}`), Format{Indent: "  ", Newline: "\n", Space: " "}))
+	expect := "{\n  \"a\": [\n    1,\n    {}\n  ]\n}"
+	if pretty != expect {
+		t.Errorf("expect %q, actual %q", expect, pretty)
+	}
+}
+
+func marshalMatches(matches []Match) string {
+	arr := NewArray()
+	for _, m := range matches {
+		arr.Append(m.Value)
+	}
+	return string(Marshal(arr))
+}
+
+func TestSelect(t *testing.T) {
+	doc := New(mustParse(t, `{"a":{"b":[1,2,3,4]},"c":[{"b":5}],"d":"x"}`))
+	cases := map[string]string{
+		`$`:              `[{"a":{"b":[1,2,3,4]},"c":[{"b":5}],"d":"x"}]`,
+		`$.a.b[*]`:       `[1,2,3,4]`,
+		`$.a.b[-1]`:      `[4]`,
+		`$.a.b[1:3]`:     `[2,3]`,
+		`$.a.b[::-2]`:    `[4,2]`,
+		`$.a.b[0,2,9]`:   `[1,3]`,
+		`$['a']["b"][0]`: `[1]`,
+		`$..b`:           `[[1,2,3,4],5]`,
+		`$.*`:            `[{"b":[1,2,3,4]},[{"b":5}],"x"]`,
+		`$.c[*].b`:       `[5]`,
+		`$.none`:         `[]`,
+		`.a.b[1]`:        `[2]`,
+		`d`:              `["x"]`,
+		`.`:              `[{"a":{"b":[1,2,3,4]},"c":[{"b":5}],"d":"x"}]`,
+	}
+	for text, expect := range cases {
+		path, err := CompilePath(text)
+		if err != nil {
+			t.Errorf("compile %s: %v", text, err)
+			continue
+		}
+		if actual := marshalMatches(doc.Select(path)); actual != expect {
+			t.Errorf("select %s: expect %s, actual %s", text, expect, actual)
+		}
+	}
+	for _, text := range []string{`$.`, `$[`, `$[a]`, `$.a[1`, `$x`} {
+		if _, err := CompilePath(text); err == nil {
+			t.Errorf("expect error compiling %s", text)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	doc := New(mustParse(t, `{"a":[1,2,3,4],"b":{"c":1,"d":2}}`))
+	path, _ := CompilePath(`$.a[0,2,-1]`)
+	if deleted := doc.Delete(doc.Select(path)); deleted != 3 {
+		t.Errorf("expect 3 deleted, actual %d", deleted)
+	}
+	path, _ = CompilePath(`$.b.c`)
+	for _, m := range doc.Select(path) {
+		doc.Replace(m, "x")
+	}
+	path, _ = CompilePath(`$.b.d`)
+	doc.Delete(doc.Select(path))
+	path, _ = CompilePath(`$.a`)
+	arr := doc.Select(path)[0].Value.(*Array)
+	arr.Insert(0, int64(0))
+	arr.Append(int64(9))
+	if actual := string(Marshal(doc.Root())); actual != `{"a":[0,2,9],"b":{"c":"x"}}` {
+		t.Errorf("actual %s", actual)
+	}
+	path, _ = CompilePath(`$.b.e`)
+	parent, key, ok := path.Parent()
+	if !ok || key != "e" || len(doc.Select(parent)) != 1 {
+		t.Error("wrong parent")
+	}
+}
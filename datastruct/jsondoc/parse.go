@@ -0,0 +1,269 @@
+package jsondoc
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDepth limits the nesting of containers, like RedisJSON
+const maxDepth = 128
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ERR invalid JSON at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.data) && isSpace(p.data[p.pos]) {
+		p.pos++
+	}
+}
+
+// Parse decodes a JSON text into value tree
+func Parse(data []byte) (interface{}, error) {
+	p := &parser{data: data}
+	val, err := p.parseValue(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.data) {
+		return nil, p.errorf("trailing characters")
+	}
+	return val, nil
+}
+
+func (p *parser) parseValue(depth int) (interface{}, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject(depth + 1)
+	case c == '[':
+		return p.parseArray(depth + 1)
+	case c == '"':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	default:
+		for _, literal := range [...]struct {
+			text string
+			val  interface{}
+		}{{"true", true}, {"false", false}, {"null", nil}} {
+			if len(p.data)-p.pos >= len(literal.text) && string(p.data[p.pos:p.pos+len(literal.text)]) == literal.text {
+				p.pos += len(literal.text)
+				return literal.val, nil
+			}
+		}
+		return nil, p.errorf("unexpected character '%c'", c)
+	}
+}
+
+func (p *parser) parseObject(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("exceeds max nesting depth %d", maxDepth)
+	}
+	p.pos++ // skip '{'
+	obj := NewObject()
+	p.skipSpaces()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return obj, nil
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return nil, p.errorf("expect object key")
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf("expect ':'")
+		}
+		p.pos++
+		val, err := p.parseValue(depth)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, val)
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unexpected end")
+		}
+		if p.data[p.pos] == '}' {
+			p.pos++
+			return obj, nil
+		}
+		if p.data[p.pos] != ',' {
+			return nil, p.errorf("expect ',' or '}'")
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseArray(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("exceeds max nesting depth %d", maxDepth)
+	}
+	p.pos++ // skip '['
+	arr := NewArray()
+	p.skipSpaces()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return arr, nil
+	}
+	for {
+		val, err := p.parseValue(depth)
+		if err != nil {
+			return nil, err
+		}
+		arr.Append(val)
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unexpected end")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+		if p.data[p.pos] != ',' {
+			return nil, p.errorf("expect ',' or ']'")
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseNumber() (interface{}, error) {
+	start := p.pos
+	isFloat := false
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c >= '0' && c <= '9' {
+			p.pos++
+		} else if c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-' {
+			isFloat = true
+			p.pos++
+		} else {
+			break
+		}
+	}
+	text := string(p.data[start:p.pos])
+	if p.pos == digits || (p.data[digits] == '0' && p.pos > digits+1 && p.data[digits+1] >= '0' && p.data[digits+1] <= '9') {
+		return nil, p.errorf("invalid number %s", text)
+	}
+	if !isFloat {
+		if val, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return val, nil
+		}
+	}
+	val, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %s", text)
+	}
+	return val, nil
+}
+
+func (p *parser) parseString() (string, error) {
+	p.pos++ // skip '"'
+	var buf []byte
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return string(buf), nil
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		case c == '\\':
+			if p.pos+1 >= len(p.data) {
+				return "", p.errorf("unterminated string")
+			}
+			p.pos++
+			switch esc := p.data[p.pos]; esc {
+			case '"', '\\', '/':
+				buf = append(buf, esc)
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'u':
+				r, err := p.parseUnicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				buf = appendRune(buf, r)
+				continue
+			default:
+				return "", p.errorf("invalid escape '\\%c'", esc)
+			}
+			p.pos++
+		default:
+			buf = append(buf, c)
+			p.pos++
+		}
+	}
+}
+
+// parseUnicodeEscape parses \uXXXX after '\', including surrogate pairs
+func (p *parser) parseUnicodeEscape() (rune, error) {
+	r, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+	if utf16.IsSurrogate(r) && p.pos+1 < len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+		p.pos++
+		low, err := p.parseHex4()
+		if err != nil {
+			return 0, err
+		}
+		return utf16.DecodeRune(r, low), nil
+	}
+	return r, nil
+}
+
+// parseHex4 parses uXXXX, p.pos points to 'u'
+func (p *parser) parseHex4() (rune, error) {
+	if p.pos+5 > len(p.data) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	val, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+5]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	p.pos += 5
+	return rune(val), nil
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(buf, tmp[:n]...)
+}
@@ -0,0 +1,401 @@
+package jsondoc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Path is a compiled JSONPath, supported syntax:
+ *   $              the root
+ *   .name ['name'] child of object
+ *   .* [*]         all children
+ *   [1] [-1]       item of array, negative index counts from the end
+ *   [0:2] [::-1]   slice of array
+ *   [0,'a']        union of selectors
+ *   ..name ..*     descendants
+ * A path not starting with '$' is a legacy path of RedisJSON v1, e.g. `.a.b` or `a[0]`,
+ * it is the same as the JSONPath with '$' prepended, but commands reply the first matched value only.
+ */
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectIndex
+	selectWildcard
+	selectSlice
+)
+
+type selector struct {
+	kind  selectorKind
+	name  string
+	index int
+	// slice bounds, nil means default
+	start, end *int
+	step       int
+}
+
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+// Path is a compiled JSONPath
+type Path struct {
+	segments []segment
+	legacy   bool
+}
+
+// IsLegacy returns whether the path is a legacy path which selects a single value
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// IsRoot returns whether the path selects the root only
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// Parent returns the path of parent and the key of child if the path ends with a single name selector,
+// which is used to create a new key of object
+func (p *Path) Parent() (*Path, string, bool) {
+	if len(p.segments) == 0 {
+		return nil, "", false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.descendant || len(last.selectors) != 1 || last.selectors[0].kind != selectName {
+		return nil, "", false
+	}
+	return &Path{segments: p.segments[:len(p.segments)-1], legacy: p.legacy}, last.selectors[0].name, true
+}
+
+type pathParser struct {
+	text string
+	pos  int
+}
+
+func (pp *pathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ERR invalid JSONPath '%s' at offset %d: %s", pp.text, pp.pos, fmt.Sprintf(format, args...))
+}
+
+func (pp *pathParser) eof() bool {
+	return pp.pos >= len(pp.text)
+}
+
+func (pp *pathParser) peek() byte {
+	return pp.text[pp.pos]
+}
+
+func (pp *pathParser) skipSpaces() {
+	for !pp.eof() && pp.peek() == ' ' {
+		pp.pos++
+	}
+}
+
+// CompilePath parses JSONPath or legacy path
+func CompilePath(text string) (*Path, error) {
+	path := &Path{}
+	pp := &pathParser{text: text}
+	if strings.HasPrefix(text, "$") {
+		pp.pos = 1
+	} else {
+		path.legacy = true
+		if text == "." {
+			return path, nil
+		}
+		if !strings.HasPrefix(text, ".") && !strings.HasPrefix(text, "[") {
+			// a bare name like `a.b`
+			seg, err := pp.parseName(false)
+			if err != nil {
+				return nil, err
+			}
+			path.segments = append(path.segments, seg)
+		}
+	}
+	for !pp.eof() {
+		var seg segment
+		var err error
+		switch pp.peek() {
+		case '.':
+			pp.pos++
+			if !pp.eof() && pp.peek() == '.' {
+				pp.pos++
+				if !pp.eof() && pp.peek() == '[' {
+					seg, err = pp.parseBracket()
+					seg.descendant = true
+				} else {
+					seg, err = pp.parseName(true)
+				}
+			} else {
+				seg, err = pp.parseName(false)
+			}
+		case '[':
+			seg, err = pp.parseBracket()
+		default:
+			err = pp.errorf("unexpected character '%c'", pp.peek())
+		}
+		if err != nil {
+			return nil, err
+		}
+		path.segments = append(path.segments, seg)
+	}
+	return path, nil
+}
+
+// parseName parses a dot notated name or wildcard
+func (pp *pathParser) parseName(descendant bool) (segment, error) {
+	start := pp.pos
+	for !pp.eof() && pp.peek() != '.' && pp.peek() != '[' {
+		pp.pos++
+	}
+	name := pp.text[start:pp.pos]
+	if name == "" {
+		return segment{}, pp.errorf("expect name")
+	}
+	if name == "*" {
+		return segment{descendant: descendant, selectors: []selector{{kind: selectWildcard}}}, nil
+	}
+	return segment{descendant: descendant, selectors: []selector{{kind: selectName, name: name}}}, nil
+}
+
+// parseBracket parses selectors between '[' and ']'
+func (pp *pathParser) parseBracket() (segment, error) {
+	pp.pos++ // skip '['
+	var seg segment
+	for {
+		pp.skipSpaces()
+		if pp.eof() {
+			return seg, pp.errorf("unterminated bracket")
+		}
+		var sel selector
+		var err error
+		switch c := pp.peek(); {
+		case c == '*':
+			pp.pos++
+			sel = selector{kind: selectWildcard}
+		case c == '\'' || c == '"':
+			sel, err = pp.parseQuotedName(c)
+		case c == ':' || c == '-' || (c >= '0' && c <= '9'):
+			sel, err = pp.parseIndexOrSlice()
+		default:
+			err = pp.errorf("unexpected character '%c'", c)
+		}
+		if err != nil {
+			return seg, err
+		}
+		seg.selectors = append(seg.selectors, sel)
+		pp.skipSpaces()
+		if pp.eof() {
+			return seg, pp.errorf("unterminated bracket")
+		}
+		switch pp.peek() {
+		case ']':
+			pp.pos++
+			return seg, nil
+		case ',':
+			pp.pos++
+		default:
+			return seg, pp.errorf("expect ',' or ']'")
+		}
+	}
+}
+
+func (pp *pathParser) parseQuotedName(quote byte) (selector, error) {
+	pp.pos++ // skip quote
+	var buf []byte
+	for {
+		if pp.eof() {
+			return selector{}, pp.errorf("unterminated string")
+		}
+		c := pp.peek()
+		pp.pos++
+		if c == quote {
+			return selector{kind: selectName, name: string(buf)}, nil
+		}
+		if c == '\\' {
+			if pp.eof() {
+				return selector{}, pp.errorf("unterminated string")
+			}
+			c = pp.peek()
+			pp.pos++
+		}
+		buf = append(buf, c)
+	}
+}
+
+func (pp *pathParser) parseInt() (*int, error) {
+	pp.skipSpaces()
+	start := pp.pos
+	if !pp.eof() && pp.peek() == '-' {
+		pp.pos++
+	}
+	for !pp.eof() && pp.peek() >= '0' && pp.peek() <= '9' {
+		pp.pos++
+	}
+	if start == pp.pos {
+		return nil, nil
+	}
+	val, err := strconv.Atoi(pp.text[start:pp.pos])
+	if err != nil {
+		return nil, pp.errorf("invalid integer")
+	}
+	pp.skipSpaces()
+	return &val, nil
+}
+
+func (pp *pathParser) parseIndexOrSlice() (selector, error) {
+	first, err := pp.parseInt()
+	if err != nil {
+		return selector{}, err
+	}
+	if pp.eof() || pp.peek() != ':' {
+		if first == nil {
+			return selector{}, pp.errorf("expect index")
+		}
+		return selector{kind: selectIndex, index: *first}, nil
+	}
+	sel := selector{kind: selectSlice, start: first, step: 1}
+	pp.pos++ // skip ':'
+	if sel.end, err = pp.parseInt(); err != nil {
+		return selector{}, err
+	}
+	if !pp.eof() && pp.peek() == ':' {
+		pp.pos++
+		step, err := pp.parseInt()
+		if err != nil {
+			return selector{}, err
+		}
+		if step != nil {
+			sel.step = *step
+		}
+	}
+	return sel, nil
+}
+
+/* ---- evaluation ---- */
+
+func (p *Path) selectFrom(matches []Match) []Match {
+	for _, seg := range p.segments {
+		var next []Match
+		for _, m := range matches {
+			if seg.descendant {
+				forEachNode(m.Value, func(node interface{}) {
+					next = seg.apply(node, next)
+				})
+			} else {
+				next = seg.apply(m.Value, next)
+			}
+		}
+		matches = next
+	}
+	return matches
+}
+
+// forEachNode visits val and all of its descendants in document order
+func forEachNode(val interface{}, cb func(node interface{})) {
+	cb(val)
+	switch v := val.(type) {
+	case *Object:
+		for _, key := range v.keys {
+			forEachNode(v.values[key], cb)
+		}
+	case *Array:
+		for _, item := range v.items {
+			forEachNode(item, cb)
+		}
+	}
+}
+
+// apply appends children of val selected by segment into result
+func (seg *segment) apply(val interface{}, result []Match) []Match {
+	for i := range seg.selectors {
+		result = seg.selectors[i].apply(val, result)
+	}
+	return result
+}
+
+func (sel *selector) apply(val interface{}, result []Match) []Match {
+	switch v := val.(type) {
+	case *Object:
+		switch sel.kind {
+		case selectName:
+			if child, ok := v.values[sel.name]; ok {
+				result = append(result, Match{Value: child, parent: v, key: sel.name})
+			}
+		case selectWildcard:
+			for _, key := range v.keys {
+				result = append(result, Match{Value: v.values[key], parent: v, key: key})
+			}
+		}
+	case *Array:
+		n := len(v.items)
+		switch sel.kind {
+		case selectIndex:
+			i := sel.index
+			if i < 0 {
+				i += n
+			}
+			if i >= 0 && i < n {
+				result = append(result, Match{Value: v.items[i], parent: v, index: i})
+			}
+		case selectWildcard:
+			for i, item := range v.items {
+				result = append(result, Match{Value: item, parent: v, index: i})
+			}
+		case selectSlice:
+			for _, i := range sel.sliceIndexes(n) {
+				result = append(result, Match{Value: v.items[i], parent: v, index: i})
+			}
+		}
+	}
+	return result
+}
+
+// sliceIndexes returns the indexes selected by slice in an array of length n, like RFC 9535
+func (sel *selector) sliceIndexes(n int) []int {
+	if sel.step == 0 {
+		return nil
+	}
+	normalize := func(i int) int {
+		if i < 0 {
+			return i + n
+		}
+		return i
+	}
+	clamp := func(i, lower, upper int) int {
+		if i < lower {
+			return lower
+		}
+		if i > upper {
+			return upper
+		}
+		return i
+	}
+	var indexes []int
+	if sel.step > 0 {
+		start, end := 0, n
+		if sel.start != nil {
+			start = clamp(normalize(*sel.start), 0, n)
+		}
+		if sel.end != nil {
+			end = clamp(normalize(*sel.end), 0, n)
+		}
+		for i := start; i < end; i += sel.step {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+	start, end := n-1, -1
+	if sel.start != nil {
+		start = clamp(normalize(*sel.start), -1, n-1)
+	}
+	if sel.end != nil {
+		end = clamp(normalize(*sel.end), -1, n-1)
+	}
+	for i := start; i > end; i += sel.step {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
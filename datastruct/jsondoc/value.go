@@ -0,0 +1,210 @@
+package jsondoc
+
+import "sort"
+
+/*
+ * Document is a JSON value tree which is modified in place.
+ * Values in the tree are one of:
+ *   *Object, *Array, string, int64, float64, bool and nil for null
+ * Containers are pointers so that a selected container can be updated without replacing it in its parent.
+ */
+
+// Object is a JSON object keeping the insertion order of keys
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject creates an empty object
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+// Get returns the value of key
+func (o *Object) Get(key string) (interface{}, bool) {
+	val, ok := o.values[key]
+	return val, ok
+}
+
+// Set puts value of key, a new key is appended to the end
+func (o *Object) Set(key string, val interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = val
+}
+
+// Delete removes key, returns whether it exists
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Keys returns keys in insertion order, the returned slice must not be modified
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+// Len returns the number of keys
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Array is a JSON array
+type Array struct {
+	items []interface{}
+}
+
+// NewArray creates an array of items
+func NewArray(items ...interface{}) *Array {
+	return &Array{items: items}
+}
+
+// Get returns the i-th item
+func (a *Array) Get(i int) interface{} {
+	return a.items[i]
+}
+
+// Len returns the number of items
+func (a *Array) Len() int {
+	return len(a.items)
+}
+
+// Append appends items to the end
+func (a *Array) Append(items ...interface{}) {
+	a.items = append(a.items, items...)
+}
+
+// Insert inserts items before the i-th item, 0 <= i <= Len()
+func (a *Array) Insert(i int, items ...interface{}) {
+	merged := make([]interface{}, 0, len(a.items)+len(items))
+	merged = append(merged, a.items[:i]...)
+	merged = append(merged, items...)
+	merged = append(merged, a.items[i:]...)
+	a.items = merged
+}
+
+// TypeName returns the type name of value like RedisJSON
+func TypeName(val interface{}) string {
+	switch val.(type) {
+	case *Object:
+		return "object"
+	case *Array:
+		return "array"
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// Document holds the root of a JSON value tree
+type Document struct {
+	root interface{}
+}
+
+// New creates a document of root value
+func New(root interface{}) *Document {
+	return &Document{root: root}
+}
+
+// Root returns the root value
+func (d *Document) Root() interface{} {
+	return d.root
+}
+
+// Match is a value selected by path, with its location in the document
+type Match struct {
+	Value interface{}
+	// parent is *Object, *Array or nil for the root
+	parent interface{}
+	key    string
+	index  int
+}
+
+// IsRoot returns whether the match is the root of document
+func (m Match) IsRoot() bool {
+	return m.parent == nil
+}
+
+// Select returns values matched by path in document order
+func (d *Document) Select(p *Path) []Match {
+	return p.selectFrom([]Match{{Value: d.root}})
+}
+
+// Replace replaces the matched value
+func (d *Document) Replace(m Match, val interface{}) {
+	switch parent := m.parent.(type) {
+	case nil:
+		d.root = val
+	case *Object:
+		parent.Set(m.key, val)
+	case *Array:
+		parent.items[m.index] = val
+	}
+}
+
+// Delete removes matched values, the root is never removed. Returns the number of removed values
+func (d *Document) Delete(matches []Match) int {
+	deleted := 0
+	arrayIndexes := make(map[*Array][]int)
+	for _, m := range matches {
+		switch parent := m.parent.(type) {
+		case *Object:
+			if parent.Delete(m.key) {
+				deleted++
+			}
+		case *Array:
+			arrayIndexes[parent] = append(arrayIndexes[parent], m.index)
+		}
+	}
+	for arr, indexes := range arrayIndexes {
+		// remove from tail to head so that indexes are not shifted
+		sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+		for i, index := range indexes {
+			if i > 0 && index == indexes[i-1] {
+				continue
+			}
+			arr.items = append(arr.items[:index], arr.items[index+1:]...)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Clone returns a deep copy of value
+func Clone(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *Object:
+		obj := &Object{
+			keys:   make([]string, len(v.keys)),
+			values: make(map[string]interface{}, len(v.values)),
+		}
+		copy(obj.keys, v.keys)
+		for key, child := range v.values {
+			obj.values[key] = Clone(child)
+		}
+		return obj
+	case *Array:
+		arr := &Array{items: make([]interface{}, len(v.items))}
+		for i, item := range v.items {
+			arr.items[i] = Clone(item)
+		}
+		return arr
+	}
+	return val
+}
@@ -0,0 +1,265 @@
+package list
+
+import "github.com/pluming/aurora/datastruct/listpack"
+
+// Encodings of CompactList
+const (
+	EncodingListPack  = "listpack"
+	EncodingQuickList = "quicklist"
+)
+
+// CompactList stores a small list of []byte in a listpack, and converts into a QuickList once it is too large.
+// maxSize limits the listpack like list-max-listpack-size of redis: a positive value is the max number of elements,
+// and -1 to -5 limit the size of listpack to 4, 8, 16, 32 or 64 kb. A converted list never converts back.
+type CompactList struct {
+	// lp is nil after converting
+	lp *listpack.ListPack
+	ql *QuickList
+
+	maxSize int
+}
+
+// NewCompact creates a list in listpack encoding
+func NewCompact(maxSize int) *CompactList {
+	if maxSize < -5 {
+		maxSize = -5
+	}
+	l := &CompactList{
+		maxSize: maxSize,
+	}
+	if maxSize != 0 {
+		l.lp = listpack.New()
+	} else {
+		l.ql = NewQuickList()
+	}
+	return l
+}
+
+// Encoding returns the current encoding of list
+func (l *CompactList) Encoding() string {
+	if l.lp != nil {
+		return EncodingListPack
+	}
+	return EncodingQuickList
+}
+
+// fits returns whether the listpack is within maxSize
+func (l *CompactList) fits() bool {
+	if l.maxSize > 0 {
+		return l.lp.Len() <= l.maxSize
+	}
+	return l.lp.Bytes() <= 4096<<(-l.maxSize-1)
+}
+
+func (l *CompactList) convert() {
+	l.ql = NewQuickList()
+	l.lp.ForEach(func(i int, val []byte) bool {
+		l.ql.Add(val)
+		return true
+	})
+	l.lp = nil
+}
+
+// compact returns the listpack if val can be stored in it, otherwise it converts the list
+func (l *CompactList) compact(val interface{}) ([]byte, bool) {
+	if l.lp == nil {
+		return nil, false
+	}
+	bytes, ok := val.([]byte)
+	if !ok {
+		l.convert()
+	}
+	return bytes, ok
+}
+
+// checkSize converts the list after the listpack grows
+func (l *CompactList) checkSize() {
+	if !l.fits() {
+		l.convert()
+	}
+}
+
+// Add adds value to the tail
+func (l *CompactList) Add(val interface{}) {
+	if bytes, ok := l.compact(val); ok {
+		l.lp.Append(bytes)
+		l.checkSize()
+		return
+	}
+	l.ql.Add(val)
+}
+
+// Get returns value at the given index
+func (l *CompactList) Get(index int) (val interface{}) {
+	if l.lp != nil {
+		if index < 0 || index >= l.lp.Len() {
+			panic("index out of bound")
+		}
+		return l.lp.Get(index)
+	}
+	return l.ql.Get(index)
+}
+
+// Set updates value at the given index
+func (l *CompactList) Set(index int, val interface{}) {
+	if bytes, ok := l.compact(val); ok {
+		if index < 0 || index >= l.lp.Len() {
+			panic("index out of bound")
+		}
+		l.lp.Set(index, bytes)
+		l.checkSize()
+		return
+	}
+	l.ql.Set(index, val)
+}
+
+// Insert inserts value at the given index, the original element at the given index will move backward
+func (l *CompactList) Insert(index int, val interface{}) {
+	if bytes, ok := l.compact(val); ok {
+		if index < 0 || index > l.lp.Len() {
+			panic("index out of bound")
+		}
+		l.lp.Insert(index, bytes)
+		l.checkSize()
+		return
+	}
+	l.ql.Insert(index, val)
+}
+
+// Remove removes value at the given index
+func (l *CompactList) Remove(index int) (val interface{}) {
+	if l.lp != nil {
+		if index < 0 || index >= l.lp.Len() {
+			panic("index out of bound")
+		}
+		val = l.lp.Get(index)
+		l.lp.Remove(index, 1)
+		return val
+	}
+	return l.ql.Remove(index)
+}
+
+// RemoveLast removes the last element and returns its value
+func (l *CompactList) RemoveLast() (val interface{}) {
+	if l.lp != nil {
+		if l.lp.Len() == 0 {
+			return nil
+		}
+		return l.Remove(l.lp.Len() - 1)
+	}
+	return l.ql.RemoveLast()
+}
+
+// removeIf removes at most count elements matching expected from the head, or from the tail if reverse is true,
+// count <= 0 means no limit
+func (l *CompactList) removeIf(expected Expected, count int, reverse bool) int {
+	n := l.lp.Len()
+	var matched []int
+	l.lp.ForEach(func(i int, val []byte) bool {
+		if expected(val) {
+			matched = append(matched, i)
+		}
+		return true
+	})
+	if count > 0 && len(matched) > count {
+		if reverse {
+			matched = matched[len(matched)-count:]
+		} else {
+			matched = matched[:count]
+		}
+	}
+	if len(matched) == 0 {
+		return 0
+	}
+	lp := listpack.New()
+	l.lp.ForEach(func(i int, val []byte) bool {
+		if len(matched) > 0 && matched[0] == i {
+			matched = matched[1:]
+		} else {
+			lp.Append(val)
+		}
+		return true
+	})
+	l.lp = lp
+	return n - lp.Len()
+}
+
+// RemoveAllByVal removes all elements with the given val
+func (l *CompactList) RemoveAllByVal(expected Expected) int {
+	if l.lp != nil {
+		return l.removeIf(expected, 0, false)
+	}
+	return l.ql.RemoveAllByVal(expected)
+}
+
+// RemoveByVal removes at most `count` values of the specified value in this list
+// scan from left to right
+func (l *CompactList) RemoveByVal(expected Expected, count int) int {
+	if l.lp != nil {
+		return l.removeIf(expected, count, false)
+	}
+	return l.ql.RemoveByVal(expected, count)
+}
+
+// ReverseRemoveByVal removes at most `count` values of the specified value in this list
+// scan from right to left
+func (l *CompactList) ReverseRemoveByVal(expected Expected, count int) int {
+	if l.lp != nil {
+		return l.removeIf(expected, count, true)
+	}
+	return l.ql.ReverseRemoveByVal(expected, count)
+}
+
+// Len returns the number of elements in list
+func (l *CompactList) Len() int {
+	if l.lp != nil {
+		return l.lp.Len()
+	}
+	return l.ql.Len()
+}
+
+// ForEach visits each element in the list
+// if the consumer returns false, the loop will be break
+func (l *CompactList) ForEach(consumer Consumer) {
+	if l.lp != nil {
+		l.lp.ForEach(func(i int, val []byte) bool {
+			return consumer(i, val)
+		})
+		return
+	}
+	l.ql.ForEach(consumer)
+}
+
+// Contains returns whether the list contains an element matching expected
+func (l *CompactList) Contains(expected Expected) bool {
+	contains := false
+	l.ForEach(func(i int, actual interface{}) bool {
+		if expected(actual) {
+			contains = true
+			return false
+		}
+		return true
+	})
+	return contains
+}
+
+// Range returns elements which index within [start, stop)
+func (l *CompactList) Range(start int, stop int) []interface{} {
+	if l.lp == nil {
+		return l.ql.Range(start, stop)
+	}
+	if start < 0 || start >= l.Len() {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > l.Len() {
+		panic("`stop` out of range")
+	}
+	slice := make([]interface{}, 0, stop-start)
+	l.lp.ForEach(func(i int, val []byte) bool {
+		if i >= start {
+			slice = append(slice, val)
+		}
+		return i+1 < stop
+	})
+	return slice
+}
@@ -0,0 +1,80 @@
+package list
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func equalsTo(s string) Expected {
+	return func(a interface{}) bool {
+		return bytes.Equal(a.([]byte), []byte(s))
+	}
+}
+
+func toStrings(l List) string {
+	s := ""
+	l.ForEach(func(i int, v interface{}) bool {
+		s += string(v.([]byte)) + " "
+		return true
+	})
+	return s
+}
+
+// TestCompactList checks a list in listpack encoding behaves the same as a QuickList
+func TestCompactList(t *testing.T) {
+	compact := NewCompact(128)
+	normal := NewQuickList()
+	for _, l := range []List{compact, normal} {
+		for i := 0; i < 20; i++ {
+			l.Add([]byte(strconv.Itoa(i % 4)))
+		}
+		l.Insert(0, []byte("a"))
+		l.Insert(l.Len(), []byte("b"))
+		l.Set(3, []byte("c"))
+		l.Remove(5)
+		l.RemoveLast()
+		l.RemoveByVal(equalsTo("1"), 2)
+		l.ReverseRemoveByVal(equalsTo("2"), 2)
+		l.RemoveAllByVal(equalsTo("3"))
+	}
+	if compact.Encoding() != EncodingListPack {
+		t.Fatal("expect listpack")
+	}
+	if toStrings(compact) != toStrings(normal) {
+		t.Fatalf("expect %s, actual %s", toStrings(normal), toStrings(compact))
+	}
+	if len(compact.Range(1, 4)) != 3 || string(compact.Range(1, 4)[0].([]byte)) != string(normal.Get(1).([]byte)) {
+		t.Fatal("wrong range")
+	}
+	if !compact.Contains(equalsTo("c")) || compact.Contains(equalsTo("3")) {
+		t.Fatal("wrong result of contains")
+	}
+}
+
+func TestCompactListConvert(t *testing.T) {
+	l := NewCompact(4)
+	for i := 0; i < 4; i++ {
+		l.Add([]byte(strconv.Itoa(i)))
+	}
+	if l.Encoding() != EncodingListPack {
+		t.Fatal("expect listpack")
+	}
+	l.Insert(0, []byte("x"))
+	if l.Encoding() != EncodingQuickList || l.Len() != 5 || toStrings(l) != "x 0 1 2 3 " {
+		t.Fatalf("expect 5 elements in quicklist, actual %s in %s", toStrings(l), l.Encoding())
+	}
+
+	// 4kb
+	l = NewCompact(-1)
+	for i := 0; i < 90; i++ {
+		l.Add(make([]byte, 40))
+	}
+	if l.Encoding() != EncodingListPack {
+		t.Fatal("expect listpack")
+	}
+	l.Add(make([]byte, 400))
+	if l.Encoding() != EncodingQuickList || l.Len() != 91 {
+		t.Fatalf("expect 91 elements in quicklist, actual %d in %s", l.Len(), l.Encoding())
+	}
+}
@@ -227,10 +227,17 @@ func (iter *iterator) remove() interface{} {
 	} else {
 		// page is empty, update iter.node and iter.offset
 		if iter.node == iter.ql.data.Back() {
-			// removed last element, ql is empty now
+			prevNode := iter.node.Prev()
 			iter.ql.data.Remove(iter.node)
-			iter.node = nil
-			iter.offset = 0
+			if prevNode == nil {
+				// removed last element, ql is empty now
+				iter.node = nil
+				iter.offset = 0
+			} else {
+				// removed last page, iter moves to the end of previous page
+				iter.node = prevNode
+				iter.offset = len(prevNode.Value.([]interface{}))
+			}
 		} else {
 			nextNode := iter.node.Next()
 			iter.ql.data.Remove(iter.node)
@@ -273,6 +280,9 @@ func (ql *QuickList) RemoveLast() interface{} {
 
 // RemoveAllByVal removes all elements with the given val
 func (ql *QuickList) RemoveAllByVal(expected Expected) int {
+	if ql.size == 0 {
+		return 0
+	}
 	iter := ql.find(0)
 	removed := 0
 	for !iter.atEnd() {
@@ -177,6 +177,32 @@ func TestQuickListRemoveVal(t *testing.T) {
 	}
 }
 
+func TestQuickListReverseRemoveLastPage(t *testing.T) {
+	list := NewQuickList()
+	size := pageSize + 1 // the last page holds only one element
+	for i := 0; i < size; i++ {
+		list.Add(i % 2)
+	}
+	removed := list.ReverseRemoveByVal(func(a interface{}) bool {
+		return utils.Equals(a, 0)
+	}, size)
+	if removed != size/2+1 {
+		t.Error("test fail: expected " + strconv.Itoa(size/2+1) + ", actual: " + strconv.Itoa(removed))
+	}
+	list.ForEach(func(i int, v interface{}) bool {
+		if v.(int) != 1 {
+			t.Error("test fail: found 0 at index: " + strconv.Itoa(i))
+		}
+		return true
+	})
+	if list.RemoveAllByVal(func(a interface{}) bool { return true }) != size/2 {
+		t.Error("remove all fail")
+	}
+	if list.RemoveAllByVal(func(a interface{}) bool { return true }) != 0 {
+		t.Error("remove all from empty list fail")
+	}
+}
+
 func TestQuickList_Contains(t *testing.T) {
 	list := NewQuickList()
 	list.Add(1)
@@ -0,0 +1,208 @@
+package listpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+)
+
+/*
+ * ListPack stores a sequence of byte strings in a single byte slice, like the listpack of redis.
+ * It saves the pointers and headers of each element, so it is used to encode small hashes, sets, sorted sets and lists.
+ *
+ * Every entry starts with an 1 byte tag:
+ *   STR 0x00 <uvarint len> <bytes>: a string
+ *   INT 0x01 <varint>:              a string which is the canonical form of an int64, such as "-12" but not "012"
+ * The encoding of a value is unique, so that equal values have equal encoded bytes.
+ *
+ * Entries are located by walking from the head, most operations are O(n) like redis listpack,
+ * callers should keep it small and convert to another encoding if it grows large.
+ *
+ * ListPack never modifies bytes which have been written, an update writes a new slice, so that slices returned
+ * by Get and ForEach keep valid after updates.
+ */
+
+const (
+	tagStr byte = iota
+	tagInt
+)
+
+// ListPack is a compact sequence of byte strings, it is not thread safe
+type ListPack struct {
+	buf  []byte
+	size int
+}
+
+// New creates an empty ListPack
+func New() *ListPack {
+	return &ListPack{}
+}
+
+// Len returns the number of entries
+func (lp *ListPack) Len() int {
+	return lp.size
+}
+
+// Bytes returns the size of encoded entries in bytes
+func (lp *ListPack) Bytes() int {
+	return len(lp.buf)
+}
+
+// parseCanonicalInt returns the int64 whose decimal form is exactly val
+func parseCanonicalInt(val []byte) (int64, bool) {
+	// the longest int64 is "-9223372036854775808"
+	if len(val) == 0 || len(val) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	var tmp [20]byte
+	if !bytes.Equal(strconv.AppendInt(tmp[:0], v, 10), val) {
+		return 0, false
+	}
+	return v, true
+}
+
+// appendEntry appends the encoded val to dst
+func appendEntry(dst []byte, val []byte) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	if v, ok := parseCanonicalInt(val); ok {
+		n := binary.PutVarint(tmp[:], v)
+		dst = append(dst, tagInt)
+		return append(dst, tmp[:n]...)
+	}
+	n := binary.PutUvarint(tmp[:], uint64(len(val)))
+	dst = append(dst, tagStr)
+	dst = append(dst, tmp[:n]...)
+	return append(dst, val...)
+}
+
+func encode(vals [][]byte) []byte {
+	var buf []byte
+	for _, val := range vals {
+		buf = appendEntry(buf, val)
+	}
+	return buf
+}
+
+// decode returns the value of entry at offset and the offset of next entry
+func (lp *ListPack) decode(offset int) ([]byte, int) {
+	if lp.buf[offset] == tagInt {
+		v, n := binary.Varint(lp.buf[offset+1:])
+		return strconv.AppendInt(nil, v, 10), offset + 1 + n
+	}
+	l, n := binary.Uvarint(lp.buf[offset+1:])
+	start := offset + 1 + n
+	end := start + int(l)
+	return lp.buf[start:end:end], end
+}
+
+// next returns the offset of the entry after the one at offset
+func (lp *ListPack) next(offset int) int {
+	if lp.buf[offset] == tagInt {
+		_, n := binary.Varint(lp.buf[offset+1:])
+		return offset + 1 + n
+	}
+	l, n := binary.Uvarint(lp.buf[offset+1:])
+	return offset + 1 + n + int(l)
+}
+
+// offset returns the offset of the entry at index, index == Len() returns the end of buf
+func (lp *ListPack) offset(index int) int {
+	if index < 0 || index > lp.size {
+		panic("index out of bound: " + strconv.Itoa(index))
+	}
+	offset := 0
+	for i := 0; i < index; i++ {
+		offset = lp.next(offset)
+	}
+	return offset
+}
+
+// Get returns the entry at index
+func (lp *ListPack) Get(index int) []byte {
+	if index == lp.size {
+		panic("index out of bound: " + strconv.Itoa(index))
+	}
+	val, _ := lp.decode(lp.offset(index))
+	return val
+}
+
+// ForEach visits entries in order until consumer returns false
+func (lp *ListPack) ForEach(consumer func(i int, val []byte) bool) {
+	offset := 0
+	for i := 0; i < lp.size; i++ {
+		var val []byte
+		val, offset = lp.decode(offset)
+		if !consumer(i, val) {
+			return
+		}
+	}
+}
+
+// Find returns the index of the first entry equal to val in start, start+step, start+2*step ..., or -1 if not found
+func (lp *ListPack) Find(val []byte, start, step int) int {
+	target := appendEntry(nil, val)
+	offset := lp.offset(start)
+	for i := start; i < lp.size; i++ {
+		next := lp.next(offset)
+		if (i-start)%step == 0 && bytes.Equal(lp.buf[offset:next], target) {
+			return i
+		}
+		offset = next
+	}
+	return -1
+}
+
+// Append adds vals to the tail
+func (lp *ListPack) Append(vals ...[]byte) {
+	// bytes in len(buf) are not modified by append
+	for _, val := range vals {
+		lp.buf = appendEntry(lp.buf, val)
+	}
+	lp.size += len(vals)
+}
+
+// Insert inserts vals before the entry at index, index == Len() appends vals
+func (lp *ListPack) Insert(index int, vals ...[]byte) {
+	offset := lp.offset(index)
+	lp.replace(offset, offset, encode(vals))
+	lp.size += len(vals)
+}
+
+// Set replaces the entry at index with val
+func (lp *ListPack) Set(index int, val []byte) {
+	offset := lp.offset(index)
+	if index == lp.size {
+		panic("index out of bound: " + strconv.Itoa(index))
+	}
+	lp.replace(offset, lp.next(offset), appendEntry(nil, val))
+}
+
+// Remove removes n entries from index
+func (lp *ListPack) Remove(index, n int) {
+	if n <= 0 {
+		return
+	}
+	if index+n > lp.size {
+		panic("index out of bound: " + strconv.Itoa(index+n))
+	}
+	start := lp.offset(index)
+	end := start
+	for i := 0; i < n; i++ {
+		end = lp.next(end)
+	}
+	lp.replace(start, end, nil)
+	lp.size -= n
+}
+
+// replace replaces buf[start:end] with encoded entries in a new slice
+func (lp *ListPack) replace(start, end int, encoded []byte) {
+	buf := make([]byte, 0, len(lp.buf)-(end-start)+len(encoded))
+	buf = append(buf, lp.buf[:start]...)
+	buf = append(buf, encoded...)
+	buf = append(buf, lp.buf[end:]...)
+	lp.buf = buf
+}
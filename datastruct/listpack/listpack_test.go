@@ -0,0 +1,75 @@
+package listpack
+
+import (
+	"strconv"
+	"testing"
+)
+
+func collect(lp *ListPack) []string {
+	var result []string
+	lp.ForEach(func(i int, val []byte) bool {
+		result = append(result, string(val))
+		return true
+	})
+	return result
+}
+
+func TestListPack(t *testing.T) {
+	lp := New()
+	vals := []string{"a", "12", "012", "-0", "-9223372036854775808", "9223372036854775808", "", "hello world"}
+	for _, val := range vals {
+		lp.Append([]byte(val))
+	}
+	if lp.Len() != len(vals) {
+		t.Fatalf("expect len %d, actual %d", len(vals), lp.Len())
+	}
+	for i, val := range vals {
+		if string(lp.Get(i)) != val {
+			t.Errorf("expect %q at %d, actual %q", val, i, lp.Get(i))
+		}
+		if lp.Find([]byte(val), 0, 1) != i {
+			t.Errorf("cannot find %q", val)
+		}
+	}
+	if lp.Find([]byte("12"), 0, 2) != -1 || lp.Find([]byte("12"), 1, 2) != 1 {
+		t.Error("wrong find with step")
+	}
+
+	got := lp.Get(0)
+	lp.Insert(0, []byte("x"), []byte("100"))
+	lp.Set(2, []byte("b"))
+	lp.Remove(3, 2)
+	if string(got) != "a" {
+		t.Error("returned slice is modified")
+	}
+	expect := []string{"x", "100", "b", "-0", "-9223372036854775808", "9223372036854775808", "", "hello world"}
+	actual := collect(lp)
+	if len(actual) != len(expect) {
+		t.Fatalf("expect %v, actual %v", expect, actual)
+	}
+	for i := range expect {
+		if actual[i] != expect[i] {
+			t.Fatalf("expect %v, actual %v", expect, actual)
+		}
+	}
+	lp.Remove(0, lp.Len())
+	if lp.Len() != 0 || lp.Bytes() != 0 {
+		t.Error("expect empty listpack")
+	}
+}
+
+func TestListPackIntEncoding(t *testing.T) {
+	lp := New()
+	for i := 0; i < 100; i++ {
+		lp.Append([]byte(strconv.Itoa(i * 1000)))
+	}
+	// each entry takes 1 byte tag and at most 3 bytes varint
+	if lp.Bytes() > 400 {
+		t.Errorf("integers are not encoded compactly: %d bytes", lp.Bytes())
+	}
+	for i := 0; i < 100; i++ {
+		if string(lp.Get(i)) != strconv.Itoa(i*1000) {
+			t.Fatalf("wrong value at %d", i)
+		}
+	}
+}
@@ -166,3 +166,17 @@ func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
 		}
 	}
 }
+
+// LockAll obtains exclusive locks of all keys, it waits for all holders of any key
+func (locks *Locks) LockAll() {
+	for _, mu := range locks.table {
+		mu.Lock()
+	}
+}
+
+// UnLockAll releases locks obtained by LockAll
+func (locks *Locks) UnLockAll() {
+	for i := len(locks.table) - 1; i >= 0; i-- {
+		locks.table[i].Unlock()
+	}
+}
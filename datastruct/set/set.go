@@ -1,16 +1,57 @@
 package set
 
-import "github.com/pluming/aurora/datastruct/dict"
+import (
+	"math/rand"
+	"strconv"
 
-// Set is a set of elements based on hash table
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/intset"
+	"github.com/pluming/aurora/datastruct/listpack"
+)
+
+// Encodings of Set
+const (
+	EncodingIntSet    = "intset"
+	EncodingListPack  = "listpack"
+	EncodingHashTable = "hashtable"
+)
+
+// Limits are the thresholds of compact encodings, 0 disables the encoding.
+// A set of integers is encoded in intset until it has more than MaxIntSetEntries members,
+// other small sets are encoded in listpack until it has more than MaxListPackEntries members
+// or a member longer than MaxListPackValue. A set in hashtable never converts back.
+type Limits struct {
+	MaxIntSetEntries   int
+	MaxListPackEntries int
+	MaxListPackValue   int
+}
+
+// Set is a set of elements based on hash table, or a compact encoding if it is small
 type Set struct {
+	// only one of ints, lp and dict is not nil
+	ints *intset.IntSet
+	lp   *listpack.ListPack
 	dict dict.Dict
+
+	limits Limits
 }
 
-// Make creates a new set
+// Make creates a new set in hashtable encoding
 func Make(members ...string) *Set {
+	return MakeCompact(Limits{}, members...)
+}
+
+// MakeCompact creates a new set which is encoded compactly within limits
+func MakeCompact(limits Limits, members ...string) *Set {
 	set := &Set{
-		dict: dict.MakeSimple(),
+		limits: limits,
+	}
+	if limits.MaxIntSetEntries > 0 {
+		set.ints = intset.New()
+	} else if limits.MaxListPackEntries > 0 {
+		set.lp = listpack.New()
+	} else {
+		set.dict = dict.MakeSimple()
 	}
 	for _, member := range members {
 		set.Add(member)
@@ -18,39 +59,122 @@ func Make(members ...string) *Set {
 	return set
 }
 
+// Encoding returns the current encoding of set
+func (set *Set) Encoding() string {
+	if set.ints != nil {
+		return EncodingIntSet
+	} else if set.lp != nil {
+		return EncodingListPack
+	}
+	return EncodingHashTable
+}
+
+// parseInt returns the integer whose decimal form is exactly val, only such members can be stored in intset
+func parseInt(val string) (int64, bool) {
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != val {
+		return 0, false
+	}
+	return v, true
+}
+
+// convert moves all members into the given encoding
+func (set *Set) convert(encoding string) {
+	members := set.ToSlice()
+	set.ints = nil
+	if encoding == EncodingListPack {
+		set.lp = listpack.New()
+		for _, member := range members {
+			set.lp.Append([]byte(member))
+		}
+		return
+	}
+	set.lp = nil
+	set.dict = dict.MakeSimple()
+	for _, member := range members {
+		set.dict.Put(member, nil)
+	}
+}
+
 // Add adds member into set
 func (set *Set) Add(val string) int {
+	if set.ints != nil {
+		if v, ok := parseInt(val); ok {
+			if set.ints.Has(v) {
+				return 0
+			}
+			if set.ints.Len() < set.limits.MaxIntSetEntries {
+				set.ints.Add(v)
+				return 1
+			}
+			set.convert(EncodingHashTable)
+		} else if set.ints.Len() < set.limits.MaxListPackEntries && len(val) <= set.limits.MaxListPackValue {
+			set.convert(EncodingListPack)
+		} else {
+			set.convert(EncodingHashTable)
+		}
+	}
+	if set.lp != nil {
+		if set.lp.Find([]byte(val), 0, 1) >= 0 {
+			return 0
+		}
+		if set.lp.Len() < set.limits.MaxListPackEntries && len(val) <= set.limits.MaxListPackValue {
+			set.lp.Append([]byte(val))
+			return 1
+		}
+		set.convert(EncodingHashTable)
+	}
 	return set.dict.Put(val, nil)
 }
 
 // Remove removes member from set
 func (set *Set) Remove(val string) int {
+	if set.ints != nil {
+		if v, ok := parseInt(val); ok && set.ints.Remove(v) {
+			return 1
+		}
+		return 0
+	}
+	if set.lp != nil {
+		i := set.lp.Find([]byte(val), 0, 1)
+		if i < 0 {
+			return 0
+		}
+		set.lp.Remove(i, 1)
+		return 1
+	}
 	return set.dict.Remove(val)
 }
 
 // Has returns true if the val exists in the set
 func (set *Set) Has(val string) bool {
+	if set.ints != nil {
+		v, ok := parseInt(val)
+		return ok && set.ints.Has(v)
+	}
+	if set.lp != nil {
+		return set.lp.Find([]byte(val), 0, 1) >= 0
+	}
 	_, exists := set.dict.Get(val)
 	return exists
 }
 
 // Len returns number of members in the set
 func (set *Set) Len() int {
+	if set.ints != nil {
+		return set.ints.Len()
+	}
+	if set.lp != nil {
+		return set.lp.Len()
+	}
 	return set.dict.Len()
 }
 
 // ToSlice convert set to []string
 func (set *Set) ToSlice() []string {
-	slice := make([]string, set.Len())
-	i := 0
-	set.dict.ForEach(func(key string, val interface{}) bool {
-		if i < len(slice) {
-			slice[i] = key
-		} else {
-			// set extended during traversal
-			slice = append(slice, key)
-		}
-		i++
+	slice := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		slice = append(slice, member)
 		return true
 	})
 	return slice
@@ -58,18 +182,46 @@ func (set *Set) ToSlice() []string {
 
 // ForEach visits each member in the set
 func (set *Set) ForEach(consumer func(member string) bool) {
+	if set.ints != nil {
+		set.ints.ForEach(func(v int64) bool {
+			return consumer(strconv.FormatInt(v, 10))
+		})
+		return
+	}
+	if set.lp != nil {
+		set.lp.ForEach(func(i int, val []byte) bool {
+			return consumer(string(val))
+		})
+		return
+	}
 	set.dict.ForEach(func(key string, val interface{}) bool {
 		return consumer(key)
 	})
 }
 
+// Scan visits members from cursor and returns the cursor of the next call, see dict.Dict.
+// A compact set is visited in one call.
+func (set *Set) Scan(cursor uint64, count int, consumer func(member string)) uint64 {
+	if set.dict == nil {
+		set.ForEach(func(member string) bool {
+			consumer(member)
+			return true
+		})
+		return 0
+	}
+	return set.dict.Scan(cursor, count, func(key string, val interface{}) bool {
+		consumer(key)
+		return true
+	})
+}
+
 // Intersect intersects two sets
 func (set *Set) Intersect(another *Set) *Set {
 	if set == nil {
 		panic("set is nil")
 	}
 
-	result := Make()
+	result := MakeCompact(set.limits)
 	another.ForEach(func(member string) bool {
 		if set.Has(member) {
 			result.Add(member)
@@ -84,7 +236,7 @@ func (set *Set) Union(another *Set) *Set {
 	if set == nil {
 		panic("set is nil")
 	}
-	result := Make()
+	result := MakeCompact(set.limits)
 	another.ForEach(func(member string) bool {
 		result.Add(member)
 		return true
@@ -102,7 +254,7 @@ func (set *Set) Diff(another *Set) *Set {
 		panic("set is nil")
 	}
 
-	result := Make()
+	result := MakeCompact(set.limits)
 	set.ForEach(func(member string) bool {
 		if !another.Has(member) {
 			result.Add(member)
@@ -112,12 +264,41 @@ func (set *Set) Diff(another *Set) *Set {
 	return result
 }
 
+// get returns the member at index of a compact set
+func (set *Set) get(index int) string {
+	if set.ints != nil {
+		return strconv.FormatInt(set.ints.Get(index), 10)
+	}
+	return string(set.lp.Get(index))
+}
+
 // RandomMembers randomly returns keys of the given number, may contain duplicated key
 func (set *Set) RandomMembers(limit int) []string {
-	return set.dict.RandomKeys(limit)
+	if set.dict != nil {
+		return set.dict.RandomKeys(limit)
+	}
+	if set.Len() == 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = set.get(rand.Intn(set.Len()))
+	}
+	return result
 }
 
 // RandomDistinctMembers randomly returns keys of the given number, won't contain duplicated key
 func (set *Set) RandomDistinctMembers(limit int) []string {
-	return set.dict.RandomDistinctKeys(limit)
+	if set.dict != nil {
+		return set.dict.RandomDistinctKeys(limit)
+	}
+	size := limit
+	if size > set.Len() {
+		size = set.Len()
+	}
+	result := make([]string, size)
+	for i, j := range rand.Perm(set.Len())[:size] {
+		result[i] = set.get(j)
+	}
+	return result
 }
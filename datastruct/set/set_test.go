@@ -30,3 +30,44 @@ func TestSet(t *testing.T) {
 		}
 	}
 }
+
+func TestSetEncoding(t *testing.T) {
+	limits := Limits{MaxIntSetEntries: 4, MaxListPackEntries: 3, MaxListPackValue: 4}
+	set := MakeCompact(limits, "1", "2", "3")
+	if set.Encoding() != EncodingIntSet {
+		t.Fatalf("expect intset, actual %s", set.Encoding())
+	}
+	if set.Add("01") != 1 || set.Encoding() != EncodingHashTable {
+		t.Fatalf("expect hashtable since 4 members exceed listpack entries, actual %s", set.Encoding())
+	}
+
+	set = MakeCompact(limits, "1", "2")
+	set.Add("a")
+	if set.Encoding() != EncodingListPack || !set.Has("1") || !set.Has("a") || set.Has("01") {
+		t.Fatalf("expect listpack, actual %s", set.Encoding())
+	}
+	if set.Add("1") != 0 || set.Remove("2") != 1 || set.Len() != 2 {
+		t.Fatal("wrong members in listpack")
+	}
+	set.Add("abcde")
+	if set.Encoding() != EncodingHashTable || set.Len() != 3 || !set.Has("abcde") {
+		t.Fatalf("expect 3 members in hashtable, actual %d in %s", set.Len(), set.Encoding())
+	}
+
+	set = MakeCompact(limits, "1", "2", "3", "4", "5")
+	if set.Encoding() != EncodingHashTable || set.Len() != 5 {
+		t.Fatalf("expect 5 members in hashtable, actual %d in %s", set.Len(), set.Encoding())
+	}
+	if Make("1").Encoding() != EncodingHashTable {
+		t.Fatal("expect hashtable")
+	}
+
+	set = MakeCompact(limits, "1", "2", "3")
+	result := set.Union(MakeCompact(limits, "3", "4"))
+	if result.Encoding() != EncodingIntSet || result.Len() != 4 {
+		t.Fatalf("expect 4 members in intset, actual %d in %s", result.Len(), result.Encoding())
+	}
+	if len(set.RandomDistinctMembers(5)) != 3 || len(set.RandomMembers(5)) != 5 {
+		t.Fatal("wrong number of random members")
+	}
+}
@@ -71,9 +71,9 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 	if s == "-inf" {
 		return NegativeInfBorder, nil
 	}
-	if s[0] == '(' {
+	if len(s) > 0 && s[0] == '(' {
 		value, err := strconv.ParseFloat(s[1:], 64)
-		if err != nil {
+		if err != nil || math.IsNaN(value) {
 			return nil, errors.New("ERR min or max is not a float")
 		}
 		return &ScoreBorder{
@@ -83,7 +83,7 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		}, nil
 	}
 	value, err := strconv.ParseFloat(s, 64)
-	if err != nil {
+	if err != nil || math.IsNaN(value) {
 		return nil, errors.New("ERR min or max is not a float")
 	}
 	return &ScoreBorder{
@@ -92,3 +92,8 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		Exclude: false,
 	}, nil
 }
+
+// InScoreRange returns whether score is within the border min and max
+func InScoreRange(min, max *ScoreBorder, score float64) bool {
+	return min.less(score) && max.greater(score)
+}
@@ -0,0 +1,170 @@
+package skiplist
+
+import "errors"
+
+/*
+ * LexBorder is a struct represents `min` `max` parameter of client command `ZRANGEBYLEX`
+ * can accept:
+ *   inclusive string, such as [a, [abc ...
+ *   exclusive string, such as (a, (abc ...
+ *   infinity: - and +
+ */
+
+// LexBorder represents range of a member, including: <, <=, >, >=, +, -
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+// if max.greater(member) then the member is within the upper border
+// do not use min.greater()
+func (border *LexBorder) greater(value string) bool {
+	if border.Inf == negativeInf {
+		return false
+	} else if border.Inf == positiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value > value
+	}
+	return border.Value >= value
+}
+
+// if min.less(member) then the member is within the lower border
+func (border *LexBorder) less(value string) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < value
+	}
+	return border.Value <= value
+}
+
+var PositiveInfLexBorder = &LexBorder{
+	Inf: positiveInf,
+}
+
+var NegativeInfLexBorder = &LexBorder{
+	Inf: negativeInf,
+}
+
+// ParseLexBorder creates LexBorder from client arguments
+func ParseLexBorder(s string) (*LexBorder, error) {
+	if s == "+" {
+		return PositiveInfLexBorder, nil
+	}
+	if s == "-" {
+		return NegativeInfLexBorder, nil
+	}
+	if len(s) == 0 || (s[0] != '(' && s[0] != '[') {
+		return nil, errors.New("ERR min or max not valid string range item")
+	}
+	return &LexBorder{
+		Inf:     0,
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
+
+// InLexRange returns whether member is within the border min and max
+func InLexRange(min, max *LexBorder, member string) bool {
+	return min.less(member) && max.greater(member)
+}
+
+func (sl *SkipList) hasInLexRange(min *LexBorder, max *LexBorder) bool {
+	if min.Inf == positiveInf || max.Inf == negativeInf {
+		return false
+	}
+	if min.Inf == 0 && max.Inf == 0 &&
+		(min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude))) {
+		return false
+	}
+	// min > tail
+	node := sl.Tail
+	if node == nil || !min.less(node.Member) {
+		return false
+	}
+	// max < head
+	node = sl.Header.Level[0].Forward
+	if node == nil || !max.greater(node.Member) {
+		return false
+	}
+	return true
+}
+
+// GetFirstInLexRange returns the first node within the lex range and its 1-based rank, rank is -1 if not found.
+// Lex ranges make sense only when all members have the same score
+func (sl *SkipList) GetFirstInLexRange(min *LexBorder, max *LexBorder) (*Node, int64) {
+	var rank int64
+	if !sl.hasInLexRange(min, max) {
+		return nil, -1
+	}
+	node := sl.Header
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.Level[i].Forward != nil && !min.less(node.Level[i].Forward.Member) {
+			rank += node.Level[i].span
+			node = node.Level[i].Forward
+		}
+	}
+
+	node = node.Level[0].Forward
+	if node == nil || !max.greater(node.Member) {
+		return nil, -1
+	}
+	rank++
+	return node, rank
+}
+
+// GetLastInLexRange returns the last node within the lex range and its 1-based rank, rank is -1 if not found
+func (sl *SkipList) GetLastInLexRange(min *LexBorder, max *LexBorder) (*Node, int64) {
+	var rank int64
+	if !sl.hasInLexRange(min, max) {
+		return nil, -1
+	}
+	node := sl.Header
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.Level[i].Forward != nil && max.greater(node.Level[i].Forward.Member) {
+			rank += node.Level[i].span
+			node = node.Level[i].Forward
+		}
+	}
+
+	if node == sl.Header || !min.less(node.Member) {
+		return nil, -1
+	}
+	return node, rank
+}
+
+// RemoveRangeByLex removes nodes within the lex range and returns removed elements
+func (sl *SkipList) RemoveRangeByLex(min *LexBorder, max *LexBorder) (removed []*Element) {
+	update := make([]*Node, maxLevel)
+	removed = make([]*Element, 0)
+	if !sl.hasInLexRange(min, max) {
+		return removed
+	}
+	// find Backward nodes (of target range) or last node of each Level
+	node := sl.Header
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.Level[i].Forward != nil && !min.less(node.Level[i].Forward.Member) {
+			node = node.Level[i].Forward
+		}
+		update[i] = node
+	}
+
+	// node is the first one within range
+	node = node.Level[0].Forward
+
+	// remove nodes in range
+	for node != nil && max.greater(node.Member) {
+		next := node.Level[0].Forward
+		removedElement := node.Element
+		removed = append(removed, &removedElement)
+		sl.removeNode(node, update)
+		node = next
+	}
+	return removed
+}
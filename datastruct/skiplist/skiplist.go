@@ -73,10 +73,7 @@ func init() {
 func randomLevel() int16 {
 	var level int16 = 1
 
-	for float64(rand.Int31()&0xffff) < (0.25 * 0xffff) {
-		level++
-	}
-	if level > maxLevel {
+	for level < maxLevel && float64(rand.Int31()&0xffff) < (0.25*0xffff) {
 		level++
 	}
 	return level
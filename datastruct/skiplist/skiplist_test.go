@@ -53,3 +53,55 @@ func TestNormalSkip(t *testing.T) {
 
 	t.Log(sl)
 }
+
+func TestLexRange(t *testing.T) {
+	sl := MakeSkipList()
+	members := []string{"a", "b", "c", "d", "e", "f", "g"}
+	for _, m := range members {
+		sl.Insert(m, 0)
+	}
+	parse := func(s string) *LexBorder {
+		border, err := ParseLexBorder(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return border
+	}
+	tests := []struct {
+		min, max    string
+		first, last string
+		firstRank   int64
+		lastRank    int64
+	}{
+		{"-", "+", "a", "g", 1, 7},
+		{"[b", "(e", "b", "d", 2, 4},
+		{"(b", "[e", "c", "e", 3, 5},
+		{"[bb", "[ee", "c", "e", 3, 5},
+		{"(a", "(b", "", "", -1, -1},
+		{"[e", "[b", "", "", -1, -1},
+		{"[h", "+", "", "", -1, -1},
+		{"-", "(a", "", "", -1, -1},
+	}
+	for _, tt := range tests {
+		min, max := parse(tt.min), parse(tt.max)
+		first, firstRank := sl.GetFirstInLexRange(min, max)
+		last, lastRank := sl.GetLastInLexRange(min, max)
+		if firstRank != tt.firstRank || lastRank != tt.lastRank {
+			t.Fatalf("%s %s: expect ranks %d %d, actual %d %d", tt.min, tt.max, tt.firstRank, tt.lastRank, firstRank, lastRank)
+		}
+		if first != nil && (first.Member != tt.first || last.Member != tt.last) {
+			t.Fatalf("%s %s: expect %s %s, actual %s %s", tt.min, tt.max, tt.first, tt.last, first.Member, last.Member)
+		}
+	}
+
+	if _, err := ParseLexBorder("a"); err == nil {
+		t.Fatal("expect error for border without prefix")
+	}
+	removed := sl.RemoveRangeByLex(parse("(b"), parse("[e"))
+	if len(removed) != 3 || sl.Length() != 4 {
+		t.Fatalf("expect 3 removed, actual %d", len(removed))
+	}
+	if _, rank := sl.GetFirstInLexRange(parse("[c"), parse("+")); rank != 3 {
+		t.Fatalf("expect rank 3, actual %d", rank)
+	}
+}
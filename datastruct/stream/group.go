@@ -0,0 +1,251 @@
+package stream
+
+import (
+	"sort"
+)
+
+// PendingEntry is an entry delivered to a consumer but not acknowledged yet
+type PendingEntry struct {
+	ID            ID
+	Consumer      *Consumer
+	DeliveryTime  int64 // unix milliseconds
+	DeliveryCount int64
+}
+
+// Consumer is a member of consumer group
+type Consumer struct {
+	Name       string
+	SeenTime   int64 // last time of attempted interaction in unix milliseconds
+	ActiveTime int64 // last time of successful interaction, -1 if never
+	Pending    int64 // number of pending entries owned by consumer
+}
+
+// Group is a consumer group of stream
+type Group struct {
+	Name        string
+	LastID      ID    // ID of the last entry delivered
+	EntriesRead int64 // logical counter of entries read, -1 if unknown
+	pending     []*PendingEntry
+	consumers   map[string]*Consumer
+}
+
+// CreateGroup creates a consumer group, ok is false if the group exists
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) (*Group, bool) {
+	if _, exists := s.groups[name]; exists {
+		return nil, false
+	}
+	group := &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		consumers:   make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+// Group returns the consumer group of name
+func (s *Stream) Group(name string) (*Group, bool) {
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+// DestroyGroup removes the consumer group, returns whether it exists
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups returns consumer groups ordered by name
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// ReadGroup delivers at most count entries after the last delivered ID of group to consumer,
+// delivered entries are added into the pending entries list unless noAck
+func (s *Stream) ReadGroup(group *Group, consumer *Consumer, count int64, noAck bool, now int64) []*Entry {
+	start, ok := group.LastID.Next()
+	if !ok {
+		return nil
+	}
+	entries := s.Range(start, MaxID, count, false)
+	for _, entry := range entries {
+		s.advanceGroup(group, entry.ID)
+		if noAck {
+			continue
+		}
+		if pending, ok := group.GetPending(entry.ID); ok {
+			// the last ID of group has been set back
+			group.Assign(pending, consumer)
+			pending.DeliveryTime = now
+			pending.DeliveryCount = 1
+		} else {
+			group.AddPending(entry.ID, consumer, now)
+		}
+	}
+	return entries
+}
+
+// advanceGroup moves last ID of group forward to id, and maintains the counter of entries read
+func (s *Stream) advanceGroup(group *Group, id ID) {
+	if !group.LastID.Less(id) {
+		return
+	}
+	if group.EntriesRead >= 0 && !s.hasTombstones(&id) {
+		group.EntriesRead++
+	} else if s.entriesAdded > 0 {
+		group.EntriesRead = s.EstimateEntriesRead(id)
+	}
+	group.LastID = id
+}
+
+// Lag returns the number of entries not delivered to group yet, ok is false if it can not be known
+func (s *Stream) Lag(group *Group) (lag int64, ok bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if group.EntriesRead >= 0 && !s.hasTombstones(&group.LastID) {
+		return s.entriesAdded - group.EntriesRead, true
+	}
+	entriesRead := s.EstimateEntriesRead(group.LastID)
+	if entriesRead < 0 {
+		return 0, false
+	}
+	return s.entriesAdded - entriesRead, true
+}
+
+/* ---- consumers ---- */
+
+// Consumer returns the consumer of name
+func (g *Group) Consumer(name string) (*Consumer, bool) {
+	consumer, ok := g.consumers[name]
+	return consumer, ok
+}
+
+// CreateConsumer returns the consumer of name, it is created if absent
+func (g *Group) CreateConsumer(name string, now int64) (consumer *Consumer, created bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer = &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer removes the consumer and its pending entries, returns the number of its pending entries
+func (g *Group) DeleteConsumer(name string) int64 {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0
+	}
+	pending := consumer.Pending
+	kept := g.pending[:0]
+	for _, entry := range g.pending {
+		if entry.Consumer != consumer {
+			kept = append(kept, entry)
+		}
+	}
+	for i := len(kept); i < len(g.pending); i++ {
+		g.pending[i] = nil
+	}
+	g.pending = kept
+	delete(g.consumers, name)
+	return pending
+}
+
+// Consumers returns consumers ordered by name
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+/* ---- pending entries list ---- */
+
+func (g *Group) searchPending(id ID) int {
+	return sort.Search(len(g.pending), func(i int) bool {
+		return !g.pending[i].ID.Less(id)
+	})
+}
+
+// PendingLen returns the number of pending entries
+func (g *Group) PendingLen() int {
+	return len(g.pending)
+}
+
+// GetPending returns the pending entry of id
+func (g *Group) GetPending(id ID) (*PendingEntry, bool) {
+	i := g.searchPending(id)
+	if i < len(g.pending) && g.pending[i].ID == id {
+		return g.pending[i], true
+	}
+	return nil, false
+}
+
+// AddPending adds a pending entry owned by consumer, the entry must not be pending
+func (g *Group) AddPending(id ID, consumer *Consumer, now int64) *PendingEntry {
+	entry := &PendingEntry{
+		ID:            id,
+		Consumer:      consumer,
+		DeliveryTime:  now,
+		DeliveryCount: 1,
+	}
+	i := g.searchPending(id)
+	g.pending = append(g.pending, nil)
+	copy(g.pending[i+1:], g.pending[i:])
+	g.pending[i] = entry
+	consumer.Pending++
+	return entry
+}
+
+// RemovePending acknowledges the entry of id, returns whether it is pending
+func (g *Group) RemovePending(id ID) bool {
+	i := g.searchPending(id)
+	if i >= len(g.pending) || g.pending[i].ID != id {
+		return false
+	}
+	g.pending[i].Consumer.Pending--
+	copy(g.pending[i:], g.pending[i+1:])
+	g.pending[len(g.pending)-1] = nil
+	g.pending = g.pending[:len(g.pending)-1]
+	return true
+}
+
+// Assign transfers the ownership of pending entry to consumer
+func (g *Group) Assign(entry *PendingEntry, consumer *Consumer) {
+	if entry.Consumer == consumer {
+		return
+	}
+	entry.Consumer.Pending--
+	entry.Consumer = consumer
+	consumer.Pending++
+}
+
+// ForEachPending iterates pending entries in [start, end] in ascending order, cb must not modify the list
+func (g *Group) ForEachPending(start, end ID, cb func(entry *PendingEntry) bool) {
+	for i := g.searchPending(start); i < len(g.pending); i++ {
+		entry := g.pending[i]
+		if end.Less(entry.ID) || !cb(entry) {
+			return
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+/*
+ * Stream stores entries in listpack-like nodes indexed by their master ID, like the rax of redis.
+ * A node packs entries into a byte slice:
+ *   flags | ms delta | seq | [field count] | [fields] | values
+ * IDs are delta encoded against the master ID, and field names are omitted
+ * if an entry has the same fields as the master entry, which is the first entry of node.
+ * Deleted entries are only flagged, a node is removed after all of its entries are deleted.
+ */
+
+const (
+	// nodeMaxEntries and nodeMaxBytes limit the size of node, like stream-node-max-entries and stream-node-max-bytes
+	nodeMaxEntries = 100
+	nodeMaxBytes   = 4096
+
+	flagDeleted    = 1 << 0
+	flagSameFields = 1 << 1
+)
+
+// Entry is an entry of stream
+type Entry struct {
+	ID ID
+	// Fields holds field value pairs
+	Fields [][]byte
+}
+
+type node struct {
+	master       ID
+	masterFields [][]byte
+	data         []byte
+	count        int // number of entries including deleted ones
+	deleted      int
+	lastID       ID
+}
+
+func sameFields(masterFields, fields [][]byte) bool {
+	if len(masterFields)*2 != len(fields) {
+		return false
+	}
+	for i, field := range masterFields {
+		if !bytes.Equal(field, fields[i*2]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *node) isFull() bool {
+	return n.count >= nodeMaxEntries || len(n.data) >= nodeMaxBytes
+}
+
+func (n *node) live() int {
+	return n.count - n.deleted
+}
+
+func (n *node) append(id ID, fields [][]byte) {
+	if n.count == 0 {
+		n.master = id
+		n.masterFields = make([][]byte, 0, len(fields)/2)
+		for i := 0; i < len(fields); i += 2 {
+			n.masterFields = append(n.masterFields, append([]byte(nil), fields[i]...))
+		}
+	}
+	var flags byte
+	same := sameFields(n.masterFields, fields)
+	if same {
+		flags |= flagSameFields
+	}
+	n.data = append(n.data, flags)
+	n.data = appendUvarint(n.data, id.Ms-n.master.Ms)
+	n.data = appendUvarint(n.data, id.Seq)
+	if !same {
+		n.data = appendUvarint(n.data, uint64(len(fields)/2))
+	}
+	for i := 0; i < len(fields); i += 2 {
+		if !same {
+			n.data = appendUvarint(n.data, uint64(len(fields[i])))
+			n.data = append(n.data, fields[i]...)
+		}
+		n.data = appendUvarint(n.data, uint64(len(fields[i+1])))
+		n.data = append(n.data, fields[i+1]...)
+	}
+	n.count++
+	n.lastID = id
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+// forEach iterates entries in node including deleted ones, offset is the position of flags of entry
+func (n *node) forEach(cb func(offset int, deleted bool, entry *Entry) bool) {
+	data := n.data
+	pos := 0
+	readUvarint := func() uint64 {
+		val, size := binary.Uvarint(data[pos:])
+		pos += size
+		return val
+	}
+	readBytes := func() []byte {
+		size := int(readUvarint())
+		b := data[pos : pos+size : pos+size]
+		pos += size
+		return b
+	}
+	for pos < len(data) {
+		offset := pos
+		flags := data[pos]
+		pos++
+		id := ID{Ms: n.master.Ms + readUvarint(), Seq: readUvarint()}
+		var fields [][]byte
+		if flags&flagSameFields > 0 {
+			fields = make([][]byte, 0, len(n.masterFields)*2)
+			for _, field := range n.masterFields {
+				fields = append(fields, field, readBytes())
+			}
+		} else {
+			fieldCount := int(readUvarint())
+			fields = make([][]byte, 0, fieldCount*2)
+			for i := 0; i < fieldCount; i++ {
+				field := readBytes()
+				fields = append(fields, field, readBytes())
+			}
+		}
+		if !cb(offset, flags&flagDeleted > 0, &Entry{ID: id, Fields: fields}) {
+			return
+		}
+	}
+}
+
+// Stream is an append-only log of entries, and the consumer groups reading it
+type Stream struct {
+	nodes        []*node // ordered by master ID
+	length       int64
+	lastID       ID
+	maxDeletedID ID
+	entriesAdded int64
+	groups       map[string]*Group
+}
+
+// New creates an empty stream
+func New() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+// Len returns the number of entries
+func (s *Stream) Len() int64 {
+	return s.length
+}
+
+// LastID returns the ID of the last entry ever added
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// MaxDeletedID returns the greatest ID of deleted entries
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// EntriesAdded returns the number of entries ever added
+func (s *Stream) EntriesAdded() int64 {
+	return s.entriesAdded
+}
+
+// NodeCount returns the number of nodes
+func (s *Stream) NodeCount() int {
+	return len(s.nodes)
+}
+
+// SetMeta sets the last ID, entries added and max deleted ID, which is used by XSETID
+func (s *Stream) SetMeta(lastID ID, entriesAdded int64, maxDeletedID ID) {
+	s.lastID = lastID
+	s.entriesAdded = entriesAdded
+	s.maxDeletedID = maxDeletedID
+}
+
+// NextID generates ID of a new entry at ms, seq is increased if ms is not greater than the last one,
+// ok is false if no ID is available
+func (s *Stream) NextID(ms uint64) (id ID, ok bool) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add appends an entry, id must be greater than the last ID
+func (s *Stream) Add(id ID, fields [][]byte) {
+	var tail *node
+	if len(s.nodes) > 0 {
+		tail = s.nodes[len(s.nodes)-1]
+	}
+	if tail == nil || tail.isFull() {
+		tail = &node{}
+		s.nodes = append(s.nodes, tail)
+	}
+	tail.append(id, fields)
+	s.length++
+	s.entriesAdded++
+	s.lastID = id
+}
+
+// seekNode returns index of the last node whose master ID is not greater than id
+func (s *Stream) seekNode(id ID) int {
+	i := sort.Search(len(s.nodes), func(i int) bool {
+		return id.Less(s.nodes[i].master)
+	})
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// ForEach iterates entries in [start, end] in ascending order, or descending order if desc
+func (s *Stream) ForEach(start, end ID, desc bool, cb func(entry *Entry) bool) {
+	if end.Less(start) || len(s.nodes) == 0 {
+		return
+	}
+	if !desc {
+		for i := s.seekNode(start); i < len(s.nodes); i++ {
+			stop := false
+			s.nodes[i].forEach(func(offset int, deleted bool, entry *Entry) bool {
+				if end.Less(entry.ID) {
+					stop = true
+					return false
+				}
+				if deleted || entry.ID.Less(start) {
+					return true
+				}
+				stop = !cb(entry)
+				return !stop
+			})
+			if stop {
+				return
+			}
+		}
+		return
+	}
+	for i := s.seekNode(end); i >= 0; i-- {
+		n := s.nodes[i]
+		if n.lastID.Less(start) {
+			return
+		}
+		entries := make([]*Entry, 0, n.live())
+		n.forEach(func(offset int, deleted bool, entry *Entry) bool {
+			if end.Less(entry.ID) {
+				return false
+			}
+			if !deleted && !entry.ID.Less(start) {
+				entries = append(entries, entry)
+			}
+			return true
+		})
+		for j := len(entries) - 1; j >= 0; j-- {
+			if !cb(entries[j]) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns at most count entries in [start, end], count <= 0 means no limit
+func (s *Stream) Range(start, end ID, count int64, desc bool) []*Entry {
+	var entries []*Entry
+	s.ForEach(start, end, desc, func(entry *Entry) bool {
+		entries = append(entries, entry)
+		return count <= 0 || int64(len(entries)) < count
+	})
+	return entries
+}
+
+// Get returns the entry of id
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	entries := s.Range(id, id, 1, false)
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return entries[0], true
+}
+
+// First returns the first entry
+func (s *Stream) First() (*Entry, bool) {
+	entries := s.Range(MinID, MaxID, 1, false)
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return entries[0], true
+}
+
+// Last returns the last entry
+func (s *Stream) Last() (*Entry, bool) {
+	entries := s.Range(MinID, MaxID, 1, true)
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return entries[0], true
+}
+
+// FirstID returns ID of the first entry, or 0-0 if stream is empty
+func (s *Stream) FirstID() ID {
+	if entry, ok := s.First(); ok {
+		return entry.ID
+	}
+	return MinID
+}
+
+// Delete removes entry of id, returns whether it is found
+func (s *Stream) Delete(id ID) bool {
+	if len(s.nodes) == 0 {
+		return false
+	}
+	i := s.seekNode(id)
+	n := s.nodes[i]
+	found := false
+	n.forEach(func(offset int, deleted bool, entry *Entry) bool {
+		if entry.ID == id {
+			if !deleted {
+				n.data[offset] |= flagDeleted
+				found = true
+			}
+			return false
+		}
+		return entry.ID.Less(id)
+	})
+	if !found {
+		return false
+	}
+	n.deleted++
+	s.length--
+	if n.live() == 0 {
+		s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+	}
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// trim removes entries from the head while shouldTrim returns true, approximate trimming only removes whole nodes.
+// limit is the max number of entries to remove, limit <= 0 means no limit
+func (s *Stream) trim(shouldTrim func(id ID, length int64) bool, approx bool, limit int64) int64 {
+	var removed int64
+	for len(s.nodes) > 0 {
+		n := s.nodes[0]
+		if limit > 0 && removed+int64(n.count) > limit {
+			break
+		}
+		// whole node can be removed if its last entry should be removed
+		if shouldTrim(n.lastID, s.length-int64(n.live())+1) {
+			removed += int64(n.live())
+			s.length -= int64(n.live())
+			s.nodes = s.nodes[1:]
+			continue
+		}
+		if approx {
+			break
+		}
+		n.forEach(func(offset int, deleted bool, entry *Entry) bool {
+			if deleted {
+				return true
+			}
+			if !shouldTrim(entry.ID, s.length) {
+				return false
+			}
+			n.data[offset] |= flagDeleted
+			n.deleted++
+			s.length--
+			removed++
+			return true
+		})
+		break
+	}
+	return removed
+}
+
+// TrimMaxLen removes the oldest entries until the length is at most maxLen, returns the number of removed entries
+func (s *Stream) TrimMaxLen(maxLen int64, approx bool, limit int64) int64 {
+	return s.trim(func(id ID, length int64) bool {
+		return length > maxLen
+	}, approx, limit)
+}
+
+// TrimMinID removes entries whose ID is less than minID, returns the number of removed entries
+func (s *Stream) TrimMinID(minID ID, approx bool, limit int64) int64 {
+	return s.trim(func(id ID, length int64) bool {
+		return id.Less(minID)
+	}, approx, limit)
+}
+
+// hasTombstones returns whether deleted entries may exist in [start, last ID], start is the first ID if nil
+func (s *Stream) hasTombstones(start *ID) bool {
+	if s.length == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	startID := s.FirstID()
+	if start != nil {
+		startID = *start
+	}
+	return !s.maxDeletedID.Less(startID) && !s.lastID.Less(s.maxDeletedID)
+}
+
+// EstimateEntriesRead returns the number of entries ever added before id (inclusive), -1 if it can not be known
+func (s *Stream) EstimateEntriesRead(id ID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	cmpLast := id.Compare(s.lastID)
+	if s.length == 0 && cmpLast <= 0 {
+		return s.entriesAdded
+	}
+	if cmpLast == 0 {
+		return s.entriesAdded
+	} else if cmpLast > 0 {
+		return -1
+	}
+	firstID := s.FirstID()
+	cmpFirst := id.Compare(firstID)
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Less(firstID) {
+		// no tombstone
+		if cmpFirst < 0 {
+			return s.entriesAdded - s.length
+		} else if cmpFirst == 0 {
+			return s.entriesAdded - s.length + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+)
+
+func makeStream(size int) *Stream {
+	s := New()
+	for i := 1; i <= size; i++ {
+		fields := [][]byte{[]byte("f"), []byte(strconv.Itoa(i))}
+		if i%10 == 0 {
+			fields = append(fields, []byte("extra"), []byte("x"))
+		}
+		s.Add(ID{Ms: uint64(i / 3), Seq: uint64(i % 3)}, fields)
+	}
+	return s
+}
+
+func TestRange(t *testing.T) {
+	s := makeStream(1000)
+	if s.Len() != 1000 || s.NodeCount() < 10 {
+		t.Fatalf("unexpected len %d or nodes %d", s.Len(), s.NodeCount())
+	}
+	entries := s.Range(MinID, MaxID, 0, false)
+	if len(entries) != 1000 {
+		t.Fatalf("expect 1000 entries, actual %d", len(entries))
+	}
+	for i, entry := range entries {
+		if string(entry.Fields[1]) != strconv.Itoa(i+1) {
+			t.Fatalf("wrong entry %d", i)
+		}
+		if (i+1)%10 == 0 && len(entry.Fields) != 4 {
+			t.Fatalf("wrong fields of entry %d", i)
+		}
+	}
+	entries = s.Range(ID{Ms: 100}, ID{Ms: 200, Seq: 1}, 5, true)
+	if len(entries) != 5 || entries[0].ID != (ID{Ms: 200, Seq: 1}) || entries[4].ID != (ID{Ms: 199, Seq: 0}) {
+		t.Errorf("wrong reversed range %v", entries)
+	}
+	entries = s.Range(ID{Ms: 100, Seq: 1}, ID{Ms: 101}, 0, false)
+	if len(entries) != 3 {
+		t.Errorf("expect 3 entries, actual %d", len(entries))
+	}
+}
+
+func TestDeleteAndTrim(t *testing.T) {
+	s := makeStream(300)
+	if !s.Delete(ID{Ms: 10, Seq: 1}) || s.Delete(ID{Ms: 10, Seq: 1}) {
+		t.Error("wrong delete result")
+	}
+	if _, ok := s.Get(ID{Ms: 10, Seq: 1}); ok {
+		t.Error("entry should be deleted")
+	}
+	if s.Len() != 299 || s.MaxDeletedID() != (ID{Ms: 10, Seq: 1}) {
+		t.Error("wrong stream meta")
+	}
+
+	if removed := s.TrimMaxLen(250, true, 0); removed != 0 {
+		t.Errorf("approximate trim should keep whole nodes, removed %d", removed)
+	}
+	if removed := s.TrimMaxLen(200, true, 0); removed != 99 || s.Len() != 200 {
+		t.Errorf("approximate trim should remove whole nodes, removed %d", removed)
+	}
+	if removed := s.TrimMaxLen(150, false, 0); removed != 50 || s.Len() != 150 {
+		t.Errorf("expect 50 removed, actual %d", removed)
+	}
+	first := s.FirstID()
+	if removed := s.TrimMinID(ID{Ms: first.Ms + 10}, false, 0); removed != 29 {
+		t.Errorf("expect 29 removed, actual %d", removed)
+	}
+	if s.FirstID() != (ID{Ms: first.Ms + 10}) {
+		t.Errorf("wrong first id %s", s.FirstID())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	s := makeStream(10)
+	group, _ := s.CreateGroup("g", MinID, 0)
+	if _, ok := s.CreateGroup("g", MinID, 0); ok {
+		t.Error("group should exist")
+	}
+	alice, _ := group.CreateConsumer("alice", 0)
+	bob, _ := group.CreateConsumer("bob", 0)
+	entries := s.ReadGroup(group, alice, 4, false, 100)
+	if len(entries) != 4 || group.LastID != entries[3].ID || group.EntriesRead != 4 {
+		t.Fatal("wrong read result")
+	}
+	if lag, ok := s.Lag(group); !ok || lag != 6 {
+		t.Errorf("expect lag 6, actual %d", lag)
+	}
+	s.ReadGroup(group, bob, 0, false, 200)
+	if group.PendingLen() != 10 || alice.Pending != 4 || bob.Pending != 6 {
+		t.Fatal("wrong pending entries")
+	}
+	pending, _ := group.GetPending(entries[0].ID)
+	group.Assign(pending, bob)
+	if !group.RemovePending(entries[1].ID) || group.RemovePending(entries[1].ID) {
+		t.Error("wrong ack result")
+	}
+	if alice.Pending != 2 || bob.Pending != 7 {
+		t.Error("wrong pending count")
+	}
+	if group.DeleteConsumer("bob") != 7 || group.PendingLen() != 2 {
+		t.Error("wrong pending entries after deleting consumer")
+	}
+	var ids []ID
+	group.ForEachPending(MinID, MaxID, func(entry *PendingEntry) bool {
+		ids = append(ids, entry.ID)
+		return true
+	})
+	if len(ids) != 2 || ids[0] != entries[2].ID || ids[1] != entries[3].ID {
+		t.Errorf("wrong pending entries %v", ids)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("5", 0)
+	if err != nil || id != (ID{Ms: 5}) {
+		t.Error("wrong id")
+	}
+	id, err = ParseID("5-3", 0)
+	if err != nil || id != (ID{Ms: 5, Seq: 3}) || id.String() != "5-3" {
+		t.Error("wrong id")
+	}
+	for _, s := range []string{"", "-", "a-1", "1-", "-1", "1-2-3"} {
+		if _, err := ParseID(s, 0); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+	if next, _ := (ID{Ms: 1, Seq: MaxID.Seq}).Next(); next != (ID{Ms: 2}) {
+		t.Error("wrong next id")
+	}
+}
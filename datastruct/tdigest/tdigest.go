@@ -0,0 +1,346 @@
+package tdigest
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+/*
+ * Digest is a merging t-digest by Ted Dunning for estimating quantiles.
+ * Values are buffered and merged into centroids in batches. A centroid is merged with its neighbour
+ * only if the merged weight is under a limit proportional to q * (1 - q), where q is its quantile,
+ * so that centroids near both tails are small and quantiles near the tails are accurate.
+ * Quantiles are interpolated between the centers of adjacent centroids, min and max are kept exactly.
+ *
+ * Queries never modify the digest: buffered values are merged into a copy if any.
+ */
+
+const (
+	// bufferFactor is the ratio of the buffer size to the compression
+	bufferFactor = 5
+
+	headerSize   = 8 + 8 + 8 + 8 + 4
+	centroidSize = 8 + 8
+)
+
+// ErrBadData is returned when restoring from corrupted data
+var ErrBadData = errors.New("ERR received bad data")
+
+// Centroid is the mean of a cluster of values and their count
+type Centroid struct {
+	Mean   float64
+	Weight float64
+}
+
+// Digest is a t-digest
+type Digest struct {
+	compression float64
+	// centroids are merged centroids in ascending order of mean
+	centroids      []Centroid
+	mergedWeight   float64
+	unmerged       []Centroid
+	unmergedWeight float64
+	min, max       float64
+	compressions   int64
+}
+
+// New creates an empty digest, larger compression gives more accurate results with more centroids
+func New(compression float64) *Digest {
+	return &Digest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Compression returns the compression parameter
+func (d *Digest) Compression() float64 {
+	return d.compression
+}
+
+// Capacity returns the size of the buffer of unmerged values
+func (d *Digest) Capacity() int {
+	return int(d.compression * bufferFactor)
+}
+
+// Add adds a value
+func (d *Digest) Add(value float64) {
+	d.AddCentroid(Centroid{Mean: value, Weight: 1})
+}
+
+// AddCentroid adds a cluster of values, whose min and max are regarded as the mean
+func (d *Digest) AddCentroid(c Centroid) {
+	if c.Weight <= 0 {
+		return
+	}
+	d.unmerged = append(d.unmerged, c)
+	d.unmergedWeight += c.Weight
+	d.min = math.Min(d.min, c.Mean)
+	d.max = math.Max(d.max, c.Mean)
+	if len(d.unmerged) >= d.Capacity() {
+		d.Compress()
+	}
+}
+
+// Merge adds all values of src
+func (d *Digest) Merge(src *Digest) {
+	if src.Count() == 0 {
+		return
+	}
+	for _, c := range src.view() {
+		d.AddCentroid(c)
+	}
+	// min and max of src are exact
+	d.min = math.Min(d.min, src.min)
+	d.max = math.Max(d.max, src.max)
+}
+
+// Compress merges buffered values into centroids
+func (d *Digest) Compress() {
+	if len(d.unmerged) == 0 {
+		return
+	}
+	d.centroids = d.merge()
+	d.mergedWeight += d.unmergedWeight
+	d.unmerged = d.unmerged[:0]
+	d.unmergedWeight = 0
+	d.compressions++
+}
+
+// merge returns centroids merged with buffered values without modifying d
+func (d *Digest) merge() []Centroid {
+	all := make([]Centroid, 0, len(d.centroids)+len(d.unmerged))
+	all = append(all, d.centroids...)
+	all = append(all, d.unmerged...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Mean < all[j].Mean
+	})
+	total := d.mergedWeight + d.unmergedWeight
+	result := make([]Centroid, 0, len(all))
+	cur := all[0]
+	weightSoFar := 0.0
+	for _, next := range all[1:] {
+		proposed := cur.Weight + next.Weight
+		q0 := weightSoFar / total
+		q2 := (weightSoFar + proposed) / total
+		limit := 4 * total * math.Min(q0*(1-q0), q2*(1-q2)) / d.compression
+		if proposed <= limit {
+			cur.Mean += (next.Mean - cur.Mean) * next.Weight / proposed
+			cur.Weight = proposed
+			continue
+		}
+		weightSoFar += cur.Weight
+		result = append(result, cur)
+		cur = next
+	}
+	return append(result, cur)
+}
+
+// view returns centroids including buffered values
+func (d *Digest) view() []Centroid {
+	if len(d.unmerged) == 0 {
+		return d.centroids
+	}
+	return d.merge()
+}
+
+// Count returns the number of added values
+func (d *Digest) Count() float64 {
+	return d.mergedWeight + d.unmergedWeight
+}
+
+// Min returns the min value, NaN if the digest is empty
+func (d *Digest) Min() float64 {
+	if d.Count() == 0 {
+		return math.NaN()
+	}
+	return d.min
+}
+
+// Max returns the max value, NaN if the digest is empty
+func (d *Digest) Max() float64 {
+	if d.Count() == 0 {
+		return math.NaN()
+	}
+	return d.max
+}
+
+// MergedNodes returns the number of merged centroids
+func (d *Digest) MergedNodes() int {
+	return len(d.centroids)
+}
+
+// UnmergedNodes returns the number of buffered values
+func (d *Digest) UnmergedNodes() int {
+	return len(d.unmerged)
+}
+
+// MergedWeight returns the weight of merged centroids
+func (d *Digest) MergedWeight() float64 {
+	return d.mergedWeight
+}
+
+// UnmergedWeight returns the weight of buffered values
+func (d *Digest) UnmergedWeight() float64 {
+	return d.unmergedWeight
+}
+
+// Compressions returns the times of merging buffered values
+func (d *Digest) Compressions() int64 {
+	return d.compressions
+}
+
+// point is a vertex of the piecewise linear function from rank to value
+type point struct {
+	rank, value float64
+}
+
+// points returns vertices at min, the center of each centroid and max
+func (d *Digest) points() []point {
+	centroids := d.view()
+	points := make([]point, 0, len(centroids)+2)
+	points = append(points, point{rank: 0, value: d.min})
+	weightSoFar := 0.0
+	for _, c := range centroids {
+		points = append(points, point{rank: weightSoFar + c.Weight/2, value: c.Mean})
+		weightSoFar += c.Weight
+	}
+	return append(points, point{rank: weightSoFar, value: d.max})
+}
+
+// Quantile returns the estimated value at quantile q in [0, 1], NaN if the digest is empty
+func (d *Digest) Quantile(q float64) float64 {
+	total := d.Count()
+	if total == 0 {
+		return math.NaN()
+	}
+	points := d.points()
+	index := q * total
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		if index > b.rank {
+			continue
+		}
+		if b.rank == a.rank {
+			return a.value
+		}
+		return a.value + (b.value-a.value)*(index-a.rank)/(b.rank-a.rank)
+	}
+	return d.max
+}
+
+// CDF returns the estimated fraction of values not greater than value, NaN if the digest is empty
+func (d *Digest) CDF(value float64) float64 {
+	total := d.Count()
+	if total == 0 {
+		return math.NaN()
+	}
+	if value < d.min {
+		return 0
+	}
+	if value > d.max {
+		return 1
+	}
+	if d.min == d.max {
+		return 0.5
+	}
+	points := d.points()
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		if value >= b.value {
+			continue
+		}
+		if value == a.value {
+			// the middle of vertices at value
+			first := i - 1
+			for first > 0 && points[first-1].value == value {
+				first--
+			}
+			return (points[first].rank + a.rank) / 2 / total
+		}
+		return (a.rank + (b.rank-a.rank)*(value-a.value)/(b.value-a.value)) / total
+	}
+	return 1
+}
+
+/* ---- dump and restore ----
+ * a digest is dumped as a header of its parameters, followed by centroids including buffered values
+ */
+
+// Header returns the encoded parameters
+func (d *Digest) Header() []byte {
+	buf := make([]byte, headerSize)
+	binary.LittleEndian.PutUint64(buf[0:], math.Float64bits(d.compression))
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(d.min))
+	binary.LittleEndian.PutUint64(buf[16:], math.Float64bits(d.max))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(d.compressions))
+	binary.LittleEndian.PutUint32(buf[32:], uint32(len(d.view())))
+	return buf
+}
+
+// FromHeader creates a digest of the given header with all centroids empty, which are filled by WriteData
+func FromHeader(header []byte) (*Digest, error) {
+	if len(header) != headerSize {
+		return nil, ErrBadData
+	}
+	d := New(math.Float64frombits(binary.LittleEndian.Uint64(header[0:])))
+	if !(d.compression > 0) {
+		return nil, ErrBadData
+	}
+	d.min = math.Float64frombits(binary.LittleEndian.Uint64(header[8:]))
+	d.max = math.Float64frombits(binary.LittleEndian.Uint64(header[16:]))
+	d.compressions = int64(binary.LittleEndian.Uint64(header[24:]))
+	d.centroids = make([]Centroid, binary.LittleEndian.Uint32(header[32:]))
+	return d, nil
+}
+
+// DataLen returns the number of bytes of centroids
+func (d *Digest) DataLen() int {
+	return len(d.view()) * centroidSize
+}
+
+// ReadData returns at most size bytes of centroids from offset
+func (d *Digest) ReadData(offset, size int) []byte {
+	centroids := d.view()
+	end := offset + size
+	if end > len(centroids)*centroidSize {
+		end = len(centroids) * centroidSize
+	}
+	buf := make([]byte, 0, end-offset)
+	var tmp [centroidSize]byte
+	for i := offset / centroidSize; i*centroidSize < end; i++ {
+		binary.LittleEndian.PutUint64(tmp[0:], math.Float64bits(centroids[i].Mean))
+		binary.LittleEndian.PutUint64(tmp[8:], math.Float64bits(centroids[i].Weight))
+		from, to := 0, centroidSize
+		if start := i * centroidSize; start < offset {
+			from = offset - start
+		}
+		if start := i * centroidSize; start+to > end {
+			to = end - start
+		}
+		buf = append(buf, tmp[from:to]...)
+	}
+	return buf
+}
+
+// WriteData overwrites merged centroids from offset, data must be made of whole centroids
+func (d *Digest) WriteData(offset int, data []byte) error {
+	if offset < 0 || offset%centroidSize != 0 || len(data)%centroidSize != 0 || offset+len(data) > len(d.centroids)*centroidSize {
+		return ErrBadData
+	}
+	for i := offset / centroidSize; len(data) > 0; i++ {
+		c := Centroid{
+			Mean:   math.Float64frombits(binary.LittleEndian.Uint64(data[0:])),
+			Weight: math.Float64frombits(binary.LittleEndian.Uint64(data[8:])),
+		}
+		if !(c.Weight >= 0) {
+			return ErrBadData
+		}
+		d.mergedWeight += c.Weight - d.centroids[i].Weight
+		d.centroids[i] = c
+		data = data[centroidSize:]
+	}
+	return nil
+}
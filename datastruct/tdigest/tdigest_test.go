@@ -0,0 +1,74 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantileAndCDF(t *testing.T) {
+	d := New(100)
+	perm := rand.Perm(100000)
+	for _, v := range perm {
+		d.Add(float64(v))
+	}
+	d.Compress()
+	if d.Count() != 100000 || d.Min() != 0 || d.Max() != 99999 {
+		t.Fatalf("wrong count %v min %v max %v", d.Count(), d.Min(), d.Max())
+	}
+	if d.MergedNodes() > 1000 || d.UnmergedNodes() != 0 {
+		t.Errorf("too many centroids %d", d.MergedNodes())
+	}
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		expect := q * 100000
+		if actual := d.Quantile(q); math.Abs(actual-expect) > 100000*0.01 {
+			t.Errorf("quantile %v: expect %v, actual %v", q, expect, actual)
+		}
+		if actual := d.CDF(expect); math.Abs(actual-q) > 0.01 {
+			t.Errorf("cdf %v: expect %v, actual %v", expect, q, actual)
+		}
+	}
+	if d.Quantile(0) != 0 || d.Quantile(1) != 99999 || d.CDF(-1) != 0 || d.CDF(100000) != 1 {
+		t.Error("wrong bounds")
+	}
+	if !math.IsNaN(New(100).Quantile(0.5)) || !math.IsNaN(New(100).CDF(1)) {
+		t.Error("expect NaN for empty digest")
+	}
+}
+
+func TestMergeAndDump(t *testing.T) {
+	a, b := New(50), New(50)
+	for i := 0; i < 1000; i++ {
+		a.Add(float64(i))
+		b.Add(float64(i + 1000))
+	}
+	// values of b are buffered
+	a.Compress()
+	dst := New(100)
+	dst.Merge(a)
+	dst.Merge(b)
+	if dst.Count() != 2000 || dst.Min() != 0 || dst.Max() != 1999 {
+		t.Fatalf("wrong merged digest %v %v %v", dst.Count(), dst.Min(), dst.Max())
+	}
+	if median := dst.Quantile(0.5); math.Abs(median-1000) > 20 {
+		t.Errorf("wrong median %v", median)
+	}
+
+	restored, err := FromHeader(dst.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < dst.DataLen(); offset += 64 {
+		if err := restored.WriteData(offset, dst.ReadData(offset, 64)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// buffered values of dst are dumped
+	if dst.UnmergedNodes() == 0 || restored.Count() != 2000 || restored.Quantile(0.5) != dst.Quantile(0.5) ||
+		restored.CDF(300) != dst.CDF(300) || restored.Compressions() != dst.Compressions() {
+		t.Error("wrong restored digest")
+	}
+	if err := restored.WriteData(8, make([]byte, 16)); err != ErrBadData {
+		t.Error("expect bad data for unaligned chunk")
+	}
+}
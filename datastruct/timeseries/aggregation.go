@@ -0,0 +1,153 @@
+package timeseries
+
+import (
+	"math"
+	"strings"
+)
+
+// Aggregation is the function reducing samples in a bucket into a value
+type Aggregation int
+
+// aggregation functions
+const (
+	AggAvg Aggregation = iota
+	AggSum
+	AggMin
+	AggMax
+	AggCount
+	AggFirst
+	AggLast
+	AggRange
+)
+
+var aggregationNames = [...]string{"avg", "sum", "min", "max", "count", "first", "last", "range"}
+
+// ParseAggregation parses aggregation name case-insensitively
+func ParseAggregation(name string) (Aggregation, bool) {
+	name = strings.ToLower(name)
+	for i, n := range aggregationNames {
+		if n == name {
+			return Aggregation(i), true
+		}
+	}
+	return 0, false
+}
+
+func (agg Aggregation) String() string {
+	return aggregationNames[agg]
+}
+
+type aggregator struct {
+	agg         Aggregation
+	count       int
+	sum         float64
+	min, max    float64
+	first, last float64
+}
+
+func (a *aggregator) add(value float64) {
+	if a.count == 0 {
+		a.min, a.max, a.first = value, value, value
+	}
+	a.count++
+	a.sum += value
+	a.min = math.Min(a.min, value)
+	a.max = math.Max(a.max, value)
+	a.last = value
+}
+
+// value returns the result of aggregated samples, NaN if no sample is aggregated except count and sum
+func (a *aggregator) value() float64 {
+	switch a.agg {
+	case AggCount:
+		return float64(a.count)
+	case AggSum:
+		return a.sum
+	}
+	if a.count == 0 {
+		return math.NaN()
+	}
+	switch a.agg {
+	case AggAvg:
+		return a.sum / float64(a.count)
+	case AggMin:
+		return a.min
+	case AggMax:
+		return a.max
+	case AggFirst:
+		return a.first
+	case AggLast:
+		return a.last
+	case AggRange:
+		return a.max - a.min
+	}
+	return math.NaN()
+}
+
+// BucketTimestamp decides the timestamp reported for a bucket
+type BucketTimestamp int
+
+// bucket timestamps
+const (
+	BucketStart BucketTimestamp = iota
+	BucketEnd
+	BucketMid
+)
+
+// AggregateOptions describes how samples are aggregated into buckets
+type AggregateOptions struct {
+	Aggregation    Aggregation
+	BucketDuration int64
+	// Align is a timestamp which is the start of a bucket
+	Align           int64
+	BucketTimestamp BucketTimestamp
+	// Empty reports buckets without samples between the first and the last bucket
+	Empty bool
+}
+
+// bucketStart returns the start of the bucket containing timestamp
+func bucketStart(timestamp, duration, align int64) int64 {
+	offset := (timestamp - align) % duration
+	if offset < 0 {
+		offset += duration
+	}
+	return timestamp - offset
+}
+
+func (opt *AggregateOptions) reportedTimestamp(start int64) int64 {
+	switch opt.BucketTimestamp {
+	case BucketEnd:
+		return start + opt.BucketDuration
+	case BucketMid:
+		return start + opt.BucketDuration/2
+	}
+	return start
+}
+
+// Aggregate reduces samples in ascending order into a sample per bucket
+func Aggregate(samples []Sample, opt *AggregateOptions) []Sample {
+	var result []Sample
+	if len(samples) == 0 {
+		return result
+	}
+	current := bucketStart(samples[0].Timestamp, opt.BucketDuration, opt.Align)
+	a := &aggregator{agg: opt.Aggregation}
+	for _, sample := range samples {
+		start := bucketStart(sample.Timestamp, opt.BucketDuration, opt.Align)
+		if start != current {
+			result = append(result, Sample{Timestamp: opt.reportedTimestamp(current), Value: a.value()})
+			if opt.Empty {
+				for empty := current + opt.BucketDuration; empty < start; empty += opt.BucketDuration {
+					result = append(result, Sample{
+						Timestamp: opt.reportedTimestamp(empty),
+						Value:     (&aggregator{agg: opt.Aggregation}).value(),
+					})
+				}
+			}
+			current = start
+			a = &aggregator{agg: opt.Aggregation}
+		}
+		a.add(sample.Value)
+	}
+	return append(result, Sample{Timestamp: opt.reportedTimestamp(current), Value: a.value()})
+}
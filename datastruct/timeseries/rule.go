@@ -0,0 +1,145 @@
+package timeseries
+
+/*
+ * A compaction rule aggregates samples of the source series into the destination series.
+ * The source series tracks the latest bucket, the bucket is aggregated into the destination
+ * after a sample of a later bucket is added. Adding a sample into an earlier bucket
+ * aggregates that bucket again.
+ */
+
+// Rule is a compaction rule of source series
+type Rule struct {
+	DestKey        string
+	Aggregation    Aggregation
+	BucketDuration int64
+	AlignTimestamp int64
+
+	// current is the start of the latest bucket, valid if hasCurrent
+	current    int64
+	hasCurrent bool
+}
+
+// Compaction is a sample to be added into the destination series of rule
+type Compaction struct {
+	DestKey string
+	Sample  Sample
+}
+
+// Rules returns copies of compaction rules
+func (s *Series) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]Rule, len(s.rules))
+	for i, rule := range s.rules {
+		rules[i] = *rule
+	}
+	return rules
+}
+
+// HasRule returns whether series has a rule compacting into destKey
+func (s *Series) HasRule(destKey string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rule := range s.rules {
+		if rule.DestKey == destKey {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRule adds a compaction rule, samples in the bucket of the latest sample will be compacted
+func (s *Series) AddRule(destKey string, agg Aggregation, bucketDuration, alignTimestamp int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule := &Rule{
+		DestKey:        destKey,
+		Aggregation:    agg,
+		BucketDuration: bucketDuration,
+		AlignTimestamp: alignTimestamp,
+	}
+	if n := len(s.chunks); n > 0 {
+		rule.current = bucketStart(s.chunks[n-1].last(), bucketDuration, alignTimestamp)
+		rule.hasCurrent = true
+	}
+	s.rules = append(s.rules, rule)
+}
+
+// DeleteRule removes the rule compacting into destKey, returns whether it exists
+func (s *Series) DeleteRule(destKey string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rule := range s.rules {
+		if rule.DestKey == destKey {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SourceKey returns the key of series compacted into this one
+func (s *Series) SourceKey() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sourceKey
+}
+
+// SetSourceKey sets the key of series compacted into this one, empty means none
+func (s *Series) SetSourceKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourceKey = key
+}
+
+// AddAndCompact adds a sample like Add, and returns samples of finished buckets affected by it.
+// A bucket finished by the sample is aggregated before adding, so samples expiring because of the
+// new sample are still compacted.
+func (s *Series) AddAndCompact(timestamp int64, value float64, policy DuplicatePolicy) ([]Compaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := make([]*Compaction, len(s.rules))
+	for i, rule := range s.rules {
+		start := bucketStart(timestamp, rule.BucketDuration, rule.AlignTimestamp)
+		if rule.hasCurrent && start > rule.current {
+			finished[i] = s.aggregateBucket(rule, rule.current)
+		}
+	}
+	if err := s.add(timestamp, value, policy); err != nil {
+		return nil, err
+	}
+	var result []Compaction
+	for i, rule := range s.rules {
+		start := bucketStart(timestamp, rule.BucketDuration, rule.AlignTimestamp)
+		var c *Compaction
+		switch {
+		case !rule.hasCurrent:
+			rule.current, rule.hasCurrent = start, true
+		case start > rule.current:
+			c, rule.current = finished[i], start
+		case start < rule.current:
+			c = s.aggregateBucket(rule, start)
+		}
+		// c is nil if the latest bucket is not finished
+		if c != nil {
+			result = append(result, *c)
+		}
+	}
+	return result, nil
+}
+
+// aggregateBucket aggregates samples of the bucket beginning at start, returns nil if the bucket is empty
+func (s *Series) aggregateBucket(rule *Rule, start int64) *Compaction {
+	samples := s.rangeSamples(start, start+rule.BucketDuration-1)
+	if len(samples) == 0 {
+		return nil
+	}
+	a := &aggregator{agg: rule.Aggregation}
+	for _, sample := range samples {
+		a.add(sample.Value)
+	}
+	return &Compaction{
+		DestKey: rule.DestKey,
+		Sample:  Sample{Timestamp: start, Value: a.value()},
+	}
+}
@@ -0,0 +1,328 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * Series stores samples ordered by timestamp in chunks like RedisTimeSeries.
+ * Samples are usually appended to the last chunk, a chunk is split when a sample is inserted into a full chunk.
+ * Retention is relative to the latest timestamp: expired samples are hidden from queries at once,
+ * and removed physically by Trim.
+ *
+ * Series is safe for concurrent use. Compaction rules write the destination series
+ * while only the source key is locked, so the destination can not rely on key locks.
+ */
+
+// chunkMaxSamples limits the number of samples of a chunk
+const chunkMaxSamples = 256
+
+var (
+	// ErrTooOld is returned when adding a sample older than retention
+	ErrTooOld = errors.New("ERR TSDB: Timestamp is older than retention")
+	// ErrDuplicateBlocked is returned when updating a sample under BLOCK policy
+	ErrDuplicateBlocked = errors.New("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+)
+
+// Sample is a data point of series
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Label is a name value pair attached to series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// DuplicatePolicy decides how to handle a sample whose timestamp exists
+type DuplicatePolicy int
+
+// duplicate policies, PolicyNone means using the policy of series
+const (
+	PolicyNone DuplicatePolicy = iota
+	PolicyBlock
+	PolicyFirst
+	PolicyLast
+	PolicyMin
+	PolicyMax
+	PolicySum
+)
+
+var policyNames = [...]string{"", "block", "first", "last", "min", "max", "sum"}
+
+// ParseDuplicatePolicy parses policy name case-insensitively
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, bool) {
+	name = strings.ToLower(name)
+	for i := PolicyBlock; i <= PolicySum; i++ {
+		if policyNames[i] == name {
+			return i, true
+		}
+	}
+	return PolicyNone, false
+}
+
+func (p DuplicatePolicy) String() string {
+	return policyNames[p]
+}
+
+// resolve returns the value kept after adding value into a timestamp having old value
+func (p DuplicatePolicy) resolve(old, value float64) (float64, error) {
+	switch p {
+	case PolicyFirst:
+		return old, nil
+	case PolicyLast:
+		return value, nil
+	case PolicyMin:
+		return math.Min(old, value), nil
+	case PolicyMax:
+		return math.Max(old, value), nil
+	case PolicySum:
+		return old + value, nil
+	}
+	return 0, ErrDuplicateBlocked
+}
+
+type chunk struct {
+	samples []Sample
+}
+
+func (c *chunk) first() int64 {
+	return c.samples[0].Timestamp
+}
+
+func (c *chunk) last() int64 {
+	return c.samples[len(c.samples)-1].Timestamp
+}
+
+// Series is a time series
+type Series struct {
+	mu     sync.RWMutex
+	chunks []*chunk
+	count  int
+	// retention is the max age of samples in milliseconds compared to the latest timestamp, 0 means forever
+	retention       int64
+	duplicatePolicy DuplicatePolicy
+	labels          []Label
+	rules           []*Rule
+	// sourceKey is the key of series compacted into this one
+	sourceKey string
+}
+
+// New creates an empty series
+func New(retention int64, policy DuplicatePolicy, labels []Label) *Series {
+	if policy == PolicyNone {
+		policy = PolicyBlock
+	}
+	return &Series{
+		retention:       retention,
+		duplicatePolicy: policy,
+		labels:          labels,
+	}
+}
+
+// minTimestamp returns the min timestamp of live samples
+func (s *Series) minTimestamp() int64 {
+	if s.retention == 0 || len(s.chunks) == 0 {
+		return math.MinInt64
+	}
+	last := s.chunks[len(s.chunks)-1].last()
+	if last < math.MinInt64+s.retention {
+		return math.MinInt64
+	}
+	return last - s.retention
+}
+
+// Add adds a sample, policy overrides the duplicate policy of series unless it is PolicyNone
+func (s *Series) Add(timestamp int64, value float64, policy DuplicatePolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(timestamp, value, policy)
+}
+
+func (s *Series) add(timestamp int64, value float64, policy DuplicatePolicy) error {
+	if timestamp < s.minTimestamp() {
+		return ErrTooOld
+	}
+	if policy == PolicyNone {
+		policy = s.duplicatePolicy
+	}
+	n := len(s.chunks)
+	if n == 0 || timestamp > s.chunks[n-1].last() {
+		// fast path of appending
+		if n == 0 || len(s.chunks[n-1].samples) >= chunkMaxSamples {
+			s.chunks = append(s.chunks, &chunk{samples: make([]Sample, 0, chunkMaxSamples)})
+			n++
+		}
+		last := s.chunks[n-1]
+		last.samples = append(last.samples, Sample{Timestamp: timestamp, Value: value})
+		s.count++
+		return nil
+	}
+	// the last chunk whose first sample is not after timestamp, or the first chunk
+	ci := sort.Search(n, func(i int) bool {
+		return s.chunks[i].first() > timestamp
+	}) - 1
+	if ci < 0 {
+		ci = 0
+	}
+	c := s.chunks[ci]
+	si := sort.Search(len(c.samples), func(i int) bool {
+		return c.samples[i].Timestamp >= timestamp
+	})
+	if si < len(c.samples) && c.samples[si].Timestamp == timestamp {
+		resolved, err := policy.resolve(c.samples[si].Value, value)
+		if err != nil {
+			return err
+		}
+		c.samples[si].Value = resolved
+		return nil
+	}
+	c.samples = append(c.samples, Sample{})
+	copy(c.samples[si+1:], c.samples[si:])
+	c.samples[si] = Sample{Timestamp: timestamp, Value: value}
+	s.count++
+	if len(c.samples) > chunkMaxSamples {
+		half := len(c.samples) / 2
+		right := &chunk{samples: make([]Sample, len(c.samples)-half, chunkMaxSamples)}
+		copy(right.samples, c.samples[half:])
+		c.samples = c.samples[:half]
+		s.chunks = append(s.chunks, nil)
+		copy(s.chunks[ci+2:], s.chunks[ci+1:])
+		s.chunks[ci+1] = right
+	}
+	return nil
+}
+
+// Range returns live samples in [from, to] in ascending order
+func (s *Series) Range(from, to int64) []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rangeSamples(from, to)
+}
+
+func (s *Series) rangeSamples(from, to int64) []Sample {
+	if min := s.minTimestamp(); from < min {
+		from = min
+	}
+	var result []Sample
+	ci := sort.Search(len(s.chunks), func(i int) bool {
+		return s.chunks[i].last() >= from
+	})
+	for ; ci < len(s.chunks) && s.chunks[ci].first() <= to; ci++ {
+		samples := s.chunks[ci].samples
+		start := sort.Search(len(samples), func(i int) bool {
+			return samples[i].Timestamp >= from
+		})
+		end := sort.Search(len(samples), func(i int) bool {
+			return samples[i].Timestamp > to
+		})
+		result = append(result, samples[start:end]...)
+	}
+	return result
+}
+
+// Last returns the latest sample
+func (s *Series) Last() (Sample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.chunks) == 0 {
+		return Sample{}, false
+	}
+	last := s.chunks[len(s.chunks)-1]
+	return last.samples[len(last.samples)-1], true
+}
+
+// Trim removes expired samples, returns the number of removed samples
+func (s *Series) Trim() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	min := s.minTimestamp()
+	removed := 0
+	for len(s.chunks) > 0 && s.chunks[0].first() < min {
+		c := s.chunks[0]
+		if c.last() < min {
+			removed += len(c.samples)
+			s.chunks = s.chunks[1:]
+			continue
+		}
+		i := sort.Search(len(c.samples), func(i int) bool {
+			return c.samples[i].Timestamp >= min
+		})
+		c.samples = append(c.samples[:0], c.samples[i:]...)
+		removed += i
+	}
+	s.count -= removed
+	return removed
+}
+
+// Len returns the number of live samples
+func (s *Series) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.retention == 0 {
+		return s.count
+	}
+	return len(s.rangeSamples(math.MinInt64, math.MaxInt64))
+}
+
+// FirstTimestamp returns the timestamp of the earliest live sample, 0 if series is empty
+func (s *Series) FirstTimestamp() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	min := s.minTimestamp()
+	for _, c := range s.chunks {
+		if c.last() >= min {
+			i := sort.Search(len(c.samples), func(i int) bool {
+				return c.samples[i].Timestamp >= min
+			})
+			return c.samples[i].Timestamp
+		}
+	}
+	return 0
+}
+
+// ChunkCount returns the number of chunks
+func (s *Series) ChunkCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks)
+}
+
+// Retention returns the retention in milliseconds, 0 means forever
+func (s *Series) Retention() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retention
+}
+
+// DuplicatePolicy returns the default duplicate policy of series
+func (s *Series) DuplicatePolicy() DuplicatePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.duplicatePolicy
+}
+
+// Labels returns labels of series, the returned slice must not be modified
+func (s *Series) Labels() []Label {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.labels
+}
+
+// Label returns the value of label name
+func (s *Series) Label(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, label := range s.labels {
+		if label.Name == name {
+			return label.Value, true
+		}
+	}
+	return "", false
+}
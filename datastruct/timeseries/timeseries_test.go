@@ -0,0 +1,149 @@
+package timeseries
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAddAndRange(t *testing.T) {
+	s := New(0, PolicyNone, nil)
+	perm := rand.Perm(2000)
+	for _, i := range perm {
+		if err := s.Add(int64(i), float64(i), PolicyNone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Len() != 2000 || s.ChunkCount() < 2000/chunkMaxSamples {
+		t.Errorf("wrong len %d or chunk count %d", s.Len(), s.ChunkCount())
+	}
+	samples := s.Range(100, 1099)
+	if len(samples) != 1000 {
+		t.Fatalf("expect 1000 samples, actual %d", len(samples))
+	}
+	for i, sample := range samples {
+		if sample.Timestamp != int64(100+i) || sample.Value != float64(100+i) {
+			t.Fatalf("wrong sample %v at %d", sample, i)
+		}
+	}
+
+	if err := s.Add(5, 1, PolicyNone); err != ErrDuplicateBlocked {
+		t.Errorf("expect blocked, actual %v", err)
+	}
+	cases := []struct {
+		policy DuplicatePolicy
+		value  float64
+		expect float64
+	}{
+		{PolicyFirst, 1, 5},
+		{PolicyMin, 1, 1},
+		{PolicyMax, 9, 9},
+		{PolicySum, 1, 10},
+		{PolicyLast, 3, 3},
+	}
+	for _, c := range cases {
+		if err := s.Add(5, c.value, c.policy); err != nil {
+			t.Fatal(err)
+		}
+		if actual := s.Range(5, 5)[0].Value; actual != c.expect {
+			t.Errorf("policy %s: expect %v, actual %v", c.policy, c.expect, actual)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s := New(100, PolicyLast, nil)
+	for i := 0; i < 1000; i++ {
+		_ = s.Add(int64(i), 1, PolicyNone)
+	}
+	if err := s.Add(800, 1, PolicyNone); err != ErrTooOld {
+		t.Errorf("expect too old, actual %v", err)
+	}
+	if s.Len() != 101 || s.FirstTimestamp() != 899 {
+		t.Errorf("wrong len %d or first timestamp %d", s.Len(), s.FirstTimestamp())
+	}
+	if removed := s.Trim(); removed != 899 {
+		t.Errorf("expect 899 removed, actual %d", removed)
+	}
+	if len(s.Range(0, 2000)) != 101 || s.Len() != 101 {
+		t.Error("wrong samples after trim")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	samples := []Sample{{0, 1}, {5, 3}, {10, 2}, {35, 4}, {36, 6}}
+	expect := map[Aggregation][]float64{
+		AggAvg:   {2, 2, 5},
+		AggSum:   {4, 2, 10},
+		AggMin:   {1, 2, 4},
+		AggMax:   {3, 2, 6},
+		AggCount: {2, 1, 2},
+		AggFirst: {1, 2, 4},
+		AggLast:  {3, 2, 6},
+		AggRange: {2, 0, 2},
+	}
+	for agg, values := range expect {
+		result := Aggregate(samples, &AggregateOptions{Aggregation: agg, BucketDuration: 10})
+		if len(result) != 3 || result[0].Timestamp != 0 || result[1].Timestamp != 10 || result[2].Timestamp != 30 {
+			t.Fatalf("%s: wrong buckets %v", agg, result)
+		}
+		for i, v := range values {
+			if result[i].Value != v {
+				t.Errorf("%s: expect %v, actual %v", agg, values, result)
+				break
+			}
+		}
+	}
+	result := Aggregate(samples, &AggregateOptions{
+		Aggregation:     AggMax,
+		BucketDuration:  10,
+		Align:           5,
+		BucketTimestamp: BucketEnd,
+		Empty:           true,
+	})
+	// buckets: [-5,5) [5,15) [15,25) [25,35) [35,45)
+	if len(result) != 5 || result[0].Timestamp != 5 || result[4].Timestamp != 45 ||
+		result[1].Value != 3 || !math.IsNaN(result[2].Value) {
+		t.Errorf("wrong result %v", result)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	src := New(0, PolicyLast, nil)
+	src.AddRule("dst", AggSum, 10, 0)
+	var compactions []Compaction
+	add := func(ts int64, v float64) {
+		c, _ := src.AddAndCompact(ts, v, PolicyNone)
+		compactions = append(compactions, c...)
+	}
+	add(1, 1)
+	add(2, 2)
+	if len(compactions) != 0 {
+		t.Fatal("bucket is not finished")
+	}
+	add(25, 5)
+	add(3, 3) // update a finished bucket
+	if len(compactions) != 2 || compactions[0].Sample != (Sample{0, 3}) || compactions[1].Sample != (Sample{0, 6}) {
+		t.Errorf("wrong compactions %v", compactions)
+	}
+	if !src.HasRule("dst") || !src.DeleteRule("dst") || len(src.Rules()) != 0 {
+		t.Error("wrong rules")
+	}
+}
+
+func TestCompactExpiring(t *testing.T) {
+	src := New(1000, PolicyLast, nil)
+	src.AddRule("dst", AggSum, 1000, 0)
+	_, _ = src.AddAndCompact(3000, 1, PolicyNone)
+	// the bucket of 3000 expires once 4100 is added, it is compacted before that
+	compactions, err := src.AddAndCompact(4100, 1, PolicyNone)
+	if err != nil || len(compactions) != 1 || compactions[0].Sample != (Sample{3000, 1}) {
+		t.Errorf("wrong compactions %v", compactions)
+	}
+	if _, err := src.AddAndCompact(3000, 2, PolicyNone); err != ErrTooOld {
+		t.Errorf("expect ErrTooOld, got %v", err)
+	}
+	if src.Rules()[0].current != 4000 {
+		t.Error("rule is changed by failed adding")
+	}
+}
@@ -0,0 +1,293 @@
+package topk
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/pluming/aurora/lib/murmur"
+)
+
+/*
+ * TopK tracks the k most frequent items with HeavyKeeper like RedisBloom.
+ * Each of depth rows has width buckets of a fingerprint and a counter. An item increases the counter of
+ * its bucket in each row if the fingerprint matches, otherwise decays the counter with probability decay^count
+ * and takes over the bucket when the counter reaches 0. The max counter of an item is its estimated count,
+ * items of the k largest counts are kept in a min heap.
+ */
+
+const (
+	fingerprintSeed = 0x9747b28c
+	bucketSize      = 4 + 4
+
+	headerFixedSize = 4 + 4 + 4 + 8 + 4
+	itemHeaderSize  = 4 + 4
+)
+
+// ErrBadData is returned when restoring from corrupted data
+var ErrBadData = errors.New("ERR received bad data")
+
+// Item is an item tracked by TopK with its estimated count
+type Item struct {
+	Item  string
+	Count uint32
+}
+
+// minHeap implements heap.Interface ordered by count
+type minHeap []*Item
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].Count < h[j].Count }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(*Item)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// TopK is a HeavyKeeper sketch tracking top k items
+type TopK struct {
+	k     uint32
+	width uint32
+	depth uint32
+	decay float64
+	// buckets are little endian uint32 fingerprint and counter pairs, row by row
+	buckets []byte
+	heap    minHeap
+}
+
+// New creates a TopK tracking k items with depth rows of width buckets, decay is in (0, 1]
+func New(k, width, depth uint32, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]byte, int(width)*int(depth)*bucketSize),
+		heap:    make(minHeap, 0, k),
+	}
+}
+
+// K returns the number of tracked items
+func (t *TopK) K() uint32 {
+	return t.k
+}
+
+// Width returns the number of buckets per row
+func (t *TopK) Width() uint32 {
+	return t.width
+}
+
+// Depth returns the number of rows
+func (t *TopK) Depth() uint32 {
+	return t.depth
+}
+
+// Decay returns the base of the probability of decaying a counter
+func (t *TopK) Decay() float64 {
+	return t.decay
+}
+
+func fingerprint(item []byte) uint32 {
+	return uint32(murmur.Hash64A(item, fingerprintSeed))
+}
+
+// offset returns the offset of the bucket of item in row
+func (t *TopK) offset(item []byte, row uint32) int {
+	col := murmur.Hash64A(item, uint64(row)) % uint64(t.width)
+	return (int(row)*int(t.width) + int(col)) * bucketSize
+}
+
+func (t *TopK) bucket(offset int) (fp, count uint32) {
+	return binary.LittleEndian.Uint32(t.buckets[offset:]), binary.LittleEndian.Uint32(t.buckets[offset+4:])
+}
+
+func (t *TopK) setBucket(offset int, fp, count uint32) {
+	binary.LittleEndian.PutUint32(t.buckets[offset:], fp)
+	binary.LittleEndian.PutUint32(t.buckets[offset+4:], count)
+}
+
+func (t *TopK) find(item string) int {
+	for i, it := range t.heap {
+		if it.Item == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add increases the count of item, returns the item expelled from top k if any
+func (t *TopK) Add(item []byte, increment uint32) (expelled string, ok bool) {
+	fp := fingerprint(item)
+	var maxCount uint32
+	for row := uint32(0); row < t.depth; row++ {
+		offset := t.offset(item, row)
+		bfp, count := t.bucket(offset)
+		switch {
+		case count == 0:
+			count = increment
+			bfp = fp
+		case bfp == fp:
+			if count > math.MaxUint32-increment {
+				count = math.MaxUint32
+			} else {
+				count += increment
+			}
+		default:
+			for remain := increment; remain > 0; remain-- {
+				if rand.Float64() < math.Pow(t.decay, float64(count)) {
+					count--
+					if count == 0 {
+						bfp, count = fp, remain
+						break
+					}
+				}
+			}
+		}
+		t.setBucket(offset, bfp, count)
+		if bfp == fp && count > maxCount {
+			maxCount = count
+		}
+	}
+	if maxCount == 0 {
+		return "", false
+	}
+
+	key := string(item)
+	if i := t.find(key); i >= 0 {
+		if maxCount > t.heap[i].Count {
+			t.heap[i].Count = maxCount
+			heap.Fix(&t.heap, i)
+		}
+		return "", false
+	}
+	if len(t.heap) < int(t.k) {
+		heap.Push(&t.heap, &Item{Item: key, Count: maxCount})
+		return "", false
+	}
+	if maxCount > t.heap[0].Count {
+		expelled = t.heap[0].Item
+		t.heap[0] = &Item{Item: key, Count: maxCount}
+		heap.Fix(&t.heap, 0)
+		return expelled, true
+	}
+	return "", false
+}
+
+// Query returns whether item is in top k
+func (t *TopK) Query(item []byte) bool {
+	return t.find(string(item)) >= 0
+}
+
+// Count returns the estimated count of item
+func (t *TopK) Count(item []byte) uint32 {
+	fp := fingerprint(item)
+	var maxCount uint32
+	for row := uint32(0); row < t.depth; row++ {
+		bfp, count := t.bucket(t.offset(item, row))
+		if bfp == fp && count > maxCount {
+			maxCount = count
+		}
+	}
+	return maxCount
+}
+
+// List returns copies of top k items in descending order of count
+func (t *TopK) List() []Item {
+	items := make([]Item, len(t.heap))
+	for i, it := range t.heap {
+		items[i] = *it
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	return items
+}
+
+/* ---- dump and restore ----
+ * TopK is dumped as a header of its parameters and heap, followed by buckets
+ */
+
+// Header returns the encoded parameters and heap
+func (t *TopK) Header() []byte {
+	buf := make([]byte, headerFixedSize)
+	binary.LittleEndian.PutUint32(buf[0:], t.k)
+	binary.LittleEndian.PutUint32(buf[4:], t.width)
+	binary.LittleEndian.PutUint32(buf[8:], t.depth)
+	binary.LittleEndian.PutUint64(buf[12:], math.Float64bits(t.decay))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(len(t.heap)))
+	var tmp [itemHeaderSize]byte
+	for _, it := range t.heap {
+		binary.LittleEndian.PutUint32(tmp[0:], it.Count)
+		binary.LittleEndian.PutUint32(tmp[4:], uint32(len(it.Item)))
+		buf = append(buf, tmp[:]...)
+		buf = append(buf, it.Item...)
+	}
+	return buf
+}
+
+// FromHeader creates a TopK of the given header with all buckets empty, which are filled by WriteData
+func FromHeader(header []byte) (*TopK, error) {
+	if len(header) < headerFixedSize {
+		return nil, ErrBadData
+	}
+	k := binary.LittleEndian.Uint32(header[0:])
+	width := binary.LittleEndian.Uint32(header[4:])
+	depth := binary.LittleEndian.Uint32(header[8:])
+	decay := math.Float64frombits(binary.LittleEndian.Uint64(header[12:]))
+	n := binary.LittleEndian.Uint32(header[20:])
+	if k == 0 || width == 0 || depth == 0 || n > k || !(decay > 0 && decay <= 1) {
+		return nil, ErrBadData
+	}
+	t := New(k, width, depth, decay)
+	header = header[headerFixedSize:]
+	for i := uint32(0); i < n; i++ {
+		if len(header) < itemHeaderSize {
+			return nil, ErrBadData
+		}
+		count := binary.LittleEndian.Uint32(header[0:])
+		size := int(binary.LittleEndian.Uint32(header[4:]))
+		header = header[itemHeaderSize:]
+		if len(header) < size {
+			return nil, ErrBadData
+		}
+		t.heap = append(t.heap, &Item{Item: string(header[:size]), Count: count})
+		header = header[size:]
+	}
+	if len(header) != 0 {
+		return nil, ErrBadData
+	}
+	heap.Init(&t.heap)
+	return t, nil
+}
+
+// DataLen returns the number of bytes of buckets
+func (t *TopK) DataLen() int {
+	return len(t.buckets)
+}
+
+// ReadData returns a copy of at most size bytes of buckets from offset
+func (t *TopK) ReadData(offset, size int) []byte {
+	end := offset + size
+	if end > len(t.buckets) {
+		end = len(t.buckets)
+	}
+	return append([]byte(nil), t.buckets[offset:end]...)
+}
+
+// WriteData overwrites buckets from offset
+func (t *TopK) WriteData(offset int, data []byte) error {
+	if offset < 0 || offset+len(data) > len(t.buckets) {
+		return ErrBadData
+	}
+	copy(t.buckets[offset:], data)
+	return nil
+}
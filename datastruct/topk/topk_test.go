@@ -0,0 +1,59 @@
+package topk
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	tk := New(5, 100, 5, 0.9)
+	// item i is added i times for heavy items, noise items are added once
+	for i := 1; i <= 10; i++ {
+		for j := 0; j < i*100; j++ {
+			tk.Add([]byte("heavy"+strconv.Itoa(i)), 1)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		tk.Add([]byte("noise"+strconv.Itoa(i)), 1)
+	}
+	list := tk.List()
+	if len(list) != 5 {
+		t.Fatalf("expect 5 items, actual %v", list)
+	}
+	for i, item := range list {
+		expect := "heavy" + strconv.Itoa(10-i)
+		if item.Item != expect {
+			t.Errorf("expect %s at %d, actual %v", expect, i, list)
+		}
+	}
+	if !tk.Query([]byte("heavy10")) || tk.Query([]byte("heavy1")) {
+		t.Error("wrong query result")
+	}
+	if c := tk.Count([]byte("heavy10")); c < 900 || c > 1000 {
+		t.Errorf("wrong count %d", c)
+	}
+}
+
+func TestExpelledAndDump(t *testing.T) {
+	tk := New(2, 50, 4, 0.9)
+	tk.Add([]byte("a"), 10)
+	tk.Add([]byte("b"), 20)
+	if _, ok := tk.Add([]byte("c"), 5); ok {
+		t.Error("c should not enter top k")
+	}
+	if expelled, ok := tk.Add([]byte("d"), 30); !ok || expelled != "a" {
+		t.Errorf("expect a expelled, actual %s", expelled)
+	}
+
+	restored, err := FromHeader(tk.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.WriteData(0, tk.ReadData(0, tk.DataLen())); err != nil {
+		t.Fatal(err)
+	}
+	list := restored.List()
+	if len(list) != 2 || list[0] != (Item{"d", 30}) || list[1] != (Item{"b", 20}) || restored.Count([]byte("a")) != 10 {
+		t.Errorf("wrong restored top k %v", list)
+	}
+}
@@ -0,0 +1,167 @@
+package zset
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/listpack"
+	"github.com/pluming/aurora/datastruct/skiplist"
+)
+
+/*
+ * A small ZSet is encoded in a listpack of alternate members and scores sorted by score and member.
+ * Operations decode the listpack and work on the sorted elements, which is fast enough for small sets.
+ */
+
+// formatScore formats integral scores as integers so that listpack stores them compactly
+func formatScore(score float64) []byte {
+	// -0 is kept as a float
+	if score == math.Trunc(score) && math.Abs(score) < 1<<53 && !(score == 0 && math.Signbit(score)) {
+		return strconv.AppendInt(nil, int64(score), 10)
+	}
+	return strconv.AppendFloat(nil, score, 'g', -1, 64)
+}
+
+func parseScore(raw []byte) float64 {
+	score, _ := strconv.ParseFloat(string(raw), 64)
+	return score
+}
+
+// elements decodes all elements in the listpack
+func (zs *ZSet) elements() []*skiplist.Element {
+	elements := make([]*skiplist.Element, zs.lp.Len()/2)
+	var member string
+	zs.lp.ForEach(func(i int, val []byte) bool {
+		if i%2 == 0 {
+			member = string(val)
+		} else {
+			elements[i/2] = &skiplist.Element{Member: member, Score: parseScore(val)}
+		}
+		return true
+	})
+	return elements
+}
+
+// store replaces the listpack with the given sorted elements
+func (zs *ZSet) store(elements []*skiplist.Element) {
+	zs.lp = listpack.New()
+	for _, element := range elements {
+		zs.lp.Append([]byte(element.Member), formatScore(element.Score))
+	}
+}
+
+// convert moves all elements into dict and skiplist
+func (zs *ZSet) convert() {
+	elements := zs.elements()
+	zs.lp = nil
+	zs.dict = dict.MakeSimple()
+	zs.skipList = skiplist.MakeSkipList()
+	for _, element := range elements {
+		zs.dict.Put(element.Member, element)
+		zs.skipList.Insert(element.Member, element.Score)
+	}
+}
+
+// lpFind returns the rank of member in the listpack or -1
+func (zs *ZSet) lpFind(member string) int {
+	i := zs.lp.Find([]byte(member), 0, 2)
+	if i < 0 {
+		return -1
+	}
+	return i / 2
+}
+
+// lpAdd adds member into listpack, it returns false if the listpack cannot hold it
+func (zs *ZSet) lpAdd(member string, score float64) (inserted bool, ok bool) {
+	rank := zs.lpFind(member)
+	if rank >= 0 {
+		if parseScore(zs.lp.Get(rank*2+1)) == score {
+			return false, true
+		}
+		zs.lp.Remove(rank*2, 2)
+	} else if zs.lp.Len()/2 >= zs.maxEntries || len(member) > zs.maxValue {
+		return false, false
+	}
+	elements := zs.elements()
+	pos := sort.Search(len(elements), func(i int) bool {
+		e := elements[i]
+		return e.Score > score || (e.Score == score && e.Member > member)
+	})
+	zs.lp.Insert(pos*2, []byte(member), formatScore(score))
+	return rank < 0, true
+}
+
+func (zs *ZSet) lpGet(member string) (*skiplist.Element, bool) {
+	rank := zs.lpFind(member)
+	if rank < 0 {
+		return nil, false
+	}
+	return &skiplist.Element{
+		Member: member,
+		Score:  parseScore(zs.lp.Get(rank*2 + 1)),
+	}, true
+}
+
+func (zs *ZSet) lpRemove(member string) bool {
+	rank := zs.lpFind(member)
+	if rank < 0 {
+		return false
+	}
+	zs.lp.Remove(rank*2, 2)
+	return true
+}
+
+// forEachInSlice visits elements like forEachInRange
+func forEachInSlice(elements []*skiplist.Element, offset, limit int64, desc bool, cb func(element *skiplist.Element) bool) {
+	n := int64(len(elements))
+	for i := offset; i < n && (limit < 0 || i < offset+limit); i++ {
+		element := elements[i]
+		if desc {
+			element = elements[n-1-i]
+		}
+		if !cb(element) {
+			break
+		}
+	}
+}
+
+// lpFilter returns the sorted elements which match filter
+func (zs *ZSet) lpFilter(filter func(element *skiplist.Element) bool) []*skiplist.Element {
+	var result []*skiplist.Element
+	for _, element := range zs.elements() {
+		if filter(element) {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// lpRemoveIf removes elements which match filter and returns the number of removed elements
+func (zs *ZSet) lpRemoveIf(filter func(rank int, element *skiplist.Element) bool) int64 {
+	elements := zs.elements()
+	kept := elements[:0]
+	for rank, element := range elements {
+		if !filter(rank, element) {
+			kept = append(kept, element)
+		}
+	}
+	removed := int64(len(elements) - len(kept))
+	if removed > 0 {
+		zs.store(kept)
+	}
+	return removed
+}
+
+func inScoreRange(min, max *skiplist.ScoreBorder) func(element *skiplist.Element) bool {
+	return func(element *skiplist.Element) bool {
+		return skiplist.InScoreRange(min, max, element.Score)
+	}
+}
+
+func inLexRange(min, max *skiplist.LexBorder) func(element *skiplist.Element) bool {
+	return func(element *skiplist.Element) bool {
+		return skiplist.InLexRange(min, max, element.Member)
+	}
+}
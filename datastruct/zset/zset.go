@@ -3,73 +3,163 @@ package zset
 import (
 	"strconv"
 
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/listpack"
 	"github.com/pluming/aurora/datastruct/skiplist"
 )
 
+// Encodings of ZSet
 const (
-	initZSetDictSize = 16
+	EncodingListPack = "listpack"
+	EncodingSkipList = "skiplist"
 )
 
 type ZSet struct {
-	//dict dict.Dict
-	dict map[string]*skiplist.Element
+	// dict maps members to elements, it is a SimpleDict so that ZSCAN has a cursor
+	dict *dict.SimpleDict
 
 	skipList *skiplist.SkipList
+
+	// lp is not nil if zset is in listpack encoding, while dict and skipList are nil
+	lp         *listpack.ListPack
+	maxEntries int
+	maxValue   int
 }
 
 func New() *ZSet {
 	return &ZSet{
-		dict:     make(map[string]*skiplist.Element, initZSetDictSize),
+		dict:     dict.MakeSimple(),
 		skipList: skiplist.MakeSkipList(),
 	}
 }
 
+// NewCompact creates a zset in listpack encoding, which converts to skiplist once it has more than maxEntries members
+// or a member longer than maxValue, and never converts back
+func NewCompact(maxEntries, maxValue int) *ZSet {
+	if maxEntries <= 0 {
+		return New()
+	}
+	return &ZSet{
+		lp:         listpack.New(),
+		maxEntries: maxEntries,
+		maxValue:   maxValue,
+	}
+}
+
+// Encoding returns the current encoding of zset
+func (zs *ZSet) Encoding() string {
+	if zs.lp != nil {
+		return EncodingListPack
+	}
+	return EncodingSkipList
+}
+
 // Add puts member into set,  and returns whether has inserted new node
 func (zs *ZSet) Add(member string, score float64) bool {
-	element, ok := zs.dict[member]
+	if zs.lp != nil {
+		inserted, ok := zs.lpAdd(member, score)
+		if ok {
+			return inserted
+		}
+		zs.convert()
+	}
+	element, ok := zs.getElement(member)
 
 	//exist and score eq ==> not modify
 	if ok {
 		if element.Score != score {
-			zs.dict[member] = &skiplist.Element{
+			zs.dict.Put(member, &skiplist.Element{
 				Member: member,
 				Score:  score,
-			}
-			zs.skipList.Remove(member, score)
+			})
+			zs.skipList.Remove(member, element.Score)
 			zs.skipList.Insert(member, score)
 		}
 		return false
 	}
-	zs.dict[member] = &skiplist.Element{
+	zs.dict.Put(member, &skiplist.Element{
 		Member: member,
 		Score:  score,
-	}
+	})
 	zs.skipList.Insert(member, score)
 	return true
 }
 
 func (zs *ZSet) Len() int64 {
-	return int64(len(zs.dict))
+	if zs.lp != nil {
+		return int64(zs.lp.Len() / 2)
+	}
+	return int64(zs.dict.Len())
 }
 
-func (zs *ZSet) Get(member string) (*skiplist.Element, bool) {
-	element, ok := zs.dict[member]
+func (zs *ZSet) getElement(member string) (*skiplist.Element, bool) {
+	val, ok := zs.dict.Get(member)
 	if !ok {
 		return nil, false
 	}
-	return element, ok
+	return val.(*skiplist.Element), true
+}
+
+func (zs *ZSet) Get(member string) (*skiplist.Element, bool) {
+	if zs.lp != nil {
+		return zs.lpGet(member)
+	}
+	return zs.getElement(member)
+}
+
+// GetRank returns the 0-based rank of member, sort by ascending order unless desc is true
+func (zs *ZSet) GetRank(member string, desc bool) (rank int64, ok bool) {
+	if zs.lp != nil {
+		rank = int64(zs.lpFind(member))
+		if rank < 0 {
+			return -1, false
+		}
+		if desc {
+			rank = zs.Len() - 1 - rank
+		}
+		return rank, true
+	}
+	element, ok := zs.getElement(member)
+	if !ok {
+		return -1, false
+	}
+	rank = zs.skipList.GetRank(member, element.Score)
+	if desc {
+		rank = zs.Len() - rank
+	} else {
+		rank--
+	}
+	return rank, true
 }
 
 func (zs *ZSet) Remove(member string) bool {
-	element, ok := zs.dict[member]
+	if zs.lp != nil {
+		return zs.lpRemove(member)
+	}
+	element, ok := zs.getElement(member)
 	if ok {
-		delete(zs.dict, member)
+		zs.dict.Remove(member)
 		zs.skipList.Remove(element.Member, element.Score)
 		return true
 	}
 	return false
 }
 
+// Scan visits elements from cursor and returns the cursor of the next call, see dict.Dict.
+// A zset in listpack encoding is visited in one call.
+func (zs *ZSet) Scan(cursor uint64, count int, cb func(element *skiplist.Element)) uint64 {
+	if zs.lp != nil {
+		for _, element := range zs.elements() {
+			cb(element)
+		}
+		return 0
+	}
+	return zs.dict.Scan(cursor, count, func(member string, val interface{}) bool {
+		cb(val.(*skiplist.Element))
+		return true
+	})
+}
+
 // ForEach visits each member which rank within [start, stop), sort by ascending order, rank starts from 0
 func (zs *ZSet) ForEach(start, stop int64, desc bool, cb func(element *skiplist.Element) bool) {
 	size := zs.Len()
@@ -81,6 +171,15 @@ func (zs *ZSet) ForEach(start, stop int64, desc bool, cb func(element *skiplist.
 		panic("illegal stop " + strconv.FormatInt(start, 10))
 	}
 
+	if zs.lp != nil {
+		elements := zs.elements()
+		if desc {
+			start, stop = size-stop, size-start
+		}
+		forEachInSlice(elements[start:stop], 0, -1, desc, cb)
+		return
+	}
+
 	var node *skiplist.Node
 	if desc {
 		node = zs.skipList.Tail
@@ -118,8 +217,11 @@ func (zs *ZSet) Range(start int64, stop int64, desc bool) []*skiplist.Element {
 	return slice
 }
 
+// Count returns the number of members which score within the given border
 func (zs *ZSet) Count(min *skiplist.ScoreBorder, max *skiplist.ScoreBorder) int64 {
-	var c int64
+	if zs.lp != nil {
+		return int64(len(zs.lpFilter(inScoreRange(min, max))))
+	}
 	_, firstRank := zs.skipList.GetFirstInScoreRange(min, max)
 	if firstRank < 0 {
 		return 0
@@ -128,50 +230,50 @@ func (zs *ZSet) Count(min *skiplist.ScoreBorder, max *skiplist.ScoreBorder) int6
 	if lastRank < 0 {
 		return 0
 	}
-	zs.ForEach(firstRank-1, lastRank, false, func(element *skiplist.Element) bool {
-		c++
-		return true
-	})
-	return c
+	return lastRank - firstRank + 1
 }
 
-// ForEachByScore offset : 0-base
-// ForEachByScore visits members which score within the given border
+// ForEachByScore visits members which score within the given border, the first offset (0-based) members are skipped
+// param limit: <0 means no limit
 func (zs *ZSet) ForEachByScore(min, max *skiplist.ScoreBorder, offset, limit int64, desc bool, cb func(element *skiplist.Element) bool) {
-	if offset < 0 {
+	if offset < 0 || limit == 0 {
 		return
 	}
-	_, firstRank := zs.skipList.GetFirstInScoreRange(min, max)
+	if zs.lp != nil {
+		forEachInSlice(zs.lpFilter(inScoreRange(min, max)), offset, limit, desc, cb)
+		return
+	}
+	first, firstRank := zs.skipList.GetFirstInScoreRange(min, max)
 	if firstRank < 0 {
 		return
 	}
-	_, lastRank := zs.skipList.GetLastInScoreRange(min, max)
+	last, lastRank := zs.skipList.GetLastInScoreRange(min, max)
 	if lastRank < 0 {
 		return
 	}
+	forEachInRange(first, last, lastRank-firstRank+1, offset, limit, desc, cb)
+}
 
-	start := firstRank + offset - 1
-	stop := lastRank
-	if start < 0 || start >= zs.Len() {
-		return
+// forEachInRange visits n nodes from first to last, or from last to first if desc is true
+func forEachInRange(first, last *skiplist.Node, n, offset, limit int64, desc bool, cb func(element *skiplist.Element) bool) {
+	n -= offset
+	if limit > 0 && n > limit {
+		n = limit
 	}
-	if stop < start || stop > zs.Len() {
-		return
+	node := first
+	if desc {
+		node = last
 	}
-	var c int64
-	zs.ForEach(start, stop, desc, func(element *skiplist.Element) bool {
-		if limit < 0 || c >= limit {
-			return false
-		}
-		c++
-		if !cb(element) {
-			return false
+	for i := int64(0); i < offset+n; i++ {
+		if i >= offset && !cb(&node.Element) {
+			break
 		}
-		if c == limit {
-			return false
+		if desc {
+			node = node.Backward
+		} else {
+			node = node.Level[0].Forward
 		}
-		return true
-	})
+	}
 }
 
 // RangeByScore returns members which score within the given border
@@ -190,9 +292,15 @@ func (zs *ZSet) RangeByScore(min *skiplist.ScoreBorder, max *skiplist.ScoreBorde
 
 // RemoveByScore removes members which score within the given border
 func (zs *ZSet) RemoveByScore(min, max *skiplist.ScoreBorder) int64 {
+	if zs.lp != nil {
+		filter := inScoreRange(min, max)
+		return zs.lpRemoveIf(func(rank int, element *skiplist.Element) bool {
+			return filter(element)
+		})
+	}
 	removed := zs.skipList.RemoveRangeByScore(min, max)
 	for _, element := range removed {
-		delete(zs.dict, element.Member)
+		zs.dict.Remove(element.Member)
 	}
 	return int64(len(removed))
 }
@@ -200,9 +308,77 @@ func (zs *ZSet) RemoveByScore(min, max *skiplist.ScoreBorder) int64 {
 // RemoveByRank removes member ranking within [start, stop)
 // sort by ascending order and rank starts from 0
 func (zs *ZSet) RemoveByRank(start, stop int64) int64 {
+	if zs.lp != nil {
+		return zs.lpRemoveIf(func(rank int, element *skiplist.Element) bool {
+			return int64(rank) >= start && int64(rank) < stop
+		})
+	}
 	removed := zs.skipList.RemoveRangeByRank(start+1, stop+1)
 	for _, element := range removed {
-		delete(zs.dict, element.Member)
+		zs.dict.Remove(element.Member)
+	}
+	return int64(len(removed))
+}
+
+// CountByLex returns the number of members within the given lex border
+func (zs *ZSet) CountByLex(min, max *skiplist.LexBorder) int64 {
+	if zs.lp != nil {
+		return int64(len(zs.lpFilter(inLexRange(min, max))))
+	}
+	_, firstRank := zs.skipList.GetFirstInLexRange(min, max)
+	if firstRank < 0 {
+		return 0
+	}
+	_, lastRank := zs.skipList.GetLastInLexRange(min, max)
+	if lastRank < 0 {
+		return 0
+	}
+	return lastRank - firstRank + 1
+}
+
+// ForEachByLex visits members within the given lex border, the first offset (0-based) members are skipped
+// param limit: <0 means no limit
+func (zs *ZSet) ForEachByLex(min, max *skiplist.LexBorder, offset, limit int64, desc bool, cb func(element *skiplist.Element) bool) {
+	if offset < 0 || limit == 0 {
+		return
+	}
+	if zs.lp != nil {
+		forEachInSlice(zs.lpFilter(inLexRange(min, max)), offset, limit, desc, cb)
+		return
+	}
+	first, firstRank := zs.skipList.GetFirstInLexRange(min, max)
+	if firstRank < 0 {
+		return
+	}
+	last, lastRank := zs.skipList.GetLastInLexRange(min, max)
+	if lastRank < 0 {
+		return
+	}
+	forEachInRange(first, last, lastRank-firstRank+1, offset, limit, desc, cb)
+}
+
+// RangeByLex returns members within the given lex border
+// param limit: <0 means no limit
+func (zs *ZSet) RangeByLex(min, max *skiplist.LexBorder, offset, limit int64, desc bool) []*skiplist.Element {
+	slice := make([]*skiplist.Element, 0)
+	zs.ForEachByLex(min, max, offset, limit, desc, func(element *skiplist.Element) bool {
+		slice = append(slice, element)
+		return true
+	})
+	return slice
+}
+
+// RemoveByLex removes members within the given lex border
+func (zs *ZSet) RemoveByLex(min, max *skiplist.LexBorder) int64 {
+	if zs.lp != nil {
+		filter := inLexRange(min, max)
+		return zs.lpRemoveIf(func(rank int, element *skiplist.Element) bool {
+			return filter(element)
+		})
+	}
+	removed := zs.skipList.RemoveRangeByLex(min, max)
+	for _, element := range removed {
+		zs.dict.Remove(element.Member)
 	}
 	return int64(len(removed))
 }
@@ -76,3 +76,148 @@ func TestNormalZSet(t *testing.T) {
 	t.Log(delCount)
 	t.Log(zs)
 }
+
+func TestZSetUpdateAndRangeByScore(t *testing.T) {
+	zs := New()
+	for i := 0; i < 100; i++ {
+		zs.Add(fmt.Sprintf("m%d", i), float64(i))
+	}
+	// move m0 to the tail
+	zs.Add("m0", 1000)
+	if zs.Len() != 100 {
+		t.Fatalf("expect 100 members, actual %d", zs.Len())
+	}
+	if rank, _ := zs.GetRank("m0", false); rank != 99 {
+		t.Fatalf("expect rank 99, actual %d", rank)
+	}
+	if rank, _ := zs.GetRank("m0", true); rank != 0 {
+		t.Fatalf("expect rev rank 0, actual %d", rank)
+	}
+	if zs.Count(&skiplist.ScoreBorder{Value: 0}, &skiplist.ScoreBorder{Value: 10}) != 10 {
+		t.Fatal("wrong count")
+	}
+
+	min := &skiplist.ScoreBorder{Value: 10}
+	max := &skiplist.ScoreBorder{Value: 20, Exclude: true}
+	elements := zs.RangeByScore(min, max, 2, 3, true)
+	if len(elements) != 3 || elements[0].Score != 17 || elements[2].Score != 15 {
+		t.Fatalf("wrong desc range: %v", elements)
+	}
+	elements = zs.RangeByScore(min, max, 8, -1, false)
+	if len(elements) != 2 || elements[0].Score != 18 || elements[1].Score != 19 {
+		t.Fatalf("wrong asc range: %v", elements)
+	}
+	if len(zs.RangeByScore(min, max, 10, -1, false)) != 0 {
+		t.Fatal("expect empty range")
+	}
+}
+
+func elementsString(elements []*skiplist.Element) string {
+	s := ""
+	for _, e := range elements {
+		s += fmt.Sprintf("%s:%v ", e.Member, e.Score)
+	}
+	return s
+}
+
+// TestCompactZSet checks a zset in listpack encoding behaves the same as one in skiplist
+func TestCompactZSet(t *testing.T) {
+	compact := NewCompact(1000, 64)
+	normal := New()
+	for i := 0; i < 200; i++ {
+		m := fmt.Sprintf("m%d", i%50)
+		score := float64(i%7) - 3.5
+		if i%3 == 0 {
+			score = float64(i % 5)
+		}
+		if compact.Add(m, score) != normal.Add(m, score) {
+			t.Fatalf("different result of adding %s", m)
+		}
+	}
+	if compact.Encoding() != EncodingListPack || normal.Encoding() != EncodingSkipList {
+		t.Fatal("wrong encoding")
+	}
+	min, _ := skiplist.ParseScoreBorder("(-1")
+	max, _ := skiplist.ParseScoreBorder("3")
+	lexMin, _ := skiplist.ParseLexBorder("[m1")
+	lexMax, _ := skiplist.ParseLexBorder("(m3")
+	check := func() {
+		if compact.Len() != normal.Len() {
+			t.Fatalf("expect len %d, actual %d", normal.Len(), compact.Len())
+		}
+		for _, desc := range []bool{false, true} {
+			expect := elementsString(normal.Range(0, normal.Len(), desc))
+			if actual := elementsString(compact.Range(0, compact.Len(), desc)); actual != expect {
+				t.Fatalf("expect %s, actual %s", expect, actual)
+			}
+			expect = elementsString(normal.Range(3, 9, desc))
+			if actual := elementsString(compact.Range(3, 9, desc)); actual != expect {
+				t.Fatalf("expect %s, actual %s", expect, actual)
+			}
+			expect = elementsString(normal.RangeByScore(min, max, 2, 5, desc))
+			if actual := elementsString(compact.RangeByScore(min, max, 2, 5, desc)); actual != expect {
+				t.Fatalf("expect %s, actual %s", expect, actual)
+			}
+			rank1, _ := normal.GetRank("m7", desc)
+			rank2, _ := compact.GetRank("m7", desc)
+			if rank1 != rank2 {
+				t.Fatalf("expect rank %d, actual %d", rank1, rank2)
+			}
+		}
+		if compact.Count(min, max) != normal.Count(min, max) {
+			t.Fatal("different count")
+		}
+	}
+	check()
+	if compact.RemoveByScore(min, max) != normal.RemoveByScore(min, max) {
+		t.Fatal("different result of RemoveByScore")
+	}
+	check()
+	if compact.RemoveByRank(2, 5) != normal.RemoveByRank(2, 5) {
+		t.Fatal("different result of RemoveByRank")
+	}
+	check()
+
+	// lex ranges require the same score
+	compact, normal = NewCompact(1000, 64), New()
+	for i := 0; i < 50; i++ {
+		m := fmt.Sprintf("m%d", i)
+		compact.Add(m, 1)
+		normal.Add(m, 1)
+	}
+	if compact.CountByLex(lexMin, lexMax) != normal.CountByLex(lexMin, lexMax) {
+		t.Fatal("different result of CountByLex")
+	}
+	expect := elementsString(normal.RangeByLex(lexMin, lexMax, 1, 4, true))
+	if actual := elementsString(compact.RangeByLex(lexMin, lexMax, 1, 4, true)); actual != expect {
+		t.Fatalf("expect %s, actual %s", expect, actual)
+	}
+	if compact.RemoveByLex(lexMin, lexMax) != normal.RemoveByLex(lexMin, lexMax) {
+		t.Fatal("different result of RemoveByLex")
+	}
+	check()
+}
+
+func TestZSetConvert(t *testing.T) {
+	zs := NewCompact(3, 4)
+	zs.Add("a", 1.5)
+	zs.Add("b", -0.0)
+	zs.Add("c", 1e300)
+	if zs.Encoding() != EncodingListPack {
+		t.Fatal("expect listpack")
+	}
+	zs.Add("d", 3)
+	if zs.Encoding() != EncodingSkipList || zs.Len() != 4 {
+		t.Fatalf("expect 4 members in skiplist, actual %d in %s", zs.Len(), zs.Encoding())
+	}
+	for member, score := range map[string]float64{"a": 1.5, "b": 0, "c": 1e300, "d": 3} {
+		if e, ok := zs.Get(member); !ok || e.Score != score {
+			t.Fatalf("wrong score of %s after converting", member)
+		}
+	}
+	zs = NewCompact(3, 4)
+	zs.Add("abcde", 1)
+	if zs.Encoding() != EncodingSkipList {
+		t.Fatal("expect skiplist")
+	}
+}
@@ -18,7 +18,10 @@ type Connection interface {
 	GetQueuedCmdLine() [][][]byte
 	EnqueueCmd([][]byte)
 	ClearQueuedCmds()
-	GetWatching() map[string]uint32
+	GetWatching() map[WatchedKey]uint64
+	// AddTxError records an error of queuing command, the transaction is discarded by EXEC if any error occurs
+	AddTxError(err error)
+	GetTxErrors() []error
 
 	// GetDBIndex used for multi database
 	GetDBIndex() int
@@ -29,3 +32,9 @@ type Connection interface {
 
 	Close() error
 }
+
+// WatchedKey is a key watched by WATCH in the database of DBIndex
+type WatchedKey struct {
+	DBIndex int
+	Key     string
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pluming/aurora/internal/client"
 	"github.com/pluming/aurora/lib/sync/wait"
 )
 
@@ -35,7 +36,8 @@ type Connection struct {
 	// queued commands for `multi`
 	multiState bool
 	queue      [][][]byte
-	watching   map[string]uint32
+	watching   map[client.WatchedKey]uint64
+	txErrors   []error
 
 	// selected db
 	selectedDB int
@@ -138,6 +140,7 @@ func (c *Connection) SetMultiState(state bool) {
 	if !state { // reset data when cancel multi
 		c.watching = nil
 		c.queue = nil
+		c.txErrors = nil
 	}
 	c.multiState = state
 }
@@ -157,6 +160,16 @@ func (c *Connection) ClearQueuedCmds() {
 	c.queue = nil
 }
 
+// AddTxError records an error of queuing command in current transaction
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns errors of queuing commands in current transaction
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
 // GetRole returns role of connection, such as connection with master
 func (c *Connection) GetRole() int32 {
 	if c == nil {
@@ -170,9 +183,9 @@ func (c *Connection) SetRole(r int32) {
 }
 
 // GetWatching returns watching keys and their version code when started watching
-func (c *Connection) GetWatching() map[string]uint32 {
+func (c *Connection) GetWatching() map[client.WatchedKey]uint64 {
 	if c.watching == nil {
-		c.watching = make(map[string]uint32)
+		c.watching = make(map[client.WatchedKey]uint64)
 	}
 	return c.watching
 }
@@ -14,6 +14,7 @@ type DBServer interface {
 type DBInstance interface {
 	Exec(client client.Connection, cmdLine [][]byte) client.Reply
 	ExecNormalCommand(cmdLine [][]byte) client.Reply
+	AfterClientClose(c client.Connection)
 }
 
 // EmbedDB is the embedding storage engine exposing more methods for complex application
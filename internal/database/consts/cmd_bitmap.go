@@ -0,0 +1,12 @@
+package consts
+
+// bitmap commands
+const (
+	CMDSetBit     = "SETBIT"
+	CMDGetBit     = "GETBIT"
+	CMDBitCount   = "BITCOUNT"
+	CMDBitPos     = "BITPOS"
+	CMDBitOp      = "BITOP"
+	CMDBitField   = "BITFIELD"
+	CMDBitFieldRO = "BITFIELD_RO"
+)
@@ -0,0 +1,26 @@
+package consts
+
+// bloom filter commands
+const (
+	CMDBFReserve   = "BF.RESERVE"
+	CMDBFAdd       = "BF.ADD"
+	CMDBFMAdd      = "BF.MADD"
+	CMDBFExists    = "BF.EXISTS"
+	CMDBFMExists   = "BF.MEXISTS"
+	CMDBFInfo      = "BF.INFO"
+	CMDBFScanDump  = "BF.SCANDUMP"
+	CMDBFLoadChunk = "BF.LOADCHUNK"
+)
+
+// cuckoo filter commands
+const (
+	CMDCFReserve   = "CF.RESERVE"
+	CMDCFAdd       = "CF.ADD"
+	CMDCFAddNX     = "CF.ADDNX"
+	CMDCFDel       = "CF.DEL"
+	CMDCFExists    = "CF.EXISTS"
+	CMDCFCount     = "CF.COUNT"
+	CMDCFInfo      = "CF.INFO"
+	CMDCFScanDump  = "CF.SCANDUMP"
+	CMDCFLoadChunk = "CF.LOADCHUNK"
+)
@@ -0,0 +1,15 @@
+package consts
+
+// geo commands
+const (
+	CMDGeoAdd              = "GEOADD"
+	CMDGeoPos              = "GEOPOS"
+	CMDGeoDist             = "GEODIST"
+	CMDGeoHash             = "GEOHASH"
+	CMDGeoSearch           = "GEOSEARCH"
+	CMDGeoSearchStore      = "GEOSEARCHSTORE"
+	CMDGeoRadius           = "GEORADIUS"
+	CMDGeoRadiusRO         = "GEORADIUS_RO"
+	CMDGeoRadiusByMember   = "GEORADIUSBYMEMBER"
+	CMDGeoRadiusByMemberRO = "GEORADIUSBYMEMBER_RO"
+)
@@ -0,0 +1,21 @@
+package consts
+
+// hash commands
+const (
+	CMDHSet         = "HSET"
+	CMDHSetNX       = "HSETNX"
+	CMDHMSet        = "HMSET"
+	CMDHGet         = "HGET"
+	CMDHMGet        = "HMGET"
+	CMDHDel         = "HDEL"
+	CMDHExists      = "HEXISTS"
+	CMDHLen         = "HLEN"
+	CMDHStrLen      = "HSTRLEN"
+	CMDHIncrBy      = "HINCRBY"
+	CMDHIncrByFloat = "HINCRBYFLOAT"
+	CMDHGetAll      = "HGETALL"
+	CMDHKeys        = "HKEYS"
+	CMDHVals        = "HVALS"
+	CMDHRandField   = "HRANDFIELD"
+	CMDHScan        = "HSCAN"
+)
@@ -0,0 +1,8 @@
+package consts
+
+// hyperloglog commands
+const (
+	CMDPFAdd   = "PFADD"
+	CMDPFCount = "PFCOUNT"
+	CMDPFMerge = "PFMERGE"
+)
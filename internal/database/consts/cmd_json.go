@@ -0,0 +1,16 @@
+package consts
+
+// json commands
+const (
+	CMDJSONSet       = "JSON.SET"
+	CMDJSONGet       = "JSON.GET"
+	CMDJSONMGet      = "JSON.MGET"
+	CMDJSONDel       = "JSON.DEL"
+	CMDJSONForget    = "JSON.FORGET"
+	CMDJSONType      = "JSON.TYPE"
+	CMDJSONArrAppend = "JSON.ARRAPPEND"
+	CMDJSONArrInsert = "JSON.ARRINSERT"
+	CMDJSONNumIncrBy = "JSON.NUMINCRBY"
+	CMDJSONStrAppend = "JSON.STRAPPEND"
+	CMDJSONObjKeys   = "JSON.OBJKEYS"
+)
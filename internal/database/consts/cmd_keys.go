@@ -0,0 +1,31 @@
+package consts
+
+// generic keyspace commands
+const (
+	CMDDel       = "DEL"
+	CMDExists    = "EXISTS"
+	CMDType      = "TYPE"
+	CMDRename    = "RENAME"
+	CMDRenameNX  = "RENAMENX"
+	CMDKeys      = "KEYS"
+	CMDRandomKey = "RANDOMKEY"
+	CMDDBSize    = "DBSIZE"
+	CMDTouch     = "TOUCH"
+	CMDSort      = "SORT"
+	CMDSortRO    = "SORT_RO"
+	CMDScan      = "SCAN"
+	CMDObject    = "OBJECT"
+)
+
+// expiration commands
+const (
+	CMDExpire      = "EXPIRE"
+	CMDPExpire     = "PEXPIRE"
+	CMDExpireAt    = "EXPIREAT"
+	CMDPExpireAt   = "PEXPIREAT"
+	CMDExpireTime  = "EXPIRETIME"
+	CMDPExpireTime = "PEXPIRETIME"
+	CMDTTL         = "TTL"
+	CMDPTTL        = "PTTL"
+	CMDPersist     = "PERSIST"
+)
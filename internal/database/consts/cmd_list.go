@@ -0,0 +1,31 @@
+package consts
+
+// list commands
+const (
+	CMDLPush     = "LPUSH"
+	CMDRPush     = "RPUSH"
+	CMDLPushX    = "LPUSHX"
+	CMDRPushX    = "RPUSHX"
+	CMDLPop      = "LPOP"
+	CMDRPop      = "RPOP"
+	CMDLRange    = "LRANGE"
+	CMDLIndex    = "LINDEX"
+	CMDLSet      = "LSET"
+	CMDLRem      = "LREM"
+	CMDLInsert   = "LINSERT"
+	CMDLLen      = "LLEN"
+	CMDLTrim     = "LTRIM"
+	CMDLPos      = "LPOS"
+	CMDLMove     = "LMOVE"
+	CMDRPopLPush = "RPOPLPUSH"
+	CMDLMPop     = "LMPOP"
+)
+
+// blocking list commands
+const (
+	CMDBLPop      = "BLPOP"
+	CMDBRPop      = "BRPOP"
+	CMDBLMove     = "BLMOVE"
+	CMDBRPopLPush = "BRPOPLPUSH"
+	CMDBLMPop     = "BLMPOP"
+)
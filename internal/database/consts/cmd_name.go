@@ -9,12 +9,14 @@ const (
 	CMDUnsubscribe  = "UNSUBSCRIBE"
 	CMDBgRewriteAof = "BGREWRITEAOF"
 	CMDRewriteAof   = "REWRITEAOF"
-	CMDFlushAll     = "flushall"
-	CMDFlushBb      = "FLUSHDB"
+	CMDFlushAll     = "FLUSHALL"
+	CMDFlushDB      = "FLUSHDB"
 	CMDSave         = "SAVE"
 	CMDSelect       = "SELECT"
 	CMDBgSave       = "BGSAVE"
 	CMDCopy         = "COPY"
+	CMDMove         = "MOVE"
+	CMDSwapDB       = "SWAPDB"
 )
 
 //db 事务命令
@@ -23,6 +25,7 @@ const (
 	CMDDiscard = "DISCARD"
 	CMDExec    = "EXEC"
 	CMDWatch   = "WATCH"
+	CMDUnwatch = "UNWATCH"
 )
 
 const (
@@ -0,0 +1,22 @@
+package consts
+
+// set commands
+const (
+	CMDSAdd        = "SADD"
+	CMDSRem        = "SREM"
+	CMDSIsMember   = "SISMEMBER"
+	CMDSMIsMember  = "SMISMEMBER"
+	CMDSMembers    = "SMEMBERS"
+	CMDSCard       = "SCARD"
+	CMDSPop        = "SPOP"
+	CMDSRandMember = "SRANDMEMBER"
+	CMDSMove       = "SMOVE"
+	CMDSInter      = "SINTER"
+	CMDSInterStore = "SINTERSTORE"
+	CMDSInterCard  = "SINTERCARD"
+	CMDSUnion      = "SUNION"
+	CMDSUnionStore = "SUNIONSTORE"
+	CMDSDiff       = "SDIFF"
+	CMDSDiffStore  = "SDIFFSTORE"
+	CMDSScan       = "SSCAN"
+)
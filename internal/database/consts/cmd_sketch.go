@@ -0,0 +1,40 @@
+package consts
+
+// count-min sketch commands
+const (
+	CMDCMSInitByDim  = "CMS.INITBYDIM"
+	CMDCMSInitByProb = "CMS.INITBYPROB"
+	CMDCMSIncrBy     = "CMS.INCRBY"
+	CMDCMSQuery      = "CMS.QUERY"
+	CMDCMSMerge      = "CMS.MERGE"
+	CMDCMSInfo       = "CMS.INFO"
+	CMDCMSScanDump   = "CMS.SCANDUMP"
+	CMDCMSLoadChunk  = "CMS.LOADCHUNK"
+)
+
+// top-k commands
+const (
+	CMDTopKReserve   = "TOPK.RESERVE"
+	CMDTopKAdd       = "TOPK.ADD"
+	CMDTopKIncrBy    = "TOPK.INCRBY"
+	CMDTopKQuery     = "TOPK.QUERY"
+	CMDTopKCount     = "TOPK.COUNT"
+	CMDTopKList      = "TOPK.LIST"
+	CMDTopKInfo      = "TOPK.INFO"
+	CMDTopKScanDump  = "TOPK.SCANDUMP"
+	CMDTopKLoadChunk = "TOPK.LOADCHUNK"
+)
+
+// t-digest commands
+const (
+	CMDTDigestCreate    = "TDIGEST.CREATE"
+	CMDTDigestAdd       = "TDIGEST.ADD"
+	CMDTDigestQuantile  = "TDIGEST.QUANTILE"
+	CMDTDigestCDF       = "TDIGEST.CDF"
+	CMDTDigestMerge     = "TDIGEST.MERGE"
+	CMDTDigestMin       = "TDIGEST.MIN"
+	CMDTDigestMax       = "TDIGEST.MAX"
+	CMDTDigestInfo      = "TDIGEST.INFO"
+	CMDTDigestScanDump  = "TDIGEST.SCANDUMP"
+	CMDTDigestLoadChunk = "TDIGEST.LOADCHUNK"
+)
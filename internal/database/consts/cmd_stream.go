@@ -0,0 +1,20 @@
+package consts
+
+// stream commands
+const (
+	CMDXAdd       = "XADD"
+	CMDXRange     = "XRANGE"
+	CMDXRevRange  = "XREVRANGE"
+	CMDXLen       = "XLEN"
+	CMDXDel       = "XDEL"
+	CMDXTrim      = "XTRIM"
+	CMDXSetID     = "XSETID"
+	CMDXRead      = "XREAD"
+	CMDXReadGroup = "XREADGROUP"
+	CMDXGroup     = "XGROUP"
+	CMDXAck       = "XACK"
+	CMDXPending   = "XPENDING"
+	CMDXClaim     = "XCLAIM"
+	CMDXAutoClaim = "XAUTOCLAIM"
+	CMDXInfo      = "XINFO"
+)
@@ -0,0 +1,29 @@
+package consts
+
+// string commands
+const (
+	CMDSet      = "SET"
+	CMDSetNX    = "SETNX"
+	CMDSetEX    = "SETEX"
+	CMDPSetEX   = "PSETEX"
+	CMDGet      = "GET"
+	CMDGetSet   = "GETSET"
+	CMDGetDel   = "GETDEL"
+	CMDGetEX    = "GETEX"
+	CMDMSet     = "MSET"
+	CMDMSetNX   = "MSETNX"
+	CMDMGet     = "MGET"
+	CMDAppend   = "APPEND"
+	CMDStrLen   = "STRLEN"
+	CMDSetRange = "SETRANGE"
+	CMDGetRange = "GETRANGE"
+)
+
+// counter commands
+const (
+	CMDIncr        = "INCR"
+	CMDIncrBy      = "INCRBY"
+	CMDIncrByFloat = "INCRBYFLOAT"
+	CMDDecr        = "DECR"
+	CMDDecrBy      = "DECRBY"
+)
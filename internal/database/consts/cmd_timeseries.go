@@ -0,0 +1,16 @@
+package consts
+
+// time series commands
+const (
+	CMDTSCreate     = "TS.CREATE"
+	CMDTSAdd        = "TS.ADD"
+	CMDTSMAdd       = "TS.MADD"
+	CMDTSGet        = "TS.GET"
+	CMDTSRange      = "TS.RANGE"
+	CMDTSRevRange   = "TS.REVRANGE"
+	CMDTSMRange     = "TS.MRANGE"
+	CMDTSMRevRange  = "TS.MREVRANGE"
+	CMDTSCreateRule = "TS.CREATERULE"
+	CMDTSDeleteRule = "TS.DELETERULE"
+	CMDTSInfo       = "TS.INFO"
+)
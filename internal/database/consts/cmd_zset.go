@@ -0,0 +1,43 @@
+package consts
+
+// sorted set commands
+const (
+	CMDZAdd             = "ZADD"
+	CMDZScore           = "ZSCORE"
+	CMDZMScore          = "ZMSCORE"
+	CMDZIncrBy          = "ZINCRBY"
+	CMDZCard            = "ZCARD"
+	CMDZCount           = "ZCOUNT"
+	CMDZRank            = "ZRANK"
+	CMDZRevRank         = "ZREVRANK"
+	CMDZRem             = "ZREM"
+	CMDZRemRangeByScore = "ZREMRANGEBYSCORE"
+	CMDZRemRangeByRank  = "ZREMRANGEBYRANK"
+	CMDZPopMin          = "ZPOPMIN"
+	CMDZPopMax          = "ZPOPMAX"
+	CMDZRandMember      = "ZRANDMEMBER"
+	CMDZRange           = "ZRANGE"
+	CMDZRangeStore      = "ZRANGESTORE"
+	CMDZRevRange        = "ZREVRANGE"
+	CMDZRangeByScore    = "ZRANGEBYSCORE"
+	CMDZRevRangeByScore = "ZREVRANGEBYSCORE"
+	CMDZRangeByLex      = "ZRANGEBYLEX"
+	CMDZRevRangeByLex   = "ZREVRANGEBYLEX"
+	CMDZLexCount        = "ZLEXCOUNT"
+	CMDZRemRangeByLex   = "ZREMRANGEBYLEX"
+	CMDZUnion           = "ZUNION"
+	CMDZUnionStore      = "ZUNIONSTORE"
+	CMDZInter           = "ZINTER"
+	CMDZInterStore      = "ZINTERSTORE"
+	CMDZDiff            = "ZDIFF"
+	CMDZDiffStore       = "ZDIFFSTORE"
+	CMDZMPop            = "ZMPOP"
+	CMDZScan            = "ZSCAN"
+)
+
+// blocking sorted set commands
+const (
+	CMDBZPopMin = "BZPOPMIN"
+	CMDBZPopMax = "BZPOPMAX"
+	CMDBZMPop   = "BZMPOP"
+)
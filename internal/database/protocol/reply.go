@@ -8,7 +8,7 @@ import (
 )
 
 var (
-	nullBulkReplyBytes = []byte("$-1")
+	nullBulkReplyBytes = []byte("$-1\r\n")
 
 	// CRLF is the line separator of redis serialization protocol
 	CRLF = "\r\n"
@@ -30,7 +30,7 @@ func MakeBulkReply(arg []byte) *BulkReply {
 
 // ToBytes marshal client.Reply
 func (r *BulkReply) ToBytes() []byte {
-	if len(r.Arg) == 0 {
+	if r.Arg == nil {
 		return nullBulkReplyBytes
 	}
 	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
@@ -58,3 +58,43 @@ func ValidateArity(arity int, cmdArgs [][]byte) bool {
 func NoPrepare(args [][]byte) ([]string, []string) {
 	return nil, nil
 }
+
+// ReadFirstKey returns the first arg as read key
+func ReadFirstKey(args [][]byte) ([]string, []string) {
+	// assert len(args) > 0
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+// WriteFirstKey returns the first arg as write key
+func WriteFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+// WriteAllKeys returns all args as write keys
+func WriteAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+// ReadAllKeys returns all args as read keys
+func ReadAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+// WriteFirstReadOthers returns the first arg as write key and the others as read keys
+func WriteFirstReadOthers(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args)-1)
+	for i, v := range args[1:] {
+		keys[i] = string(v)
+	}
+	return []string{string(args[0])}, keys
+}
@@ -0,0 +1,602 @@
+package single_db
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/bitmap"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- Bitmap Commands ----
+ * bitmaps are string values, redis numbers bits of a byte from the most significant one,
+ * while bitmap.bitmap numbers them from the least significant one
+ */
+
+// maxBitOffset is the max bit offset of a string value
+const maxBitOffset = maxStringSize * 8
+
+// toBitmapOffset converts redis bit offset into the offset of bitmap.bitmap
+func toBitmapOffset(offset int64) int64 {
+	return offset&^7 | (7 - offset&7)
+}
+
+func parseBitOffset(raw []byte) (int64, protocol.ErrorReply) {
+	offset, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || offset < 0 || offset >= maxBitOffset {
+		return 0, protocol.MakeErrReply("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// growString extends bytes with zeros to at least size bytes. Bitmaps are modified in place, and the spare capacity
+// is reused, so that setting bits one by one costs amortized O(1) rather than copying the whole value every time
+func growString(bytes []byte, size int64) []byte {
+	if size <= int64(len(bytes)) {
+		return bytes
+	}
+	return append(bytes, make([]byte, size-int64(len(bytes)))...)
+}
+
+// execSetBit sets or clears the bit at offset of the string value, and returns the original bit
+func execSetBit(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	var val byte
+	switch string(args[2]) {
+	case "0":
+		val = 0
+	case "1":
+		val = 1
+	default:
+		return protocol.MakeErrReply("ERR bit is not an integer or out of range")
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	// modified in place, values in replies are copies
+	bytes = growString(bytes, offset>>3+1)
+	bm := bitmap.FromBytes(bytes)
+	original := bm.GetBit(toBitmapOffset(offset))
+	bm.SetBit(toBitmapOffset(offset), val)
+	db.PutEntity(key, &IDB.DataEntity{Data: bytes})
+	return protocol.MakeIntReply(int64(original))
+}
+
+// execGetBit returns the bit at offset of the string value, bits beyond the string are 0
+func execGetBit(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	bm := bitmap.FromBytes(bytes)
+	return protocol.MakeIntReply(int64(bm.GetBit(toBitmapOffset(offset))))
+}
+
+// parseBitRange parses start and end of BITCOUNT and BITPOS with an optional BYTE|BIT unit,
+// and returns the range of bits [startBit, endBit). ok is false when the range is empty
+func parseBitRange(startArg, endArg, unitArg []byte, size int64) (startBit, endBit int64, ok bool, errReply protocol.ErrorReply) {
+	start, errReply := parseInt(startArg)
+	if errReply != nil {
+		return 0, 0, false, errReply
+	}
+	end, errReply := parseInt(endArg)
+	if errReply != nil {
+		return 0, 0, false, errReply
+	}
+	unit := "BYTE"
+	if unitArg != nil {
+		unit = strings.ToUpper(string(unitArg))
+	}
+	switch unit {
+	case "BYTE":
+		start, end, ok = normalizeRange(start, end, size)
+		return start * 8, end * 8, ok, nil
+	case "BIT":
+		start, end, ok = normalizeRange(start, end, size*8)
+		return start, end, ok, nil
+	}
+	return 0, 0, false, protocol.MakeSyntaxErrReply()
+}
+
+// bitCount counts set bits in [startBit, endBit)
+func bitCount(bytes []byte, startBit, endBit int64) int64 {
+	bm := bitmap.FromBytes(bytes)
+	var count int64
+	bm.ForEachByte(int(startBit>>3), int((endBit+7)>>3), func(i int64, b byte) bool {
+		first, last := i*8, i*8+8
+		if first >= startBit && last <= endBit {
+			count += int64(bits.OnesCount8(b))
+			return true
+		}
+		// partial byte at the border of range
+		if first < startBit {
+			first = startBit
+		}
+		if last > endBit {
+			last = endBit
+		}
+		for offset := first; offset < last; offset++ {
+			count += int64(bm.GetBit(toBitmapOffset(offset)))
+		}
+		return true
+	})
+	return count
+}
+
+// execBitCount counts set bits of the string value, optionally within a range of bytes or bits
+func execBitCount(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(len(bytes))
+	startBit, endBit, ok := int64(0), size*8, size > 0
+	if len(args) > 1 {
+		var unit []byte
+		if len(args) == 4 {
+			unit = args[3]
+		}
+		startBit, endBit, ok, errReply = parseBitRange(args[1], args[2], unit, size)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(bitCount(bytes, startBit, endBit))
+}
+
+// bitPos returns offset of the first bit equals to val in [startBit, endBit), or -1 if not found
+func bitPos(bytes []byte, val byte, startBit, endBit int64) int64 {
+	bm := bitmap.FromBytes(bytes)
+	skipped := byte(0)
+	if val == 0 {
+		skipped = 0xff
+	}
+	pos := int64(-1)
+	bm.ForEachByte(int(startBit>>3), int((endBit+7)>>3), func(i int64, b byte) bool {
+		first, last := i*8, i*8+8
+		if b == skipped && first >= startBit && last <= endBit {
+			return true
+		}
+		if first < startBit {
+			first = startBit
+		}
+		if last > endBit {
+			last = endBit
+		}
+		for offset := first; offset < last; offset++ {
+			if bm.GetBit(toBitmapOffset(offset)) == val {
+				pos = offset
+				return false
+			}
+		}
+		return true
+	})
+	return pos
+}
+
+// execBitPos returns the position of the first bit set to 1 or 0 in the string value
+func execBitPos(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if len(args) > 5 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	var val byte
+	switch string(args[1]) {
+	case "0":
+		val = 0
+	case "1":
+		val = 1
+	default:
+		return protocol.MakeErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
+		// an absent key is regarded as an infinite string of 0
+		if val == 1 {
+			return protocol.MakeIntReply(-1)
+		}
+		return protocol.MakeIntReply(0)
+	}
+	startArg, endArg := []byte("0"), []byte("-1")
+	var unitArg []byte
+	if len(args) > 2 {
+		startArg = args[2]
+	}
+	if len(args) > 3 {
+		endArg = args[3]
+	}
+	if len(args) > 4 {
+		unitArg = args[4]
+	}
+	startBit, endBit, ok, errReply := parseBitRange(startArg, endArg, unitArg, int64(len(bytes)))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return protocol.MakeIntReply(-1)
+	}
+	pos := bitPos(bytes, val, startBit, endBit)
+	if pos < 0 && val == 0 && len(args) <= 3 {
+		// without end, the string is regarded as padded with 0 on the right
+		pos = endBit
+	}
+	return protocol.MakeIntReply(pos)
+}
+
+// execBitOp performs bitwise operation between strings and stores the result in destination
+func execBitOp(db *DB, args [][]byte) client.Reply {
+	op := strings.ToUpper(string(args[0]))
+	dest := string(args[1])
+	keys := args[2:]
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return protocol.MakeErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+
+	sources := make([][]byte, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		bytes, errReply := db.getAsString(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		sources[i] = bytes
+		if len(bytes) > maxLen {
+			maxLen = len(bytes)
+		}
+	}
+	if maxLen == 0 {
+		db.Remove(dest)
+		return protocol.MakeIntReply(0)
+	}
+
+	// shorter strings are regarded as padded with 0
+	byteAt := func(bytes []byte, i int) byte {
+		if i < len(bytes) {
+			return bytes[i]
+		}
+		return 0
+	}
+	result := make([]byte, maxLen)
+	for i := range result {
+		b := byteAt(sources[0], i)
+		for _, source := range sources[1:] {
+			switch op {
+			case "AND":
+				b &= byteAt(source, i)
+			case "OR":
+				b |= byteAt(source, i)
+			case "XOR":
+				b ^= byteAt(source, i)
+			}
+		}
+		if op == "NOT" {
+			b = ^b
+		}
+		result[i] = b
+	}
+	db.PutEntity(dest, &IDB.DataEntity{Data: result})
+	db.Persist(dest) // override ttl
+	return protocol.MakeIntReply(int64(maxLen))
+}
+
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	return router.WriteFirstReadOthers(args[1:])
+}
+
+func undoBitOp(db *DB, args [][]byte) []router.CmdLine {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+/* ---- BITFIELD ---- */
+
+const (
+	overflowWrap = "WRAP"
+	overflowSat  = "SAT"
+	overflowFail = "FAIL"
+)
+
+// bitfieldOp is a subcommand of BITFIELD
+type bitfieldOp struct {
+	action   string // GET, SET or INCRBY
+	signed   bool
+	width    uint // bits of integer, at most 64 for signed and 63 for unsigned
+	offset   int64
+	value    int64 // value of SET or increment of INCRBY
+	overflow string
+}
+
+func parseBitfieldType(raw []byte) (signed bool, width uint, errReply protocol.ErrorReply) {
+	errReply = protocol.MakeErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	s := string(raw)
+	if len(s) < 2 {
+		return false, 0, errReply
+	}
+	switch s[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+		signed = false
+	default:
+		return false, 0, errReply
+	}
+	n, err := strconv.Atoi(s[1:])
+	if err != nil || n < 1 || n > 64 || (!signed && n == 64) {
+		return false, 0, errReply
+	}
+	return signed, uint(n), nil
+}
+
+// parseBitfieldOffset parses offset of bitfield, offset prefixed with '#' is multiplied by width
+func parseBitfieldOffset(raw []byte, width uint) (int64, protocol.ErrorReply) {
+	errReply := protocol.MakeErrReply("ERR bit offset is not an integer or out of range")
+	s := string(raw)
+	multiply := strings.HasPrefix(s, "#")
+	if multiply {
+		s = s[1:]
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, errReply
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(width) {
+			return 0, errReply
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width) > maxBitOffset {
+		return 0, errReply
+	}
+	return offset, nil
+}
+
+// parseBitfield parses subcommands of BITFIELD, BITFIELD_RO only accepts GET
+func parseBitfield(args [][]byte, readOnly bool) ([]*bitfieldOp, protocol.ErrorReply) {
+	var ops []*bitfieldOp
+	overflow := overflowWrap
+	for i := 0; i < len(args); {
+		action := strings.ToUpper(string(args[i]))
+		if readOnly && action != "GET" {
+			return nil, protocol.MakeErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		switch action {
+		case "OVERFLOW":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			overflow = strings.ToUpper(string(args[i+1]))
+			if overflow != overflowWrap && overflow != overflowSat && overflow != overflowFail {
+				return nil, protocol.MakeErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+		case "GET", "SET", "INCRBY":
+			argNum := 3
+			if action != "GET" {
+				argNum = 4
+			}
+			if i+argNum > len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			signed, width, errReply := parseBitfieldType(args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			offset, errReply := parseBitfieldOffset(args[i+2], width)
+			if errReply != nil {
+				return nil, errReply
+			}
+			op := &bitfieldOp{
+				action:   action,
+				signed:   signed,
+				width:    width,
+				offset:   offset,
+				overflow: overflow,
+			}
+			if action != "GET" {
+				op.value, errReply = parseInt(args[i+3])
+				if errReply != nil {
+					return nil, errReply
+				}
+			}
+			ops = append(ops, op)
+			i += argNum
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return ops, nil
+}
+
+// getBits reads an unsigned integer of width bits from offset
+func getBits(bytes []byte, offset int64, width uint) uint64 {
+	bm := bitmap.FromBytes(bytes)
+	var val uint64
+	for i := int64(0); i < int64(width); i++ {
+		val = val<<1 | uint64(bm.GetBit(toBitmapOffset(offset+i)))
+	}
+	return val
+}
+
+// setBits writes the lowest width bits of val at offset, bytes must be large enough
+func setBits(bytes []byte, offset int64, width uint, val uint64) {
+	bm := bitmap.FromBytes(bytes)
+	for i := int64(width) - 1; i >= 0; i-- {
+		bm.SetBit(toBitmapOffset(offset+i), byte(val&1))
+		val >>= 1
+	}
+}
+
+func (op *bitfieldOp) get(bytes []byte) int64 {
+	val := getBits(bytes, op.offset, op.width)
+	if op.signed && op.width < 64 && val&(1<<(op.width-1)) != 0 {
+		// sign extension
+		val |= math.MaxUint64 << op.width
+	}
+	return int64(val)
+}
+
+// incr returns value+incr of the op type handled by the overflow policy, overflowed is true if it overflows
+func (op *bitfieldOp) incr(value, incr int64) (result int64, overflowed bool) {
+	if op.signed {
+		return signedBitfieldIncr(value, incr, op.width, op.overflow)
+	}
+	res, overflowed := unsignedBitfieldIncr(uint64(value), incr, op.width, op.overflow)
+	return int64(res), overflowed
+}
+
+func unsignedBitfieldIncr(value uint64, incr int64, width uint, overflow string) (uint64, bool) {
+	max := uint64(1)<<width - 1
+	wrapped := (value + uint64(incr)) & max
+	if value > max || (incr > 0 && incr > int64(max-value)) {
+		if overflow == overflowSat {
+			return max, true
+		}
+		return wrapped, true
+	}
+	if incr < 0 && incr < -int64(value) {
+		if overflow == overflowSat {
+			return 0, true
+		}
+		return wrapped, true
+	}
+	return value + uint64(incr), false
+}
+
+func signedBitfieldIncr(value, incr int64, width uint, overflow string) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = int64(1)<<(width-1) - 1
+	}
+	min := -max - 1
+	maxIncr, minIncr := max-value, min-value
+
+	wrapped := uint64(value) + uint64(incr)
+	if width < 64 {
+		if wrapped&(1<<(width-1)) != 0 {
+			wrapped |= math.MaxUint64 << width
+		} else {
+			wrapped &^= math.MaxUint64 << width
+		}
+	}
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return max, true
+		}
+		return int64(wrapped), true
+	}
+	if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == overflowSat {
+			return min, true
+		}
+		return int64(wrapped), true
+	}
+	return value + incr, false
+}
+
+func (db *DB) execBitfield(args [][]byte, readOnly bool) client.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitfield(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var size int64
+	for _, op := range ops {
+		if op.action == "GET" {
+			continue
+		}
+		if end := (op.offset + int64(op.width) + 7) >> 3; end > size {
+			size = end
+		}
+	}
+	written := size > 0
+	if written {
+		// modified in place, values in replies are copies
+		bytes = growString(bytes, size)
+	}
+
+	replies := make([]client.Reply, 0, len(ops))
+	for _, op := range ops {
+		old := op.get(bytes)
+		switch op.action {
+		case "GET":
+			replies = append(replies, protocol.MakeIntReply(old))
+			continue
+		case "SET":
+			val, overflowed := op.incr(op.value, 0)
+			if overflowed && op.overflow == overflowFail {
+				replies = append(replies, protocol.MakeNullBulkReply())
+				continue
+			}
+			setBits(bytes, op.offset, op.width, uint64(val))
+			replies = append(replies, protocol.MakeIntReply(old))
+		case "INCRBY":
+			val, overflowed := op.incr(old, op.value)
+			if overflowed && op.overflow == overflowFail {
+				replies = append(replies, protocol.MakeNullBulkReply())
+				continue
+			}
+			setBits(bytes, op.offset, op.width, uint64(val))
+			replies = append(replies, protocol.MakeIntReply(val))
+		}
+	}
+	if written {
+		db.PutEntity(key, &IDB.DataEntity{Data: bytes})
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execBitField treats the string value as an array of integers of arbitrary width and offset
+func execBitField(db *DB, args [][]byte) client.Reply {
+	return db.execBitfield(args, false)
+}
+
+// execBitFieldRO is the read-only variant of BITFIELD which only accepts GET
+func execBitFieldRO(db *DB, args [][]byte) client.Reply {
+	return db.execBitfield(args, true)
+}
+
+func init() {
+	registerCommand(consts.CMDSetBit, execSetBit, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDGetBit, execGetBit, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDBitCount, execBitCount, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDBitPos, execBitPos, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDBitOp, execBitOp, prepareBitOp, undoBitOp, -4, router.FlagWrite)
+	registerCommand(consts.CMDBitField, execBitField, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDBitFieldRO, execBitFieldRO, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+}
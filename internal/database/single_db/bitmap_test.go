@@ -0,0 +1,111 @@
+package single_db
+
+import (
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func TestSetBit(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SETBIT b 7 1", ":0")
+	check(t, db, "GET b", "$1 \x01")
+	check(t, db, "SETBIT b 0 1", ":0")
+	check(t, db, "SETBIT b 0 0", ":1")
+	check(t, db, "SETBIT b 0 1", ":0")
+	check(t, db, "GET b", "$1 \x81")
+	check(t, db, "GETBIT b 7", ":1")
+	check(t, db, "GETBIT b 100", ":0")
+	check(t, db, "SETBIT b 2 2", "-ERR bit is not an integer or out of range")
+	check(t, db, "SETBIT b 4294967296 1", "-ERR bit offset is not an integer or out of range")
+	check(t, db, "LPUSH l a", ":1")
+	check(t, db, "SETBIT l 0 1", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestBitCountAndPos(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET s foobar", "+OK")
+	check(t, db, "GETBIT s 1", ":1")
+	check(t, db, "BITCOUNT s", ":26")
+	check(t, db, "BITCOUNT s 0 0", ":4")
+	check(t, db, "BITCOUNT s 1 1", ":6")
+	check(t, db, "BITCOUNT s 1 1 BYTE", ":6")
+	check(t, db, "BITCOUNT s 5 30 BIT", ":17")
+	check(t, db, "BITCOUNT s 1", "-Err syntax error")
+	check(t, db, "BITCOUNT none", ":0")
+	check(t, db, "SET m \xff\xf0\x00", "+OK")
+	check(t, db, "BITPOS m 0", ":12")
+	check(t, db, "SET m2 \x00\xff\xf0", "+OK")
+	check(t, db, "BITPOS m2 1 0", ":8")
+	check(t, db, "BITPOS m2 1 2", ":16")
+	check(t, db, "BITPOS m2 1 2 -1 BYTE", ":16")
+	check(t, db, "BITPOS m2 1 7 15 BIT", ":8")
+	check(t, db, "BITPOS m2 1 7 -3 BIT", ":8")
+	check(t, db, "SET ff \xff\xff", "+OK")
+	check(t, db, "BITPOS ff 0", ":16")
+	check(t, db, "BITPOS ff 0 0 -1", ":-1")
+	check(t, db, "BITPOS none 0", ":0")
+	check(t, db, "BITPOS none 1", ":-1")
+	check(t, db, "BITPOS ff 2", "-ERR The bit argument must be 1 or 0.")
+}
+
+func TestBitOp(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SETBIT b 0 1", ":0")
+	check(t, db, "SETBIT b 7 1", ":0")
+	check(t, db, "SET k1 foobar", "+OK")
+	check(t, db, "SET k2 abcdef", "+OK")
+	check(t, db, "BITOP AND dest k1 k2", ":6")
+	check(t, db, "GET dest", "$6 `bc`ab")
+	check(t, db, "BITOP OR dest k1 b", ":6")
+	check(t, db, "GETRANGE dest 0 1", "$2 \xe7o")
+	check(t, db, "BITOP NOT dest k1 k2", "-ERR BITOP NOT must be called with a single source key.")
+	check(t, db, "BITOP NOT dest b", ":1")
+	check(t, db, "GET dest", "$1 ~")
+	check(t, db, "BITOP XOR dest none", ":0")
+	check(t, db, "EXISTS dest", ":0")
+}
+
+func TestBitField(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "BITFIELD f INCRBY i5 100 1 GET u4 0", "*2 :1 :0")
+	check(t, db, "BITFIELD c INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1", "*2 :1 :1")
+	check(t, db, "BITFIELD c INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1", "*2 :2 :2")
+	check(t, db, "BITFIELD c INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1", "*2 :3 :3")
+	check(t, db, "BITFIELD c INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1", "*2 :0 :3")
+	check(t, db, "BITFIELD c OVERFLOW FAIL INCRBY u2 102 1", "*1 $-1")
+	check(t, db, "BITFIELD bf SET i8 0 -100 GET i8 0 GET u8 0", "*3 :0 :-100 :156")
+	check(t, db, "BITFIELD bf SET u8 #1 255 GET u8 8", "*2 :0 :255")
+	check(t, db, "BITFIELD bf INCRBY i8 0 -100", "*1 :56")
+	check(t, db, "BITFIELD bf OVERFLOW SAT INCRBY i8 0 -200 INCRBY u8 #1 1", "*2 :-128 :255")
+	check(t, db, "BITFIELD bf SET i64 0 -1 GET u63 0 INCRBY i64 0 1", "*3 :-9151595917793558528 :9223372036854775807 :0")
+	check(t, db, "BITFIELD bf GET u64 0", "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	check(t, db, "BITFIELD bf OVERFLOW X", "-ERR Invalid OVERFLOW type specified")
+	check(t, db, "BITFIELD_RO bf GET i8 0", "*1 :0")
+	check(t, db, "BITFIELD_RO bf SET i8 0 1", "-ERR BITFIELD_RO only supports the GET subcommand")
+	check(t, db, "BITFIELD_RO nokey GET i8 0", "*1 :0")
+	check(t, db, "EXISTS nokey", ":0")
+}
+
+func TestSetBitInPlace(t *testing.T) {
+	db := MakeDB(0)
+	// 1 MB bitmap
+	check(t, db, "SETBIT b 8388607 1", ":0")
+	value := func() []byte {
+		entity, _ := db.GetEntity("b")
+		return entity.Data.([]byte)
+	}
+	before := value()
+	reply := db.ExecNormalCommand(utils.ToCmdLine("GET", "b")).(*protocol.BulkReply)
+	check(t, db, "SETBIT b 0 1", ":0")
+	check(t, db, "BITFIELD b SET u8 8 255", "*1 :0")
+	if &value()[0] != &before[0] {
+		t.Error("expect bitmap modified in place")
+	}
+	if reply.Arg[0] != 0 || reply.Arg[1] != 0 {
+		t.Error("expect replied value not modified")
+	}
+	check(t, db, "GETRANGE b 0 1", "$2 \x80\xff")
+	check(t, db, "BITCOUNT b", ":10")
+}
@@ -0,0 +1,435 @@
+package single_db
+
+import (
+	"container/list"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/timewheel"
+)
+
+/* ---- Blocking Commands ---- */
+
+// blockingOp describes how a blocking command waits for and consumes its keys
+type blockingOp struct {
+	// keys to wait for, in the order of trying
+	keys []string
+	// extraKeys should be locked besides the ready key, e.g. destination of BLMOVE
+	extraKeys []string
+	// timeout is 0 means waiting forever
+	timeout time.Duration
+	// serve consumes the given key and returns the reply,
+	// ok is false if the key is not ready. It is invoked with lockKeys(key) locked
+	serve func(db *DB, key string) (reply client.Reply, ok bool)
+	// timeoutReply is replied when no key gets ready before timeout
+	timeoutReply client.Reply
+	// perWaiter means the readiness of key depends on the waiter, e.g. XREAD reads entries after its own IDs.
+	// Such waiters do not wait behind earlier clients, and are tried even if earlier ones are not ready
+	perWaiter bool
+	// readOnly means serve does not modify keys, so versions of keys are kept
+	readOnly bool
+	// noBlock replies timeoutReply at once if no key is ready, e.g. XREAD without BLOCK option
+	noBlock bool
+}
+
+func (op *blockingOp) lockKeys(key string) []string {
+	return append([]string{key}, op.extraKeys...)
+}
+
+// blockingTick is the interval of blockingWheel, timeouts are rounded up to it.
+// It is much shorter than the tick of the default time wheel, since timeouts of blocking
+// commands are often less than a second.
+const blockingTick = 10 * time.Millisecond
+
+// blockingWheel times out blocked clients
+var blockingWheel = timewheel.New(blockingTick, 6000)
+
+func init() {
+	blockingWheel.Start()
+}
+
+// blockingParser parses arguments of a blocking command
+type blockingParser func(args [][]byte) (*blockingOp, protocol.ErrorReply)
+
+// blockingCommands holds parsers of commands which may block the client
+var blockingCommands = make(map[string]blockingParser)
+
+// registerBlockingCommand registers a command which blocks the client until one of its keys gets ready.
+// Inside MULTI or without connection, it is executed as a non-blocking command which times out immediately.
+func registerBlockingCommand(name string, parser blockingParser, prepare router.PreFunc, arity int) {
+	blockingCommands[strings.ToUpper(name)] = parser
+	registerCommand(name, makeNonBlockingExec(parser), prepare, rollbackWriteKeys(prepare), arity, router.FlagWrite)
+}
+
+// registerReadOnlyBlockingCommand registers a blocking command which never modifies its keys, e.g. XREAD
+func registerReadOnlyBlockingCommand(name string, parser blockingParser, prepare router.PreFunc, arity int) {
+	blockingCommands[strings.ToUpper(name)] = parser
+	registerCommand(name, makeNonBlockingExec(parser), prepare, nil, arity, router.FlagReadOnly)
+}
+
+// makeNonBlockingExec returns an executor trying each key once, timeoutReply is replied if no key is ready
+func makeNonBlockingExec(parser blockingParser) execFunc {
+	return func(db *DB, args [][]byte) client.Reply {
+		op, errReply := parser(args)
+		if errReply != nil {
+			return errReply
+		}
+		for _, key := range op.keys {
+			if reply, ok := op.serve(db, key); ok {
+				return reply
+			}
+		}
+		return op.timeoutReply
+	}
+}
+
+// parseTimeout parses timeout in seconds of blocking commands
+func parseTimeout(raw []byte) (time.Duration, protocol.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(seconds) {
+		return 0, protocol.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, protocol.MakeErrReply("ERR timeout is negative")
+	}
+	// float64(math.MaxInt64) is rounded up to 2^63, which overflows Duration too
+	if seconds*float64(time.Second) >= math.MaxInt64 {
+		return 0, protocol.MakeErrReply("ERR timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+var waiterSeq uint64
+
+// waiter is a client blocked by a blocking command
+type waiter struct {
+	conn    client.Connection
+	op      *blockingOp
+	taskKey string // key of timeout job in time wheel
+
+	mu     sync.Mutex
+	done   bool
+	result chan client.Reply
+
+	// elements of waiter in the waiting queue of each key, guarded by blockingRegistry.mu
+	elements map[string]*list.Element
+	removed  bool
+}
+
+func makeWaiter(conn client.Connection, op *blockingOp) *waiter {
+	return &waiter{
+		conn:     conn,
+		op:       op,
+		taskKey:  "blocking:" + strconv.FormatUint(atomic.AddUint64(&waiterSeq, 1), 10),
+		result:   make(chan client.Reply, 1),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// tryFinish wakes up the waiter with the reply made by fn, only one of serving, timeout
+// and client closing can finish a waiter. ok is false if fn can not make a reply
+func (w *waiter) tryFinish(fn func() (reply client.Reply, ok bool)) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return false
+	}
+	reply, ok := fn()
+	if !ok {
+		return false
+	}
+	w.done = true
+	w.result <- reply
+	return true
+}
+
+func (w *waiter) isDone() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.done
+}
+
+// blockingRegistry keeps blocked clients of a db in FIFO queues of each key
+type blockingRegistry struct {
+	mu     sync.Mutex
+	count  int32 // number of waiters, allows checking emptiness without lock
+	queues map[string]*list.List
+	conns  map[client.Connection]*waiter
+}
+
+func makeBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		queues: make(map[string]*list.List),
+		conns:  make(map[client.Connection]*waiter),
+	}
+}
+
+func (r *blockingRegistry) isEmpty() bool {
+	return atomic.LoadInt32(&r.count) == 0
+}
+
+func (r *blockingRegistry) add(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range w.op.keys {
+		if _, ok := w.elements[key]; ok {
+			continue // duplicated key
+		}
+		queue, ok := r.queues[key]
+		if !ok {
+			queue = list.New()
+			r.queues[key] = queue
+		}
+		w.elements[key] = queue.PushBack(w)
+	}
+	r.conns[w.conn] = w
+	atomic.AddInt32(&r.count, 1)
+}
+
+func (r *blockingRegistry) remove(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w.removed {
+		return
+	}
+	w.removed = true
+	for key, e := range w.elements {
+		queue := r.queues[key]
+		queue.Remove(e)
+		if queue.Len() == 0 {
+			delete(r.queues, key)
+		}
+	}
+	if r.conns[w.conn] == w {
+		delete(r.conns, w.conn)
+	}
+	atomic.AddInt32(&r.count, -1)
+}
+
+// waiters returns a snapshot of waiters of key in FIFO order
+func (r *blockingRegistry) waiters(key string) []*waiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue, ok := r.queues[key]
+	if !ok {
+		return nil
+	}
+	waiters := make([]*waiter, 0, queue.Len())
+	for e := queue.Front(); e != nil; e = e.Next() {
+		waiters = append(waiters, e.Value.(*waiter))
+	}
+	return waiters
+}
+
+func (r *blockingRegistry) hasWaiters(key string) bool {
+	if r.isEmpty() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.queues[key]
+	return ok
+}
+
+func (r *blockingRegistry) getByConn(c client.Connection) *waiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conns[c]
+}
+
+// getBlocking returns the registry of clients blocked in db
+func (db *DB) getBlocking() *blockingRegistry {
+	return db.blocking.Load().(*blockingRegistry)
+}
+
+// keys returns keys waited by blocked clients
+func (r *blockingRegistry) keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.queues))
+	for key := range r.queues {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// execBlocking executes a blocking command, it parks the client until one of keys gets ready or timeout
+func (db *DB) execBlocking(c client.Connection, cmdLine [][]byte, parser blockingParser) client.Reply {
+	cmdName := strings.ToUpper(string(cmdLine[0]))
+	cmd, _ := router.GetCmdCommand(cmdName)
+	if !router.ValidateArity(cmd.Arity, cmdLine) {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+	op, errReply := parser(cmdLine[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	writeKeys := append(append([]string{}, op.keys...), op.extraKeys...)
+	db.RWLocks(writeKeys, nil)
+	// the registry is not swapped while keys are locked
+	blocking := db.getBlocking()
+	for _, key := range op.keys {
+		if !op.perWaiter && blocking.hasWaiters(key) {
+			// earlier clients are waiting for this key
+			continue
+		}
+		if reply, ok := op.serve(db, key); ok {
+			if !op.readOnly {
+				db.addVersion(op.lockKeys(key)...)
+			}
+			db.RWUnLocks(writeKeys, nil)
+			db.serveExtraKeys(op)
+			return reply
+		}
+	}
+	if op.noBlock {
+		db.RWUnLocks(writeKeys, nil)
+		return op.timeoutReply
+	}
+
+	// park the client, it must be registered before unlock, otherwise the push may be missed
+	w := makeWaiter(c, op)
+	blocking.add(w)
+	if op.timeout > 0 {
+		// the current tick has partly elapsed, one more tick makes sure the client is not timed out early
+		blockingWheel.AddJob(op.timeout+blockingTick, w.taskKey, func() {
+			if w.tryFinish(func() (client.Reply, bool) { return op.timeoutReply, true }) {
+				blocking.remove(w)
+			}
+		})
+	}
+	db.RWUnLocks(writeKeys, nil)
+	return <-w.result
+}
+
+// serveBlocked wakes up clients blocked by the given keys in FIFO order, invoker should not hold locks of keys
+func (db *DB) serveBlocked(keys []string) {
+	blocking := db.getBlocking()
+	if blocking.isEmpty() {
+		return
+	}
+	for _, key := range keys {
+		db.serveBlockedKey(blocking, key)
+	}
+}
+
+// serveBlockedKey serves clients of blocking waiting for key, it stops if blocking is swapped out of db
+func (db *DB) serveBlockedKey(blocking *blockingRegistry, key string) {
+	for {
+		progressed := false
+		exhausted := false // whether the key is not ready for waiters which are not perWaiter
+		for _, w := range blocking.waiters(key) {
+			if exhausted && !w.op.perWaiter {
+				continue
+			}
+			served, swapped := db.serveWaiter(blocking, w, key)
+			if swapped {
+				// clients are served by the database swapped in, see Swap
+				return
+			}
+			if served {
+				blocking.remove(w)
+				blockingWheel.RemoveJob(w.taskKey)
+				db.serveExtraKeys(w.op)
+				progressed = true
+				continue
+			}
+			if w.isDone() {
+				// finished by timeout, client closing or another key
+				blocking.remove(w)
+				continue
+			}
+			if !w.op.perWaiter {
+				exhausted = true
+			}
+		}
+		// clients blocked during serving are not in the snapshot, check again
+		if !progressed {
+			return
+		}
+	}
+}
+
+// serveExtraKeys wakes up clients blocked by keys written by a served op besides the ready key,
+// e.g. the destination of BLMOVE. Invoker should not hold locks of keys
+func (db *DB) serveExtraKeys(op *blockingOp) {
+	if !op.readOnly {
+		db.serveBlocked(op.extraKeys)
+	}
+}
+
+// serveWaiter tries to finish the waiter of blocking by the given key, returns whether it is served,
+// and whether blocking is no longer the registry of db
+func (db *DB) serveWaiter(blocking *blockingRegistry, w *waiter, key string) (served bool, swapped bool) {
+	lockKeys := w.op.lockKeys(key)
+	db.RWLocks(lockKeys, nil)
+	defer db.RWUnLocks(lockKeys, nil)
+	if db.getBlocking() != blocking {
+		return false, true
+	}
+	served = w.tryFinish(func() (client.Reply, bool) {
+		reply, ok := w.op.serve(db, key)
+		if !ok {
+			return nil, false
+		}
+		if _, isErr := reply.(protocol.ErrorReply); isErr {
+			// key holds a value of wrong type, keep blocking as redis does
+			return nil, false
+		}
+		if !w.op.readOnly {
+			db.addVersion(lockKeys...)
+		}
+		return reply, true
+	})
+	return served, false
+}
+
+// AfterClientClose releases the client blocked in db
+func (db *DB) AfterClientClose(c client.Connection) {
+	blocking := db.getBlocking()
+	w := blocking.getByConn(c)
+	if w == nil {
+		return
+	}
+	if w.tryFinish(func() (client.Reply, bool) { return &protocol.NoReply{}, true }) {
+		blocking.remove(w)
+		blockingWheel.RemoveJob(w.taskKey)
+	}
+}
+
+// Swap exchanges clients blocked in db and other when the databases are swapped,
+// so that blocked clients stay with the database index they selected like redis.
+// Keys waited by them may be ready in the database swapped in, so they are served at once.
+// Keys watched in both databases are modified as well.
+func (db *DB) Swap(other *DB) {
+	// no client is being blocked or served during swapping
+	unlock := LockAll([]*DB{db, other})
+	db.SwapLocked(other)
+	unlock()
+	db.ServeAllBlocked()
+	other.ServeAllBlocked()
+}
+
+// SwapLocked exchanges blocked clients like Swap, invoker should lock all keys of both databases
+// and serve blocked clients after unlocking
+func (db *DB) SwapLocked(other *DB) {
+	blocking, otherBlocking := db.getBlocking(), other.getBlocking()
+	db.blocking.Store(otherBlocking)
+	other.blocking.Store(blocking)
+	// keys watched in both databases are modified by swapping
+	atomic.AddUint32(&db.epoch, 1)
+	atomic.AddUint32(&other.epoch, 1)
+}
+
+// ServeAllBlocked serves clients blocked by any key, invoker should not hold locks of keys
+func (db *DB) ServeAllBlocked() {
+	db.serveBlocked(db.getBlocking().keys())
+}
@@ -0,0 +1,168 @@
+package single_db
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+)
+
+// waitBlocked waits until n clients are blocked in db
+func waitBlocked(t *testing.T, db *DB, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&db.getBlocking().count) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d blocked clients, got %d", n, atomic.LoadInt32(&db.getBlocking().count))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// goConn executes line from conn in another goroutine, and returns the channel of its reply
+func goConn(db *DB, conn *tcp.FakeConn, line string) <-chan string {
+	result := make(chan string, 1)
+	go func() {
+		result <- runConn(db, conn, line)
+	}()
+	return result
+}
+
+func TestBlockingPop(t *testing.T) {
+	db := MakeDB(0)
+	c1, c2, c3 := &tcp.FakeConn{}, &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, db, "RPUSH l a", ":1")
+	checkConn(t, db, c1, "BLPOP x l 0", "*2 $1 l $1 a")
+
+	res1 := goConn(db, c1, "BLPOP l m 0")
+	waitBlocked(t, db, 1)
+	res2 := goConn(db, c2, "BRPOP m l 0")
+	waitBlocked(t, db, 2)
+	res3 := goConn(db, c3, "BLMOVE l dst LEFT RIGHT 0")
+	waitBlocked(t, db, 3)
+	// clients are served in the order of blocking
+	check(t, db, "RPUSH l v1 v2", ":2")
+	if got := <-res1; got != "*2 $1 l $2 v1" {
+		t.Error(got)
+	}
+	if got := <-res2; got != "*2 $1 l $2 v2" {
+		t.Error(got)
+	}
+	check(t, db, "LPUSH l v3", ":1")
+	if got := <-res3; got != "$2 v3" {
+		t.Error(got)
+	}
+	check(t, db, "LRANGE dst 0 -1", "*1 $2 v3")
+	check(t, db, "EXISTS l", ":0")
+	if !db.getBlocking().isEmpty() {
+		t.Error("expect no blocked clients")
+	}
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	db := MakeDB(0)
+	c := &tcp.FakeConn{}
+	checkConn(t, db, c, "BLMPOP 0.5 2 a b LEFT COUNT 2", "*-1")
+	checkConn(t, db, c, "BLMOVE a b LEFT LEFT 0.5", "$-1")
+	checkConn(t, db, c, "BLPOP q -1", "-ERR timeout is negative")
+	checkConn(t, db, c, "BLPOP q x", "-ERR timeout is not a float or out of range")
+	checkConn(t, db, c, "BLPOP q nan", "-ERR timeout is not a float or out of range")
+	checkConn(t, db, c, "BLPOP q 1e300", "-ERR timeout is out of range")
+	checkConn(t, db, c, "BRPOPLPUSH q d 9223372037", "-ERR timeout is out of range")
+	if !db.getBlocking().isEmpty() {
+		t.Error("expect no blocked clients")
+	}
+}
+
+func TestBlockingMoveServesDest(t *testing.T) {
+	db := MakeDB(0)
+	c1, c2, c3 := &tcp.FakeConn{}, &tcp.FakeConn{}, &tcp.FakeConn{}
+	res2 := goConn(db, c2, "BLPOP dst 0")
+	waitBlocked(t, db, 1)
+	res1 := goConn(db, c1, "BLMOVE src dst LEFT RIGHT 0")
+	waitBlocked(t, db, 2)
+	// the element moved by the woken BLMOVE wakes up the client blocked by dst
+	check(t, db, "RPUSH src a", ":1")
+	if got := <-res1; got != "$1 a" {
+		t.Error(got)
+	}
+	if got := <-res2; got != "*2 $3 dst $1 a" {
+		t.Error(got)
+	}
+
+	res3 := goConn(db, c3, "BLPOP dst2 0")
+	waitBlocked(t, db, 1)
+	// the same for BLMOVE served at once
+	check(t, db, "RPUSH src b", ":1")
+	checkConn(t, db, c1, "BRPOPLPUSH src dst2 0", "$1 b")
+	if got := <-res3; got != "*2 $4 dst2 $1 b" {
+		t.Error(got)
+	}
+	check(t, db, "EXISTS src dst dst2", ":0")
+}
+
+func TestBlockingSubSecondTimeout(t *testing.T) {
+	db := MakeDB(0)
+	c := &tcp.FakeConn{}
+	start := time.Now()
+	checkConn(t, db, c, "BLPOP q 0.2", "*-1")
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("expect timeout after 200ms, got %s", elapsed)
+	}
+}
+
+func TestBlockingClientClose(t *testing.T) {
+	db := MakeDB(0)
+	c := &tcp.FakeConn{}
+	res := goConn(db, c, "BLPOP q 0")
+	waitBlocked(t, db, 1)
+	db.AfterClientClose(c)
+	<-res
+	if !db.getBlocking().isEmpty() {
+		t.Error("expect no blocked clients")
+	}
+	check(t, db, "RPUSH q 1", ":1")
+	check(t, db, "LLEN q", ":1")
+}
+
+func TestBlockingWrongType(t *testing.T) {
+	db := MakeDB(0)
+	c := &tcp.FakeConn{}
+	check(t, db, "SET s 1", "+OK")
+	checkConn(t, db, c, "BLPOP s 0", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestNonBlockingPop(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "RPUSH q 1", ":1")
+	check(t, db, "LMPOP 2 z q RIGHT COUNT 5", "*2 $1 q *1 $1 1")
+	check(t, db, "LMPOP 0 z q RIGHT", "-ERR numkeys should be greater than 0")
+	// commands without connection never block
+	check(t, db, "BLPOP q 0", "*-1")
+}
+
+func TestBlockingZPop(t *testing.T) {
+	db := MakeDB(0)
+	c1, c2 := &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, db, "ZADD z 1 a 2 b 3 c", ":3")
+	check(t, db, "ZMPOP 2 x z MAX COUNT 2", "*2 $1 z *2 *2 $1 c $1 3 *2 $1 b $1 2")
+	checkConn(t, db, c1, "BZPOPMIN x z 0", "*3 $1 z $1 a $1 1")
+	res1 := goConn(db, c1, "BZPOPMAX q z 0")
+	waitBlocked(t, db, 1)
+	res2 := goConn(db, c2, "BZMPOP 0 1 z MIN COUNT 5")
+	waitBlocked(t, db, 2)
+	check(t, db, "ZADD z 1 a 2 b 3 c", ":3")
+	if got := <-res1; got != "*3 $1 z $1 c $1 3" {
+		t.Error(got)
+	}
+	if got := <-res2; got != "*2 $1 z *2 *2 $1 a $1 1 *2 $1 b $1 2" {
+		t.Error(got)
+	}
+	check(t, db, "EXISTS z", ":0")
+	checkConn(t, db, c1, "BZMPOP 0.2 1 z MIN", "*-1")
+	checkConn(t, db, c1, "BZMPOP 0 1 z FOO", "-Err syntax error")
+	if !db.getBlocking().isEmpty() {
+		t.Error("expect no blocked clients")
+	}
+}
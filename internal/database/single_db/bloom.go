@@ -0,0 +1,342 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/bloom"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+/* ---- Bloom Filter Commands ----
+ * compatible with RedisBloom, a filter is created with default parameters if absent when adding
+ */
+
+const (
+	bloomDefaultErrorRate = 0.01
+	bloomDefaultCapacity  = 100
+	bloomDefaultExpansion = 2
+
+	// dumpChunkSize is the max size of chunk replied by SCANDUMP
+	dumpChunkSize = 16 << 20
+)
+
+func (db *DB) getAsBloom(key string) (*bloom.Filter, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	filter, ok := entity.Data.(*bloom.Filter)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return filter, nil
+}
+
+func (db *DB) getOrInitBloom(key string) (*bloom.Filter, protocol.ErrorReply) {
+	filter, errReply := db.getAsBloom(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if filter == nil {
+		filter = bloom.New(bloomDefaultCapacity, bloomDefaultErrorRate, bloomDefaultExpansion)
+		db.PutEntity(key, &IDB.DataEntity{Data: filter})
+	}
+	return filter, nil
+}
+
+// execBFReserve creates an empty bloom filter with the given error rate and capacity
+func execBFReserve(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR bad error rate")
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return protocol.MakeErrReply("ERR (0 < error rate range < 1)")
+	}
+	capacity, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR bad capacity")
+	}
+	if capacity <= 0 {
+		return protocol.MakeErrReply("ERR (capacity should be larger than 0)")
+	}
+	expansion := int64(bloomDefaultExpansion)
+	expansionGiven, nonScaling := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NONSCALING":
+			nonScaling = true
+		case "EXPANSION":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			expansion, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || expansion > int64(^uint32(0)) {
+				return protocol.MakeErrReply("ERR bad expansion")
+			}
+			if expansion < 1 {
+				return protocol.MakeErrReply("ERR expansion should be greater or equal to 1")
+			}
+			expansionGiven = true
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if nonScaling {
+		if expansionGiven {
+			return protocol.MakeErrReply("ERR Nonscaling filters cannot expand")
+		}
+		expansion = 0
+	}
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR item exists")
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: bloom.New(uint64(capacity), errorRate, uint32(expansion))})
+	return protocol.MakeOkReply()
+}
+
+func makeBloomAddReply(filter *bloom.Filter, item []byte) client.Reply {
+	added, err := filter.Add(item)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	if added {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execBFAdd adds an item into bloom filter, returns 0 if it may exist
+func execBFAdd(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getOrInitBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return makeBloomAddReply(filter, args[1])
+}
+
+// execBFMAdd adds items into bloom filter, the error of a full filter is replied in place of the item
+func execBFMAdd(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getOrInitBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		replies = append(replies, makeBloomAddReply(filter, item))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execBFExists returns whether the item may exist in bloom filter
+func execBFExists(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter != nil && filter.Exists(args[1]) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execBFMExists returns whether each item may exist in bloom filter
+func execBFMExists(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		if filter != nil && filter.Exists(item) {
+			replies = append(replies, protocol.MakeIntReply(1))
+		} else {
+			replies = append(replies, protocol.MakeIntReply(0))
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execBFInfo returns parameters of bloom filter, or only one of them if specified
+func execBFInfo(db *DB, args [][]byte) client.Reply {
+	if len(args) > 2 {
+		return protocol.MakeArgNumErrReply(consts.CMDBFInfo)
+	}
+	filter, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	var expansion client.Reply = protocol.MakeIntReply(int64(filter.Expansion()))
+	if filter.Expansion() == 0 {
+		expansion = protocol.MakeNullBulkReply()
+	}
+	fields := []struct {
+		option string
+		name   string
+		value  client.Reply
+	}{
+		{"CAPACITY", "Capacity", protocol.MakeIntReply(int64(filter.Capacity()))},
+		{"SIZE", "Size", protocol.MakeIntReply(int64(filter.Size()))},
+		{"FILTERS", "Number of filters", protocol.MakeIntReply(int64(filter.FilterCount()))},
+		{"ITEMS", "Number of items inserted", protocol.MakeIntReply(int64(filter.Items()))},
+		{"EXPANSION", "Expansion rate", expansion},
+	}
+	if len(args) == 2 {
+		option := strings.ToUpper(string(args[1]))
+		for _, field := range fields {
+			if field.option == option {
+				return protocol.MakeMultiRawReply([]client.Reply{field.value})
+			}
+		}
+		return protocol.MakeErrReply("ERR Invalid information value")
+	}
+	replies := make([]client.Reply, 0, 2*len(fields))
+	for _, field := range fields {
+		replies = append(replies, protocol.MakeBulkReply([]byte(field.name)), field.value)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+/* ---- dump and restore of probabilistic filters and sketches ----
+ * SCANDUMP replies the header at iterator 0, then chunks of data, iterator 0 means the end.
+ * LOADCHUNK with the replied iterator and chunk restores the value, so they can be rebuilt by commands
+ */
+
+// chunkDumper is a probabilistic filter or sketch which can be dumped into chunks
+type chunkDumper interface {
+	Header() []byte
+	DataLen() int
+	ReadData(offset, size int) []byte
+	WriteData(offset int, data []byte) error
+}
+
+func parseChunkIterator(raw []byte) (int64, protocol.ErrorReply) {
+	iter, errReply := parseInt(raw)
+	if errReply != nil {
+		return 0, errReply
+	}
+	if iter < 0 {
+		return 0, protocol.MakeErrReply("ERR invalid iterator")
+	}
+	return iter, nil
+}
+
+// scanDump returns the chunk at iter and the iterator of the next one
+func scanDump(dumper chunkDumper, iter int64) (next int64, chunk []byte) {
+	if iter == 0 {
+		return 1, dumper.Header()
+	}
+	offset := iter - 1
+	if offset >= int64(dumper.DataLen()) {
+		return 0, nil
+	}
+	chunk = dumper.ReadData(int(offset), dumpChunkSize)
+	// the iterator replied with a chunk points to the end of the chunk
+	return iter + int64(len(chunk)), chunk
+}
+
+func makeScanDumpReply(dumper chunkDumper, iter int64) client.Reply {
+	next, chunk := scanDump(dumper, iter)
+	if chunk == nil {
+		chunk = []byte{}
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeIntReply(next),
+		protocol.MakeBulkReply(chunk),
+	})
+}
+
+// loadChunk writes a data chunk replied by SCANDUMP with iterator iter
+func loadChunk(dumper chunkDumper, iter int64, chunk []byte) protocol.ErrorReply {
+	offset := iter - 1 - int64(len(chunk))
+	if offset < 0 || offset > int64(dumper.DataLen()) {
+		return protocol.MakeErrReply("ERR invalid offset - cannot load chunk")
+	}
+	if err := dumper.WriteData(int(offset), chunk); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return nil
+}
+
+// dumpToCmdLines serializes dumper to LOADCHUNK command lines
+func dumpToCmdLines(cmdName, key string, dumper chunkDumper) []router.CmdLine {
+	var cmdLines []router.CmdLine
+	for iter := int64(0); ; {
+		next, chunk := scanDump(dumper, iter)
+		if next == 0 {
+			break
+		}
+		cmdLines = append(cmdLines, utils.ToCmdLine3(cmdName, []byte(key), []byte(strconv.FormatInt(next, 10)), chunk))
+		iter = next
+	}
+	return cmdLines
+}
+
+// execBFScanDump dumps bloom filter in chunks
+func execBFScanDump(db *DB, args [][]byte) client.Reply {
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	filter, errReply := db.getAsBloom(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	return makeScanDumpReply(filter, iter)
+}
+
+// execBFLoadChunk restores bloom filter from chunks replied by BF.SCANDUMP
+func execBFLoadChunk(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	filter, errReply := db.getAsBloom(key)
+	if errReply != nil {
+		return errReply
+	}
+	if iter == 1 {
+		if filter != nil {
+			return protocol.MakeErrReply("ERR item exists")
+		}
+		filter, err := bloom.FromHeader(args[2])
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		db.PutEntity(key, &IDB.DataEntity{Data: filter})
+		return protocol.MakeOkReply()
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	if errReply := loadChunk(filter, iter, args[2]); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDBFReserve, execBFReserve, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDBFAdd, execBFAdd, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDBFMAdd, execBFMAdd, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDBFExists, execBFExists, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDBFMExists, execBFMExists, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDBFInfo, execBFInfo, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDBFScanDump, execBFScanDump, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDBFLoadChunk, execBFLoadChunk, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+}
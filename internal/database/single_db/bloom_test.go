@@ -0,0 +1,73 @@
+package single_db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+// copyByChunks copies src to dest by SCANDUMP and LOADCHUNK of the given command prefix, such as BF
+func copyByChunks(t *testing.T, db *DB, prefix, src, dest string) {
+	t.Helper()
+	iter := "0"
+	for {
+		r, ok := db.ExecNormalCommand(utils.ToCmdLine(prefix+".SCANDUMP", src, iter)).(*protocol.MultiRawReply)
+		if !ok {
+			t.Fatalf("%s.SCANDUMP %s %s: expect multi reply", prefix, src, iter)
+		}
+		next := r.Replies[0].(*protocol.IntReply).Code
+		if next == 0 {
+			return
+		}
+		iter = strconv.FormatInt(next, 10)
+		chunk := r.Replies[1].(*protocol.BulkReply).Arg
+		cmdLine := utils.ToCmdLine(prefix+".LOADCHUNK", dest, iter)
+		if r := db.ExecNormalCommand(append(cmdLine, chunk)); protocol.IsErrorReply(r) {
+			t.Fatal(string(r.ToBytes()))
+		}
+	}
+}
+
+func TestBloom(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "BF.RESERVE b 0.01 10 NONSCALING", "+OK")
+	check(t, db, "BF.RESERVE b 0.01 10", "-ERR item exists")
+	check(t, db, "BF.RESERVE c 2 10", "-ERR (0 < error rate range < 1)")
+	check(t, db, "BF.RESERVE c 0.1 0", "-ERR (capacity should be larger than 0)")
+	check(t, db, "BF.RESERVE c 0.1 10 NONSCALING EXPANSION 2", "-ERR Nonscaling filters cannot expand")
+	check(t, db, "BF.ADD b a", ":1")
+	check(t, db, "BF.ADD b a", ":0")
+	check(t, db, "BF.EXISTS b a", ":1")
+	check(t, db, "BF.EXISTS b zz", ":0")
+	check(t, db, "BF.EXISTS nokey zz", ":0")
+	check(t, db, "TYPE b", "+MBbloom--")
+	for i := 0; i < 20; i++ {
+		run(db, "BF.ADD b x"+strconv.Itoa(i))
+	}
+	check(t, db, "BF.ADD b final", "-ERR non scaling filter is full")
+	check(t, db, "BF.MADD b q w e", "*3 -ERR non scaling filter is full -ERR non scaling filter is full -ERR non scaling filter is full")
+	check(t, db, "BF.INFO b", "*10 $8 Capacity :10 $4 Size :64 $17 Number of filters :1 $24 Number of items inserted :10 $14 Expansion rate $-1")
+}
+
+func TestBloomScaling(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "BF.MADD s a b c", "*3 :1 :1 :1")
+	for i := 0; i < 500; i++ {
+		run(db, "BF.ADD s y"+strconv.Itoa(i))
+	}
+	check(t, db, "BF.INFO s CAPACITY", "*1 :700")
+	check(t, db, "BF.INFO s FILTERS", "*1 :3")
+	check(t, db, "BF.MEXISTS s a y499 zzz", "*3 :1 :1 :0")
+
+	info := run(db, "BF.INFO s")
+	replayUndo(t, db, "s")
+	check(t, db, "BF.INFO s", info)
+	check(t, db, "BF.MEXISTS s a y499", "*2 :1 :1")
+
+	copyByChunks(t, db, "BF", "s", "s2")
+	check(t, db, "BF.INFO s2", info)
+	check(t, db, "BF.MEXISTS s2 a y499 zzz", "*3 :1 :1 :0")
+	check(t, db, "BF.LOADCHUNK s2 1 x", "-ERR item exists")
+}
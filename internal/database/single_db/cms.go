@@ -0,0 +1,256 @@
+package single_db
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/cms"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- Count-Min Sketch Commands ----
+ * compatible with RedisBloom, a sketch must be initialized before incrementing
+ */
+
+// cmsMaxCounters limits the memory of a sketch
+const cmsMaxCounters = 1 << 28
+
+func (db *DB) getAsCMS(key string) (*cms.Sketch, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	sketch, ok := entity.Data.(*cms.Sketch)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return sketch, nil
+}
+
+// getExistedCMS returns the sketch of key or an error reply if it does not exist
+func (db *DB) getExistedCMS(key string) (*cms.Sketch, protocol.ErrorReply) {
+	sketch, errReply := db.getAsCMS(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if sketch == nil {
+		return nil, protocol.MakeErrReply("ERR CMS: key does not exist")
+	}
+	return sketch, nil
+}
+
+func makeCMSTooLargeErr() protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR CMS: width * depth is too large")
+}
+
+func (db *DB) putNewCMS(key string, sketch *cms.Sketch) client.Reply {
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR CMS: key already exists")
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: sketch})
+	return protocol.MakeOkReply()
+}
+
+// execCMSInitByDim creates a sketch of the given width and depth
+func execCMSInitByDim(db *DB, args [][]byte) client.Reply {
+	width, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil || width == 0 {
+		return protocol.MakeErrReply("ERR CMS: invalid width")
+	}
+	depth, err := strconv.ParseUint(string(args[2]), 10, 32)
+	if err != nil || depth == 0 {
+		return protocol.MakeErrReply("ERR CMS: invalid depth")
+	}
+	if width*depth > cmsMaxCounters {
+		return makeCMSTooLargeErr()
+	}
+	return db.putNewCMS(string(args[0]), cms.New(uint32(width), uint32(depth)))
+}
+
+// execCMSInitByProb creates a sketch whose estimation exceeds the real count by at most
+// errorRate * total count with the probability of 1 - prob
+func execCMSInitByProb(db *DB, args [][]byte) client.Reply {
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || !(errorRate > 0 && errorRate < 1) {
+		return protocol.MakeErrReply("ERR CMS: invalid overestimation value")
+	}
+	prob, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || !(prob > 0 && prob < 1) {
+		return protocol.MakeErrReply("ERR CMS: invalid prob value")
+	}
+	width := math.Ceil(2 / errorRate)
+	depth := math.Ceil(math.Log10(prob) / math.Log10(0.5))
+	if width*depth > cmsMaxCounters {
+		return makeCMSTooLargeErr()
+	}
+	return db.putNewCMS(string(args[0]), cms.New(uint32(width), uint32(depth)))
+}
+
+// execCMSIncrBy increases counts of items, replies the estimated counts after increasing
+func execCMSIncrBy(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 1 {
+		return protocol.MakeArgNumErrReply(consts.CMDCMSIncrBy)
+	}
+	increments := make([]uint32, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		increment, err := strconv.ParseUint(string(args[i]), 10, 32)
+		if err != nil {
+			return protocol.MakeErrReply("ERR CMS: Cannot parse number")
+		}
+		increments = append(increments, uint32(increment))
+	}
+	sketch, errReply := db.getExistedCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(increments))
+	for i, increment := range increments {
+		count, err := sketch.IncrBy(args[1+2*i], increment)
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		replies[i] = protocol.MakeIntReply(int64(count))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execCMSQuery returns the estimated counts of items
+func execCMSQuery(db *DB, args [][]byte) client.Reply {
+	sketch, errReply := db.getExistedCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		replies[i] = protocol.MakeIntReply(int64(sketch.Query(item)))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// parseNumKeys parses numKeys of commands like CMS.MERGE destKey numKeys sourceKey...
+func parseNumKeys(args [][]byte) (int, bool) {
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-2 {
+		return 0, false
+	}
+	return numKeys, true
+}
+
+// prepareMerge locks the destination for writing and sources for reading
+// of commands like CMS.MERGE destKey numKeys sourceKey...
+func prepareMerge(args [][]byte) ([]string, []string) {
+	numKeys, ok := parseNumKeys(args)
+	if !ok {
+		return []string{string(args[0])}, nil
+	}
+	readKeys := make([]string, numKeys)
+	for i := range readKeys {
+		readKeys[i] = string(args[2+i])
+	}
+	return []string{string(args[0])}, readKeys
+}
+
+// execCMSMerge overwrites the destination with the weighted sum of sources
+func execCMSMerge(db *DB, args [][]byte) client.Reply {
+	numKeys, ok := parseNumKeys(args)
+	if !ok {
+		return protocol.MakeErrReply("ERR CMS: invalid numkeys")
+	}
+	weights := make([]int64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if rest := args[2+numKeys:]; len(rest) > 0 {
+		if strings.ToUpper(string(rest[0])) != "WEIGHTS" || len(rest)-1 != numKeys {
+			return protocol.MakeSyntaxErrReply()
+		}
+		for i, raw := range rest[1:] {
+			weight, err := strconv.ParseInt(string(raw), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR CMS: invalid weight value")
+			}
+			weights[i] = weight
+		}
+	}
+	dest, errReply := db.getExistedCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	sources := make([]*cms.Sketch, numKeys)
+	for i := range sources {
+		sources[i], errReply = db.getExistedCMS(string(args[2+i]))
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if err := dest.Merge(sources, weights); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return protocol.MakeOkReply()
+}
+
+// execCMSInfo returns parameters of sketch
+func execCMSInfo(db *DB, args [][]byte) client.Reply {
+	sketch, errReply := db.getExistedCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte("width")), protocol.MakeIntReply(int64(sketch.Width())),
+		protocol.MakeBulkReply([]byte("depth")), protocol.MakeIntReply(int64(sketch.Depth())),
+		protocol.MakeBulkReply([]byte("count")), protocol.MakeIntReply(int64(sketch.Count())),
+	})
+}
+
+// execCMSScanDump dumps sketch in chunks
+func execCMSScanDump(db *DB, args [][]byte) client.Reply {
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	sketch, errReply := db.getExistedCMS(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return makeScanDumpReply(sketch, iter)
+}
+
+// execCMSLoadChunk restores sketch from chunks replied by CMS.SCANDUMP
+func execCMSLoadChunk(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if iter == 1 {
+		sketch, err := cms.FromHeader(args[2])
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return db.putNewCMS(key, sketch)
+	}
+	sketch, errReply := db.getExistedCMS(key)
+	if errReply != nil {
+		return errReply
+	}
+	if errReply := loadChunk(sketch, iter, args[2]); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDCMSInitByDim, execCMSInitByDim, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDCMSInitByProb, execCMSInitByProb, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDCMSIncrBy, execCMSIncrBy, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDCMSQuery, execCMSQuery, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDCMSMerge, execCMSMerge, prepareMerge, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDCMSInfo, execCMSInfo, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDCMSScanDump, execCMSScanDump, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDCMSLoadChunk, execCMSLoadChunk, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+}
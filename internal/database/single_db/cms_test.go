@@ -0,0 +1,31 @@
+package single_db
+
+import "testing"
+
+func TestCountMinSketch(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "CMS.INITBYDIM c 0 5", "-ERR CMS: invalid width")
+	check(t, db, "CMS.INITBYDIM c 1000 5", "+OK")
+	check(t, db, "CMS.INITBYDIM c 1000 5", "-ERR CMS: key already exists")
+	check(t, db, "CMS.INITBYPROB p 0.001 0.01", "+OK")
+	check(t, db, "CMS.INFO p", "*6 $5 width :2000 $5 depth :7 $5 count :0")
+	check(t, db, "CMS.INCRBY c a 3 b 5", "*2 :3 :5")
+	check(t, db, "CMS.INCRBY c a", "-ERR wrong number of arguments for 'CMS.INCRBY' command")
+	check(t, db, "CMS.INCRBY c a -1", "-ERR CMS: Cannot parse number")
+	check(t, db, "CMS.INCRBY nokey a 1", "-ERR CMS: key does not exist")
+	check(t, db, "CMS.QUERY c a b x", "*3 :3 :5 :0")
+	check(t, db, "CMS.INITBYDIM d 1000 5", "+OK")
+	check(t, db, "CMS.INCRBY d a 1", "*1 :1")
+	check(t, db, "CMS.MERGE d 2 c d WEIGHTS 2 1", "+OK")
+	check(t, db, "CMS.QUERY d a b", "*2 :7 :10")
+	check(t, db, "CMS.MERGE d 2 c p", "-ERR CMS: width/depth is not equal")
+	check(t, db, "CMS.MERGE d 3 c p", "-ERR CMS: invalid numkeys")
+	check(t, db, "TYPE d", "+CMSk-TYPE")
+
+	replayUndo(t, db, "d")
+	check(t, db, "CMS.INFO d", "*6 $5 width :1000 $5 depth :5 $5 count :17")
+	check(t, db, "CMS.QUERY d a b", "*2 :7 :10")
+	copyByChunks(t, db, "CMS", "d", "d2")
+	check(t, db, "CMS.INFO d2", "*6 $5 width :1000 $5 depth :5 $5 count :17")
+	check(t, db, "CMS.QUERY d2 a b", "*2 :7 :10")
+}
@@ -0,0 +1,194 @@
+package single_db
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/timewheel"
+)
+
+/* ---- Operations Across Databases ----
+ * MOVE, COPY and FLUSHDB are dispatched by standalone.MultiDB which knows all databases.
+ * Keys in two databases are locked in the order of db index to avoid dead lock between opposite moves.
+ * Methods named Locked are used by transactions across databases, which lock all keys by LockAll.
+ */
+
+// lockPair locks srcKey in src and destKey in dest for writing, and returns the function to unlock them
+func lockPair(src, dest *DB, srcKey, destKey string) (unlock func()) {
+	if src == dest {
+		keys := []string{srcKey, destKey}
+		src.RWLocks(keys, nil)
+		return func() {
+			src.RWUnLocks(keys, nil)
+		}
+	}
+	first, second := src, dest
+	firstKeys, secondKeys := []string{srcKey}, []string{destKey}
+	if dest.index < src.index {
+		first, second = dest, src
+		firstKeys, secondKeys = secondKeys, firstKeys
+	}
+	first.RWLocks(firstKeys, nil)
+	second.RWLocks(secondKeys, nil)
+	return func() {
+		second.RWUnLocks(secondKeys, nil)
+		first.RWUnLocks(firstKeys, nil)
+	}
+}
+
+// MoveKey moves key with its ttl into dest, returns false if key does not exist in db or already exists in dest
+func (db *DB) MoveKey(dest *DB, key string) bool {
+	unlock := lockPair(db, dest, key, key)
+	moved := db.MoveKeyLocked(dest, key)
+	unlock()
+	if moved {
+		dest.serveBlocked([]string{key})
+	}
+	return moved
+}
+
+// MoveKeyLocked moves key like MoveKey, invoker should lock key in both databases and serve blocked clients
+func (db *DB) MoveKeyLocked(dest *DB, key string) bool {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return false
+	}
+	if _, exists = dest.GetEntity(key); exists {
+		return false
+	}
+	dest.PutEntity(key, entity)
+	if expireTime, ok := db.getExpireTime(key); ok {
+		dest.Expire(key, expireTime)
+	}
+	db.Remove(key)
+	db.addVersion(key)
+	dest.addVersion(key)
+	return true
+}
+
+// CopyKey copies the value of srcKey with its ttl to destKey of dest, which may be db itself.
+// It returns false if srcKey does not exist or destKey exists and replace is false.
+func (db *DB) CopyKey(dest *DB, srcKey, destKey string, replace bool) bool {
+	unlock := lockPair(db, dest, srcKey, destKey)
+	copied := db.CopyKeyLocked(dest, srcKey, destKey, replace)
+	unlock()
+	if copied {
+		dest.serveBlocked([]string{destKey})
+	}
+	return copied
+}
+
+// CopyKeyLocked copies srcKey like CopyKey, invoker should lock both keys and serve blocked clients
+func (db *DB) CopyKeyLocked(dest *DB, srcKey, destKey string, replace bool) bool {
+	entity, exists := db.GetEntity(srcKey)
+	if !exists {
+		return false
+	}
+	if _, exists = dest.GetEntity(destKey); exists && !replace {
+		return false
+	}
+	dest.Remove(destKey)
+	// the value is copied by command lines rebuilding it, the same as undo logs
+	for _, cmdLine := range entityToCmdLines(destKey, entity) {
+		dest.execLocked(cmdLine)
+	}
+	if expireTime, ok := db.getExpireTime(srcKey); ok {
+		dest.Expire(destKey, expireTime)
+	}
+	dest.addVersion(destKey)
+	return true
+}
+
+// execLocked executes cmdLine whose keys are locked by invoker
+func (db *DB) execLocked(cmdLine router.CmdLine) client.Reply {
+	cmd, _ := router.GetCmdCommand(strings.ToUpper(string(cmdLine[0])))
+	return cmd.Executor(db, cmdLine[1:])
+}
+
+// Flush removes all keys in db, it waits for running commands and blocks commands on any key until finished.
+// Keys are removed at once by swapping in empty dicts, then expire jobs of flushed keys are cancelled,
+// in background if async. Flushed values are released by garbage collector.
+func (db *DB) Flush(async bool) {
+	db.locker.LockAll()
+	flushed := db.FlushLocked()
+	db.locker.UnLockAll()
+	flushed.Release(async)
+}
+
+// Flushed holds keys removed by FlushLocked, which are restored if the flush is rolled back
+type Flushed struct {
+	db     *DB
+	data   *dict.ConcurrentDict
+	ttlMap *dict.ConcurrentDict
+}
+
+// FlushLocked removes all keys like Flush, invoker should lock all keys and release the result after unlocking
+func (db *DB) FlushLocked() *Flushed {
+	// NoPrepare commands like SCAN may run concurrently, Detach is safe with them
+	flushed := &Flushed{
+		db:     db,
+		data:   db.data.Detach(),
+		ttlMap: db.ttlMap.Detach(),
+	}
+	// modifies watched keys
+	atomic.AddUint32(&db.epoch, 1)
+	return flushed
+}
+
+// Restore puts flushed keys back, invoker should lock all keys. Keys set after flushing are overwritten.
+func (f *Flushed) Restore() {
+	f.data.ForEach(func(key string, val interface{}) bool {
+		f.db.data.Put(key, val)
+		return true
+	})
+	f.ttlMap.ForEach(func(key string, val interface{}) bool {
+		// reschedules the expire job in case it is replaced by a key set after flushing
+		f.db.Expire(key, val.(time.Time))
+		return true
+	})
+}
+
+// Release cancels expire jobs of flushed keys, in background if async. Invoker should not hold locks of keys.
+func (f *Flushed) Release(async bool) {
+	if async {
+		go f.cancelExpireJobs()
+	} else {
+		f.cancelExpireJobs()
+	}
+}
+
+func (f *Flushed) cancelExpireJobs() {
+	db := f.db
+	f.ttlMap.ForEach(func(key string, _ interface{}) bool {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		// the key may be set again with ttl after flushing, whose job has the same task key
+		if _, ok := db.ttlMap.Get(key); !ok {
+			timewheel.Cancel(db.genExpireTask(key))
+		}
+		db.RWUnLocks(keys, nil)
+		return true
+	})
+}
+
+// LockAll locks all keys of dbs in the order of db index, and returns the function to unlock them
+func LockAll(dbs []*DB) (unlock func()) {
+	sorted := make([]*DB, len(dbs))
+	copy(sorted, dbs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].index < sorted[j].index
+	})
+	for _, db := range sorted {
+		db.locker.LockAll()
+	}
+	return func() {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			sorted[i].locker.UnLockAll()
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/cuckoo"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- Cuckoo Filter Commands ----
+ * compatible with RedisBloom, a filter is created with default parameters if absent when adding
+ */
+
+const (
+	cuckooDefaultCapacity      = 1024
+	cuckooDefaultBucketSize    = 2
+	cuckooDefaultMaxIterations = 20
+	cuckooDefaultExpansion     = 1
+)
+
+func (db *DB) getAsCuckoo(key string) (*cuckoo.Filter, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	filter, ok := entity.Data.(*cuckoo.Filter)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return filter, nil
+}
+
+// parseRangedUint parses an integer option in [min, max]
+func parseRangedUint(raw []byte, min, max int64, errMsg string) (int64, protocol.ErrorReply) {
+	val, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || val < min || val > max {
+		return 0, protocol.MakeErrReply(errMsg)
+	}
+	return val, nil
+}
+
+// execCFReserve creates an empty cuckoo filter
+func execCFReserve(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	capacity, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || capacity <= 0 {
+		return protocol.MakeErrReply("ERR Bad capacity")
+	}
+	bucketSize := int64(cuckooDefaultBucketSize)
+	maxIterations := int64(cuckooDefaultMaxIterations)
+	expansion := int64(cuckooDefaultExpansion)
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var errReply protocol.ErrorReply
+		switch strings.ToUpper(string(args[i])) {
+		case "BUCKETSIZE":
+			bucketSize, errReply = parseRangedUint(args[i+1], 1, 255, "ERR Bad bucket size")
+		case "MAXITERATIONS":
+			maxIterations, errReply = parseRangedUint(args[i+1], 1, 65535,
+				"ERR MAXITERATIONS: value must be an integer between 1 and 65535, inclusive.")
+		case "EXPANSION":
+			expansion, errReply = parseRangedUint(args[i+1], 0, 32768,
+				"ERR EXPANSION: value must be an integer between 0 and 32768, inclusive.")
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if capacity < bucketSize*2 {
+		return protocol.MakeErrReply("ERR Capacity must be at least (BucketSize * 2)")
+	}
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR item exists")
+	}
+	filter := cuckoo.New(uint64(capacity), uint16(bucketSize), uint16(maxIterations), uint16(expansion))
+	db.PutEntity(key, &IDB.DataEntity{Data: filter})
+	return protocol.MakeOkReply()
+}
+
+func (db *DB) getOrInitCuckoo(key string) (*cuckoo.Filter, protocol.ErrorReply) {
+	filter, errReply := db.getAsCuckoo(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if filter == nil {
+		filter = cuckoo.New(cuckooDefaultCapacity, cuckooDefaultBucketSize, cuckooDefaultMaxIterations, cuckooDefaultExpansion)
+		db.PutEntity(key, &IDB.DataEntity{Data: filter})
+	}
+	return filter, nil
+}
+
+// execCFAdd adds an item into cuckoo filter, an item can be added multiple times
+func execCFAdd(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getOrInitCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if err := filter.Add(args[1]); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return protocol.MakeIntReply(1)
+}
+
+// execCFAddNX adds an item into cuckoo filter only if it does not exist
+func execCFAddNX(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getOrInitCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	added, err := filter.AddNX(args[1])
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	if added {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execCFDel removes an occurrence of item from cuckoo filter
+func execCFDel(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR Not found")
+	}
+	if filter.Delete(args[1]) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execCFExists returns whether the item may exist in cuckoo filter
+func execCFExists(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter != nil && filter.Exists(args[1]) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execCFCount returns the estimated number of times the item was added
+func execCFCount(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(filter.Count(args[1]))
+}
+
+// execCFInfo returns parameters of cuckoo filter
+func execCFInfo(db *DB, args [][]byte) client.Reply {
+	filter, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte("Size")), protocol.MakeIntReply(int64(filter.Size())),
+		protocol.MakeBulkReply([]byte("Number of buckets")), protocol.MakeIntReply(int64(filter.NumBuckets())),
+		protocol.MakeBulkReply([]byte("Number of filters")), protocol.MakeIntReply(int64(filter.FilterCount())),
+		protocol.MakeBulkReply([]byte("Number of items inserted")), protocol.MakeIntReply(int64(filter.Items())),
+		protocol.MakeBulkReply([]byte("Number of items deleted")), protocol.MakeIntReply(int64(filter.Deletes())),
+		protocol.MakeBulkReply([]byte("Bucket size")), protocol.MakeIntReply(int64(filter.BucketSize())),
+		protocol.MakeBulkReply([]byte("Expansion rate")), protocol.MakeIntReply(int64(filter.Expansion())),
+		protocol.MakeBulkReply([]byte("Max iterations")), protocol.MakeIntReply(int64(filter.MaxIterations())),
+	})
+}
+
+// execCFScanDump dumps cuckoo filter in chunks
+func execCFScanDump(db *DB, args [][]byte) client.Reply {
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	filter, errReply := db.getAsCuckoo(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	return makeScanDumpReply(filter, iter)
+}
+
+// execCFLoadChunk restores cuckoo filter from chunks replied by CF.SCANDUMP
+func execCFLoadChunk(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	filter, errReply := db.getAsCuckoo(key)
+	if errReply != nil {
+		return errReply
+	}
+	if iter == 1 {
+		if filter != nil {
+			return protocol.MakeErrReply("ERR item exists")
+		}
+		filter, err := cuckoo.FromHeader(args[2])
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		db.PutEntity(key, &IDB.DataEntity{Data: filter})
+		return protocol.MakeOkReply()
+	}
+	if filter == nil {
+		return protocol.MakeErrReply("ERR not found")
+	}
+	if errReply := loadChunk(filter, iter, args[2]); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDCFReserve, execCFReserve, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDCFAdd, execCFAdd, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDCFAddNX, execCFAddNX, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDCFDel, execCFDel, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDCFExists, execCFExists, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDCFCount, execCFCount, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDCFInfo, execCFInfo, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDCFScanDump, execCFScanDump, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDCFLoadChunk, execCFLoadChunk, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+}
@@ -0,0 +1,75 @@
+package single_db
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var cuckooInfoField = regexp.MustCompile(`\$\d+ ([A-Za-z ]+) :(\d+)`)
+
+// cuckooInfo returns fields of CF.INFO key
+func cuckooInfo(t *testing.T, db *DB, key string) map[string]int64 {
+	t.Helper()
+	info := make(map[string]int64)
+	for _, m := range cuckooInfoField.FindAllStringSubmatch(run(db, "CF.INFO "+key), -1) {
+		info[m[1]], _ = strconv.ParseInt(m[2], 10, 64)
+	}
+	if len(info) != 8 {
+		t.Fatalf("unexpected CF.INFO %s: %v", key, info)
+	}
+	return info
+}
+
+func TestCuckoo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "CF.RESERVE c 1", "-ERR Capacity must be at least (BucketSize * 2)")
+	check(t, db, "CF.RESERVE c 100 BUCKETSIZE 0", "-ERR Bad bucket size")
+	check(t, db, "CF.RESERVE c 100 BUCKETSIZE 4 EXPANSION 0", "+OK")
+	check(t, db, "CF.ADD c a", ":1")
+	check(t, db, "CF.ADD c a", ":1")
+	check(t, db, "CF.ADDNX c a", ":0")
+	check(t, db, "CF.COUNT c a", ":2")
+	check(t, db, "CF.EXISTS c a", ":1")
+	check(t, db, "CF.DEL c a", ":1")
+	check(t, db, "CF.COUNT c a", ":1")
+	check(t, db, "CF.DEL nokey a", "-ERR Not found")
+	check(t, db, "TYPE c", "+MBbloomCF")
+	for i := 0; i < 200; i++ {
+		run(db, "CF.ADD c x"+strconv.Itoa(i))
+	}
+	// a filter not expanding is full after filling nearly all of its 128 slots
+	check(t, db, "CF.ADD c more", "-ERR Filter is full")
+	info := cuckooInfo(t, db, "c")
+	if items := info["Number of items inserted"]; items < 100 || items > 128 {
+		t.Errorf("unexpected number of items: %d", items)
+	}
+	if info["Number of filters"] != 1 || info["Number of buckets"] != 32 || info["Size"] != 168 {
+		t.Errorf("unexpected CF.INFO: %v", info)
+	}
+}
+
+func TestCuckooExpansion(t *testing.T) {
+	db := MakeDB(0)
+	for i := 0; i < 3000; i++ {
+		run(db, "CF.ADD d y"+strconv.Itoa(i))
+	}
+	// each filter has 1024 slots
+	fields := cuckooInfo(t, db, "d")
+	if filters := fields["Number of filters"]; filters < 3 || filters > 6 {
+		t.Errorf("unexpected number of filters: %d", filters)
+	}
+	if fields["Number of items inserted"] != 3000 || fields["Number of buckets"] != 512 || fields["Expansion rate"] != 1 {
+		t.Errorf("unexpected CF.INFO: %v", fields)
+	}
+	check(t, db, "CF.EXISTS d y2999", ":1")
+
+	info := run(db, "CF.INFO d")
+	replayUndo(t, db, "d")
+	check(t, db, "CF.INFO d", info)
+	check(t, db, "CF.EXISTS d y2999", ":1")
+
+	copyByChunks(t, db, "CF", "d", "d2")
+	check(t, db, "CF.INFO d2", info)
+	check(t, db, "CF.COUNT d2 y1234", ":1")
+}
@@ -0,0 +1,102 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/config"
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/list"
+	"github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/datastruct/stream"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- Compact Encodings ----
+ * Small hashes, sorted sets and lists are encoded in listpack, small sets in intset or listpack.
+ * They convert themselves to hashtable, skiplist or quicklist once they exceed the thresholds in config.Properties,
+ * so values stored into db should be created by the constructors below.
+ */
+
+// embstrMaxLen is the max length of strings in embstr encoding of redis
+const embstrMaxLen = 44
+
+func makeHash() *dict.CompactDict {
+	return dict.MakeCompact(config.Properties.HashMaxListpackEntries, config.Properties.HashMaxListpackValue)
+}
+
+func makeSet(members ...string) *set.Set {
+	return set.MakeCompact(set.Limits{
+		MaxIntSetEntries:   config.Properties.SetMaxIntsetEntries,
+		MaxListPackEntries: config.Properties.SetMaxListpackEntries,
+		MaxListPackValue:   config.Properties.SetMaxListpackValue,
+	}, members...)
+}
+
+func makeZSet() *zset.ZSet {
+	return zset.NewCompact(config.Properties.ZSetMaxListpackEntries, config.Properties.ZSetMaxListpackValue)
+}
+
+func makeList() *list.CompactList {
+	return list.NewCompact(config.Properties.ListMaxListpackSize)
+}
+
+// objectEncoding returns the encoding of entity reported by OBJECT ENCODING
+func objectEncoding(entity *IDB.DataEntity) string {
+	switch data := entity.Data.(type) {
+	case []byte:
+		if v, err := strconv.ParseInt(string(data), 10, 64); err == nil && strconv.FormatInt(v, 10) == string(data) {
+			return "int"
+		}
+		if len(data) <= embstrMaxLen {
+			return "embstr"
+		}
+		return "raw"
+	case *list.CompactList:
+		return data.Encoding()
+	case list.List:
+		return list.EncodingQuickList
+	case *dict.CompactDict:
+		return data.Encoding()
+	case dict.Dict:
+		return dict.EncodingHashTable
+	case *set.Set:
+		return data.Encoding()
+	case *zset.ZSet:
+		return data.Encoding()
+	case *stream.Stream:
+		return "stream"
+	}
+	// module types
+	return "raw"
+}
+
+// execObject inspects the internal of value by subcommand ENCODING
+func execObject(db *DB, args [][]byte) client.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	if subCmd != "ENCODING" || len(args) != 2 {
+		return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" +
+			string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	entity, exists := db.GetEntity(string(args[1]))
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply([]byte(objectEncoding(entity)))
+}
+
+func prepareObject(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+func init() {
+	registerCommand(consts.CMDObject, execObject, prepareObject, nil, -2, router.FlagReadOnly)
+}
@@ -0,0 +1,79 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pluming/aurora/config"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "OBJECT ENCODING none", "$-1")
+	check(t, db, "SET s 123", "+OK")
+	check(t, db, "OBJECT ENCODING s", "$3 int")
+	check(t, db, "SET s 0123", "+OK")
+	check(t, db, "OBJECT ENCODING s", "$6 embstr")
+	check(t, db, "SET s "+strings.Repeat("a", 45), "+OK")
+	check(t, db, "OBJECT ENCODING s", "$3 raw")
+	check(t, db, "OBJECT FOO s", "-ERR unknown subcommand or wrong number of arguments for 'FOO'. Try OBJECT HELP.")
+
+	check(t, db, "HSET h f v", ":1")
+	check(t, db, "OBJECT ENCODING h", "$8 listpack")
+	for i := 0; i < 128; i++ {
+		run(db, "HSET h f"+strconv.Itoa(i)+" v")
+	}
+	check(t, db, "OBJECT ENCODING h", "$9 hashtable")
+	check(t, db, "HLEN h", ":129")
+	check(t, db, "HSET h2 f "+strings.Repeat("a", 65), ":1")
+	check(t, db, "OBJECT ENCODING h2", "$9 hashtable")
+
+	check(t, db, "SADD st 1 2 3", ":3")
+	check(t, db, "OBJECT ENCODING st", "$6 intset")
+	check(t, db, "SADD st a", ":1")
+	check(t, db, "OBJECT ENCODING st", "$8 listpack")
+	check(t, db, "SISMEMBER st 2", ":1")
+	check(t, db, "SADD st "+strings.Repeat("a", 65), ":1")
+	check(t, db, "OBJECT ENCODING st", "$9 hashtable")
+	check(t, db, "SCARD st", ":5")
+	check(t, db, "SADD st2 1 2", ":2")
+	check(t, db, "SUNIONSTORE st3 st2 st2", ":2")
+	check(t, db, "OBJECT ENCODING st3", "$6 intset")
+
+	check(t, db, "ZADD z 1 a 2 b 1.5 c", ":3")
+	check(t, db, "OBJECT ENCODING z", "$8 listpack")
+	check(t, db, "ZRANGE z 0 -1 WITHSCORES", "*6 $1 a $1 1 $1 c $3 1.5 $1 b $1 2")
+	check(t, db, "ZADD z 3 "+strings.Repeat("a", 65), ":1")
+	check(t, db, "OBJECT ENCODING z", "$8 skiplist")
+	check(t, db, "ZCARD z", ":4")
+
+	check(t, db, "RPUSH l a b c", ":3")
+	check(t, db, "OBJECT ENCODING l", "$8 listpack")
+	check(t, db, "LRANGE l 0 -1", "*3 $1 a $1 b $1 c")
+	check(t, db, "RPUSH l "+strings.Repeat("a", 9000), ":4")
+	check(t, db, "OBJECT ENCODING l", "$9 quicklist")
+	check(t, db, "LINDEX l 1", "$1 b")
+	check(t, db, "XADD x 1-1 f v", "$3 1-1")
+	check(t, db, "OBJECT ENCODING x", "$6 stream")
+}
+
+func TestEncodingThresholds(t *testing.T) {
+	properties := *config.Properties
+	defer func() {
+		*config.Properties = properties
+	}()
+	config.Properties.HashMaxListpackEntries = 2
+	config.Properties.SetMaxIntsetEntries = 0
+	config.Properties.ZSetMaxListpackEntries = 0
+	db := MakeDB(0)
+	check(t, db, "HSET h a 1 b 2", ":2")
+	check(t, db, "OBJECT ENCODING h", "$8 listpack")
+	check(t, db, "HSET h c 3", ":1")
+	check(t, db, "OBJECT ENCODING h", "$9 hashtable")
+	// 0 disables the encoding
+	check(t, db, "SADD s 1", ":1")
+	check(t, db, "OBJECT ENCODING s", "$8 listpack")
+	check(t, db, "ZADD z 1 a", ":1")
+	check(t, db, "OBJECT ENCODING z", "$8 skiplist")
+}
@@ -0,0 +1,205 @@
+package single_db
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+// options of expire commands since redis 7.0
+const (
+	expireNX = 1 << iota // set expiry only when the key has no expiry
+	expireXX             // set expiry only when the key has an existing expiry
+	expireGT             // set expiry only when the new expiry is greater than current one
+	expireLT             // set expiry only when the new expiry is less than current one
+)
+
+func parseExpireFlags(args [][]byte) (int, protocol.ErrorReply) {
+	flags := 0
+	for _, arg := range args {
+		option := strings.ToUpper(string(arg))
+		switch option {
+		case "NX":
+			flags |= expireNX
+		case "XX":
+			flags |= expireXX
+		case "GT":
+			flags |= expireGT
+		case "LT":
+			flags |= expireLT
+		default:
+			return 0, protocol.MakeErrReply("ERR Unsupported option " + string(arg))
+		}
+	}
+	if flags&expireNX > 0 && flags&(expireXX|expireGT|expireLT) > 0 {
+		return 0, protocol.MakeErrReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT > 0 && flags&expireLT > 0 {
+		return 0, protocol.MakeErrReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// expireWithUnit parses `key time [NX|XX|GT|LT]` and sets the expire time of key.
+// unit is time.Second or time.Millisecond, absolute means time is an unix timestamp
+func expireWithUnit(db *DB, args [][]byte, unit time.Duration, absolute bool, cmdName string) client.Reply {
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	flags, errReply := parseExpireFlags(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	invalidErr := protocol.MakeErrReply("ERR invalid expire time in '" + strings.ToLower(cmdName) + "' command")
+	ms := raw
+	if unit == time.Second {
+		if raw > math.MaxInt64/1000 || raw < math.MinInt64/1000 {
+			return invalidErr
+		}
+		ms = raw * 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return invalidErr
+		}
+		ms += now
+	}
+	return protocol.MakeIntReply(db.expireGeneric(key, time.UnixMilli(ms), flags))
+}
+
+// expireGeneric sets the expire time of key following flags, returns 1 if the expire time is set
+func (db *DB) expireGeneric(key string, expireTime time.Time, flags int) int64 {
+	if _, exists := db.GetEntity(key); !exists {
+		return 0
+	}
+	current, hasTTL := db.getExpireTime(key)
+	if flags&expireNX > 0 && hasTTL {
+		return 0
+	}
+	if flags&expireXX > 0 && !hasTTL {
+		return 0
+	}
+	// a key without ttl is considered as having an infinite ttl
+	if flags&expireGT > 0 && (!hasTTL || !expireTime.After(current)) {
+		return 0
+	}
+	if flags&expireLT > 0 && hasTTL && !expireTime.Before(current) {
+		return 0
+	}
+	if !expireTime.After(time.Now()) {
+		// already expired
+		db.Remove(key)
+		return 1
+	}
+	db.Expire(key, expireTime)
+	return 1
+}
+
+// execExpire sets a key's time to live in seconds
+func execExpire(db *DB, args [][]byte) client.Reply {
+	return expireWithUnit(db, args, time.Second, false, consts.CMDExpire)
+}
+
+// execPExpire sets a key's time to live in milliseconds
+func execPExpire(db *DB, args [][]byte) client.Reply {
+	return expireWithUnit(db, args, time.Millisecond, false, consts.CMDPExpire)
+}
+
+// execExpireAt sets a key's expiration in unix timestamp
+func execExpireAt(db *DB, args [][]byte) client.Reply {
+	return expireWithUnit(db, args, time.Second, true, consts.CMDExpireAt)
+}
+
+// execPExpireAt sets a key's expiration in unix timestamp specified in milliseconds
+func execPExpireAt(db *DB, args [][]byte) client.Reply {
+	return expireWithUnit(db, args, time.Millisecond, true, consts.CMDPExpireAt)
+}
+
+// execExpireTime returns the absolute unix timestamp in seconds at which the key will expire
+func execExpireTime(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.getExpireTime(key)
+	if !hasTTL {
+		return protocol.MakeIntReply(-1)
+	}
+	return protocol.MakeIntReply(expireTime.Unix())
+}
+
+// execPExpireTime returns the absolute unix timestamp in milliseconds at which the key will expire
+func execPExpireTime(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.getExpireTime(key)
+	if !hasTTL {
+		return protocol.MakeIntReply(-1)
+	}
+	return protocol.MakeIntReply(expireTime.UnixMilli())
+}
+
+// execTTL returns a key's time to live in seconds
+func execTTL(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.getExpireTime(key)
+	if !hasTTL {
+		return protocol.MakeIntReply(-1)
+	}
+	ttl := time.Until(expireTime).Milliseconds()
+	// round to the nearest second like redis
+	return protocol.MakeIntReply((ttl + 500) / 1000)
+}
+
+// execPTTL returns a key's time to live in milliseconds
+func execPTTL(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.getExpireTime(key)
+	if !hasTTL {
+		return protocol.MakeIntReply(-1)
+	}
+	return protocol.MakeIntReply(time.Until(expireTime).Milliseconds())
+}
+
+// execPersist removes expiration from a key
+func execPersist(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(0)
+	}
+	if _, hasTTL := db.getExpireTime(key); !hasTTL {
+		return protocol.MakeIntReply(0)
+	}
+	db.Persist(key)
+	return protocol.MakeIntReply(1)
+}
+
+func init() {
+	registerCommand(consts.CMDExpire, execExpire, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDPExpire, execPExpire, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDExpireAt, execExpireAt, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDPExpireAt, execPExpireAt, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDExpireTime, execExpireTime, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDPExpireTime, execPExpireTime, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTTL, execTTL, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDPTTL, execPTTL, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDPersist, execPersist, router.WriteFirstKey, rollbackFirstKey, 2, router.FlagWrite)
+}
@@ -0,0 +1,42 @@
+package single_db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET a 1", "+OK")
+	check(t, db, "TTL a", ":-1")
+	check(t, db, "TTL nope", ":-2")
+	check(t, db, "EXPIRE a 100 XX", ":0")
+	check(t, db, "EXPIRE a 100 GT", ":0")
+	check(t, db, "EXPIRE a 100 LT", ":1")
+	check(t, db, "TTL a", ":100")
+	check(t, db, "EXPIRE a 50 GT", ":0")
+	check(t, db, "EXPIRE a 200 GT", ":1")
+	check(t, db, "EXPIRE a 200 NX", ":0")
+	check(t, db, "EXPIRE a 200 NX GT", "-ERR NX and XX, GT or LT options at the same time are not compatible")
+	check(t, db, "PERSIST a", ":1")
+	check(t, db, "PERSIST a", ":0")
+	check(t, db, "EXPIREAT a 1000", ":1")
+	check(t, db, "EXISTS a", ":0")
+	check(t, db, "SET d 1", "+OK")
+	check(t, db, "PEXPIREAT d 99999999999999", ":1")
+	check(t, db, "PEXPIRETIME d", ":99999999999999")
+	check(t, db, "EXPIRETIME d", ":99999999999")
+}
+
+func TestActiveExpire(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET b 1 PX 1100", "+OK")
+	check(t, db, "SET c 1 PX 10", "+OK")
+	time.Sleep(20 * time.Millisecond)
+	check(t, db, "GET c", "$-1")
+	// b is removed by time wheel without being accessed
+	time.Sleep(2500 * time.Millisecond)
+	if _, ok := db.data.Get("b"); ok {
+		t.Error("b should be expired actively")
+	}
+}
@@ -0,0 +1,634 @@
+package single_db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/skiplist"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/geohash"
+)
+
+/* ---- Geo Commands ----
+ * a geo index is a sorted set, score of a member is the highest 52 bits of its geohash,
+ * which is the precision of redis and can be represented exactly by float64
+ */
+
+const (
+	geoHashDropBits = 64 - 52
+	geoLngMin       = -180
+	geoLngMax       = 180
+	geoLatMin       = -85.05112878
+	geoLatMax       = 85.05112878
+)
+
+func geoEncode(lng, lat float64) float64 {
+	return float64(geohash.Encode(lat, lng) >> geoHashDropBits)
+}
+
+// geoDecode returns the center of the geohash cell of score
+func geoDecode(score float64) (lng, lat float64) {
+	// the highest dropped bits of longitude and latitude locate the center of cell
+	code := uint64(score)<<geoHashDropBits | 3<<(geoHashDropBits-2)
+	lat, lng = geohash.Decode(code)
+	return lng, lat
+}
+
+// geoHashString returns the 11 characters geohash like redis, the last character is always '0'
+func geoHashString(score float64) string {
+	code := uint64(score) << geoHashDropBits
+	return geohash.ToString(geohash.FromInt(code))[:10] + "0"
+}
+
+func parseLngLat(lngArg, latArg []byte) (lng, lat float64, errReply protocol.ErrorReply) {
+	lng, err := strconv.ParseFloat(string(lngArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	lat, err = strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	if !(lng >= geoLngMin && lng <= geoLngMax && lat >= geoLatMin && lat <= geoLatMax) {
+		return 0, 0, protocol.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lng, lat))
+	}
+	return lng, lat, nil
+}
+
+// parseGeoUnit returns meters of the given unit
+func parseGeoUnit(raw []byte) (float64, protocol.ErrorReply) {
+	switch strings.ToLower(string(raw)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, protocol.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func parseGeoDistance(raw []byte) (float64, protocol.ErrorReply) {
+	distance, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(distance) {
+		return 0, protocol.MakeErrReply("ERR need numeric radius")
+	}
+	return distance, nil
+}
+
+func formatGeoDistance(meters, unit float64) []byte {
+	return []byte(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+// geoMemberScore returns score of member, zs may be nil
+func geoMemberScore(zs *zset.ZSet, member string) (float64, bool) {
+	if zs == nil {
+		return 0, false
+	}
+	element, ok := zs.Get(member)
+	if !ok {
+		return 0, false
+	}
+	return element.Score, true
+}
+
+// splitGeoAddArgs splits options NX, XX and CH from the longitude, latitude, member triples
+func splitGeoAddArgs(args [][]byte) (options, triples [][]byte) {
+	for i, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX", "XX", "CH":
+		default:
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
+
+// execGeoAdd adds members with coordinates into the geo index
+func execGeoAdd(db *DB, args [][]byte) client.Reply {
+	options, triples := splitGeoAddArgs(args[1:])
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return protocol.MakeErrReply("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	}
+	// geo index is a sorted set, so GEOADD is rewritten into ZADD
+	zaddArgs := make([][]byte, 0, 1+len(options)+len(triples)/3*2)
+	zaddArgs = append(zaddArgs, args[0])
+	zaddArgs = append(zaddArgs, options...)
+	for i := 0; i < len(triples); i += 3 {
+		lng, lat, errReply := parseLngLat(triples[i], triples[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		score := strconv.FormatFloat(geoEncode(lng, lat), 'f', -1, 64)
+		zaddArgs = append(zaddArgs, []byte(score), triples[i+2])
+	}
+	return execZAdd(db, zaddArgs)
+}
+
+func undoGeoAdd(db *DB, args [][]byte) []router.CmdLine {
+	_, triples := splitGeoAddArgs(args[1:])
+	members := make([]string, 0, len(triples)/3)
+	for i := 2; i < len(triples); i += 3 {
+		members = append(members, string(triples[i]))
+	}
+	return rollbackZSetMembers(db, string(args[0]), members...)
+}
+
+// execGeoPos returns longitude and latitude of members
+func execGeoPos(db *DB, args [][]byte) client.Reply {
+	zs, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		score, ok := geoMemberScore(zs, string(member))
+		if !ok {
+			replies[i] = protocol.MakeNullMultiBulkReply()
+			continue
+		}
+		lng, lat := geoDecode(score)
+		replies[i] = protocol.MakeMultiBulkReply([][]byte{
+			[]byte(formatFloat(lng)),
+			[]byte(formatFloat(lat)),
+		})
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execGeoDist returns the distance between two members
+func execGeoDist(db *DB, args [][]byte) client.Reply {
+	if len(args) > 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	unit := float64(1)
+	if len(args) == 4 {
+		var errReply protocol.ErrorReply
+		unit, errReply = parseGeoUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	zs, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	score1, ok1 := geoMemberScore(zs, string(args[1]))
+	score2, ok2 := geoMemberScore(zs, string(args[2]))
+	if !ok1 || !ok2 {
+		return protocol.MakeNullBulkReply()
+	}
+	lng1, lat1 := geoDecode(score1)
+	lng2, lat2 := geoDecode(score2)
+	return protocol.MakeBulkReply(formatGeoDistance(geohash.Distance(lat1, lng1, lat2, lng2), unit))
+}
+
+// execGeoHash returns geohash strings of members
+func execGeoHash(db *DB, args [][]byte) client.Reply {
+	zs, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		score, ok := geoMemberScore(zs, string(member))
+		if !ok {
+			replies[i] = protocol.MakeNullBulkReply()
+			continue
+		}
+		replies[i] = protocol.MakeBulkReply([]byte(geoHashString(score)))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+/* ---- Geo Search ---- */
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchSpec holds arguments of GEOSEARCH, GEOSEARCHSTORE and GEORADIUS commands
+type geoSearchSpec struct {
+	// center is the coordinate of fromMember if it is not nil
+	fromMember []byte
+	lng, lat   float64
+	hasCenter  bool
+
+	// distances are in meters
+	byBox         bool
+	radius        float64
+	width, height float64
+	hasShape      bool
+	unit          float64
+
+	sort  int
+	count int64
+	any   bool
+
+	withCoord, withDist, withHash bool
+
+	storeKey  string
+	storeDist bool
+}
+
+// parseGeoOptions parses options of geo search, search is true for GEOSEARCH and GEOSEARCHSTORE
+// which specify center and shape by options, store is false for read-only commands
+func parseGeoOptions(spec *geoSearchSpec, args [][]byte, cmdName string, search, store bool) protocol.ErrorReply {
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		remaining := len(args) - i - 1
+		switch {
+		case arg == "WITHCOORD":
+			spec.withCoord = true
+		case arg == "WITHDIST":
+			spec.withDist = true
+		case arg == "WITHHASH":
+			spec.withHash = true
+		case arg == "ASC":
+			spec.sort = geoSortAsc
+		case arg == "DESC":
+			spec.sort = geoSortDesc
+		case arg == "COUNT" && remaining > 0:
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+			spec.count = count
+			i++
+			if remaining > 1 && strings.ToUpper(string(args[i+1])) == "ANY" {
+				spec.any = true
+				i++
+			}
+		case (arg == "STORE" || arg == "STOREDIST") && !search && store && remaining > 0:
+			spec.storeKey = string(args[i+1])
+			spec.storeDist = arg == "STOREDIST"
+			i++
+		case arg == "STOREDIST" && search && store:
+			spec.storeDist = true
+		case arg == "FROMMEMBER" && search && remaining > 0:
+			if spec.hasCenter {
+				return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			spec.fromMember = args[i+1]
+			spec.hasCenter = true
+			i++
+		case arg == "FROMLONLAT" && search && remaining > 1:
+			if spec.hasCenter {
+				return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			lng, lat, errReply := parseLngLat(args[i+1], args[i+2])
+			if errReply != nil {
+				return errReply
+			}
+			spec.lng, spec.lat = lng, lat
+			spec.hasCenter = true
+			i += 2
+		case arg == "BYRADIUS" && search && remaining > 1:
+			if spec.hasShape {
+				return protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			radius, errReply := parseGeoDistance(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			if radius < 0 {
+				return protocol.MakeErrReply("ERR radius cannot be negative")
+			}
+			spec.unit, errReply = parseGeoUnit(args[i+2])
+			if errReply != nil {
+				return errReply
+			}
+			spec.radius = radius * spec.unit
+			spec.hasShape = true
+			i += 2
+		case arg == "BYBOX" && search && remaining > 2:
+			if spec.hasShape {
+				return protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			width, errReply := parseGeoDistance(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			height, errReply := parseGeoDistance(args[i+2])
+			if errReply != nil {
+				return errReply
+			}
+			if width < 0 || height < 0 {
+				return protocol.MakeErrReply("ERR height or width cannot be negative")
+			}
+			spec.unit, errReply = parseGeoUnit(args[i+3])
+			if errReply != nil {
+				return errReply
+			}
+			spec.width, spec.height = width*spec.unit, height*spec.unit
+			spec.byBox = true
+			spec.hasShape = true
+			i += 3
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	if !spec.hasCenter {
+		return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !spec.hasShape {
+		return protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	if spec.storeKey != "" && (spec.withDist || spec.withHash || spec.withCoord) {
+		if search {
+			return protocol.MakeErrReply("ERR " + cmdName + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+		}
+		return protocol.MakeErrReply("ERR STORE option in " + cmdName + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	if spec.count > 0 && spec.sort == geoSortNone && !spec.any {
+		// the nearest ones are expected
+		spec.sort = geoSortAsc
+	}
+	return nil
+}
+
+// parseGeoRadius parses arguments of GEORADIUS and GEORADIUSBYMEMBER
+func parseGeoRadius(args [][]byte, cmdName string, byMember, store bool) (*geoSearchSpec, protocol.ErrorReply) {
+	spec := &geoSearchSpec{hasCenter: true, hasShape: true}
+	if byMember {
+		spec.fromMember = args[1]
+		args = args[2:]
+	} else {
+		lng, lat, errReply := parseLngLat(args[1], args[2])
+		if errReply != nil {
+			return nil, errReply
+		}
+		spec.lng, spec.lat = lng, lat
+		args = args[3:]
+	}
+	radius, errReply := parseGeoDistance(args[0])
+	if errReply != nil {
+		return nil, errReply
+	}
+	if radius < 0 {
+		return nil, protocol.MakeErrReply("ERR radius cannot be negative")
+	}
+	spec.unit, errReply = parseGeoUnit(args[1])
+	if errReply != nil {
+		return nil, errReply
+	}
+	spec.radius = radius * spec.unit
+	errReply = parseGeoOptions(spec, args[2:], cmdName, false, store)
+	if errReply != nil {
+		return nil, errReply
+	}
+	return spec, nil
+}
+
+// parseGeoSearch parses arguments of GEOSEARCH and GEOSEARCHSTORE after the source key
+func parseGeoSearch(args [][]byte, cmdName string, storeKey string) (*geoSearchSpec, protocol.ErrorReply) {
+	spec := &geoSearchSpec{storeKey: storeKey}
+	errReply := parseGeoOptions(spec, args, cmdName, true, storeKey != "")
+	if errReply != nil {
+		return nil, errReply
+	}
+	return spec, nil
+}
+
+// geoPoint is a member found by geo search
+type geoPoint struct {
+	member   string
+	score    float64
+	lng, lat float64
+	dist     float64 // distance to center in meters
+}
+
+// contains checks whether the coordinate is inside the shape, and returns its distance to center
+func (spec *geoSearchSpec) contains(lng, lat float64) (float64, bool) {
+	if spec.byBox {
+		// distances along latitude and longitude are compared with height and width respectively
+		if geohash.Distance(spec.lat, lng, lat, lng) > spec.height/2 {
+			return 0, false
+		}
+		if geohash.Distance(lat, spec.lng, lat, lng) > spec.width/2 {
+			return 0, false
+		}
+		return geohash.Distance(spec.lat, spec.lng, lat, lng), true
+	}
+	dist := geohash.Distance(spec.lat, spec.lng, lat, lng)
+	return dist, dist <= spec.radius
+}
+
+// geoSearch finds members inside the shape by scanning the geohash cells around center,
+// it stops as soon as count members are found if ANY is given
+func geoSearch(zs *zset.ZSet, spec *geoSearchSpec) []*geoPoint {
+	radius := spec.radius
+	if spec.byBox {
+		radius = math.Sqrt(spec.width*spec.width+spec.height*spec.height) / 2
+	}
+	enough := func(points []*geoPoint) bool {
+		return spec.any && int64(len(points)) >= spec.count
+	}
+	var points []*geoPoint
+	visited := make(map[string]struct{})
+	for _, r := range geohash.GetNeighbours(spec.lat, spec.lng, radius) {
+		// r is [lower, upper) of 64 bits geohash, upper may overflow to 0
+		min := &skiplist.ScoreBorder{Value: float64(r[0] >> geoHashDropBits)}
+		max := &skiplist.ScoreBorder{Value: float64((r[1] - 1) >> geoHashDropBits)}
+		zs.ForEachByScore(min, max, 0, -1, false, func(element *skiplist.Element) bool {
+			if _, ok := visited[element.Member]; ok {
+				return true // neighbour cells may overlap
+			}
+			visited[element.Member] = struct{}{}
+			lng, lat := geoDecode(element.Score)
+			dist, ok := spec.contains(lng, lat)
+			if ok {
+				points = append(points, &geoPoint{
+					member: element.Member,
+					score:  element.Score,
+					lng:    lng,
+					lat:    lat,
+					dist:   dist,
+				})
+			}
+			return !enough(points)
+		})
+		if enough(points) {
+			break
+		}
+	}
+
+	switch spec.sort {
+	case geoSortAsc:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist < points[j].dist })
+	case geoSortDesc:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist > points[j].dist })
+	}
+	if spec.count > 0 && int64(len(points)) > spec.count {
+		points = points[:spec.count]
+	}
+	return points
+}
+
+func geoPointsToReply(points []*geoPoint, spec *geoSearchSpec) client.Reply {
+	if !spec.withCoord && !spec.withDist && !spec.withHash {
+		members := make([][]byte, len(points))
+		for i, point := range points {
+			members[i] = []byte(point.member)
+		}
+		return protocol.MakeMultiBulkReply(members)
+	}
+	replies := make([]client.Reply, len(points))
+	for i, point := range points {
+		item := []client.Reply{protocol.MakeBulkReply([]byte(point.member))}
+		if spec.withDist {
+			item = append(item, protocol.MakeBulkReply(formatGeoDistance(point.dist, spec.unit)))
+		}
+		if spec.withHash {
+			item = append(item, protocol.MakeIntReply(int64(point.score)))
+		}
+		if spec.withCoord {
+			item = append(item, protocol.MakeMultiBulkReply([][]byte{
+				[]byte(formatFloat(point.lng)),
+				[]byte(formatFloat(point.lat)),
+			}))
+		}
+		replies[i] = protocol.MakeMultiRawReply(item)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// geoStore stores found members into storeKey with their geohash, or distances if STOREDIST is given
+func (db *DB) geoStore(points []*geoPoint, spec *geoSearchSpec) client.Reply {
+	if len(points) == 0 {
+		db.Remove(spec.storeKey)
+		return protocol.MakeIntReply(0)
+	}
+	result := makeZSet()
+	for _, point := range points {
+		score := point.score
+		if spec.storeDist {
+			score = point.dist / spec.unit
+		}
+		result.Add(point.member, score)
+	}
+	db.PutEntity(spec.storeKey, &IDB.DataEntity{
+		Data: result,
+	})
+	db.Persist(spec.storeKey) // override ttl
+	return protocol.MakeIntReply(int64(len(points)))
+}
+
+func (db *DB) execGeoSearchGeneric(key string, spec *geoSearchSpec) client.Reply {
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		if spec.storeKey != "" {
+			db.Remove(spec.storeKey)
+			return protocol.MakeIntReply(0)
+		}
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	if spec.fromMember != nil {
+		score, ok := geoMemberScore(zs, string(spec.fromMember))
+		if !ok {
+			return protocol.MakeErrReply("ERR could not decode requested zset member")
+		}
+		spec.lng, spec.lat = geoDecode(score)
+	}
+	points := geoSearch(zs, spec)
+	if spec.storeKey != "" {
+		return db.geoStore(points, spec)
+	}
+	return geoPointsToReply(points, spec)
+}
+
+// execGeoSearch returns members inside the given circle or box
+func execGeoSearch(db *DB, args [][]byte) client.Reply {
+	spec, errReply := parseGeoSearch(args[1:], consts.CMDGeoSearch, "")
+	if errReply != nil {
+		return errReply
+	}
+	return db.execGeoSearchGeneric(string(args[0]), spec)
+}
+
+// execGeoSearchStore stores members inside the given circle or box into destination
+func execGeoSearchStore(db *DB, args [][]byte) client.Reply {
+	spec, errReply := parseGeoSearch(args[2:], consts.CMDGeoSearchStore, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return db.execGeoSearchGeneric(string(args[1]), spec)
+}
+
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+func execGeoRadiusGeneric(db *DB, args [][]byte, cmdName string, byMember, store bool) client.Reply {
+	spec, errReply := parseGeoRadius(args, cmdName, byMember, store)
+	if errReply != nil {
+		return errReply
+	}
+	return db.execGeoSearchGeneric(string(args[0]), spec)
+}
+
+// execGeoRadius returns members within radius of the given coordinate, results can be stored by STORE or STOREDIST
+func execGeoRadius(db *DB, args [][]byte) client.Reply {
+	return execGeoRadiusGeneric(db, args, consts.CMDGeoRadius, false, true)
+}
+
+// execGeoRadiusRO is the read-only variant of GEORADIUS
+func execGeoRadiusRO(db *DB, args [][]byte) client.Reply {
+	return execGeoRadiusGeneric(db, args, consts.CMDGeoRadiusRO, false, false)
+}
+
+// execGeoRadiusByMember returns members within radius of the given member
+func execGeoRadiusByMember(db *DB, args [][]byte) client.Reply {
+	return execGeoRadiusGeneric(db, args, consts.CMDGeoRadiusByMember, true, true)
+}
+
+// execGeoRadiusByMemberRO is the read-only variant of GEORADIUSBYMEMBER
+func execGeoRadiusByMemberRO(db *DB, args [][]byte) client.Reply {
+	return execGeoRadiusGeneric(db, args, consts.CMDGeoRadiusByMemberRO, true, false)
+}
+
+// prepareGeoRadius locks the destination of STORE or STOREDIST for writing
+func prepareGeoRadius(byMember bool) router.PreFunc {
+	return func(args [][]byte) ([]string, []string) {
+		readKeys := []string{string(args[0])}
+		spec, errReply := parseGeoRadius(args, consts.CMDGeoRadius, byMember, true)
+		if errReply != nil || spec.storeKey == "" {
+			return nil, readKeys
+		}
+		return []string{spec.storeKey}, readKeys
+	}
+}
+
+func init() {
+	registerCommand(consts.CMDGeoAdd, execGeoAdd, router.WriteFirstKey, undoGeoAdd, -5, router.FlagWrite)
+	registerCommand(consts.CMDGeoPos, execGeoPos, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDGeoDist, execGeoDist, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDGeoHash, execGeoHash, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDGeoSearch, execGeoSearch, router.ReadFirstKey, nil, -7, router.FlagReadOnly)
+	registerCommand(consts.CMDGeoSearchStore, execGeoSearchStore, prepareGeoSearchStore, rollbackFirstKey, -8, router.FlagWrite)
+
+	prepareByCoord, prepareByMember := prepareGeoRadius(false), prepareGeoRadius(true)
+	registerCommand(consts.CMDGeoRadius, execGeoRadius, prepareByCoord, rollbackWriteKeys(prepareByCoord), -6, router.FlagWrite)
+	registerCommand(consts.CMDGeoRadiusRO, execGeoRadiusRO, router.ReadFirstKey, nil, -6, router.FlagReadOnly)
+	registerCommand(consts.CMDGeoRadiusByMember, execGeoRadiusByMember, prepareByMember, rollbackWriteKeys(prepareByMember), -5, router.FlagWrite)
+	registerCommand(consts.CMDGeoRadiusByMemberRO, execGeoRadiusByMemberRO, router.ReadFirstKey, nil, -5, router.FlagReadOnly)
+}
@@ -0,0 +1,57 @@
+package single_db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "GEOADD Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2")
+	check(t, db, "GEOADD Sicily 200 38 x", "-ERR invalid longitude,latitude pair 200.000000,38.000000")
+	check(t, db, "GEOADD Sicily 13 38 a 14", "-ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ...")
+	check(t, db, "GEODIST Sicily Palermo Catania", "$11 166274.1263")
+	check(t, db, "GEODIST Sicily Palermo Catania km", "$8 166.2741")
+	check(t, db, "GEODIST Sicily Palermo x", "$-1")
+	check(t, db, "GEODIST Sicily Palermo Catania yard", "-ERR unsupported unit provided. please use M, KM, FT, MI")
+	check(t, db, "GEOHASH Sicily Palermo Catania x", "*3 $11 sqc8b49rny0 $11 sqdtr74hyu0 $-1")
+	check(t, db, "GEORADIUS Sicily 15 37 100 km", "*1 $7 Catania")
+	check(t, db, "GEORADIUS Sicily 15 37 200 km WITHDIST ASC", "*2 *2 $7 Catania $7 56.4414 *2 $7 Palermo $8 190.4424")
+	check(t, db, "GEORADIUS Sicily 15 37 200 km WITHDIST DESC COUNT 1", "*1 *2 $7 Palermo $8 190.4424")
+	check(t, db, "GEORADIUS Sicily 15 37 200 km COUNT 1", "*1 $7 Catania")
+	check(t, db, "GEORADIUSBYMEMBER Sicily Palermo 170 km ASC", "*2 $7 Palermo $7 Catania")
+	check(t, db, "GEORADIUSBYMEMBER Sicily x 170 km", "-ERR could not decode requested zset member")
+	check(t, db, "GEOADD Sicily 12.758489 38.788135 edge1 17.241510 38.788135 edge2", ":2")
+	check(t, db, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC", "*2 $7 Catania $7 Palermo")
+	check(t, db, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km ASC WITHDIST", "*4 *2 $7 Catania $7 56.4414 *2 $7 Palermo $8 190.4424 *2 $5 edge2 $8 279.7403 *2 $5 edge1 $8 279.7404")
+	check(t, db, "GEOSEARCH Sicily FROMMEMBER Palermo BYRADIUS 1 m WITHHASH", "*1 *2 $7 Palermo :3476004292229755")
+	check(t, db, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 1000 km COUNT 3 ANY", "*3 $7 Palermo $5 edge1 $7 Catania")
+	check(t, db, "GEOSEARCH Sicily BYRADIUS 1000 km ASC WITHDIST", "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	check(t, db, "GEOSEARCH Sicily FROMMEMBER Palermo FROMLONLAT 15 37 BYRADIUS 1000 km", "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	check(t, db, "GEOSEARCH Sicily FROMMEMBER Palermo COUNT 0 BYRADIUS 1000 km", "-ERR COUNT must be > 0")
+	check(t, db, "GEOSEARCH Sicily FROMMEMBER Palermo BYRADIUS 1000 km STOREDIST", "-Err syntax error")
+	check(t, db, "GEOSEARCHSTORE dst Sicily FROMMEMBER Palermo BYRADIUS 1000 km WITHDIST", "-ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	check(t, db, "GEOSEARCHSTORE dst Sicily FROMLONLAT 15 37 BYBOX 400 400 km ASC COUNT 2 STOREDIST", ":2")
+	check(t, db, "ZRANGE dst 0 -1 WITHSCORES", "*4 $7 Catania $18 56.441351212242395 $7 Palermo $18 190.44244946354272")
+	check(t, db, "GEORADIUS Sicily 15 37 200 km STORE dst2", ":2")
+	check(t, db, "GEOPOS dst2 Catania", run(db, "GEOPOS Sicily Catania"))
+	check(t, db, "GEORADIUS Sicily 15 37 200 km STORE dst2 WITHDIST", "-ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	check(t, db, "GEORADIUS_RO Sicily 15 37 200 km STORE dst2", "-Err syntax error")
+	check(t, db, "GEOSEARCH none FROMMEMBER Palermo BYRADIUS 1 m", "*0")
+	check(t, db, "GEOADD Sicily XX CH 13.361389 38.115556 Palermo 0 0 nowhere", ":0")
+	check(t, db, "ZCARD Sicily", ":4")
+	check(t, db, "GEORADIUS Sicily 0 0 50000 km COUNT 10", "*4 $7 Catania $7 Palermo $5 edge1 $5 edge2")
+}
+
+func TestGeoPos(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "GEOADD Sicily 13.361389 38.115556 Palermo", ":1")
+	got := run(db, "GEOPOS Sicily Palermo x")
+	if !strings.HasPrefix(got, "*2 *2 $16 13.36138") || !strings.HasSuffix(got, " *-1") {
+		t.Error(got)
+	}
+	got = run(db, "GEOSEARCH Sicily FROMLONLAT 13 38 BYRADIUS 100 km WITHCOORD")
+	if !strings.HasPrefix(got, "*1 *2 $7 Palermo *2 $16 13.36138") {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,420 @@
+package single_db
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func (db *DB) getAsDict(key string) (dict.Dict, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	d, ok := entity.Data.(dict.Dict)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return d, nil
+}
+
+func (db *DB) getOrInitDict(key string) (d dict.Dict, inited bool, errReply protocol.ErrorReply) {
+	d, errReply = db.getAsDict(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if d == nil {
+		d = makeHash()
+		db.PutEntity(key, &IDB.DataEntity{
+			Data: d,
+		})
+		inited = true
+	}
+	return d, inited, nil
+}
+
+// rollbackHashFields returns undo logs restoring only the given fields of hash
+func rollbackHashFields(db *DB, key string, fields ...string) []router.CmdLine {
+	var undoCmdLines []router.CmdLine
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return nil
+	}
+	if d == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine(consts.CMDDel, key),
+		)
+		return undoCmdLines
+	}
+	for _, field := range fields {
+		raw, ok := d.Get(field)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDHDel, key, field),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine3(consts.CMDHSet, []byte(key), []byte(field), raw.([]byte)),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// execHSet sets fields of hash, returns the number of new fields
+func execHSet(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 1 {
+		return protocol.MakeArgNumErrReply(strings.ToLower(consts.CMDHSet))
+	}
+	key := string(args[0])
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	var result int64
+	for i := 1; i < len(args); i += 2 {
+		result += int64(d.Put(string(args[i]), args[i+1]))
+	}
+	return protocol.MakeIntReply(result)
+}
+
+// execHMSet sets fields of hash, the deprecated form of HSET
+func execHMSet(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 1 {
+		return protocol.MakeArgNumErrReply(strings.ToLower(consts.CMDHMSet))
+	}
+	reply := execHSet(db, args)
+	if protocol.IsErrorReply(reply) {
+		return reply
+	}
+	return protocol.MakeOkReply()
+}
+
+// undoHSet restores the fields to be set
+func undoHSet(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	fields := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, string(args[i]))
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+// execHSetNX sets field only if it not exists
+func execHSetNX(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := d.PutIfAbsent(string(args[1]), args[2])
+	return protocol.MakeIntReply(int64(result))
+}
+
+// undoHashField restores the field given by the second argument
+func undoHashField(db *DB, args [][]byte) []router.CmdLine {
+	return rollbackHashFields(db, string(args[0]), string(args[1]))
+}
+
+// execHGet returns the value of field
+func execHGet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	raw, exists := d.Get(string(args[1]))
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply(raw.([]byte))
+}
+
+// execHMGet returns values of fields, nil for absent fields
+func execHMGet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if d == nil {
+		return protocol.MakeMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		raw, exists := d.Get(string(field))
+		if exists {
+			result[i] = raw.([]byte)
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execHDel removes fields of hash, the key is removed with the last field
+func execHDel(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeIntReply(0)
+	}
+	var deleted int64
+	for _, field := range args[1:] {
+		deleted += int64(d.Remove(string(field)))
+	}
+	if d.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(deleted)
+}
+
+// undoHDel restores the fields to be removed
+func undoHDel(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	fields := make([]string, 0, len(args)-1)
+	for _, field := range args[1:] {
+		fields = append(fields, string(field))
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+// execHExists checks whether the field exists
+func execHExists(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeIntReply(0)
+	}
+	if _, exists := d.Get(string(args[1])); exists {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execHLen returns the number of fields
+func execHLen(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(d.Len()))
+}
+
+// execHStrLen returns the length of the value of field
+func execHStrLen(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeIntReply(0)
+	}
+	raw, exists := d.Get(string(args[1]))
+	if !exists {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(len(raw.([]byte))))
+}
+
+// execHIncrBy increments the integer value of field by given delta
+func execHIncrBy(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, errReply := parseIncrement(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val int64
+	if raw, exists := d.Get(field); exists {
+		var err error
+		val, err = strconv.ParseInt(string(raw.([]byte)), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR hash value is not an integer")
+		}
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return protocol.MakeErrReply("ERR increment or decrement would overflow")
+	}
+	val += delta
+	d.Put(field, []byte(strconv.FormatInt(val, 10)))
+	return protocol.MakeIntReply(val)
+}
+
+// execHIncrByFloat increments the float value of field by given delta, it is computed in long double like INCRBYFLOAT
+func execHIncrByFloat(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, ok := parseLongDouble(args[2])
+	if !ok {
+		return protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	val := new(big.Float).SetPrec(longDoublePrec)
+	if raw, exists := d.Get(field); exists {
+		if val, ok = parseLongDouble(raw.([]byte)); !ok {
+			return protocol.MakeErrReply("ERR hash value is not a float")
+		}
+	}
+	val.Add(val, delta)
+	if !isLongDouble(val) {
+		return protocol.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(formatLongDouble(val))
+	d.Put(field, result)
+	return protocol.MakeBulkReply(result)
+}
+
+// execHGetAll returns all fields and values of hash
+func execHGetAll(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, 2*d.Len())
+	d.ForEach(func(field string, val interface{}) bool {
+		result = append(result, []byte(field), val.([]byte))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execHKeys returns all fields of hash
+func execHKeys(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	fields := make([][]byte, 0, d.Len())
+	d.ForEach(func(field string, val interface{}) bool {
+		fields = append(fields, []byte(field))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(fields)
+}
+
+// execHVals returns all values of hash
+func execHVals(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	values := make([][]byte, 0, d.Len())
+	d.ForEach(func(field string, val interface{}) bool {
+		values = append(values, val.([]byte))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(values)
+}
+
+// execHRandField returns random fields of hash.
+// A positive count returns distinct fields, while a negative count allows duplicated fields
+func execHRandField(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if len(args) > 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if d == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		fields := d.RandomKeys(1)
+		return protocol.MakeBulkReply([]byte(fields[0]))
+	}
+
+	count, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withValues = true
+	}
+	if d == nil || count == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	var fields []string
+	if count > 0 {
+		fields = d.RandomDistinctKeys(int(count))
+	} else {
+		fields = d.RandomKeys(int(-count))
+	}
+	result := make([][]byte, 0, 2*len(fields))
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			raw, _ := d.Get(field)
+			result = append(result, raw.([]byte))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+func init() {
+	registerCommand(consts.CMDHSet, execHSet, router.WriteFirstKey, undoHSet, -4, router.FlagWrite)
+	registerCommand(consts.CMDHSetNX, execHSetNX, router.WriteFirstKey, undoHashField, 4, router.FlagWrite)
+	registerCommand(consts.CMDHMSet, execHMSet, router.WriteFirstKey, undoHSet, -4, router.FlagWrite)
+	registerCommand(consts.CMDHGet, execHGet, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDHMGet, execHMGet, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDHDel, execHDel, router.WriteFirstKey, undoHDel, -3, router.FlagWrite)
+	registerCommand(consts.CMDHExists, execHExists, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDHLen, execHLen, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDHStrLen, execHStrLen, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDHIncrBy, execHIncrBy, router.WriteFirstKey, undoHashField, 4, router.FlagWrite)
+	registerCommand(consts.CMDHIncrByFloat, execHIncrByFloat, router.WriteFirstKey, undoHashField, 4, router.FlagWrite)
+	registerCommand(consts.CMDHGetAll, execHGetAll, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDHKeys, execHKeys, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDHVals, execHVals, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDHRandField, execHRandField, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+}
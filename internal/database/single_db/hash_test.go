@@ -0,0 +1,87 @@
+package single_db
+
+import (
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func TestHash(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "HSET h a 1 b 2", ":2")
+	check(t, db, "HSET h a 3 c", "-ERR wrong number of arguments for 'hset' command")
+	check(t, db, "HSET h a 3 c 4", ":1")
+	check(t, db, "HGET h a", "$1 3")
+	check(t, db, "HMGET h a x c", "*3 $1 3 $-1 $1 4")
+	check(t, db, "TYPE h", "+hash")
+	check(t, db, "GET h", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	check(t, db, "HSETNX h a 9", ":0")
+	check(t, db, "HSETNX h d 9", ":1")
+	check(t, db, "HLEN h", ":4")
+	check(t, db, "HSTRLEN h d", ":1")
+	check(t, db, "HEXISTS h d", ":1")
+	check(t, db, "HEXISTS h x", ":0")
+	// fields of hash are not ordered
+	if got := runSorted(t, db, "HGETALL h"); got != "2 3 4 9 a b c d" {
+		t.Error(got)
+	}
+	if got := runSorted(t, db, "HKEYS h"); got != "a b c d" {
+		t.Error(got)
+	}
+	if got := runSorted(t, db, "HVALS h"); got != "2 3 4 9" {
+		t.Error(got)
+	}
+	check(t, db, "HDEL h a b c d zz", ":4")
+	check(t, db, "EXISTS h", ":0")
+	check(t, db, "HMSET h a 1", "+OK")
+	check(t, db, "HGETALL nokey", "*0")
+}
+
+func TestHashIncr(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "HSET h a 3", ":1")
+	check(t, db, "HINCRBY h a 5", ":8")
+	check(t, db, "HINCRBY h n -1", ":-1")
+	check(t, db, "HINCRBYFLOAT h f 1.5", "$3 1.5")
+	check(t, db, "HSET h g 0.1", ":1")
+	check(t, db, "HINCRBYFLOAT h g 0.2", "$3 0.3")
+	check(t, db, "HINCRBY h f 1", "-ERR hash value is not an integer")
+	check(t, db, "HINCRBYFLOAT h f x", "-ERR value is not a valid float")
+}
+
+func TestHRandField(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "HSET h a 1 b 2 c 3", ":3")
+	check(t, db, "HRANDFIELD nx 3", "*0")
+	check(t, db, "HRANDFIELD nx", "$-1")
+	// a positive count returns distinct fields
+	if got := runSorted(t, db, "HRANDFIELD h 10"); got != "a b c" {
+		t.Error(got)
+	}
+	// a negative count may return duplicated fields
+	if got := run(db, "HRANDFIELD h -6 WITHVALUES"); len(got) < 2 || got[:3] != "*12" {
+		t.Error(got)
+	}
+	switch got := run(db, "HRANDFIELD h"); got {
+	case "$1 a", "$1 b", "$1 c":
+	default:
+		t.Error(got)
+	}
+}
+
+func TestHashUndo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "HSET h a 1 b 2", ":2")
+	cmd, _ := router.GetCmdCommand("HDEL")
+	undo := cmd.Undo(db, utils.ToCmdLine("h", "a", "zz"))
+	check(t, db, "HDEL h a zz", ":1")
+	for _, line := range undo {
+		db.ExecNormalCommand(line)
+	}
+	check(t, db, "HMGET h a b", "*2 $1 1 $1 2")
+	check(t, db, "EXPIRE h 100", ":1")
+	replayUndo(t, db, "h")
+	check(t, db, "HMGET h a b", "*2 $1 1 $1 2")
+	check(t, db, "TTL h", ":100")
+}
@@ -0,0 +1,145 @@
+package single_db
+
+import (
+	"github.com/pluming/aurora/datastruct/hyperloglog"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- HyperLogLog Commands ----
+ * HyperLogLog is stored as a string value in the format of redis
+ */
+
+// getAsHLL returns HyperLogLog bound to key, it shares bytes with the string value
+func (db *DB) getAsHLL(key string) (*hyperloglog.HLL, protocol.ErrorReply) {
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+	hll, err := hyperloglog.FromBytes(bytes)
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return hll, nil
+}
+
+// execPFAdd adds elements into HyperLogLog, returns 1 if the estimated cardinality may be changed
+func execPFAdd(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	hll, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := hll == nil
+	if created {
+		hll = hyperloglog.New()
+	} else {
+		// copy on write, replies may still hold the old slice
+		hll = hll.Clone()
+	}
+	changed, err := hll.Add(args[1:]...)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	if !created && !changed {
+		return protocol.MakeIntReply(0)
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: hll.Bytes()})
+	return protocol.MakeIntReply(1)
+}
+
+// mergeHLLRegisters returns the max of registers of HyperLogLogs bound to keys, absent keys are skipped
+func (db *DB) mergeHLLRegisters(keys [][]byte) ([]uint8, protocol.ErrorReply) {
+	var merged []uint8
+	for _, key := range keys {
+		hll, errReply := db.getAsHLL(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if hll == nil {
+			continue
+		}
+		registers, err := hll.Registers()
+		if err != nil {
+			return nil, protocol.MakeErrReply(err.Error())
+		}
+		if merged == nil {
+			merged = registers
+			continue
+		}
+		for i, value := range registers {
+			if value > merged[i] {
+				merged[i] = value
+			}
+		}
+	}
+	return merged, nil
+}
+
+// execPFCount returns the estimated cardinality of the union of HyperLogLogs
+func execPFCount(db *DB, args [][]byte) client.Reply {
+	if len(args) > 1 {
+		registers, errReply := db.mergeHLLRegisters(args)
+		if errReply != nil {
+			return errReply
+		}
+		if registers == nil {
+			return protocol.MakeIntReply(0)
+		}
+		return protocol.MakeIntReply(int64(hyperloglog.Estimate(registers)))
+	}
+
+	key := string(args[0])
+	hll, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hll == nil {
+		return protocol.MakeIntReply(0)
+	}
+	if count, ok := hll.Cached(); ok {
+		return protocol.MakeIntReply(int64(count))
+	}
+	// cache the cardinality like redis, so single key is locked for writing
+	hll = hll.Clone()
+	count, err := hll.Count()
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: hll.Bytes()})
+	return protocol.MakeIntReply(int64(count))
+}
+
+func preparePFCount(args [][]byte) ([]string, []string) {
+	if len(args) == 1 {
+		return router.WriteFirstKey(args)
+	}
+	return router.ReadAllKeys(args)
+}
+
+// execPFMerge merges HyperLogLogs into destination, destination itself is one of the sources if exists
+func execPFMerge(db *DB, args [][]byte) client.Reply {
+	dest := string(args[0])
+	registers, errReply := db.mergeHLLRegisters(args)
+	if errReply != nil {
+		return errReply
+	}
+	hll := hyperloglog.New()
+	if registers != nil {
+		hll = hyperloglog.FromRegisters(registers)
+	}
+	db.PutEntity(dest, &IDB.DataEntity{Data: hll.Bytes()})
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDPFAdd, execPFAdd, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDPFCount, execPFCount, preparePFCount, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDPFMerge, execPFMerge, router.WriteFirstReadOthers, rollbackFirstKey, -2, router.FlagWrite)
+}
@@ -0,0 +1,60 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "PFADD hll foo bar zap", ":1")
+	check(t, db, "PFADD hll zap zap zap", ":0")
+	check(t, db, "PFADD hll foo bar", ":0")
+	check(t, db, "PFCOUNT hll", ":3")
+	check(t, db, "PFADD some-other-hll 1 2 3", ":1")
+	check(t, db, "PFCOUNT hll some-other-hll", ":6")
+	check(t, db, "PFADD empty", ":1")
+	check(t, db, "PFADD empty", ":0")
+	check(t, db, "PFCOUNT empty none", ":0")
+	check(t, db, "PFADD hll1 foo bar zap a", ":1")
+	check(t, db, "PFADD hll2 a b c foo", ":1")
+	check(t, db, "PFMERGE hll3 hll1 hll2", "+OK")
+	check(t, db, "PFCOUNT hll3", ":6")
+	check(t, db, "PFMERGE hll3 none", "+OK")
+	check(t, db, "PFCOUNT hll3", ":6")
+	check(t, db, "PFMERGE hll4", "+OK")
+	check(t, db, "PFCOUNT hll4", ":0")
+	check(t, db, "GETRANGE hll 0 4", "$5 HYLL\x01")
+	check(t, db, "SET s foo", "+OK")
+	check(t, db, "PFADD s a", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	check(t, db, "PFCOUNT s", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	check(t, db, "LPUSH l a", ":1")
+	check(t, db, "PFCOUNT l", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// a hyperloglog is a string which can be copied by GET and SET
+	value := db.ExecNormalCommand([][]byte{[]byte("GET"), []byte("hll3")}).(*protocol.BulkReply).Arg
+	db.ExecNormalCommand([][]byte{[]byte("SET"), []byte("copy"), value})
+	check(t, db, "PFCOUNT copy", ":6")
+}
+
+func TestHyperLogLogDense(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "PFADD small a b c", ":1")
+	args := []string{"PFADD", "big"}
+	for i := 0; i < 20000; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	db.ExecNormalCommand(utils.ToCmdLine(args...))
+	check(t, db, "STRLEN big", ":12304")
+	got, _ := strconv.Atoi(strings.TrimPrefix(run(db, "PFCOUNT big"), ":"))
+	if got < 19600 || got > 20400 {
+		t.Errorf("expect about 20000, got %d", got)
+	}
+	// merging a dense hyperloglog makes the destination dense
+	check(t, db, "PFMERGE small big", "+OK")
+	check(t, db, "STRLEN small", ":12304")
+}
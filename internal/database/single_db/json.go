@@ -0,0 +1,581 @@
+package single_db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/jsondoc"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- JSON Commands ----
+ * compatible with RedisJSON, documents are modified in place while the key is locked.
+ * Commands given a JSONPath starting with '$' reply an array with an element for each matched value,
+ * and commands given a legacy path reply the result of the first matched value.
+ */
+
+// jsonLegacyRoot is the default path of commands
+const jsonLegacyRoot = "."
+
+func (db *DB) getAsJSON(key string) (*jsondoc.Document, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	doc, ok := entity.Data.(*jsondoc.Document)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return doc, nil
+}
+
+// getJSONForUpdate returns the document bound to key which must exist
+func (db *DB) getJSONForUpdate(key string) (*jsondoc.Document, protocol.ErrorReply) {
+	doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if doc == nil {
+		return nil, protocol.MakeErrReply("ERR could not perform this operation on a key that doesn't exist")
+	}
+	return doc, nil
+}
+
+func compileJSONPath(raw []byte) (*jsondoc.Path, protocol.ErrorReply) {
+	path, err := jsondoc.CompilePath(string(raw))
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return path, nil
+}
+
+func parseJSONValue(raw []byte) (interface{}, protocol.ErrorReply) {
+	val, err := jsondoc.Parse(raw)
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return val, nil
+}
+
+func makeJSONPathNotExistErr(pathText []byte) protocol.ErrorReply {
+	return protocol.MakeErrReply(fmt.Sprintf("ERR Path '%s' does not exist", pathText))
+}
+
+// jsonPathOp processes a matched value, returns nil if the value is not of the expected type
+type jsonPathOp func(m jsondoc.Match) client.Reply
+
+// applyJSONPath calls op on each matched value and replies like RedisJSON:
+// nil for values of wrong type given JSONPath, or an error given legacy path
+func applyJSONPath(path *jsondoc.Path, pathText []byte, matches []jsondoc.Match, expect string, op jsonPathOp) client.Reply {
+	if path.IsLegacy() && len(matches) == 0 {
+		return makeJSONPathNotExistErr(pathText)
+	}
+	replies := make([]client.Reply, len(matches))
+	for i, m := range matches {
+		reply := op(m)
+		if reply == nil {
+			if path.IsLegacy() {
+				return protocol.MakeErrReply(fmt.Sprintf("ERR wrong type of path value - expected %s but found %s",
+					expect, jsondoc.TypeName(m.Value)))
+			}
+			reply = protocol.MakeNullBulkReply()
+		}
+		if path.IsLegacy() {
+			return reply
+		}
+		replies[i] = reply
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// selectJSONValue returns matched values given JSONPath, or the first matched value given legacy path
+func selectJSONValue(doc *jsondoc.Document, path *jsondoc.Path) (interface{}, bool) {
+	matches := doc.Select(path)
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return nil, false
+		}
+		return matches[0].Value, true
+	}
+	arr := jsondoc.NewArray()
+	for _, m := range matches {
+		arr.Append(m.Value)
+	}
+	return arr, true
+}
+
+// execJSONSet sets value at path, new keys of object are created if the parent exists
+func execJSONSet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	path, errReply := compileJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	val, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	var nx, xx bool
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if nx && xx {
+		return protocol.MakeSyntaxErrReply()
+	}
+
+	doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		if !path.IsRoot() {
+			return protocol.MakeErrReply("ERR new objects must be created at the root")
+		}
+		if xx {
+			return protocol.MakeNullBulkReply()
+		}
+		db.PutEntity(key, &IDB.DataEntity{Data: jsondoc.New(val)})
+		return protocol.MakeOkReply()
+	}
+
+	if matches := doc.Select(path); len(matches) > 0 {
+		if nx {
+			return protocol.MakeNullBulkReply()
+		}
+		for i, m := range matches {
+			if i > 0 {
+				// matched values must not share the same container
+				val = jsondoc.Clone(val)
+			}
+			doc.Replace(m, val)
+		}
+		return protocol.MakeOkReply()
+	}
+	if xx {
+		return protocol.MakeNullBulkReply()
+	}
+	parentPath, name, ok := path.Parent()
+	if !ok {
+		return protocol.MakeNullBulkReply()
+	}
+	created := false
+	for _, m := range doc.Select(parentPath) {
+		obj, ok := m.Value.(*jsondoc.Object)
+		if !ok {
+			continue
+		}
+		if created {
+			val = jsondoc.Clone(val)
+		}
+		obj.Set(name, val)
+		created = true
+	}
+	if !created {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeOkReply()
+}
+
+// execJSONGet returns values at paths in JSON
+func execJSONGet(db *DB, args [][]byte) client.Reply {
+	var format jsondoc.Format
+	var pathArgs [][]byte
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if (option == "INDENT" || option == "NEWLINE" || option == "SPACE") && i+1 < len(args) {
+			switch option {
+			case "INDENT":
+				format.Indent = string(args[i+1])
+			case "NEWLINE":
+				format.Newline = string(args[i+1])
+			case "SPACE":
+				format.Space = string(args[i+1])
+			}
+			i++
+			continue
+		}
+		pathArgs = append(pathArgs, args[i])
+	}
+	if len(pathArgs) == 0 {
+		pathArgs = [][]byte{[]byte(jsonLegacyRoot)}
+	}
+	paths := make([]*jsondoc.Path, len(pathArgs))
+	legacy := true
+	for i, arg := range pathArgs {
+		path, errReply := compileJSONPath(arg)
+		if errReply != nil {
+			return errReply
+		}
+		paths[i] = path
+		legacy = legacy && path.IsLegacy()
+	}
+
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	if len(paths) == 1 {
+		val, ok := selectJSONValue(doc, paths[0])
+		if !ok {
+			return makeJSONPathNotExistErr(pathArgs[0])
+		}
+		return protocol.MakeBulkReply(jsondoc.MarshalFormat(val, format))
+	}
+	// replies an object of path to values, values of all paths are arrays if any path is JSONPath
+	result := jsondoc.NewObject()
+	for i, path := range paths {
+		var val interface{}
+		if legacy {
+			matches := doc.Select(path)
+			if len(matches) == 0 {
+				return makeJSONPathNotExistErr(pathArgs[i])
+			}
+			val = matches[0].Value
+		} else {
+			arr := jsondoc.NewArray()
+			for _, m := range doc.Select(path) {
+				arr.Append(m.Value)
+			}
+			val = arr
+		}
+		result.Set(string(pathArgs[i]), val)
+	}
+	return protocol.MakeBulkReply(jsondoc.MarshalFormat(result, format))
+}
+
+// execJSONMGet returns values at path of each key, nil for absent keys
+func execJSONMGet(db *DB, args [][]byte) client.Reply {
+	pathText := args[len(args)-1]
+	path, errReply := compileJSONPath(pathText)
+	if errReply != nil {
+		return errReply
+	}
+	keys := args[:len(args)-1]
+	replies := make([]client.Reply, len(keys))
+	for i, key := range keys {
+		replies[i] = protocol.MakeNullBulkReply()
+		doc, _ := db.getAsJSON(string(key))
+		if doc == nil {
+			continue
+		}
+		if val, ok := selectJSONValue(doc, path); ok {
+			replies[i] = protocol.MakeBulkReply(jsondoc.Marshal(val))
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func prepareJSONMGet(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args)-1)
+	for i, v := range args[:len(args)-1] {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+// execJSONDel removes values at path, the key is removed if path is the root
+func execJSONDel(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	pathText := []byte(jsonLegacyRoot)
+	if len(args) > 1 {
+		pathText = args[1]
+	}
+	path, errReply := compileJSONPath(pathText)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeIntReply(0)
+	}
+	if path.IsRoot() {
+		db.Remove(key)
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(int64(doc.Delete(doc.Select(path))))
+}
+
+// execJSONType returns the types of values at path
+func execJSONType(db *DB, args [][]byte) client.Reply {
+	pathText := []byte(jsonLegacyRoot)
+	if len(args) > 1 {
+		pathText = args[1]
+	}
+	path, errReply := compileJSONPath(pathText)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	matches := doc.Select(path)
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeStatusReply(jsondoc.TypeName(matches[0].Value))
+	}
+	types := make([][]byte, len(matches))
+	for i, m := range matches {
+		types[i] = []byte(jsondoc.TypeName(m.Value))
+	}
+	return protocol.MakeMultiBulkReply(types)
+}
+
+// execJSONArrAppend appends values to arrays at path, replies new lengths
+func execJSONArrAppend(db *DB, args [][]byte) client.Reply {
+	path, errReply := compileJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	values := make([]interface{}, len(args)-2)
+	for i, arg := range args[2:] {
+		if values[i], errReply = parseJSONValue(arg); errReply != nil {
+			return errReply
+		}
+	}
+	doc, errReply := db.getJSONForUpdate(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	appended := false
+	return applyJSONPath(path, args[1], doc.Select(path), "array", func(m jsondoc.Match) client.Reply {
+		arr, ok := m.Value.(*jsondoc.Array)
+		if !ok {
+			return nil
+		}
+		for _, val := range values {
+			if appended {
+				val = jsondoc.Clone(val)
+			}
+			arr.Append(val)
+		}
+		appended = true
+		return protocol.MakeIntReply(int64(arr.Len()))
+	})
+}
+
+// execJSONArrInsert inserts values before index of arrays at path, replies new lengths
+func execJSONArrInsert(db *DB, args [][]byte) client.Reply {
+	path, errReply := compileJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	index, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	values := make([]interface{}, len(args)-3)
+	for i, arg := range args[3:] {
+		if values[i], errReply = parseJSONValue(arg); errReply != nil {
+			return errReply
+		}
+	}
+	doc, errReply := db.getJSONForUpdate(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	matches := doc.Select(path)
+	// checks all arrays before inserting so that no array is modified on error
+	for _, m := range matches {
+		if arr, ok := m.Value.(*jsondoc.Array); ok {
+			if index < -int64(arr.Len()) || index > int64(arr.Len()) {
+				return protocol.MakeErrReply("ERR index out of bounds")
+			}
+		}
+	}
+	inserted := false
+	return applyJSONPath(path, args[1], matches, "array", func(m jsondoc.Match) client.Reply {
+		arr, ok := m.Value.(*jsondoc.Array)
+		if !ok {
+			return nil
+		}
+		i := int(index)
+		if i < 0 {
+			i += arr.Len()
+		}
+		items := values
+		if inserted {
+			items = make([]interface{}, len(values))
+			for j, val := range values {
+				items[j] = jsondoc.Clone(val)
+			}
+		}
+		arr.Insert(i, items...)
+		inserted = true
+		return protocol.MakeIntReply(int64(arr.Len()))
+	})
+}
+
+// addJSONNumbers adds numbers, the sum is an integer if both are integers and it does not overflow
+func addJSONNumbers(a, b interface{}) (interface{}, bool) {
+	x, xIsInt := a.(int64)
+	y, yIsInt := b.(int64)
+	if xIsInt && yIsInt && !((y > 0 && x > math.MaxInt64-y) || (y < 0 && x < math.MinInt64-y)) {
+		return x + y, true
+	}
+	toFloat := func(v interface{}) float64 {
+		if i, ok := v.(int64); ok {
+			return float64(i)
+		}
+		return v.(float64)
+	}
+	sum := toFloat(a) + toFloat(b)
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return nil, false
+	}
+	return sum, true
+}
+
+// execJSONNumIncrBy increases numbers at path, replies new values in JSON
+func execJSONNumIncrBy(db *DB, args [][]byte) client.Reply {
+	path, errReply := compileJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	delta, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	switch delta.(type) {
+	case int64, float64:
+	default:
+		return protocol.MakeErrReply("ERR expected a number but found " + jsondoc.TypeName(delta))
+	}
+	doc, errReply := db.getJSONForUpdate(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	matches := doc.Select(path)
+	if path.IsLegacy() && len(matches) == 0 {
+		return makeJSONPathNotExistErr(args[1])
+	}
+	// computes all sums before updating so that no number is modified on error
+	sums := make([]interface{}, len(matches))
+	for i, m := range matches {
+		switch m.Value.(type) {
+		case int64, float64:
+		default:
+			if path.IsLegacy() {
+				return protocol.MakeErrReply("ERR wrong type of path value - expected a number but found " +
+					jsondoc.TypeName(m.Value))
+			}
+			continue
+		}
+		sum, ok := addJSONNumbers(m.Value, delta)
+		if !ok {
+			return protocol.MakeErrReply("ERR result is not a valid number")
+		}
+		sums[i] = sum
+		if path.IsLegacy() {
+			doc.Replace(m, sum)
+			return protocol.MakeBulkReply(jsondoc.Marshal(sum))
+		}
+	}
+	for i, m := range matches {
+		if sums[i] != nil {
+			doc.Replace(m, sums[i])
+		}
+	}
+	return protocol.MakeBulkReply(jsondoc.Marshal(jsondoc.NewArray(sums...)))
+}
+
+// execJSONStrAppend appends to strings at path, replies new lengths
+func execJSONStrAppend(db *DB, args [][]byte) client.Reply {
+	pathText := []byte(jsonLegacyRoot)
+	valueArg := args[1]
+	if len(args) > 2 {
+		pathText, valueArg = args[1], args[2]
+	}
+	path, errReply := compileJSONPath(pathText)
+	if errReply != nil {
+		return errReply
+	}
+	val, errReply := parseJSONValue(valueArg)
+	if errReply != nil {
+		return errReply
+	}
+	suffix, ok := val.(string)
+	if !ok {
+		return protocol.MakeErrReply("ERR expected a JSON string but found " + jsondoc.TypeName(val))
+	}
+	doc, errReply := db.getJSONForUpdate(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return applyJSONPath(path, pathText, doc.Select(path), "string", func(m jsondoc.Match) client.Reply {
+		s, ok := m.Value.(string)
+		if !ok {
+			return nil
+		}
+		s += suffix
+		doc.Replace(m, s)
+		return protocol.MakeIntReply(int64(len(s)))
+	})
+}
+
+// execJSONObjKeys returns keys of objects at path
+func execJSONObjKeys(db *DB, args [][]byte) client.Reply {
+	pathText := []byte(jsonLegacyRoot)
+	if len(args) > 1 {
+		pathText = args[1]
+	}
+	path, errReply := compileJSONPath(pathText)
+	if errReply != nil {
+		return errReply
+	}
+	doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	return applyJSONPath(path, pathText, doc.Select(path), "object", func(m jsondoc.Match) client.Reply {
+		obj, ok := m.Value.(*jsondoc.Object)
+		if !ok {
+			return nil
+		}
+		keys := make([][]byte, obj.Len())
+		for i, key := range obj.Keys() {
+			keys[i] = []byte(key)
+		}
+		return protocol.MakeMultiBulkReply(keys)
+	})
+}
+
+func init() {
+	registerCommand(consts.CMDJSONSet, execJSONSet, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDJSONGet, execJSONGet, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDJSONMGet, execJSONMGet, prepareJSONMGet, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDJSONDel, execJSONDel, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDJSONForget, execJSONDel, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDJSONType, execJSONType, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDJSONArrAppend, execJSONArrAppend, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDJSONArrInsert, execJSONArrInsert, router.WriteFirstKey, rollbackFirstKey, -5, router.FlagWrite)
+	registerCommand(consts.CMDJSONNumIncrBy, execJSONNumIncrBy, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDJSONStrAppend, execJSONStrAppend, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDJSONObjKeys, execJSONObjKeys, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+}
@@ -0,0 +1,54 @@
+package single_db
+
+import (
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+)
+
+func TestJSON(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, `JSON.SET j $.a 1`, "-ERR new objects must be created at the root")
+	check(t, db, `JSON.SET j $ {"a":{"b":[1,2]},"c":[{"b":"x"}],"n":1}`, "+OK")
+	check(t, db, `TYPE j`, "+ReJSON-RL")
+	check(t, db, `JSON.GET j`, `$39 {"a":{"b":[1,2]},"c":[{"b":"x"}],"n":1}`)
+	check(t, db, `JSON.GET j $..b`, `$11 [[1,2],"x"]`)
+	check(t, db, `JSON.GET j .a.b[0]`, `$1 1`)
+	check(t, db, `JSON.GET j .nope`, `-ERR Path '.nope' does not exist`)
+	check(t, db, `JSON.GET j $.a $.n`, `$31 {"$.a":[{"b":[1,2]}],"$.n":[1]}`)
+	check(t, db, `JSON.SET j $.a.new true`, "+OK")
+	check(t, db, `JSON.SET j $.a.new false NX`, "$-1")
+	check(t, db, `JSON.SET j $.x.y 1`, "$-1")
+	check(t, db, `JSON.TYPE j $..b`, "*2 $5 array $6 string")
+	check(t, db, `JSON.TYPE j .n`, "+integer")
+	check(t, db, `JSON.ARRAPPEND j $..b 3 "s"`, "*2 :4 $-1")
+	check(t, db, `JSON.ARRAPPEND j .c[0].b 3`, "-ERR wrong type of path value - expected array but found string")
+	check(t, db, `JSON.ARRINSERT j $.a.b -1 0`, "*1 :5")
+	check(t, db, `JSON.ARRINSERT j $.a.b 9 0`, "-ERR index out of bounds")
+	check(t, db, `JSON.GET j $.a.b`, `$15 [[1,2,3,0,"s"]]`)
+	check(t, db, `JSON.NUMINCRBY j $.n 2`, `$3 [3]`)
+	check(t, db, `JSON.NUMINCRBY j .n 0.5`, `$3 3.5`)
+	check(t, db, `JSON.NUMINCRBY j $..b 1`, `$11 [null,null]`)
+	check(t, db, `JSON.STRAPPEND j $.c[*].b "yz"`, "*1 :3")
+	check(t, db, `JSON.STRAPPEND j .c[0].b 1`, "-ERR expected a JSON string but found integer")
+	check(t, db, `JSON.OBJKEYS j`, "*3 $1 a $1 c $1 n")
+	check(t, db, `JSON.OBJKEYS j $..*`, "*12 *2 $1 b $3 new $-1 $-1 $-1 $-1 $-1 $-1 $-1 $-1 $-1 *1 $1 b $-1")
+	before := run(db, "JSON.GET j")
+	undo := rollbackGivenKeys(db, "j")
+	check(t, db, `JSON.DEL j $.a.b[0,1]`, ":2")
+	check(t, db, `JSON.DEL j $..b`, ":2")
+	check(t, db, `JSON.GET j`, `$35 {"a":{"new":true},"c":[{}],"n":3.5}`)
+	for _, line := range undo {
+		if r := db.ExecNormalCommand(line); protocol.IsErrorReply(r) {
+			t.Error(string(r.ToBytes()))
+		}
+	}
+	check(t, db, "JSON.GET j", before)
+	check(t, db, `JSON.SET k $ [1]`, "+OK")
+	check(t, db, `JSON.MGET j k nokey $[0]`, "*3 $2 [] $3 [1] $-1")
+	check(t, db, `JSON.GET k INDENT __ NEWLINE | SPACE _ $`, "$17 [|__[|____1|__]|]")
+	check(t, db, `JSON.DEL k`, ":1")
+	check(t, db, `EXISTS k`, ":0")
+	check(t, db, `JSON.SET j $ {bad`, "-ERR invalid JSON at offset 1: expect object key")
+	check(t, db, `JSON.GET j $[`, "-ERR invalid JSONPath '$[' at offset 2: unterminated bracket")
+}
@@ -0,0 +1,205 @@
+package single_db
+
+import (
+	"github.com/pluming/aurora/datastruct/bloom"
+	"github.com/pluming/aurora/datastruct/cms"
+	"github.com/pluming/aurora/datastruct/cuckoo"
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/jsondoc"
+	"github.com/pluming/aurora/datastruct/list"
+	"github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/datastruct/stream"
+	"github.com/pluming/aurora/datastruct/tdigest"
+	"github.com/pluming/aurora/datastruct/timeseries"
+	"github.com/pluming/aurora/datastruct/topk"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/wildcard"
+)
+
+// execDel removes a key from db
+func execDel(db *DB, args [][]byte) client.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+
+	deleted := db.Removes(keys...)
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+func undoDel(db *DB, args [][]byte) []router.CmdLine {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execExists checks if given keys exist in db, duplicated keys are counted repeatedly
+func execExists(db *DB, args [][]byte) client.Reply {
+	result := int64(0)
+	for _, arg := range args {
+		key := string(arg)
+		_, exists := db.GetEntity(key)
+		if exists {
+			result++
+		}
+	}
+	return protocol.MakeIntReply(result)
+}
+
+// execTouch returns the number of existing keys, TOUCH only refreshes access time in redis
+func execTouch(db *DB, args [][]byte) client.Reply {
+	return execExists(db, args)
+}
+
+// typeOf returns the redis type name of the given entity
+func typeOf(entity *IDB.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte:
+		return "string"
+	case list.List:
+		return "list"
+	case dict.Dict:
+		return "hash"
+	case *set.Set:
+		return "set"
+	case *zset.ZSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
+	case *bloom.Filter:
+		return "MBbloom--"
+	case *cuckoo.Filter:
+		return "MBbloomCF"
+	case *jsondoc.Document:
+		return "ReJSON-RL"
+	case *timeseries.Series:
+		return "TSDB-TYPE"
+	case *cms.Sketch:
+		return "CMSk-TYPE"
+	case *topk.TopK:
+		return "TopK-TYPE"
+	case *tdigest.Digest:
+		return "TDIS-TYPE"
+	}
+	return "none"
+}
+
+// execType returns the type of entity, including: string, list, hash, set, zset and stream
+func execType(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return protocol.MakeStatusReply("none")
+	}
+	return protocol.MakeStatusReply(typeOf(entity))
+}
+
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoRename(db *DB, args [][]byte) []router.CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
+
+// rename moves entity and its ttl from src to dest, overriding dest
+func (db *DB) rename(src, dest string, entity *IDB.DataEntity) {
+	expireTime, hasTTL := db.getExpireTime(src)
+	db.Removes(src, dest) // clean src and dest with their ttl
+	db.PutEntity(dest, entity)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
+}
+
+// execRename a key
+func execRename(db *DB, args [][]byte) client.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+
+	entity, ok := db.GetEntity(src)
+	if !ok {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	if src == dest {
+		return protocol.MakeOkReply()
+	}
+	db.rename(src, dest, entity)
+	return protocol.MakeOkReply()
+}
+
+// execRenameNx a key, only if the new key does not exist
+func execRenameNx(db *DB, args [][]byte) client.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+
+	entity, ok := db.GetEntity(src)
+	if !ok {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	if _, exists := db.GetEntity(dest); exists {
+		return protocol.MakeIntReply(0)
+	}
+	db.rename(src, dest, entity)
+	return protocol.MakeIntReply(1)
+}
+
+// execKeys returns all keys matching the given pattern
+func execKeys(db *DB, args [][]byte) client.Reply {
+	pattern, err := wildcard.CompilePattern(string(args[0]))
+	if err != nil {
+		return protocol.MakeErrReply("ERR illegal wildcard")
+	}
+	result := make([][]byte, 0)
+	for _, key := range db.data.Keys() {
+		if pattern.IsMatch(key) && !db.hasExpired(key) {
+			result = append(result, []byte(key))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// maxRandomKeyTries limits the attempts of RANDOMKEY to skip expired keys
+const maxRandomKeyTries = 100
+
+// execRandomKey returns a random key from db
+func execRandomKey(db *DB, args [][]byte) client.Reply {
+	for i := 0; i < maxRandomKeyTries; i++ {
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		if !db.hasExpired(keys[0]) {
+			return protocol.MakeBulkReply([]byte(keys[0]))
+		}
+	}
+	return protocol.MakeNullBulkReply()
+}
+
+// execDBSize returns the number of keys in db
+func execDBSize(db *DB, args [][]byte) client.Reply {
+	return protocol.MakeIntReply(int64(db.data.Len()))
+}
+
+func init() {
+	registerCommand(consts.CMDDel, execDel, router.WriteAllKeys, undoDel, -2, router.FlagWrite)
+	registerCommand(consts.CMDExists, execExists, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDTouch, execTouch, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDType, execType, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDRename, execRename, prepareRename, undoRename, 3, router.FlagWrite)
+	registerCommand(consts.CMDRenameNX, execRenameNx, prepareRename, undoRename, 3, router.FlagWrite)
+	registerCommand(consts.CMDKeys, execKeys, router.NoPrepare, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDRandomKey, execRandomKey, router.NoPrepare, nil, 1, router.FlagReadOnly)
+	registerCommand(consts.CMDDBSize, execDBSize, router.NoPrepare, nil, 1, router.FlagReadOnly)
+}
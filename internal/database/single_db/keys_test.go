@@ -0,0 +1,52 @@
+package single_db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyspace(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "MSET a 1 b 2 ab 3", "+OK")
+	check(t, db, "EXISTS a a c", ":2")
+	check(t, db, "TYPE a", "+string")
+	check(t, db, "TYPE zz", "+none")
+	check(t, db, "DBSIZE", ":3")
+	check(t, db, "RENAMENX a b", ":0")
+	check(t, db, "RENAMENX a c", ":1")
+	check(t, db, "RENAME nope x", "-ERR no such key")
+	check(t, db, "DEL c b nope", ":2")
+	check(t, db, "KEYS a*", "*1 $2 ab")
+	check(t, db, "RANDOMKEY", "$2 ab")
+	check(t, db, "TOUCH ab nope", ":1")
+	check(t, db, "DEL ab", ":1")
+	check(t, db, "RANDOMKEY", "$-1")
+}
+
+func TestRename(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET t 1 EX 100", "+OK")
+	check(t, db, "SET t2 2", "+OK")
+	check(t, db, "RENAME t t2", "+OK")
+	check(t, db, "GET t2", "$1 1")
+	if _, ok := db.getExpireTime("t2"); !ok {
+		t.Error("expire time should be renamed")
+	}
+	check(t, db, "EXISTS t", ":0")
+	if db.GetVersion("t") != 2 || db.GetVersion("t2") != 2 {
+		t.Errorf("expect versions of both keys increased, got %d and %d", db.GetVersion("t"), db.GetVersion("t2"))
+	}
+}
+
+func TestKeysSkipExpired(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET a 1", "+OK")
+	// expire time without expire task, so only lazy expiring can remove the key
+	db.ttlMap.Put("a", time.Now().Add(-time.Second))
+	check(t, db, "KEYS *", "*0")
+	check(t, db, "RANDOMKEY", "$-1")
+	// keys are not locked by KEYS and RANDOMKEY, so they must not remove expired keys
+	check(t, db, "DBSIZE", ":1")
+	check(t, db, "GET a", "$-1")
+	check(t, db, "DBSIZE", ":0")
+}
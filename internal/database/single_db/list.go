@@ -0,0 +1,840 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/list"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func (db *DB) getAsList(key string) (list.List, protocol.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	l, ok := entity.Data.(list.List)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return l, nil
+}
+
+func (db *DB) getOrInitList(key string) (l list.List, isNew bool, errReply protocol.ErrorReply) {
+	l, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if l == nil {
+		l = makeList()
+		db.PutEntity(key, &IDB.DataEntity{
+			Data: l,
+		})
+		isNew = true
+	}
+	return l, isNew, nil
+}
+
+func equalsTo(expected []byte) list.Expected {
+	return func(actual interface{}) bool {
+		return utils.Equals(actual, expected)
+	}
+}
+
+// execLPush inserts element at head of list
+func execLPush(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	l, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range values {
+		l.Insert(0, value)
+	}
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+func undoLPush(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	return []router.CmdLine{
+		utils.ToCmdLine(consts.CMDLPop, key, strconv.Itoa(count)),
+	}
+}
+
+// execLPushX inserts element at head of list, only if list exists
+func execLPushX(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeIntReply(0)
+	}
+	for _, value := range values {
+		l.Insert(0, value)
+	}
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+// execRPush inserts element at last of list
+func execRPush(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	l, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range values {
+		l.Add(value)
+	}
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+func undoRPush(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	return []router.CmdLine{
+		utils.ToCmdLine(consts.CMDRPop, key, strconv.Itoa(count)),
+	}
+}
+
+// execRPushX inserts element at last of list, only if list exists
+func execRPushX(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeIntReply(0)
+	}
+	for _, value := range values {
+		l.Add(value)
+	}
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+// parsePopCount parses the optional count argument of LPOP and RPOP, count is -1 if absent
+func parsePopCount(args [][]byte, cmdName string) (int64, protocol.ErrorReply) {
+	if len(args) > 2 {
+		return 0, protocol.MakeArgNumErrReply(strings.ToLower(cmdName))
+	}
+	if len(args) == 1 {
+		return -1, nil
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || count < 0 {
+		return 0, protocol.MakeErrReply("ERR value is out of range, must be positive")
+	}
+	return count, nil
+}
+
+// listPop removes elements from head or tail of list, it replies a single element if count is -1
+func (db *DB) listPop(key string, count int64, fromLeft bool) client.Reply {
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		if count < 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeNullMultiBulkReply()
+	}
+
+	n := count
+	if count < 0 {
+		n = 1
+	}
+	if n > int64(l.Len()) {
+		n = int64(l.Len())
+	}
+	vals := make([][]byte, 0, n)
+	for i := int64(0); i < n; i++ {
+		var val interface{}
+		if fromLeft {
+			val = l.Remove(0)
+		} else {
+			val = l.RemoveLast()
+		}
+		vals = append(vals, val.([]byte))
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if count < 0 {
+		return protocol.MakeBulkReply(vals[0])
+	}
+	return protocol.MakeMultiBulkReply(vals)
+}
+
+// execLPop removes the first elements of list and returns them
+func execLPop(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	count, errReply := parsePopCount(args, consts.CMDLPop)
+	if errReply != nil {
+		return errReply
+	}
+	return db.listPop(key, count, true)
+}
+
+// undoPop returns a command line pushing the elements to be popped back
+func undoPop(db *DB, args [][]byte, fromLeft bool) []router.CmdLine {
+	key := string(args[0])
+	l, errReply := db.getAsList(key)
+	if errReply != nil || l == nil || l.Len() == 0 {
+		return nil
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count <= 0 {
+			return nil
+		}
+	}
+	size := int64(l.Len())
+	if count > size {
+		count = size
+	}
+	if fromLeft {
+		vals := l.Range(0, int(count))
+		// LPUSH inserts elements one by one, so push them in reverse order
+		cmdLine := utils.ToCmdLine(consts.CMDLPush, key)
+		for i := len(vals) - 1; i >= 0; i-- {
+			cmdLine = append(cmdLine, vals[i].([]byte))
+		}
+		return []router.CmdLine{cmdLine}
+	}
+	vals := l.Range(int(size-count), int(size))
+	cmdLine := utils.ToCmdLine(consts.CMDRPush, key)
+	cmdLine = append(cmdLine, toBytesSlice(vals)...)
+	return []router.CmdLine{cmdLine}
+}
+
+func undoLPop(db *DB, args [][]byte) []router.CmdLine {
+	return undoPop(db, args, true)
+}
+
+// execRPop removes the last elements of list and returns them
+func execRPop(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	count, errReply := parsePopCount(args, consts.CMDRPop)
+	if errReply != nil {
+		return errReply
+	}
+	return db.listPop(key, count, false)
+}
+
+func undoRPop(db *DB, args [][]byte) []router.CmdLine {
+	return undoPop(db, args, false)
+}
+
+// execLRange gets elements of list in given range
+func execLRange(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	begin, end, ok := normalizeRange(start, stop, int64(l.Len()))
+	if !ok {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return protocol.MakeMultiBulkReply(toBytesSlice(l.Range(int(begin), int(end))))
+}
+
+// execLIndex gets element of list at given index
+func execLIndex(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	index, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	size := int64(l.Len())
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply(l.Get(int(index)).([]byte))
+}
+
+// execLSet puts element at index of list
+func execLSet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	index, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value := args[2]
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	size := int64(l.Len())
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return protocol.MakeErrReply("ERR index out of range")
+	}
+	l.Set(int(index), value)
+	return protocol.MakeOkReply()
+}
+
+func undoLSet(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil || l == nil {
+		return nil
+	}
+	size := int64(l.Len())
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return nil
+	}
+	value := l.Get(int(index)).([]byte)
+	return []router.CmdLine{
+		utils.ToCmdLine3(consts.CMDLSet, args[0], []byte(strconv.FormatInt(index, 10)), value),
+	}
+}
+
+// execLRem removes element of list
+func execLRem(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	count, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value := args[2]
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeIntReply(0)
+	}
+
+	var removed int
+	if count == 0 {
+		removed = l.RemoveAllByVal(equalsTo(value))
+	} else if count > 0 {
+		removed = l.RemoveByVal(equalsTo(value), int(count))
+	} else {
+		removed = l.ReverseRemoveByVal(equalsTo(value), int(-count))
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(int64(removed))
+}
+
+// execLInsert inserts element before or after the pivot of list
+func execLInsert(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	var after bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+		after = false
+	case "AFTER":
+		after = true
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+	pivot := args[2]
+	value := args[3]
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeIntReply(0)
+	}
+	index := -1
+	l.ForEach(func(i int, v interface{}) bool {
+		if utils.Equals(v, pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return protocol.MakeIntReply(-1)
+	}
+	if after {
+		index++
+	}
+	l.Insert(index, value)
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+// execLLen gets length of list
+func execLLen(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(l.Len()))
+}
+
+// execLTrim trims list so that it contains only the elements in the given range
+func execLTrim(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeOkReply()
+	}
+	size := l.Len()
+	begin, end, ok := normalizeRange(start, stop, int64(size))
+	if !ok {
+		db.Remove(key)
+		return protocol.MakeOkReply()
+	}
+	for i := size; i > int(end); i-- {
+		l.RemoveLast()
+	}
+	for i := 0; i < int(begin); i++ {
+		l.Remove(0)
+	}
+	return protocol.MakeOkReply()
+}
+
+// execLPos returns the index of matching elements inside list
+func execLPos(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	value := args[1]
+	rank := int64(1)
+	count := int64(-1) // -1 means COUNT is absent
+	maxLen := int64(0)
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		option := strings.ToUpper(string(args[i]))
+		val, errReply := parseInt(args[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		switch option {
+		case "RANK":
+			if val == 0 {
+				return protocol.MakeErrReply("ERR RANK can't be zero: use 1 to start from the first match, " +
+					"2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = val
+		case "COUNT":
+			if val < 0 {
+				return protocol.MakeErrReply("ERR COUNT can't be negative")
+			}
+			count = val
+		case "MAXLEN":
+			if val < 0 {
+				return protocol.MakeErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = val
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	matches := make([]int64, 0)
+	if l != nil {
+		size := l.Len()
+		scanned := size
+		if maxLen > 0 && maxLen < int64(size) {
+			scanned = int(maxLen)
+		}
+		// window holds the elements to scan, scan from tail if rank is negative
+		var window []interface{}
+		skip := rank - 1
+		if rank > 0 {
+			window = l.Range(0, scanned)
+		} else {
+			window = l.Range(size-scanned, size)
+			skip = -rank - 1
+		}
+		for j := 0; j < scanned; j++ {
+			index, pos := j, j
+			if rank < 0 {
+				index, pos = size-1-j, scanned-1-j
+			}
+			if !utils.Equals(window[pos], value) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			matches = append(matches, int64(index))
+			if count < 0 || (count > 0 && int64(len(matches)) == count) {
+				break
+			}
+		}
+	}
+
+	if count < 0 {
+		if len(matches) == 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeIntReply(matches[0])
+	}
+	replies := make([]client.Reply, len(matches))
+	for i, index := range matches {
+		replies[i] = protocol.MakeIntReply(index)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// listMove pops an element from src and pushes it into dest
+func (db *DB) listMove(src, dest string, fromLeft, toLeft bool) client.Reply {
+	srcList, errReply := db.getAsList(src)
+	if errReply != nil {
+		return errReply
+	}
+	if srcList == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	// check type of dest before modifying src
+	if _, errReply = db.getAsList(dest); errReply != nil {
+		return errReply
+	}
+
+	var val interface{}
+	if fromLeft {
+		val = srcList.Remove(0)
+	} else {
+		val = srcList.RemoveLast()
+	}
+	if srcList.Len() == 0 {
+		db.Remove(src)
+	}
+	destList, _, _ := db.getOrInitList(dest)
+	if toLeft {
+		destList.Insert(0, val)
+	} else {
+		destList.Add(val)
+	}
+	return protocol.MakeBulkReply(val.([]byte))
+}
+
+func parseListDirection(raw []byte) (left bool, errReply protocol.ErrorReply) {
+	switch strings.ToUpper(string(raw)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, protocol.MakeSyntaxErrReply()
+}
+
+// execLMove atomically moves the first or last element of source list to the head or tail of destination list
+func execLMove(db *DB, args [][]byte) client.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	return db.listMove(src, dest, fromLeft, toLeft)
+}
+
+// execRPopLPush pops the last element of source list and pushes it at the head of destination list
+func execRPopLPush(db *DB, args [][]byte) client.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	return db.listMove(src, dest, false, true)
+}
+
+func prepareLMove(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoLMove(db *DB, args [][]byte) []router.CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
+
+// parseMPop parses "numkeys key [key ...] LEFT|RIGHT [COUNT count]" of LMPOP and BLMPOP
+func parseMPop(args [][]byte) (keys []string, fromLeft bool, count int64, errReply protocol.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, protocol.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if int64(len(args)) < numKeys+2 {
+		return nil, false, 0, protocol.MakeSyntaxErrReply()
+	}
+	for _, arg := range args[1 : numKeys+1] {
+		keys = append(keys, string(arg))
+	}
+	fromLeft, errReply = parseListDirection(args[numKeys+1])
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	count = 1
+	options := args[numKeys+2:]
+	if len(options) == 0 {
+		return keys, fromLeft, count, nil
+	}
+	if len(options) != 2 || strings.ToUpper(string(options[0])) != "COUNT" {
+		return nil, false, 0, protocol.MakeSyntaxErrReply()
+	}
+	count, err = strconv.ParseInt(string(options[1]), 10, 64)
+	if err != nil || count <= 0 {
+		return nil, false, 0, protocol.MakeErrReply("ERR count should be greater than 0")
+	}
+	return keys, fromLeft, count, nil
+}
+
+// listMPop pops elements from list and replies with the key name, ok is false if the list is empty
+func (db *DB) listMPop(key string, fromLeft bool, count int64) (client.Reply, bool) {
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply, true
+	}
+	if l == nil {
+		return nil, false
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte(key)),
+		db.listPop(key, count, fromLeft),
+	}), true
+}
+
+// execLMPop pops elements from the first non-empty list of given keys
+func execLMPop(db *DB, args [][]byte) client.Reply {
+	keys, fromLeft, count, errReply := parseMPop(args)
+	if errReply != nil {
+		return errReply
+	}
+	for _, key := range keys {
+		if reply, ok := db.listMPop(key, fromLeft, count); ok {
+			return reply
+		}
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+func prepareLMPop(args [][]byte) ([]string, []string) {
+	keys, _, _, errReply := parseMPop(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+// listBPop pops an element from list and replies with the key name, ok is false if the list is empty
+func (db *DB) listBPop(key string, fromLeft bool) (client.Reply, bool) {
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply, true
+	}
+	if l == nil {
+		return nil, false
+	}
+	val := db.listPop(key, -1, fromLeft).(*protocol.BulkReply)
+	return protocol.MakeMultiBulkReply([][]byte{[]byte(key), val.Arg}), true
+}
+
+func parseBPop(args [][]byte, fromLeft bool) (*blockingOp, protocol.ErrorReply) {
+	timeout, errReply := parseTimeout(args[len(args)-1])
+	if errReply != nil {
+		return nil, errReply
+	}
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	return &blockingOp{
+		keys:    keys,
+		timeout: timeout,
+		serve: func(db *DB, key string) (client.Reply, bool) {
+			return db.listBPop(key, fromLeft)
+		},
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+	}, nil
+}
+
+// parseBLPop parses BLPOP which blocks until the first element of one of the lists can be popped
+func parseBLPop(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	return parseBPop(args, true)
+}
+
+// parseBRPop parses BRPOP which blocks until the last element of one of the lists can be popped
+func parseBRPop(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	return parseBPop(args, false)
+}
+
+func prepareBPop(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	return keys, nil
+}
+
+func makeBMoveOp(src, dest string, fromLeft, toLeft bool, rawTimeout []byte) (*blockingOp, protocol.ErrorReply) {
+	timeout, errReply := parseTimeout(rawTimeout)
+	if errReply != nil {
+		return nil, errReply
+	}
+	return &blockingOp{
+		keys:      []string{src},
+		extraKeys: []string{dest},
+		timeout:   timeout,
+		serve: func(db *DB, key string) (client.Reply, bool) {
+			l, errReply := db.getAsList(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if l == nil {
+				return nil, false
+			}
+			return db.listMove(key, dest, fromLeft, toLeft), true
+		},
+		timeoutReply: protocol.MakeNullBulkReply(),
+	}, nil
+}
+
+// parseBLMove parses BLMOVE which blocks until source list has an element to move
+func parseBLMove(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return nil, errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return nil, errReply
+	}
+	return makeBMoveOp(string(args[0]), string(args[1]), fromLeft, toLeft, args[4])
+}
+
+// parseBRPopLPush parses BRPOPLPUSH, the blocking version of RPOPLPUSH
+func parseBRPopLPush(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	return makeBMoveOp(string(args[0]), string(args[1]), false, true, args[2])
+}
+
+// parseBLMPop parses BLMPOP which blocks until one of the lists has elements to pop
+func parseBLMPop(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	timeout, errReply := parseTimeout(args[0])
+	if errReply != nil {
+		return nil, errReply
+	}
+	keys, fromLeft, count, errReply := parseMPop(args[1:])
+	if errReply != nil {
+		return nil, errReply
+	}
+	return &blockingOp{
+		keys:    keys,
+		timeout: timeout,
+		serve: func(db *DB, key string) (client.Reply, bool) {
+			return db.listMPop(key, fromLeft, count)
+		},
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+	}, nil
+}
+
+func prepareBLMPop(args [][]byte) ([]string, []string) {
+	return prepareLMPop(args[1:])
+}
+
+func init() {
+	registerCommand(consts.CMDLPush, execLPush, router.WriteFirstKey, undoLPush, -3, router.FlagWrite)
+	registerCommand(consts.CMDLPushX, execLPushX, router.WriteFirstKey, undoLPush, -3, router.FlagWrite)
+	registerCommand(consts.CMDRPush, execRPush, router.WriteFirstKey, undoRPush, -3, router.FlagWrite)
+	registerCommand(consts.CMDRPushX, execRPushX, router.WriteFirstKey, undoRPush, -3, router.FlagWrite)
+	registerCommand(consts.CMDLPop, execLPop, router.WriteFirstKey, undoLPop, -2, router.FlagWrite)
+	registerCommand(consts.CMDRPop, execRPop, router.WriteFirstKey, undoRPop, -2, router.FlagWrite)
+	registerCommand(consts.CMDLRange, execLRange, router.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	registerCommand(consts.CMDLIndex, execLIndex, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDLSet, execLSet, router.WriteFirstKey, undoLSet, 4, router.FlagWrite)
+	registerCommand(consts.CMDLRem, execLRem, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDLInsert, execLInsert, router.WriteFirstKey, rollbackFirstKey, 5, router.FlagWrite)
+	registerCommand(consts.CMDLLen, execLLen, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDLTrim, execLTrim, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDLPos, execLPos, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDLMove, execLMove, prepareLMove, undoLMove, 5, router.FlagWrite)
+	registerCommand(consts.CMDRPopLPush, execRPopLPush, prepareLMove, undoLMove, 3, router.FlagWrite)
+	registerCommand(consts.CMDLMPop, execLMPop, prepareLMPop, rollbackWriteKeys(prepareLMPop), -4, router.FlagWrite)
+	registerBlockingCommand(consts.CMDBLPop, parseBLPop, prepareBPop, -3)
+	registerBlockingCommand(consts.CMDBRPop, parseBRPop, prepareBPop, -3)
+	registerBlockingCommand(consts.CMDBLMove, parseBLMove, prepareLMove, 6)
+	registerBlockingCommand(consts.CMDBRPopLPush, parseBRPopLPush, prepareLMove, 4)
+	registerBlockingCommand(consts.CMDBLMPop, parseBLMPop, prepareBLMPop, -5)
+}
@@ -0,0 +1,56 @@
+package single_db
+
+import (
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+)
+
+func TestList(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "RPUSH l a b c a", ":4")
+	check(t, db, "LPUSH l z", ":5")
+	check(t, db, "LLEN l", ":5")
+	check(t, db, "LRANGE l 0 -1", "*5 $1 z $1 a $1 b $1 c $1 a")
+	check(t, db, "LRANGE l -100 1", "*2 $1 z $1 a")
+	check(t, db, "LPOS l a", ":1")
+	check(t, db, "LPOS l a RANK -1", ":4")
+	check(t, db, "LPOS l a COUNT 0", "*2 :1 :4")
+	check(t, db, "LPOS l a RANK 2 MAXLEN 3", "$-1")
+	check(t, db, "LINDEX l -1", "$1 a")
+	check(t, db, "LSET l 0 y", "+OK")
+	check(t, db, "LINSERT l AFTER b q", ":6")
+	check(t, db, "LREM l -1 a", ":1")
+	check(t, db, "LRANGE l 0 -1", "*5 $1 y $1 a $1 b $1 q $1 c")
+	check(t, db, "LTRIM l 1 -2", "+OK")
+	check(t, db, "LRANGE l 0 -1", "*3 $1 a $1 b $1 q")
+	check(t, db, "LPOP l 2", "*2 $1 a $1 b")
+	check(t, db, "RPOP nope 2", "*-1")
+	check(t, db, "LMOVE l l2 LEFT RIGHT", "$1 q")
+	check(t, db, "EXISTS l", ":0")
+	check(t, db, "TYPE l2", "+list")
+	check(t, db, "LPUSHX nope a", ":0")
+	check(t, db, "EXISTS nope", ":0")
+}
+
+func TestListWrongType(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET s x", "+OK")
+	check(t, db, "RPUSH l a", ":1")
+	check(t, db, "LPUSH s x", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	check(t, db, "RPOPLPUSH l s", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	check(t, db, "LRANGE l 0 -1", "*1 $1 a")
+}
+
+func TestListUndo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "RPUSH u 1 2 3", ":3")
+	undo := undoLPop(db, [][]byte{[]byte("u"), []byte("2")})
+	check(t, db, "LPOP u 2", "*2 $1 1 $1 2")
+	for _, line := range undo {
+		if r := db.ExecNormalCommand(line); protocol.IsErrorReply(r) {
+			t.Error(string(r.ToBytes()))
+		}
+	}
+	check(t, db, "LRANGE u 0 -1", "*3 $1 1 $1 2 $1 3")
+}
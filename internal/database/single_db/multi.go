@@ -0,0 +1,137 @@
+package single_db
+
+import (
+	"strings"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/internal/database/transaction"
+)
+
+/* ---- Transaction ----
+ * Commands between MULTI and EXEC are validated and queued by transaction.EnqueueCmd.
+ * EXEC locks keys of all queued commands and watching keys during executing them, so the transaction is isolated.
+ * If a command fails, commands executed before it are rolled back by their undo logs.
+ * Transactions containing commands across databases are executed by standalone.MultiDB by ExecQueued.
+ */
+
+// execMulti executes the queued commands of conn
+func (db *DB) execMulti(conn client.Connection) client.Reply {
+	if !conn.InMultiState() {
+		return protocol.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return db.ExecMulti(conn.GetWatching(), conn.GetQueuedCmdLine())
+}
+
+// ExecMulti executes command lines atomically and isolated, it replies null if any watching key has been modified.
+// Watching keys should be in db, transactions watching keys of other databases are executed by standalone.MultiDB
+func (db *DB) ExecMulti(watching map[client.WatchedKey]uint64, cmdLines []router.CmdLine) client.Reply {
+	write := make([]string, 0) // may contains duplicate
+	read := make([]string, 0, len(watching))
+	resolved := false
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToUpper(string(cmdLine[0]))
+		cmd, _ := router.GetCmdCommand(cmdName)
+		w, r := cmd.Prepare(cmdLine[1:])
+		write = append(write, w...)
+		read = append(read, r...)
+		if _, ok := keyResolvers[cmdName]; ok {
+			resolved = true
+		}
+	}
+	for key := range watching {
+		read = append(read, key.Key)
+	}
+	// keys named by values are unknown until executing, so all keys are locked
+	if resolved {
+		db.locker.LockAll()
+	} else {
+		db.RWLocks(write, read)
+	}
+	unlock := func() {
+		if resolved {
+			db.locker.UnLockAll()
+		} else {
+			db.RWUnLocks(write, read)
+		}
+	}
+
+	if transaction.IsWatchingChanged(func(int) transaction.Versioned { return db }, watching) {
+		unlock()
+		return protocol.MakeNullMultiBulkReply()
+	}
+	results := make([]client.Reply, 0, len(cmdLines))
+	undoLogs := make([][]router.CmdLine, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		cmdName, args := strings.ToUpper(string(cmdLine[0])), cmdLine[1:]
+		cmd, _ := router.GetCmdCommand(cmdName)
+		if resolve, ok := keyResolvers[cmdName]; ok {
+			w, _ := resolve(db, args)
+			write = append(write, w...)
+		}
+		if cmd.Undo != nil {
+			undoLogs = append(undoLogs, cmd.Undo(db, args))
+		}
+		result := cmd.Executor(db, args)
+		if errReply, ok := result.(protocol.ErrorReply); ok {
+			// the failed command is rolled back too, in case it failed after modifying some keys
+			db.Rollback(undoLogs)
+			unlock()
+			return protocol.MakeErrReply("EXECABORT Transaction rolled back because of error: " + errReply.Error())
+		}
+		results = append(results, result)
+	}
+	db.addVersion(write...)
+	unlock()
+	// written keys may be waited by blocked clients
+	db.serveBlocked(write)
+	return protocol.MakeMultiRawReply(results)
+}
+
+// ExecQueued executes a command line queued in a transaction across databases, invoker should lock all keys by LockAll
+// and serve blocked clients after unlocking. It returns the reply and undo logs of the command,
+// keys written by the command are marked modified at once.
+func (db *DB) ExecQueued(cmdLine router.CmdLine) (client.Reply, []router.CmdLine) {
+	cmdName, args := strings.ToUpper(string(cmdLine[0])), cmdLine[1:]
+	cmd, _ := router.GetCmdCommand(cmdName)
+	write, _ := cmd.Prepare(args)
+	if resolve, ok := keyResolvers[cmdName]; ok {
+		w, _ := resolve(db, args)
+		write = append(write, w...)
+	}
+	var undoLog []router.CmdLine
+	if cmd.Undo != nil {
+		undoLog = cmd.Undo(db, args)
+	}
+	db.addVersion(write...)
+	return cmd.Executor(db, args), undoLog
+}
+
+// UndoKeys returns undo logs restoring the given keys, for commands executed by invoker rather than ExecQueued
+func (db *DB) UndoKeys(keys ...string) []router.CmdLine {
+	return rollbackGivenKeys(db, keys...)
+}
+
+// Rollback applies undo logs in reverse order, invoker should lock keys
+func (db *DB) Rollback(undoLogs [][]router.CmdLine) {
+	for i := len(undoLogs) - 1; i >= 0; i-- {
+		for _, cmdLine := range undoLogs[i] {
+			db.execLocked(cmdLine)
+		}
+	}
+}
+
+// execQueuedUnwatch executes UNWATCH queued in a transaction, watching keys are forgotten by EXEC already
+func execQueuedUnwatch(db *DB, args [][]byte) client.Reply {
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDUnwatch, execQueuedUnwatch, router.NoPrepare, nil, 1, router.FlagReadOnly)
+}
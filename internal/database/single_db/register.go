@@ -0,0 +1,40 @@
+package single_db
+
+import (
+	"strings"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+// execFunc is the executor signature of commands implemented on *DB
+type execFunc func(db *DB, args [][]byte) client.Reply
+
+// undoFunc is the rollback signature of commands implemented on *DB
+type undoFunc func(db *DB, args [][]byte) []router.CmdLine
+
+// registerCommand adapts executor and rollback bound to *DB and registers them into router
+func registerCommand(name string, executor execFunc, prepare router.PreFunc, rollback undoFunc, arity int, flags int) {
+	var undo router.UndoFunc
+	if rollback != nil {
+		undo = func(db IDB.DBInstance, args [][]byte) []router.CmdLine {
+			return rollback(db.(*DB), args)
+		}
+	}
+	exec := func(db IDB.DBInstance, args [][]byte) client.Reply {
+		return executor(db.(*DB), args)
+	}
+	router.RegisterCommand(name, exec, prepare, undo, arity, flags)
+}
+
+// keyResolver returns all keys of a command which also accesses keys named by values, like SORT with BY pattern.
+// It is called with keys reported by prepare locked, keys reported by prepare must be included in its result.
+type keyResolver func(db *DB, args [][]byte) (write []string, read []string)
+
+var keyResolvers = make(map[string]keyResolver)
+
+// registerKeyResolver registers the resolver of keys accessed by command name besides keys reported by prepare
+func registerKeyResolver(name string, resolver keyResolver) {
+	keyResolvers[strings.ToUpper(name)] = resolver
+}
@@ -0,0 +1,208 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/skiplist"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/wildcard"
+)
+
+/* ---- SCAN Commands ----
+ * SCAN iterates shards of the keyspace with a reverse binary cursor, see dict.ConcurrentDict.Scan.
+ * SSCAN, HSCAN and ZSCAN iterate buckets of dict.SimpleDict the same way, while collections in
+ * compact encodings are replied in one call with cursor 0 like redis.
+ */
+
+const scanDefaultCount = 10
+
+type scanOptions struct {
+	// pattern is nil if MATCH is absent
+	pattern  *wildcard.Pattern
+	count    int
+	typeName string
+	noValues bool
+}
+
+func (opts *scanOptions) match(s string) bool {
+	return opts.pattern == nil || opts.pattern.IsMatch(s)
+}
+
+func parseScanCursor(raw []byte) (uint64, protocol.ErrorReply) {
+	cursor, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// parseScanOptions parses MATCH and COUNT, TYPE is allowed only for SCAN and NOVALUES only for HSCAN
+func parseScanOptions(args [][]byte, cmdName string) (*scanOptions, protocol.ErrorReply) {
+	opts := &scanOptions{count: scanDefaultCount}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NOVALUES" && cmdName == consts.CMDHScan {
+			opts.noValues = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+		switch {
+		case option == "MATCH":
+			pattern, err := wildcard.CompilePattern(string(args[i+1]))
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR illegal wildcard")
+			}
+			opts.pattern = pattern
+		case option == "COUNT":
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.count = count
+		case option == "TYPE" && cmdName == consts.CMDScan:
+			opts.typeName = strings.ToLower(string(args[i+1]))
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+		i++
+	}
+	return opts, nil
+}
+
+func makeScanReply(cursor uint64, result [][]byte) client.Reply {
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		protocol.MakeMultiBulkReply(result),
+	})
+}
+
+// execScan iterates keys of db
+func execScan(db *DB, args [][]byte) client.Reply {
+	cursor, errReply := parseScanCursor(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[1:], consts.CMDScan)
+	if errReply != nil {
+		return errReply
+	}
+	var keys []string
+	cursor = db.data.Scan(cursor, opts.count, func(key string, val interface{}) bool {
+		if opts.match(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		// SCAN doesn't lock keys, so expired keys are skipped but left to their expire tasks
+		raw, exists := db.data.Get(key)
+		if !exists || db.hasExpired(key) {
+			continue
+		}
+		if opts.typeName != "" && strings.ToLower(typeOf(raw.(*IDB.DataEntity))) != opts.typeName {
+			continue
+		}
+		result = append(result, []byte(key))
+	}
+	return makeScanReply(cursor, result)
+}
+
+// execSScan iterates members of set
+func execSScan(db *DB, args [][]byte) client.Reply {
+	cursor, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], consts.CMDSScan)
+	if errReply != nil {
+		return errReply
+	}
+	set, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if set == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = set.Scan(cursor, opts.count, func(member string) {
+		if opts.match(member) {
+			result = append(result, []byte(member))
+		}
+	})
+	return makeScanReply(cursor, result)
+}
+
+// execHScan iterates fields and values of hash
+func execHScan(db *DB, args [][]byte) client.Reply {
+	cursor, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], consts.CMDHScan)
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if hash == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = hash.Scan(cursor, opts.count, func(field string, val interface{}) bool {
+		if opts.match(field) {
+			result = append(result, []byte(field))
+			if !opts.noValues {
+				result = append(result, val.([]byte))
+			}
+		}
+		return true
+	})
+	return makeScanReply(cursor, result)
+}
+
+// execZScan iterates members and scores of sorted set
+func execZScan(db *DB, args [][]byte) client.Reply {
+	cursor, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], consts.CMDZScan)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if sortedSet == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = sortedSet.Scan(cursor, opts.count, func(element *skiplist.Element) {
+		if opts.match(element.Member) {
+			result = append(result, []byte(element.Member), []byte(formatScore(element.Score)))
+		}
+	})
+	return makeScanReply(cursor, result)
+}
+
+func init() {
+	registerCommand(consts.CMDScan, execScan, router.NoPrepare, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDSScan, execSScan, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDHScan, execHScan, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZScan, execZScan, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+}
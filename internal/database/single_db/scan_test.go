@@ -0,0 +1,124 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+// scanAll iterates by the scan command line with cursor placeholder {} until cursor 0,
+// and returns the visited elements and the number of calls
+func scanAll(t *testing.T, db *DB, args ...string) (map[string]int, int) {
+	t.Helper()
+	seen := make(map[string]int)
+	calls := 0
+	cursor := "0"
+	for {
+		cmdLine := make([]string, len(args))
+		for i, arg := range args {
+			if arg == "{}" {
+				arg = cursor
+			}
+			cmdLine[i] = arg
+		}
+		r, ok := db.ExecNormalCommand(utils.ToCmdLine(cmdLine...)).(*protocol.MultiRawReply)
+		if !ok {
+			t.Fatalf("%v: expect multi reply", cmdLine)
+		}
+		cursor = string(r.Replies[0].(*protocol.BulkReply).Arg)
+		for _, element := range r.Replies[1].(*protocol.MultiBulkReply).Args {
+			seen[string(element)]++
+		}
+		calls++
+		if cursor == "0" {
+			return seen, calls
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := MakeDB(0)
+	for i := 0; i < 500; i++ {
+		run(db, "SET key"+strconv.Itoa(i)+" v")
+	}
+	run(db, "RPUSH list a")
+	run(db, "SET expired v PX 1")
+	time.Sleep(5 * time.Millisecond)
+	seen, calls := scanAll(t, db, "SCAN", "{}", "COUNT", "20")
+	if len(seen) != 501 || seen["expired"] > 0 || calls < 20 {
+		t.Errorf("wrong scan result %d keys in %d calls", len(seen), calls)
+	}
+	check(t, db, "SCAN 0 TYPE list COUNT 100000", "*2 $1 0 *1 $4 list")
+	seen, _ = scanAll(t, db, "SCAN", "{}", "MATCH", "key1?")
+	if len(seen) != 10 || seen["key10"] != 1 || seen["key19"] != 1 {
+		t.Errorf("wrong matched keys %v", seen)
+	}
+	check(t, db, "SCAN x", "-ERR invalid cursor")
+	check(t, db, "SCAN 0 COUNT 0", "-Err syntax error")
+	check(t, db, "SCAN 0 NOVALUES", "-Err syntax error")
+}
+
+func TestScanCollections(t *testing.T) {
+	db := MakeDB(0)
+	run(db, "SADD s a b c")
+	seen, calls := scanAll(t, db, "SSCAN", "s", "{}", "MATCH", "[ab]")
+	if len(seen) != 2 || seen["a"] != 1 || seen["b"] != 1 || calls != 1 {
+		t.Errorf("wrong matched members %v", seen)
+	}
+	run(db, "HSET h f1 v1 f2 v2")
+	check(t, db, "HSCAN h 0 MATCH f1", "*2 $1 0 *2 $2 f1 $2 v1")
+	check(t, db, "HSCAN h 0 MATCH f1 NOVALUES", "*2 $1 0 *1 $2 f1")
+	run(db, "ZADD z 1 a 2.5 b")
+	check(t, db, "ZSCAN z 0", "*2 $1 0 *4 $1 a $1 1 $1 b $3 2.5")
+	check(t, db, "ZSCAN nokey 0", "*2 $1 0 *0")
+	check(t, db, "ZSCAN h 0", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestScanLargeCollections(t *testing.T) {
+	db := MakeDB(0)
+	for i := 0; i < 200; i++ {
+		run(db, "HSET h f"+strconv.Itoa(i)+" v")
+		run(db, "SADD s m"+strconv.Itoa(i))
+		run(db, "ZADD z "+strconv.Itoa(i)+" m"+strconv.Itoa(i))
+	}
+	check(t, db, "OBJECT ENCODING h", "$9 hashtable")
+	r := db.ExecNormalCommand(utils.ToCmdLine("HSCAN", "h", "0", "COUNT", "5")).(*protocol.MultiRawReply)
+	if cursor := string(r.Replies[0].(*protocol.BulkReply).Arg); cursor == "0" {
+		t.Error("expect a nonzero cursor")
+	}
+	if n := len(r.Replies[1].(*protocol.MultiBulkReply).Args); n == 0 || n >= 400 {
+		t.Errorf("expect a part of fields, got %d elements", n)
+	}
+
+	for _, cmd := range []string{"HSCAN h {} COUNT 5 NOVALUES", "SSCAN s {} COUNT 5", "ZSCAN z {} COUNT 5 MATCH m1*"} {
+		args := strings.Fields(cmd)
+		seen, calls := scanAll(t, db, args...)
+		if calls < 2 {
+			t.Errorf("%s: expect more than one call, got %d", cmd, calls)
+		}
+		expect := 200
+		if args[0] == "ZSCAN" {
+			// members m1, m10-m19 and m100-m199 with their scores
+			expect = 2 * 111
+		}
+		if len(seen) != expect {
+			t.Errorf("%s: expect %d elements, got %d", cmd, expect, len(seen))
+		}
+	}
+}
+
+func TestScanSkipExpired(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET a 1", "+OK")
+	db.ttlMap.Put("a", time.Now().Add(-time.Second))
+	check(t, db, "SCAN 0", "*2 $1 0 *0")
+	check(t, db, "SCAN 0 TYPE string", "*2 $1 0 *0")
+	// SCAN doesn't lock keys, so the expired key is left to GET
+	check(t, db, "DBSIZE", ":1")
+	check(t, db, "GET a", "$-1")
+	check(t, db, "DBSIZE", ":0")
+}
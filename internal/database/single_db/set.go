@@ -0,0 +1,519 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	HashSet "github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func (db *DB) getAsSet(key string) (*HashSet.Set, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*HashSet.Set)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return set, nil
+}
+
+func (db *DB) getOrInitSet(key string) (set *HashSet.Set, inited bool, errReply protocol.ErrorReply) {
+	set, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if set == nil {
+		set = makeSet()
+		db.PutEntity(key, &IDB.DataEntity{
+			Data: set,
+		})
+		inited = true
+	}
+	return set, inited, nil
+}
+
+// getSets returns sets of given keys, the set of an absent key is nil
+func (db *DB) getSets(keys []string) ([]*HashSet.Set, protocol.ErrorReply) {
+	sets := make([]*HashSet.Set, len(keys))
+	for i, key := range keys {
+		set, errReply := db.getAsSet(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// rollbackSetMembers returns undo logs restoring only the given members of set
+func rollbackSetMembers(db *DB, key string, members ...string) []router.CmdLine {
+	var undoCmdLines []router.CmdLine
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if set == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine(consts.CMDDel, key),
+		)
+		return undoCmdLines
+	}
+	for _, member := range members {
+		if set.Has(member) {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDSAdd, key, member),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDSRem, key, member),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// undoSetChange restores the members given after key
+func undoSetChange(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	members := make([]string, 0, len(args)-1)
+	for _, member := range args[1:] {
+		members = append(members, string(member))
+	}
+	return rollbackSetMembers(db, key, members...)
+}
+
+func setToReply(set *HashSet.Set) client.Reply {
+	if set == nil || set.Len() == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	members := make([][]byte, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		members = append(members, []byte(member))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(members)
+}
+
+// execSAdd adds members into set, returns the number of new members
+func execSAdd(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, _, errReply := db.getOrInitSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	var added int64
+	for _, member := range args[1:] {
+		added += int64(set.Add(string(member)))
+	}
+	return protocol.MakeIntReply(added)
+}
+
+// execSRem removes members from set, the key is removed with the last member
+func execSRem(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return protocol.MakeIntReply(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		removed += int64(set.Remove(string(member)))
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+// execSIsMember checks whether the member is in set
+func execSIsMember(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set != nil && set.Has(string(args[1])) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execSMIsMember checks whether each member is in set
+func execSMIsMember(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]client.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if set != nil && set.Has(string(member)) {
+			result[i] = protocol.MakeIntReply(1)
+		} else {
+			result[i] = protocol.MakeIntReply(0)
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// execSMembers returns all members of set
+func execSMembers(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(set)
+}
+
+// execSCard returns the number of members in set
+func execSCard(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(set.Len()))
+}
+
+// execSPop removes and returns random members of set
+func execSPop(db *DB, args [][]byte) client.Reply {
+	if len(args) > 2 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(-1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if count < 0 {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	n := count
+	if count < 0 {
+		n = 1
+	}
+	members := set.RandomDistinctMembers(int(n))
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		set.Remove(member)
+		result[i] = []byte(member)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if count < 0 {
+		return protocol.MakeBulkReply(result[0])
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execSRandMember returns random members of set.
+// A positive count returns distinct members, while a negative count allows duplicated members
+func execSRandMember(db *DB, args [][]byte) client.Reply {
+	if len(args) > 2 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if set == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		members := set.RandomMembers(1)
+		return protocol.MakeBulkReply([]byte(members[0]))
+	}
+
+	count, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil || count == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	var members []string
+	if count > 0 {
+		members = set.RandomDistinctMembers(int(count))
+	} else {
+		members = set.RandomMembers(int(-count))
+	}
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execSMove moves member from source set to destination set
+func execSMove(db *DB, args [][]byte) client.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+
+	srcSet, errReply := db.getAsSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	// check type of dest before modifying src
+	if _, errReply = db.getAsSet(dest); errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return protocol.MakeIntReply(0)
+	}
+	if src == dest {
+		return protocol.MakeIntReply(1)
+	}
+
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	destSet, _, _ := db.getOrInitSet(dest)
+	destSet.Add(member)
+	return protocol.MakeIntReply(1)
+}
+
+func prepareSMove(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoSMove(db *DB, args [][]byte) []router.CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+	return append(rollbackSetMembers(db, src, member), rollbackSetMembers(db, dest, member)...)
+}
+
+/* ---- Set Operations ---- */
+
+// setOperation calculates a new set from sets, nil means the set of an absent key
+type setOperation func(sets []*HashSet.Set) *HashSet.Set
+
+func setInter(sets []*HashSet.Set) *HashSet.Set {
+	var result *HashSet.Set
+	for _, set := range sets {
+		if set == nil {
+			return makeSet()
+		}
+		if result == nil {
+			result = set
+			continue
+		}
+		result = result.Intersect(set)
+	}
+	return result
+}
+
+func setUnion(sets []*HashSet.Set) *HashSet.Set {
+	result := makeSet()
+	for _, set := range sets {
+		if set != nil {
+			result = result.Union(set)
+		}
+	}
+	return result
+}
+
+func setDiff(sets []*HashSet.Set) *HashSet.Set {
+	if sets[0] == nil {
+		return makeSet()
+	}
+	result := sets[0]
+	for _, set := range sets[1:] {
+		if set != nil {
+			result = result.Diff(set)
+		}
+	}
+	return result
+}
+
+func (db *DB) calculateSets(args [][]byte, operation setOperation) (*HashSet.Set, protocol.ErrorReply) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	sets, errReply := db.getSets(keys)
+	if errReply != nil {
+		return nil, errReply
+	}
+	return operation(sets), nil
+}
+
+func (db *DB) execSetOperation(args [][]byte, operation setOperation) client.Reply {
+	result, errReply := db.calculateSets(args, operation)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(result)
+}
+
+// execSetOperationStore stores the result of set operation into destination, an empty result removes destination
+func (db *DB) execSetOperationStore(args [][]byte, operation setOperation) client.Reply {
+	dest := string(args[0])
+	result, errReply := db.calculateSets(args[1:], operation)
+	if errReply != nil {
+		return errReply
+	}
+	if result.Len() == 0 {
+		db.Remove(dest)
+		return protocol.MakeIntReply(0)
+	}
+	// the result may share the set with a source key
+	result = result.Union(makeSet())
+	db.PutEntity(dest, &IDB.DataEntity{
+		Data: result,
+	})
+	db.Persist(dest) // override ttl
+	return protocol.MakeIntReply(int64(result.Len()))
+}
+
+// execSInter returns the intersection of sets
+func execSInter(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperation(args, setInter)
+}
+
+// execSInterStore stores the intersection of sets into destination
+func execSInterStore(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperationStore(args, setInter)
+}
+
+// execSUnion returns the union of sets
+func execSUnion(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperation(args, setUnion)
+}
+
+// execSUnionStore stores the union of sets into destination
+func execSUnionStore(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperationStore(args, setUnion)
+}
+
+// execSDiff returns members of the first set which are not in the others
+func execSDiff(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperation(args, setDiff)
+}
+
+// execSDiffStore stores the difference of sets into destination
+func execSDiffStore(db *DB, args [][]byte) client.Reply {
+	return db.execSetOperationStore(args, setDiff)
+}
+
+// parseInterCard parses "numkeys key [key ...] [LIMIT limit]" of SINTERCARD
+func parseInterCard(args [][]byte) (keys []string, limit int64, errReply protocol.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return nil, 0, protocol.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if int64(len(args)) < numKeys+1 {
+		return nil, 0, protocol.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	for _, arg := range args[1 : numKeys+1] {
+		keys = append(keys, string(arg))
+	}
+	options := args[numKeys+1:]
+	if len(options) == 0 {
+		return keys, 0, nil
+	}
+	if len(options) != 2 || strings.ToUpper(string(options[0])) != "LIMIT" {
+		return nil, 0, protocol.MakeSyntaxErrReply()
+	}
+	limit, err = strconv.ParseInt(string(options[1]), 10, 64)
+	if err != nil {
+		return nil, 0, protocol.MakeErrReply("ERR LIMIT can't be negative")
+	}
+	if limit < 0 {
+		return nil, 0, protocol.MakeErrReply("ERR LIMIT can't be negative")
+	}
+	return keys, limit, nil
+}
+
+// execSInterCard returns the cardinality of the intersection, it stops counting once reached limit
+func execSInterCard(db *DB, args [][]byte) client.Reply {
+	keys, limit, errReply := parseInterCard(args)
+	if errReply != nil {
+		return errReply
+	}
+	sets, errReply := db.getSets(keys)
+	if errReply != nil {
+		return errReply
+	}
+	smallest := sets[0]
+	for _, set := range sets {
+		if set == nil {
+			return protocol.MakeIntReply(0)
+		}
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+	var count int64
+	smallest.ForEach(func(member string) bool {
+		for _, set := range sets {
+			if !set.Has(member) {
+				return true
+			}
+		}
+		count++
+		return limit == 0 || count < limit
+	})
+	return protocol.MakeIntReply(count)
+}
+
+func prepareSInterCard(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseInterCard(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, keys
+}
+
+func init() {
+	registerCommand(consts.CMDSAdd, execSAdd, router.WriteFirstKey, undoSetChange, -3, router.FlagWrite)
+	registerCommand(consts.CMDSRem, execSRem, router.WriteFirstKey, undoSetChange, -3, router.FlagWrite)
+	registerCommand(consts.CMDSIsMember, execSIsMember, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDSMIsMember, execSMIsMember, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDSMembers, execSMembers, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDSCard, execSCard, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDSPop, execSPop, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDSRandMember, execSRandMember, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDSMove, execSMove, prepareSMove, undoSMove, 4, router.FlagWrite)
+	registerCommand(consts.CMDSInter, execSInter, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDSInterStore, execSInterStore, router.WriteFirstReadOthers, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDSInterCard, execSInterCard, prepareSInterCard, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDSUnion, execSUnion, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDSUnionStore, execSUnionStore, router.WriteFirstReadOthers, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDSDiff, execSDiff, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDSDiffStore, execSDiffStore, router.WriteFirstReadOthers, rollbackFirstKey, -3, router.FlagWrite)
+}
@@ -0,0 +1,80 @@
+package single_db
+
+import "testing"
+
+func TestSet(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SADD s a b c", ":3")
+	check(t, db, "SADD s a d", ":1")
+	check(t, db, "SISMEMBER s a", ":1")
+	check(t, db, "SISMEMBER s z", ":0")
+	check(t, db, "SMISMEMBER s a z", "*2 :1 :0")
+	check(t, db, "SCARD s", ":4")
+	check(t, db, "TYPE s", "+set")
+	if got := runSorted(t, db, "SMEMBERS s"); got != "a b c d" {
+		t.Error(got)
+	}
+	check(t, db, "SREM s a z", ":1")
+	check(t, db, "SREM nx a", ":0")
+	check(t, db, "SET str x", "+OK")
+	check(t, db, "SADD str x", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestSetAlgebra(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SADD s a b c d", ":4")
+	check(t, db, "SADD t c d e", ":3")
+	check(t, db, "SINTERCARD 2 s t", ":2")
+	check(t, db, "SINTERCARD 2 s t LIMIT 1", ":1")
+	check(t, db, "SINTERCARD 3 s t nx", ":0")
+	check(t, db, "SINTERCARD 0 s", "-ERR numkeys should be greater than 0")
+	if got := runSorted(t, db, "SINTER s t"); got != "c d" {
+		t.Error(got)
+	}
+	if got := runSorted(t, db, "SUNION s t nx"); got != "a b c d e" {
+		t.Error(got)
+	}
+	if got := runSorted(t, db, "SDIFF s t nx"); got != "a b" {
+		t.Error(got)
+	}
+	check(t, db, "SINTERSTORE d s t", ":2")
+	check(t, db, "SUNIONSTORE d s t nx", ":5")
+	check(t, db, "SDIFFSTORE d s t", ":2")
+	if got := runSorted(t, db, "SMEMBERS d"); got != "a b" {
+		t.Error(got)
+	}
+	check(t, db, "SINTERSTORE d s nx", ":0")
+	check(t, db, "EXISTS d", ":0")
+	check(t, db, "SET str x", "+OK")
+	check(t, db, "SUNION s str", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestSMove(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SADD s a b", ":2")
+	check(t, db, "SET str x", "+OK")
+	check(t, db, "SMOVE s t a", ":1")
+	check(t, db, "SMOVE s t a", ":0")
+	check(t, db, "SISMEMBER t a", ":1")
+	check(t, db, "SMOVE s str b", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	check(t, db, "SISMEMBER s b", ":1")
+}
+
+func TestSetRandom(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SADD s a b c", ":3")
+	if got := runSorted(t, db, "SRANDMEMBER s 7"); got != "a b c" {
+		t.Error(got)
+	}
+	if got := run(db, "SRANDMEMBER s -7"); got[:2] != "*7" {
+		t.Error(got)
+	}
+	check(t, db, "SPOP nx 10", "*0")
+	check(t, db, "SPOP nx", "$-1")
+	if got := runSorted(t, db, "SPOP s 2"); len(got) != 3 {
+		t.Error(got)
+	}
+	check(t, db, "SCARD s", ":1")
+	run(db, "SPOP s")
+	check(t, db, "EXISTS s", ":0")
+}
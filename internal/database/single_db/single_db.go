@@ -1,15 +1,20 @@
 package single_db
 
 import (
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pluming/aurora/datastruct/dict"
 	"github.com/pluming/aurora/datastruct/lock"
 	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
 	"github.com/pluming/aurora/internal/database/consts"
 	"github.com/pluming/aurora/internal/database/protocol"
 	"github.com/pluming/aurora/internal/database/router"
 	"github.com/pluming/aurora/internal/database/transaction"
+	"github.com/pluming/aurora/lib/timewheel"
 )
 
 const (
@@ -22,15 +27,19 @@ const (
 type DB struct {
 	index int
 	// key -> DataEntity
-	data dict.Dict
+	data *dict.ConcurrentDict
 	// key -> expireTime (time.Time)
-	ttlMap dict.Dict
+	ttlMap *dict.ConcurrentDict
 	// key -> version(uint32)
 	versionMap dict.Dict
+	// the number of flushes and swaps, added to versions of all keys, so that they modify every key at once
+	epoch uint32
 
 	// dict.Dict will ensure concurrent-safety of its method
 	// use this mutex for complicated command only, eg. rpush, incr ...
 	locker *lock.Locks
+	// clients blocked by commands like BLPOP, the *blockingRegistry is exchanged by Swap
+	blocking atomic.Value
 	//addAof func(CmdLine)
 }
 
@@ -48,6 +57,7 @@ func MakeDB(index int) *DB {
 		index:      index,
 		//addAof:     func(line CmdLine) {},
 	}
+	db.blocking.Store(makeBlockingRegistry())
 	return db
 }
 
@@ -56,17 +66,36 @@ func (db *DB) Exec(client client.Connection, cmdLine [][]byte) client.Reply {
 
 	switch cmdName {
 	case consts.CMDMulti:
-		return nil
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return transaction.StartMulti(client)
 	case consts.CMDDiscard:
-		return nil
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return transaction.DiscardMulti(client)
 	case consts.CMDExec:
-		return nil
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return db.execMulti(client)
 	case consts.CMDWatch:
-		return nil
+		if !router.ValidateArity(-2, cmdLine) {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return transaction.Watch(db, client, cmdLine[1:])
+	case consts.CMDUnwatch:
+		// UNWATCH in MULTI is queued, see execQueuedUnwatch
+		if len(cmdLine) == 1 && !client.InMultiState() {
+			return transaction.Unwatch(client)
+		}
 	}
 	if client != nil && client.InMultiState() {
-		transaction.EnqueueCmd(client, cmdLine)
-		return protocol.MakeQueuedReply()
+		return transaction.EnqueueCmd(client, cmdLine)
+	}
+	if parser, ok := blockingCommands[cmdName]; ok && client != nil {
+		return db.execBlocking(client, cmdLine, parser)
 	}
 	//normal command
 	return db.ExecNormalCommand(cmdLine)
@@ -84,9 +113,180 @@ func (db *DB) ExecNormalCommand(cmdLine [][]byte) client.Reply {
 
 	prepare := cmd.Prepare
 	write, read := prepare(cmdLine[1:])
-	db.addVersion(write...)
+	var reply client.Reply
+	if resolve, ok := keyResolvers[cmdName]; ok {
+		write, reply = db.execResolved(cmd.Executor, resolve, cmdLine[1:], write, read)
+	} else {
+		db.addVersion(write...)
+		reply = db.execWithLocks(cmd.Executor, cmdLine[1:], write, read)
+	}
+	// written keys may be waited by blocked clients
+	db.serveBlocked(write)
+	return reply
+}
+
+func (db *DB) execWithLocks(fun router.ExecFunc, args [][]byte, write, read []string) client.Reply {
 	db.RWLocks(write, read)
 	defer db.RWUnLocks(write, read)
-	fun := cmd.Executor
-	return fun(db, cmdLine[1:])
+	return fun(db, args)
+}
+
+// resolveKeys returns all keys accessed by command, write and read are keys reported by prepare
+func (db *DB) resolveKeys(resolve keyResolver, args [][]byte, write, read []string) ([]string, []string) {
+	db.RWLocks(write, read)
+	defer db.RWUnLocks(write, read)
+	return resolve(db, args)
+}
+
+// execResolved executes a command accessing keys named by values, returns its write keys and reply.
+// Values may be changed between resolving keys and locking them, so keys are resolved again after locking,
+// the command is executed only if they are all locked, otherwise it retries with the newly resolved keys.
+func (db *DB) execResolved(fun router.ExecFunc, resolve keyResolver, args [][]byte, write, read []string) ([]string, client.Reply) {
+	write, read = db.resolveKeys(resolve, args, write, read)
+	for {
+		db.RWLocks(write, read)
+		resolvedWrite, resolvedRead := resolve(db, args)
+		if keysCovered(resolvedWrite, write) && keysCovered(resolvedRead, write, read) {
+			db.addVersion(resolvedWrite...)
+			reply := fun(db, args)
+			db.RWUnLocks(write, read)
+			return resolvedWrite, reply
+		}
+		db.RWUnLocks(write, read)
+		write, read = resolvedWrite, resolvedRead
+	}
+}
+
+// keysCovered returns whether all keys are in one of the locked key lists
+func keysCovered(keys []string, locked ...[]string) bool {
+	lockedSet := make(map[string]struct{})
+	for _, list := range locked {
+		for _, key := range list {
+			lockedSet[key] = struct{}{}
+		}
+	}
+	for _, key := range keys {
+		if _, ok := lockedSet[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/* ---- Data Access ----- */
+
+// GetEntity returns DataEntity bind to given key
+func (db *DB) GetEntity(key string) (*IDB.DataEntity, bool) {
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if db.IsExpired(key) {
+		return nil, false
+	}
+	entity, _ := raw.(*IDB.DataEntity)
+	return entity, true
+}
+
+// PutEntity a DataEntity into DB
+func (db *DB) PutEntity(key string, entity *IDB.DataEntity) int {
+	return db.data.Put(key, entity)
+}
+
+// PutIfExists edit an existing DataEntity
+func (db *DB) PutIfExists(key string, entity *IDB.DataEntity) int {
+	db.IsExpired(key) // an expired key is absent
+	return db.data.PutIfExists(key, entity)
+}
+
+// PutIfAbsent insert an DataEntity only if the key not exists
+func (db *DB) PutIfAbsent(key string, entity *IDB.DataEntity) int {
+	db.IsExpired(key) // an expired key is absent
+	return db.data.PutIfAbsent(key, entity)
+}
+
+// Remove the given key from db
+func (db *DB) Remove(key string) {
+	db.data.Remove(key)
+	if db.ttlMap.Remove(key) > 0 {
+		timewheel.Cancel(db.genExpireTask(key))
+	}
+}
+
+// Removes the given keys from db, returns the number of deleted keys
+func (db *DB) Removes(keys ...string) (deleted int) {
+	deleted = 0
+	for _, key := range keys {
+		_, exists := db.GetEntity(key)
+		if exists {
+			db.Remove(key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+/* ---- TTL Functions ---- */
+
+// genExpireTask returns the time wheel task key of key, it is unique among databases
+func (db *DB) genExpireTask(key string) string {
+	return "expire:" + strconv.Itoa(db.index) + ":" + key
+}
+
+// Expire sets the expire time of key, the key is removed actively by time wheel when it expires
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+	db.scheduleExpire(key, expireTime)
+}
+
+// scheduleExpire registers a time wheel job which removes key after it expires
+func (db *DB) scheduleExpire(key string, expireTime time.Time) {
+	timewheel.At(expireTime, db.genExpireTask(key), func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		// check-lock-check, ttl may be updated during waiting lock
+		expireTime, ok := db.getExpireTime(key)
+		if !ok {
+			return
+		}
+		if time.Now().After(expireTime) {
+			db.Remove(key)
+		} else {
+			// time wheel ticks by second, the job may run a little earlier
+			db.scheduleExpire(key, expireTime)
+		}
+	})
+}
+
+// Persist cancels the expire time of key
+func (db *DB) Persist(key string) {
+	if db.ttlMap.Remove(key) > 0 {
+		timewheel.Cancel(db.genExpireTask(key))
+	}
+}
+
+// IsExpired check whether a key is expired, the expired key is removed lazily
+func (db *DB) IsExpired(key string) bool {
+	expired := db.hasExpired(key)
+	if expired {
+		db.Remove(key)
+	}
+	return expired
+}
+
+// hasExpired check whether a key is expired without removing it,
+// commands not locking the key use it and leave the key to its expire task
+func (db *DB) hasExpired(key string) bool {
+	expireTime, ok := db.getExpireTime(key)
+	return ok && time.Now().After(expireTime)
+}
+
+// getExpireTime returns the expire time of key, ok is false if the key has no ttl
+func (db *DB) getExpireTime(key string) (expireTime time.Time, ok bool) {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
 }
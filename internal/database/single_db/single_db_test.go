@@ -0,0 +1,68 @@
+package single_db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+// run executes a command line separated by spaces, and returns the reply with CRLF replaced by spaces
+func run(db *DB, line string) string {
+	r := db.ExecNormalCommand(utils.ToCmdLine(strings.Fields(line)...))
+	return formatReply(r.ToBytes())
+}
+
+// runConn executes a command line from conn, so that it may block or be queued
+func runConn(db *DB, conn *tcp.FakeConn, line string) string {
+	r := db.Exec(conn, utils.ToCmdLine(strings.Fields(line)...))
+	return formatReply(r.ToBytes())
+}
+
+func formatReply(raw []byte) string {
+	return strings.TrimSpace(strings.ReplaceAll(string(raw), "\r\n", " "))
+}
+
+// runSorted executes a command line replying a multi bulk in random order, and returns the sorted elements
+func runSorted(t *testing.T, db *DB, line string) string {
+	t.Helper()
+	r, ok := db.ExecNormalCommand(utils.ToCmdLine(strings.Fields(line)...)).(*protocol.MultiBulkReply)
+	if !ok {
+		t.Fatalf("%s: expect multi bulk reply", line)
+	}
+	elements := make([]string, len(r.Args))
+	for i, arg := range r.Args {
+		elements[i] = string(arg)
+	}
+	sort.Strings(elements)
+	return strings.Join(elements, " ")
+}
+
+func check(t *testing.T, db *DB, line, expect string) {
+	t.Helper()
+	if got := run(db, line); got != expect {
+		t.Errorf("%s: expect %q, got %q", line, expect, got)
+	}
+}
+
+func checkConn(t *testing.T, db *DB, conn *tcp.FakeConn, line, expect string) {
+	t.Helper()
+	if got := runConn(db, conn, line); got != expect {
+		t.Errorf("%s: expect %q, got %q", line, expect, got)
+	}
+}
+
+// replayUndo replaces key by its undo logs, the value should be restored as it is
+func replayUndo(t *testing.T, db *DB, key string) {
+	t.Helper()
+	undo := rollbackGivenKeys(db, key)
+	run(db, "DEL "+key)
+	for _, line := range undo {
+		if r := db.ExecNormalCommand(line); protocol.IsErrorReply(r) {
+			t.Error(string(r.ToBytes()))
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package single_db
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/list"
+	"github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/datastruct/skiplist"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- SORT ----
+ * SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]
+ * The first '*' of a pattern is replaced by the element to name a key, "key->field" names a field of hash.
+ * Keys named by patterns are resolved before execution, see registerKeyResolver.
+ */
+
+type sortOptions struct {
+	// by is the pattern of sorting weights, nil means sorting by elements
+	by     []byte
+	noSort bool
+	gets   [][]byte
+	offset int64
+	// count < 0 means all elements after offset
+	count int64
+	desc  bool
+	alpha bool
+	store string
+}
+
+// parseSortOptions parses options after the key, STORE is not allowed if readOnly
+func parseSortOptions(args [][]byte, readOnly bool) (*sortOptions, protocol.ErrorReply) {
+	opts := &sortOptions{count: -1}
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "ASC":
+			opts.desc = false
+		case "DESC":
+			opts.desc = true
+		case "ALPHA":
+			opts.alpha = true
+		case "LIMIT":
+			if remain < 2 {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			opts.offset, opts.count = offset, count
+			i += 2
+		case "BY":
+			if remain < 1 {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.by = args[i+1]
+			// sorting by a constant key makes no sense
+			opts.noSort = bytes.IndexByte(opts.by, '*') < 0
+			i++
+		case "GET":
+			if remain < 1 {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.gets = append(opts.gets, args[i+1])
+			i++
+		case "STORE":
+			if remain < 1 || readOnly {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.store = string(args[i+1])
+			i++
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// prepareSort locks the sorted key for reading and the destination of STORE for writing
+func prepareSort(args [][]byte) ([]string, []string) {
+	read := []string{string(args[0])}
+	opts, errReply := parseSortOptions(args[1:], false)
+	if errReply != nil || opts.store == "" {
+		return nil, read
+	}
+	return []string{opts.store}, read
+}
+
+// parseSortPattern returns the key and hash field named by pattern for element, ok is false if pattern has no '*'
+func parseSortPattern(pattern, element []byte) (key string, field string, hasField bool, ok bool) {
+	star := bytes.IndexByte(pattern, '*')
+	if star < 0 {
+		return "", "", false, false
+	}
+	keyEnd := len(pattern)
+	if arrow := bytes.Index(pattern[star+1:], []byte("->")); arrow >= 0 && star+1+arrow+2 < len(pattern) {
+		keyEnd = star + 1 + arrow
+		field, hasField = string(pattern[keyEnd+2:]), true
+	}
+	var buf bytes.Buffer
+	buf.Grow(keyEnd - 1 + len(element))
+	buf.Write(pattern[:star])
+	buf.Write(element)
+	buf.Write(pattern[star+1 : keyEnd])
+	return buf.String(), field, hasField, true
+}
+
+// lookupSortPattern returns the value named by pattern for element, "#" means the element itself
+func (db *DB) lookupSortPattern(pattern, element []byte) ([]byte, bool) {
+	if len(pattern) == 1 && pattern[0] == '#' {
+		return element, true
+	}
+	key, field, hasField, ok := parseSortPattern(pattern, element)
+	if !ok {
+		return nil, false
+	}
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false
+	}
+	if !hasField {
+		val, ok := entity.Data.([]byte)
+		return cloneString(val), ok
+	}
+	hash, ok := entity.Data.(dict.Dict)
+	if !ok {
+		return nil, false
+	}
+	val, exists := hash.Get(field)
+	if !exists {
+		return nil, false
+	}
+	return val.([]byte), true
+}
+
+// getSortElements returns elements of list, set or sorted set in their own order
+func (db *DB) getSortElements(key string) (elements [][]byte, isSet bool, errReply protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	switch val := entity.Data.(type) {
+	case list.List:
+		elements = make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			elements = append(elements, v.([]byte))
+			return true
+		})
+	case *set.Set:
+		elements = make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			elements = append(elements, []byte(member))
+			return true
+		})
+		isSet = true
+	case *zset.ZSet:
+		elements = make([][]byte, 0, val.Len())
+		if val.Len() > 0 {
+			val.ForEach(0, val.Len(), false, func(element *skiplist.Element) bool {
+				elements = append(elements, []byte(element.Member))
+				return true
+			})
+		}
+	default:
+		return nil, false, &protocol.WrongTypeErrReply{}
+	}
+	return elements, isSet, nil
+}
+
+// resolveSortKeys returns the destination, the sorted key and keys named by patterns
+func resolveSortKeys(db *DB, args [][]byte, readOnly bool) ([]string, []string) {
+	var write, read []string
+	if readOnly {
+		write, read = router.ReadFirstKey(args)
+	} else {
+		write, read = prepareSort(args)
+	}
+	opts, errReply := parseSortOptions(args[1:], readOnly)
+	if errReply != nil {
+		return write, read
+	}
+	patterns := opts.gets
+	if opts.by != nil && !opts.noSort {
+		patterns = append(patterns[:len(patterns):len(patterns)], opts.by)
+	}
+	if len(patterns) == 0 {
+		return write, read
+	}
+	elements, _, errReply := db.getSortElements(read[0])
+	if errReply != nil {
+		return write, read
+	}
+	seen := make(map[string]struct{})
+	for _, pattern := range patterns {
+		for _, element := range elements {
+			key, _, _, ok := parseSortPattern(pattern, element)
+			if !ok {
+				break
+			}
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				read = append(read, key)
+			}
+		}
+	}
+	return write, read
+}
+
+type sortItem struct {
+	element []byte
+	score   float64
+	// weight is compared if alpha, nil means the weight is missing
+	weight []byte
+}
+
+// sortItems sorts elements by options, elements are compared lexicographically if weights are equal
+func (db *DB) sortItems(elements [][]byte, opts *sortOptions) ([]*sortItem, protocol.ErrorReply) {
+	items := make([]*sortItem, len(elements))
+	for i, element := range elements {
+		item := &sortItem{element: element}
+		items[i] = item
+		if opts.noSort {
+			continue
+		}
+		weight := element
+		if opts.by != nil {
+			weight, _ = db.lookupSortPattern(opts.by, element)
+		}
+		if opts.alpha {
+			item.weight = weight
+			continue
+		}
+		if weight == nil {
+			// missing weights are regarded as 0
+			continue
+		}
+		score, err := strconv.ParseFloat(string(bytes.TrimSpace(weight)), 64)
+		if err != nil {
+			return nil, protocol.MakeErrReply("ERR One or more scores can't be converted into double")
+		}
+		item.score = score
+	}
+	if opts.noSort {
+		return items, nil
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		cmp := 0
+		if opts.alpha {
+			switch {
+			case a.weight == nil && b.weight != nil:
+				cmp = -1
+			case a.weight != nil && b.weight == nil:
+				cmp = 1
+			default:
+				cmp = bytes.Compare(a.weight, b.weight)
+			}
+		} else if a.score < b.score {
+			cmp = -1
+		} else if a.score > b.score {
+			cmp = 1
+		}
+		if cmp == 0 {
+			cmp = bytes.Compare(a.element, b.element)
+		}
+		if opts.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return items, nil
+}
+
+func execSortGeneric(db *DB, args [][]byte, readOnly bool) client.Reply {
+	opts, errReply := parseSortOptions(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	elements, isSet, errReply := db.getSortElements(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if opts.noSort {
+		if isSet && opts.store != "" {
+			// the order of set is random, sort it to store a deterministic result
+			opts.noSort, opts.by, opts.alpha = false, nil, true
+		} else if opts.desc {
+			for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+				elements[i], elements[j] = elements[j], elements[i]
+			}
+		}
+	}
+	items, errReply := db.sortItems(elements, opts)
+	if errReply != nil {
+		return errReply
+	}
+
+	start := opts.offset
+	if start < 0 {
+		start = 0
+	}
+	if start > int64(len(items)) {
+		start = int64(len(items))
+	}
+	end := int64(len(items))
+	if opts.count >= 0 && start+opts.count < end {
+		end = start + opts.count
+	}
+	items = items[start:end]
+
+	var result [][]byte
+	for _, item := range items {
+		if len(opts.gets) == 0 {
+			result = append(result, item.element)
+			continue
+		}
+		for _, pattern := range opts.gets {
+			val, _ := db.lookupSortPattern(pattern, item.element)
+			result = append(result, val)
+		}
+	}
+
+	if opts.store == "" {
+		return protocol.MakeMultiBulkReply(result)
+	}
+	if len(result) == 0 {
+		db.Remove(opts.store)
+		return protocol.MakeIntReply(0)
+	}
+	l := makeList()
+	for _, val := range result {
+		if val == nil {
+			val = []byte{}
+		}
+		l.Add(val)
+	}
+	db.PutEntity(opts.store, &IDB.DataEntity{Data: l})
+	db.Persist(opts.store) // override ttl
+	return protocol.MakeIntReply(int64(len(result)))
+}
+
+// execSort sorts elements of list, set or sorted set, and stores them if STORE is given
+func execSort(db *DB, args [][]byte) client.Reply {
+	return execSortGeneric(db, args, false)
+}
+
+// execSortRO is the read-only variant of SORT which does not accept STORE
+func execSortRO(db *DB, args [][]byte) client.Reply {
+	return execSortGeneric(db, args, true)
+}
+
+// undoSort restores the destination of STORE
+func undoSort(db *DB, args [][]byte) []router.CmdLine {
+	write, _ := prepareSort(args)
+	return rollbackGivenKeys(db, write...)
+}
+
+func init() {
+	registerCommand(consts.CMDSort, execSort, prepareSort, undoSort, -2, router.FlagWrite)
+	registerKeyResolver(consts.CMDSort, func(db *DB, args [][]byte) ([]string, []string) {
+		return resolveSortKeys(db, args, false)
+	})
+	registerCommand(consts.CMDSortRO, execSortRO, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerKeyResolver(consts.CMDSortRO, func(db *DB, args [][]byte) ([]string, []string) {
+		return resolveSortKeys(db, args, true)
+	})
+}
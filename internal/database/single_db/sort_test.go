@@ -0,0 +1,80 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func TestSort(t *testing.T) {
+	db := MakeDB(0)
+	run(db, "RPUSH l 3 1 2 10")
+	check(t, db, "SORT l", "*4 $1 1 $1 2 $1 3 $2 10")
+	check(t, db, "SORT l DESC LIMIT 1 2", "*2 $1 3 $1 2")
+	check(t, db, "SORT l ALPHA", "*4 $1 1 $2 10 $1 2 $1 3")
+	check(t, db, "SORT l LIMIT 10 1", "*0")
+	check(t, db, "SORT l LIMIT x 1", "-ERR value is not an integer or out of range")
+	run(db, "SET w_1 30")
+	run(db, "SET w_2 20")
+	run(db, "SET w_3 10")
+	check(t, db, "SORT l BY w_*", "*4 $2 10 $1 3 $1 2 $1 1")
+	check(t, db, "SORT l BY nosort", "*4 $1 3 $1 1 $1 2 $2 10")
+	run(db, "HSET h_1 name one")
+	run(db, "HSET h_2 name two")
+	check(t, db, "SORT l GET # GET h_*->name GET w_*", "*12 $1 1 $3 one $2 30 $1 2 $3 two $2 20 $1 3 $-1 $2 10 $2 10 $-1 $-1")
+	check(t, db, "SORT l BY h_*->name ALPHA GET #", "*4 $2 10 $1 3 $1 1 $1 2")
+	check(t, db, "SORT l STORE dst GET h_*->name", ":4")
+	check(t, db, "LRANGE dst 0 -1", "*4 $3 one $3 two $0  $0")
+	check(t, db, "SORT_RO l STORE dst", "-Err syntax error")
+	check(t, db, "SORT_RO l DESC", "*4 $2 10 $1 3 $1 2 $1 1")
+	run(db, "SADD s b a c")
+	check(t, db, "SORT s ALPHA DESC", "*3 $1 c $1 b $1 a")
+	check(t, db, "SORT s BY nosort STORE dst", ":3")
+	check(t, db, "LRANGE dst 0 -1", "*3 $1 a $1 b $1 c")
+	check(t, db, "SORT s", "-ERR One or more scores can't be converted into double")
+	run(db, "ZADD z 3 a 1 b 2 c")
+	check(t, db, "SORT z BY nosort DESC", "*3 $1 a $1 c $1 b")
+	check(t, db, "SORT nokey STORE dst", ":0")
+	check(t, db, "EXISTS dst", ":0")
+	run(db, "SET str x")
+	check(t, db, "SORT str", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestSortUndo(t *testing.T) {
+	db := MakeDB(0)
+	run(db, "RPUSH l 3 1 2")
+	run(db, "SET dst old")
+	undo := undoSort(db, utils.ToCmdLine("l", "STORE", "dst"))
+	check(t, db, "SORT l STORE dst", ":3")
+	for _, line := range undo {
+		db.ExecNormalCommand(line)
+	}
+	check(t, db, "GET dst", "$3 old")
+	// SORT without STORE writes nothing
+	if undo := undoSort(db, utils.ToCmdLine("l", "DESC")); len(undo) != 0 {
+		t.Errorf("expect no undo logs, got %d", len(undo))
+	}
+}
+
+func TestSortConcurrent(t *testing.T) {
+	db := MakeDB(0)
+	run(db, "RPUSH l 3 1 2")
+	// keys named by patterns are changed during sorting
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2000; i++ {
+			run(db, "SET w_"+strconv.Itoa(i%3+1)+" "+strconv.Itoa(i))
+			run(db, "HSET h_1 name n"+strconv.Itoa(i))
+			run(db, "RPUSH l "+strconv.Itoa(i))
+		}
+		close(done)
+	}()
+	for i := 0; i < 200; i++ {
+		if got := run(db, "SORT l BY w_* GET h_*->name LIMIT 0 5"); strings.HasPrefix(got, "-") {
+			t.Fatal(got)
+		}
+	}
+	<-done
+}
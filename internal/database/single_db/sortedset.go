@@ -0,0 +1,1353 @@
+package single_db
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	HashSet "github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/datastruct/skiplist"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func (db *DB) getAsSortedSet(key string) (*zset.ZSet, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	zs, ok := entity.Data.(*zset.ZSet)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return zs, nil
+}
+
+func (db *DB) getOrInitSortedSet(key string) (zs *zset.ZSet, inited bool, errReply protocol.ErrorReply) {
+	zs, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if zs == nil {
+		zs = makeZSet()
+		db.PutEntity(key, &IDB.DataEntity{
+			Data: zs,
+		})
+		inited = true
+	}
+	return zs, inited, nil
+}
+
+// rollbackZSetMembers returns undo logs restoring only the given members of sorted set
+func rollbackZSetMembers(db *DB, key string, members ...string) []router.CmdLine {
+	var undoCmdLines []router.CmdLine
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if zs == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine(consts.CMDDel, key),
+		)
+		return undoCmdLines
+	}
+	for _, member := range members {
+		element, ok := zs.Get(member)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDZRem, key, member),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDZAdd, key, formatScore(element.Score), member),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// parseScore parses a score argument, NaN is not allowed
+func parseScore(raw []byte) (float64, protocol.ErrorReply) {
+	score, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// formatScore formats score like redis, large or tiny scores are formatted in exponent form
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	abs := math.Abs(score)
+	if abs != 0 && (abs < 1e-4 || abs >= 1e17) {
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+	return formatFloat(score)
+}
+
+func elementsToReply(elements []*skiplist.Element, withScores bool) client.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(formatScore(element.Score)))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+/* ---- ZADD ---- */
+
+const (
+	zaddNX = 1 << iota
+	zaddXX
+	zaddGT
+	zaddLT
+	zaddCH
+	zaddIncr
+)
+
+// splitZAddArgs splits "[NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]" into flags and score-member pairs
+func splitZAddArgs(args [][]byte) (flags int, pairs [][]byte) {
+	for i, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			flags |= zaddNX
+		case "XX":
+			flags |= zaddXX
+		case "GT":
+			flags |= zaddGT
+		case "LT":
+			flags |= zaddLT
+		case "CH":
+			flags |= zaddCH
+		case "INCR":
+			flags |= zaddIncr
+		default:
+			return flags, args[i:]
+		}
+	}
+	return flags, nil
+}
+
+// execZAdd adds members into sorted set, or updates scores of existing members
+func execZAdd(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	flags, pairs := splitZAddArgs(args[1:])
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	if flags&zaddNX > 0 && flags&zaddXX > 0 {
+		return protocol.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&zaddGT > 0 && flags&zaddLT > 0) || (flags&(zaddGT|zaddLT) > 0 && flags&zaddNX > 0) {
+		return protocol.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	incr := flags&zaddIncr > 0
+	if incr && len(pairs) > 2 {
+		return protocol.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for i := range scores {
+		score, errReply := parseScore(pairs[2*i])
+		if errReply != nil {
+			return errReply
+		}
+		scores[i] = score
+	}
+
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	inited := false
+	if zs == nil {
+		zs = makeZSet()
+		inited = true
+	}
+
+	var added, changed int64
+	skipped := false
+	var score float64
+	for i := range scores {
+		member := string(pairs[2*i+1])
+		score = scores[i]
+		element, exists := zs.Get(member)
+		if (exists && flags&zaddNX > 0) || (!exists && flags&zaddXX > 0) {
+			skipped = true
+			continue
+		}
+		if !exists {
+			zs.Add(member, score)
+			added++
+			continue
+		}
+		if incr {
+			score += element.Score
+			if math.IsNaN(score) {
+				return protocol.MakeErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if (flags&zaddGT > 0 && score <= element.Score) || (flags&zaddLT > 0 && score >= element.Score) {
+			skipped = true
+			continue
+		}
+		if score != element.Score {
+			zs.Add(member, score)
+			changed++
+		}
+	}
+	if inited && zs.Len() > 0 {
+		db.PutEntity(key, &IDB.DataEntity{
+			Data: zs,
+		})
+	}
+
+	if incr {
+		if skipped {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply([]byte(formatScore(score)))
+	}
+	if flags&zaddCH > 0 {
+		return protocol.MakeIntReply(added + changed)
+	}
+	return protocol.MakeIntReply(added)
+}
+
+func undoZAdd(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	_, pairs := splitZAddArgs(args[1:])
+	members := make([]string, 0, len(pairs)/2)
+	for i := 1; i < len(pairs); i += 2 {
+		members = append(members, string(pairs[i]))
+	}
+	return rollbackZSetMembers(db, key, members...)
+}
+
+// execZIncrBy increments the score of member
+func execZIncrBy(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	delta, errReply := parseScore(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	member := string(args[2])
+	zs, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	score := delta
+	if element, exists := zs.Get(member); exists {
+		score += element.Score
+		if math.IsNaN(score) {
+			return protocol.MakeErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	zs.Add(member, score)
+	return protocol.MakeBulkReply([]byte(formatScore(score)))
+}
+
+func undoZIncr(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	member := string(args[2])
+	return rollbackZSetMembers(db, key, member)
+}
+
+/* ---- Member Query ---- */
+
+// execZScore returns the score of member
+func execZScore(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	element, exists := zs.Get(string(args[1]))
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply([]byte(formatScore(element.Score)))
+}
+
+// execZMScore returns scores of members, nil for absent members
+func execZMScore(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if zs == nil {
+		return protocol.MakeMultiBulkReply(result)
+	}
+	for i, member := range args[1:] {
+		if element, exists := zs.Get(string(member)); exists {
+			result[i] = []byte(formatScore(element.Score))
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execZCard returns the number of members
+func execZCard(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(zs.Len())
+}
+
+func parseScoreBorders(rawMin, rawMax []byte) (min, max *skiplist.ScoreBorder, errReply protocol.ErrorReply) {
+	min, err := skiplist.ParseScoreBorder(string(rawMin))
+	if err != nil {
+		return nil, nil, protocol.MakeErrReply(err.Error())
+	}
+	max, err = skiplist.ParseScoreBorder(string(rawMax))
+	if err != nil {
+		return nil, nil, protocol.MakeErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+// execZCount returns the number of members which score within [min, max]
+func execZCount(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	min, max, errReply := parseScoreBorders(args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(zs.Count(min, max))
+}
+
+func (db *DB) zsetRank(args [][]byte, desc bool) client.Reply {
+	key := string(args[0])
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		if withScore {
+			return protocol.MakeNullMultiBulkReply()
+		}
+		return protocol.MakeNullBulkReply()
+	}
+	member := string(args[1])
+	rank, exists := zs.GetRank(member, desc)
+	if !exists {
+		if withScore {
+			return protocol.MakeNullMultiBulkReply()
+		}
+		return protocol.MakeNullBulkReply()
+	}
+	if withScore {
+		element, _ := zs.Get(member)
+		return protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeIntReply(rank),
+			protocol.MakeBulkReply([]byte(formatScore(element.Score))),
+		})
+	}
+	return protocol.MakeIntReply(rank)
+}
+
+// execZRank returns the rank of member sorted by ascending score
+func execZRank(db *DB, args [][]byte) client.Reply {
+	return db.zsetRank(args, false)
+}
+
+// execZRevRank returns the rank of member sorted by descending score
+func execZRevRank(db *DB, args [][]byte) client.Reply {
+	return db.zsetRank(args, true)
+}
+
+/* ---- Remove ---- */
+
+// execZRem removes members from sorted set, the key is removed with the last member
+func execZRem(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		if zs.Remove(string(member)) {
+			removed++
+		}
+	}
+	if zs.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+func undoZRem(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	members := make([]string, 0, len(args)-1)
+	for _, member := range args[1:] {
+		members = append(members, string(member))
+	}
+	return rollbackZSetMembers(db, key, members...)
+}
+
+// execZRemRangeByScore removes members which score within [min, max]
+func execZRemRangeByScore(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	min, max, errReply := parseScoreBorders(args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := zs.RemoveByScore(min, max)
+	if zs.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+// execZRemRangeByRank removes members which rank within [start, stop]
+func execZRemRangeByRank(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	begin, end, ok := normalizeRange(start, stop, zs.Len())
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	removed := zs.RemoveByRank(begin, end)
+	if zs.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+// zsetPop removes at most count members with the lowest (or highest if max is true) scores
+func (db *DB) zsetPop(key string, count int64, max bool) ([]*skiplist.Element, protocol.ErrorReply) {
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if zs == nil {
+		return nil, nil
+	}
+	if count > zs.Len() {
+		count = zs.Len()
+	}
+	elements := zs.Range(0, count, max)
+	for _, element := range elements {
+		zs.Remove(element.Member)
+	}
+	if zs.Len() == 0 {
+		db.Remove(key)
+	}
+	return elements, nil
+}
+
+func (db *DB) execZPop(args [][]byte, max bool) client.Reply {
+	key := string(args[0])
+	count := int64(1)
+	if len(args) > 2 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+	elements, errReply := db.zsetPop(key, count, max)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsToReply(elements, true)
+}
+
+// execZPopMin removes and returns members with the lowest scores
+func execZPopMin(db *DB, args [][]byte) client.Reply {
+	return db.execZPop(args, false)
+}
+
+// execZPopMax removes and returns members with the highest scores
+func execZPopMax(db *DB, args [][]byte) client.Reply {
+	return db.execZPop(args, true)
+}
+
+// execZRandMember returns random members of sorted set.
+// A positive count returns distinct members, while a negative count allows duplicated members
+func execZRandMember(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	if len(args) > 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if zs == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		rank := rand.Int63n(zs.Len())
+		element := zs.Range(rank, rank+1, false)[0]
+		return protocol.MakeBulkReply([]byte(element.Member))
+	}
+
+	count, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withScores = true
+	}
+	if zs == nil || count == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	size := zs.Len()
+	var elements []*skiplist.Element
+	switch {
+	case count < 0:
+		elements = make([]*skiplist.Element, 0, -count)
+		for i := int64(0); i < -count; i++ {
+			rank := rand.Int63n(size)
+			elements = append(elements, zs.Range(rank, rank+1, false)[0])
+		}
+	case count >= size:
+		elements = zs.Range(0, size, false)
+	default:
+		// pick distinct ranks
+		ranks := make(map[int64]struct{}, count)
+		elements = make([]*skiplist.Element, 0, count)
+		for int64(len(elements)) < count {
+			rank := rand.Int63n(size)
+			if _, picked := ranks[rank]; picked {
+				continue
+			}
+			ranks[rank] = struct{}{}
+			elements = append(elements, zs.Range(rank, rank+1, false)[0])
+		}
+	}
+	return elementsToReply(elements, withScores)
+}
+
+func parseLexBorders(rawMin, rawMax []byte) (min, max *skiplist.LexBorder, errReply protocol.ErrorReply) {
+	min, err := skiplist.ParseLexBorder(string(rawMin))
+	if err != nil {
+		return nil, nil, protocol.MakeErrReply(err.Error())
+	}
+	max, err = skiplist.ParseLexBorder(string(rawMax))
+	if err != nil {
+		return nil, nil, protocol.MakeErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+// execZLexCount returns the number of members within lex range
+func execZLexCount(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	min, max, errReply := parseLexBorders(args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(zs.CountByLex(min, max))
+}
+
+// execZRemRangeByLex removes members within lex range
+func execZRemRangeByLex(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	min, max, errReply := parseLexBorders(args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := zs.RemoveByLex(min, max)
+	if zs.Len() == 0 {
+		db.Remove(key)
+	}
+	return protocol.MakeIntReply(removed)
+}
+
+// parseZMPop parses "numkeys key [key ...] MIN|MAX [COUNT count]" of ZMPOP and BZMPOP
+func parseZMPop(args [][]byte) (keys []string, max bool, count int64, errReply protocol.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, protocol.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if int64(len(args)) < numKeys+2 {
+		return nil, false, 0, protocol.MakeSyntaxErrReply()
+	}
+	for _, arg := range args[1 : numKeys+1] {
+		keys = append(keys, string(arg))
+	}
+	switch strings.ToUpper(string(args[numKeys+1])) {
+	case "MIN":
+		max = false
+	case "MAX":
+		max = true
+	default:
+		return nil, false, 0, protocol.MakeSyntaxErrReply()
+	}
+	count = 1
+	options := args[numKeys+2:]
+	if len(options) == 0 {
+		return keys, max, count, nil
+	}
+	if len(options) != 2 || strings.ToUpper(string(options[0])) != "COUNT" {
+		return nil, false, 0, protocol.MakeSyntaxErrReply()
+	}
+	count, err = strconv.ParseInt(string(options[1]), 10, 64)
+	if err != nil || count <= 0 {
+		return nil, false, 0, protocol.MakeErrReply("ERR count should be greater than 0")
+	}
+	return keys, max, count, nil
+}
+
+// zsetMPop pops members from sorted set and replies with the key name, ok is false if the sorted set is empty
+func (db *DB) zsetMPop(key string, max bool, count int64) (client.Reply, bool) {
+	elements, errReply := db.zsetPop(key, count, max)
+	if errReply != nil {
+		return errReply, true
+	}
+	if len(elements) == 0 {
+		return nil, false
+	}
+	pairs := make([]client.Reply, len(elements))
+	for i, element := range elements {
+		pairs[i] = protocol.MakeMultiBulkReply([][]byte{
+			[]byte(element.Member),
+			[]byte(formatScore(element.Score)),
+		})
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte(key)),
+		protocol.MakeMultiRawReply(pairs),
+	}), true
+}
+
+// execZMPop pops members from the first non-empty sorted set of given keys
+func execZMPop(db *DB, args [][]byte) client.Reply {
+	keys, max, count, errReply := parseZMPop(args)
+	if errReply != nil {
+		return errReply
+	}
+	for _, key := range keys {
+		if reply, ok := db.zsetMPop(key, max, count); ok {
+			return reply
+		}
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+func prepareZMPop(args [][]byte) ([]string, []string) {
+	keys, _, _, errReply := parseZMPop(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+// zsetBPop pops a member and replies with the key name, ok is false if the sorted set is empty
+func (db *DB) zsetBPop(key string, max bool) (client.Reply, bool) {
+	elements, errReply := db.zsetPop(key, 1, max)
+	if errReply != nil {
+		return errReply, true
+	}
+	if len(elements) == 0 {
+		return nil, false
+	}
+	return protocol.MakeMultiBulkReply([][]byte{
+		[]byte(key),
+		[]byte(elements[0].Member),
+		[]byte(formatScore(elements[0].Score)),
+	}), true
+}
+
+func parseBZPop(args [][]byte, max bool) (*blockingOp, protocol.ErrorReply) {
+	timeout, errReply := parseTimeout(args[len(args)-1])
+	if errReply != nil {
+		return nil, errReply
+	}
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	return &blockingOp{
+		keys:    keys,
+		timeout: timeout,
+		serve: func(db *DB, key string) (client.Reply, bool) {
+			return db.zsetBPop(key, max)
+		},
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+	}, nil
+}
+
+// parseBZPopMin parses BZPOPMIN which blocks until one of the sorted sets has members to pop
+func parseBZPopMin(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	return parseBZPop(args, false)
+}
+
+// parseBZPopMax parses BZPOPMAX which blocks until one of the sorted sets has members to pop
+func parseBZPopMax(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	return parseBZPop(args, true)
+}
+
+// parseBZMPop parses BZMPOP which blocks until one of the sorted sets has members to pop
+func parseBZMPop(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	timeout, errReply := parseTimeout(args[0])
+	if errReply != nil {
+		return nil, errReply
+	}
+	keys, max, count, errReply := parseZMPop(args[1:])
+	if errReply != nil {
+		return nil, errReply
+	}
+	return &blockingOp{
+		keys:    keys,
+		timeout: timeout,
+		serve: func(db *DB, key string) (client.Reply, bool) {
+			return db.zsetMPop(key, max, count)
+		},
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+	}, nil
+}
+
+func prepareBZMPop(args [][]byte) ([]string, []string) {
+	return prepareZMPop(args[1:])
+}
+
+/* ---- Range ---- */
+
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec is the parsed arguments of ZRANGE family
+type zrangeSpec struct {
+	by         int
+	rev        bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64 // <0 means no limit
+
+	// range by rank
+	start, stop int64
+	// range by score
+	min, max *skiplist.ScoreBorder
+	// range by lex
+	lexMin, lexMax *skiplist.LexBorder
+}
+
+// parseZRange parses "start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]".
+// The range type and order of legacy commands are given by by and rev, they don't accept BYSCORE, BYLEX and REV
+func parseZRange(args [][]byte, by int, rev bool, unified bool) (*zrangeSpec, protocol.ErrorReply) {
+	spec := &zrangeSpec{
+		by:    by,
+		rev:   rev,
+		count: -1,
+	}
+	options := args[2:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		switch {
+		case option == "BYSCORE" && unified:
+			spec.by = zrangeByScore
+		case option == "BYLEX" && unified:
+			spec.by = zrangeByLex
+		case option == "WITHSCORES" && !unified && by == zrangeByLex:
+			return nil, protocol.MakeSyntaxErrReply()
+		case option == "REV" && unified:
+			spec.rev = true
+		case option == "WITHSCORES":
+			spec.withScores = true
+		case option == "LIMIT" && i+2 < len(options):
+			offset, errReply := parseInt(options[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			count, errReply := parseInt(options[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.hasLimit = true
+			spec.offset = offset
+			spec.count = count
+			i += 2
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if spec.hasLimit && spec.by == zrangeByRank {
+		return nil, protocol.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		return nil, protocol.MakeErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	start, stop := args[0], args[1]
+	switch spec.by {
+	case zrangeByScore:
+		if spec.rev {
+			start, stop = stop, start
+		}
+		min, max, errReply := parseScoreBorders(start, stop)
+		if errReply != nil {
+			return nil, errReply
+		}
+		spec.min, spec.max = min, max
+	case zrangeByLex:
+		if spec.rev {
+			start, stop = stop, start
+		}
+		min, max, errReply := parseLexBorders(start, stop)
+		if errReply != nil {
+			return nil, errReply
+		}
+		spec.lexMin, spec.lexMax = min, max
+	default:
+		var errReply protocol.ErrorReply
+		spec.start, errReply = parseInt(start)
+		if errReply != nil {
+			return nil, errReply
+		}
+		spec.stop, errReply = parseInt(stop)
+		if errReply != nil {
+			return nil, errReply
+		}
+	}
+	return spec, nil
+}
+
+// elements returns members within range of zs
+func (spec *zrangeSpec) elements(zs *zset.ZSet) []*skiplist.Element {
+	if zs == nil {
+		return nil
+	}
+	switch spec.by {
+	case zrangeByScore:
+		return zs.RangeByScore(spec.min, spec.max, spec.offset, spec.count, spec.rev)
+	case zrangeByLex:
+		return zs.RangeByLex(spec.lexMin, spec.lexMax, spec.offset, spec.count, spec.rev)
+	}
+	begin, end, ok := normalizeRange(spec.start, spec.stop, zs.Len())
+	if !ok {
+		return nil
+	}
+	return zs.Range(begin, end, spec.rev)
+}
+
+func (db *DB) execZRangeGeneric(args [][]byte, by int, rev bool, unified bool) client.Reply {
+	key := string(args[0])
+	spec, errReply := parseZRange(args[1:], by, rev, unified)
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsToReply(spec.elements(zs), spec.withScores)
+}
+
+// execZRange returns members within range by rank or score, in ascending or descending order
+func execZRange(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByRank, false, true)
+}
+
+// execZRevRange returns members within range by rank in descending order
+func execZRevRange(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByRank, true, false)
+}
+
+// execZRangeByScore returns members within range by score in ascending order
+func execZRangeByScore(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByScore, false, false)
+}
+
+// execZRevRangeByScore returns members within range by score in descending order
+func execZRevRangeByScore(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByScore, true, false)
+}
+
+// execZRangeByLex returns members within lex range in ascending order
+func execZRangeByLex(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByLex, false, false)
+}
+
+// execZRevRangeByLex returns members within lex range in descending order
+func execZRevRangeByLex(db *DB, args [][]byte) client.Reply {
+	return db.execZRangeGeneric(args, zrangeByLex, true, false)
+}
+
+// execZRangeStore stores the result of ZRANGE into destination, an empty result removes destination
+func execZRangeStore(db *DB, args [][]byte) client.Reply {
+	dest := string(args[0])
+	src := string(args[1])
+	spec, errReply := parseZRange(args[2:], zrangeByRank, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if spec.withScores {
+		return protocol.MakeSyntaxErrReply()
+	}
+	zs, errReply := db.getAsSortedSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	elements := spec.elements(zs)
+	if len(elements) == 0 {
+		db.Remove(dest)
+		return protocol.MakeIntReply(0)
+	}
+	result := makeZSet()
+	for _, element := range elements {
+		result.Add(element.Member, element.Score)
+	}
+	db.PutEntity(dest, &IDB.DataEntity{
+		Data: result,
+	})
+	db.Persist(dest) // override ttl
+	return protocol.MakeIntReply(result.Len())
+}
+
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	src := string(args[1])
+	return []string{dest}, []string{src}
+}
+
+/* ---- Set Algebra ---- */
+
+// zsetSource is an input of ZUNION family, it's a sorted set or a set whose members score 1
+type zsetSource struct {
+	zs  *zset.ZSet
+	set *HashSet.Set
+}
+
+func (db *DB) getZSetSource(key string) (*zsetSource, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return &zsetSource{}, nil
+	}
+	switch val := entity.Data.(type) {
+	case *zset.ZSet:
+		return &zsetSource{zs: val}, nil
+	case *HashSet.Set:
+		return &zsetSource{set: val}, nil
+	}
+	return nil, &protocol.WrongTypeErrReply{}
+}
+
+func (src *zsetSource) len() int64 {
+	if src.zs != nil {
+		return src.zs.Len()
+	}
+	if src.set != nil {
+		return int64(src.set.Len())
+	}
+	return 0
+}
+
+func (src *zsetSource) get(member string) (float64, bool) {
+	if src.zs != nil {
+		element, ok := src.zs.Get(member)
+		if !ok {
+			return 0, false
+		}
+		return element.Score, true
+	}
+	if src.set != nil && src.set.Has(member) {
+		return 1, true
+	}
+	return 0, false
+}
+
+func (src *zsetSource) forEach(cb func(member string, score float64) bool) {
+	if src.zs != nil && src.zs.Len() > 0 {
+		src.zs.ForEach(0, src.zs.Len(), false, func(element *skiplist.Element) bool {
+			return cb(element.Member, element.Score)
+		})
+	} else if src.set != nil {
+		src.set.ForEach(func(member string) bool {
+			return cb(member, 1)
+		})
+	}
+}
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// zsetAlgebraSpec is the parsed arguments of ZUNION family
+type zsetAlgebraSpec struct {
+	keys       []string
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// parseZSetAlgebra parses "numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]".
+// WEIGHTS and AGGREGATE are accepted only if weighted is true, WITHSCORES is accepted only if store is false
+func parseZSetAlgebra(args [][]byte, cmdName string, weighted bool, store bool) (*zsetAlgebraSpec, protocol.ErrorReply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, protocol.MakeErrReply("ERR at least 1 input key is needed for '" + strings.ToLower(cmdName) + "' command")
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, protocol.MakeSyntaxErrReply()
+	}
+	spec := &zsetAlgebraSpec{
+		keys:      make([]string, numKeys),
+		weights:   make([]float64, numKeys),
+		aggregate: aggregateSum,
+	}
+	for i := range spec.keys {
+		spec.keys[i] = string(args[i+1])
+		spec.weights[i] = 1
+	}
+
+	options := args[numKeys+1:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		switch {
+		case option == "WEIGHTS" && weighted && i+len(spec.keys) < len(options):
+			for j := range spec.weights {
+				weight, err := strconv.ParseFloat(string(options[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, protocol.MakeErrReply("ERR weight value is not a float")
+				}
+				spec.weights[j] = weight
+			}
+			i += len(spec.keys)
+		case option == "AGGREGATE" && weighted && i+1 < len(options):
+			switch strings.ToUpper(string(options[i+1])) {
+			case "SUM":
+				spec.aggregate = aggregateSum
+			case "MIN":
+				spec.aggregate = aggregateMin
+			case "MAX":
+				spec.aggregate = aggregateMax
+			default:
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			i++
+		case option == "WITHSCORES" && !store:
+			spec.withScores = true
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+func (spec *zsetAlgebraSpec) aggregateScore(acc, score float64) float64 {
+	switch spec.aggregate {
+	case aggregateMin:
+		return math.Min(acc, score)
+	case aggregateMax:
+		return math.Max(acc, score)
+	}
+	sum := acc + score
+	if math.IsNaN(sum) {
+		return 0 // inf + -inf
+	}
+	return sum
+}
+
+func weightScore(score, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0 // inf * 0
+	}
+	return result
+}
+
+// zsetAlgebra calculates the result of sources
+type zsetAlgebra func(spec *zsetAlgebraSpec, sources []*zsetSource) *zset.ZSet
+
+func zsetUnion(spec *zsetAlgebraSpec, sources []*zsetSource) *zset.ZSet {
+	scores := make(map[string]float64)
+	for i, src := range sources {
+		src.forEach(func(member string, score float64) bool {
+			score = weightScore(score, spec.weights[i])
+			if acc, ok := scores[member]; ok {
+				score = spec.aggregateScore(acc, score)
+			}
+			scores[member] = score
+			return true
+		})
+	}
+	result := makeZSet()
+	for member, score := range scores {
+		result.Add(member, score)
+	}
+	return result
+}
+
+func zsetInter(spec *zsetAlgebraSpec, sources []*zsetSource) *zset.ZSet {
+	result := makeZSet()
+	smallest := sources[0]
+	for _, src := range sources {
+		if src.len() == 0 {
+			return result
+		}
+		if src.len() < smallest.len() {
+			smallest = src
+		}
+	}
+	smallest.forEach(func(member string, _ float64) bool {
+		var acc float64
+		for i, src := range sources {
+			score, ok := src.get(member)
+			if !ok {
+				return true
+			}
+			score = weightScore(score, spec.weights[i])
+			if i == 0 {
+				acc = score
+			} else {
+				acc = spec.aggregateScore(acc, score)
+			}
+		}
+		result.Add(member, acc)
+		return true
+	})
+	return result
+}
+
+func zsetDiff(spec *zsetAlgebraSpec, sources []*zsetSource) *zset.ZSet {
+	result := makeZSet()
+	sources[0].forEach(func(member string, score float64) bool {
+		for _, src := range sources[1:] {
+			if _, ok := src.get(member); ok {
+				return true
+			}
+		}
+		result.Add(member, score)
+		return true
+	})
+	return result
+}
+
+func (db *DB) calculateZSets(spec *zsetAlgebraSpec, algebra zsetAlgebra) (*zset.ZSet, protocol.ErrorReply) {
+	sources := make([]*zsetSource, len(spec.keys))
+	for i, key := range spec.keys {
+		src, errReply := db.getZSetSource(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		sources[i] = src
+	}
+	return algebra(spec, sources), nil
+}
+
+func (db *DB) execZSetAlgebra(args [][]byte, cmdName string, weighted bool, algebra zsetAlgebra) client.Reply {
+	spec, errReply := parseZSetAlgebra(args, cmdName, weighted, false)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := db.calculateZSets(spec, algebra)
+	if errReply != nil {
+		return errReply
+	}
+	if result.Len() == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return elementsToReply(result.Range(0, result.Len(), false), spec.withScores)
+}
+
+// execZSetAlgebraStore stores the result into destination, an empty result removes destination
+func (db *DB) execZSetAlgebraStore(args [][]byte, cmdName string, weighted bool, algebra zsetAlgebra) client.Reply {
+	dest := string(args[0])
+	spec, errReply := parseZSetAlgebra(args[1:], cmdName, weighted, true)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := db.calculateZSets(spec, algebra)
+	if errReply != nil {
+		return errReply
+	}
+	if result.Len() == 0 {
+		db.Remove(dest)
+		return protocol.MakeIntReply(0)
+	}
+	db.PutEntity(dest, &IDB.DataEntity{
+		Data: result,
+	})
+	db.Persist(dest) // override ttl
+	return protocol.MakeIntReply(result.Len())
+}
+
+// execZUnion returns the union of sorted sets
+func execZUnion(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebra(args, consts.CMDZUnion, true, zsetUnion)
+}
+
+// execZUnionStore stores the union of sorted sets into destination
+func execZUnionStore(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebraStore(args, consts.CMDZUnionStore, true, zsetUnion)
+}
+
+// execZInter returns the intersection of sorted sets
+func execZInter(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebra(args, consts.CMDZInter, true, zsetInter)
+}
+
+// execZInterStore stores the intersection of sorted sets into destination
+func execZInterStore(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebraStore(args, consts.CMDZInterStore, true, zsetInter)
+}
+
+// execZDiff returns members of the first sorted set which are not in the others
+func execZDiff(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebra(args, consts.CMDZDiff, false, zsetDiff)
+}
+
+// execZDiffStore stores the difference of sorted sets into destination
+func execZDiffStore(db *DB, args [][]byte) client.Reply {
+	return db.execZSetAlgebraStore(args, consts.CMDZDiffStore, false, zsetDiff)
+}
+
+// readNumKeys returns keys given by "numkeys key [key ...]" as read keys
+func readNumKeys(args [][]byte) []string {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 || numKeys > int64(len(args)-1) {
+		return nil
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return keys
+}
+
+func prepareZSetAlgebra(args [][]byte) ([]string, []string) {
+	return nil, readNumKeys(args)
+}
+
+func prepareZSetAlgebraStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	return []string{dest}, readNumKeys(args[1:])
+}
+
+func init() {
+	registerCommand(consts.CMDZAdd, execZAdd, router.WriteFirstKey, undoZAdd, -4, router.FlagWrite)
+	registerCommand(consts.CMDZScore, execZScore, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDZMScore, execZMScore, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZIncrBy, execZIncrBy, router.WriteFirstKey, undoZIncr, 4, router.FlagWrite)
+	registerCommand(consts.CMDZCard, execZCard, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDZCount, execZCount, router.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRank, execZRank, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZRevRank, execZRevRank, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZRem, execZRem, router.WriteFirstKey, undoZRem, -3, router.FlagWrite)
+	registerCommand(consts.CMDZRemRangeByScore, execZRemRangeByScore, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDZRemRangeByRank, execZRemRangeByRank, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDZPopMin, execZPopMin, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDZPopMax, execZPopMax, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDZMPop, execZMPop, prepareZMPop, rollbackWriteKeys(prepareZMPop), -4, router.FlagWrite)
+	registerBlockingCommand(consts.CMDBZPopMin, parseBZPopMin, prepareBPop, -3)
+	registerBlockingCommand(consts.CMDBZPopMax, parseBZPopMax, prepareBPop, -3)
+	registerBlockingCommand(consts.CMDBZMPop, parseBZMPop, prepareBZMPop, -5)
+	registerCommand(consts.CMDZRandMember, execZRandMember, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDZRange, execZRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRevRange, execZRevRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRangeByScore, execZRangeByScore, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRevRangeByScore, execZRevRangeByScore, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRangeByLex, execZRangeByLex, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRevRangeByLex, execZRevRangeByLex, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDZLexCount, execZLexCount, router.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	registerCommand(consts.CMDZRemRangeByLex, execZRemRangeByLex, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDZUnion, execZUnion, prepareZSetAlgebra, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZUnionStore, execZUnionStore, prepareZSetAlgebraStore, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDZInter, execZInter, prepareZSetAlgebra, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZInterStore, execZInterStore, prepareZSetAlgebraStore, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDZDiff, execZDiff, prepareZSetAlgebra, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDZDiffStore, execZDiffStore, prepareZSetAlgebraStore, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDZRangeStore, execZRangeStore, prepareZRangeStore, rollbackFirstKey, -5, router.FlagWrite)
+}
@@ -0,0 +1,135 @@
+package single_db
+
+import "testing"
+
+func TestZAdd(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 1 a 2 b 3 c", ":3")
+	check(t, db, "ZADD z NX XX 1 a", "-ERR XX and NX options at the same time are not compatible")
+	check(t, db, "ZADD z GT NX 1 a", "-ERR GT, LT, and/or NX options at the same time are not compatible")
+	check(t, db, "ZADD z INCR 1 a 2 b", "-ERR INCR option supports a single increment-element pair")
+	check(t, db, "ZADD z 1 a 2", "-Err syntax error")
+	check(t, db, "ZADD z CH 5 a 2 b 4 d", ":2")
+	check(t, db, "ZADD z GT CH 1 a 6 b", ":1")
+	check(t, db, "ZADD z LT INCR 1 a", "$-1")
+	check(t, db, "ZADD z INCR 1.5 a", "$3 6.5")
+	check(t, db, "ZADD z XX 1 nx", ":0")
+	check(t, db, "ZADD zz XX 1 nx", ":0")
+	check(t, db, "EXISTS zz", ":0")
+	check(t, db, "ZSCORE z a", "$3 6.5")
+	check(t, db, "ZMSCORE z a x", "*2 $3 6.5 $-1")
+	check(t, db, "ZINCRBY z 1e20 c", "$5 1e+20")
+	check(t, db, "ZINCRBY z -1e20 c", "$1 0")
+	check(t, db, "ZCARD z", ":4")
+	check(t, db, "TYPE z", "+zset")
+}
+
+func TestZRange(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 3 c 4 d 6 b 6.5 a", ":4")
+	check(t, db, "ZCOUNT z (3 +inf", ":3")
+	check(t, db, "ZCOUNT z x 1", "-ERR min or max is not a float")
+	check(t, db, "ZRANGE z 0 -1 WITHSCORES", "*8 $1 c $1 3 $1 d $1 4 $1 b $1 6 $1 a $3 6.5")
+	check(t, db, "ZRANGE z 0 1 REV", "*2 $1 a $1 b")
+	check(t, db, "ZRANGE z (6.5 3 BYSCORE REV LIMIT 1 5", "*2 $1 d $1 c")
+	check(t, db, "ZRANGE z 3 (6.5 BYSCORE LIMIT 1 1", "*1 $1 d")
+	check(t, db, "ZRANGE z 0 1 LIMIT 1 1", "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	check(t, db, "ZREVRANGE z 0 0 WITHSCORES", "*2 $1 a $3 6.5")
+	check(t, db, "ZRANGEBYSCORE z -inf 4", "*2 $1 c $1 d")
+	check(t, db, "ZREVRANGEBYSCORE z +inf 5 WITHSCORES LIMIT 0 1", "*2 $1 a $3 6.5")
+	check(t, db, "ZRANK z b", ":2")
+	check(t, db, "ZREVRANK z b WITHSCORE", "*2 :1 $1 6")
+	check(t, db, "ZRANK z x", "$-1")
+	check(t, db, "ZRANGESTORE dst z 0 1", ":2")
+	check(t, db, "ZRANGE dst 0 -1", "*2 $1 c $1 d")
+	check(t, db, "ZRANGESTORE dst z 10 11", ":0")
+	check(t, db, "EXISTS dst", ":0")
+}
+
+func TestZRemove(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 3 c 4 d 6 b 6.5 a", ":4")
+	check(t, db, "ZPOPMIN z", "*2 $1 c $1 3")
+	check(t, db, "ZPOPMAX z 2", "*4 $1 a $3 6.5 $1 b $1 6")
+	check(t, db, "ZADD z 1 x 2 y 3 w", ":3")
+	check(t, db, "ZREMRANGEBYRANK z 0 0", ":1")
+	check(t, db, "ZREMRANGEBYSCORE z (2 3", ":1")
+	check(t, db, "ZREM z y nx", ":1")
+	check(t, db, "ZRANGE z 0 -1 WITHSCORES", "*2 $1 d $1 4")
+	check(t, db, "ZREM z d", ":1")
+	check(t, db, "EXISTS z", ":0")
+}
+
+func TestZRandMember(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 1 a 2 b 3 c", ":3")
+	if got := runSorted(t, db, "ZRANDMEMBER z 5"); got != "a b c" {
+		t.Error(got)
+	}
+	if got := run(db, "ZRANDMEMBER z -3 WITHSCORES"); got[:2] != "*6" {
+		t.Error(got)
+	}
+	check(t, db, "ZRANDMEMBER nx", "$-1")
+}
+
+func TestZSetUndo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 1 a 2 b 3 c", ":3")
+	replayUndo(t, db, "z")
+	check(t, db, "ZRANGE z 0 -1 WITHSCORES", "*6 $1 a $1 1 $1 b $1 2 $1 c $1 3")
+}
+
+func TestZLex(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD z 0 a 0 b 0 c 0 d 0 e 0 f 0 g", ":7")
+	check(t, db, "ZRANGEBYLEX z - [c", "*3 $1 a $1 b $1 c")
+	check(t, db, "ZRANGEBYLEX z - (c", "*2 $1 a $1 b")
+	check(t, db, "ZRANGEBYLEX z [aaa (g", "*5 $1 b $1 c $1 d $1 e $1 f")
+	check(t, db, "ZRANGEBYLEX z - + LIMIT 2 2", "*2 $1 c $1 d")
+	check(t, db, "ZRANGEBYLEX z - + WITHSCORES", "-Err syntax error")
+	check(t, db, "ZREVRANGEBYLEX z + [e LIMIT 1 2", "*2 $1 f $1 e")
+	check(t, db, "ZRANGE z [b [d BYLEX", "*3 $1 b $1 c $1 d")
+	check(t, db, "ZRANGE z [d [b BYLEX REV", "*3 $1 d $1 c $1 b")
+	check(t, db, "ZRANGE z - + BYLEX WITHSCORES", "-ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	check(t, db, "ZRANGEBYLEX z a c", "-ERR min or max not valid string range item")
+	check(t, db, "ZLEXCOUNT z (a [f", ":5")
+	check(t, db, "ZLEXCOUNT z + -", ":0")
+	check(t, db, "ZRANGESTORE d z (a (d BYLEX", ":2")
+	check(t, db, "ZRANGE d 0 -1", "*2 $1 b $1 c")
+	check(t, db, "ZREMRANGEBYLEX z [b (f", ":4")
+	check(t, db, "ZRANGE z 0 -1", "*3 $1 a $1 f $1 g")
+	check(t, db, "ZREMRANGEBYLEX z - +", ":3")
+	check(t, db, "EXISTS z", ":0")
+}
+
+func TestZSetAlgebra(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD a 1 x 2 y 3 z", ":3")
+	check(t, db, "ZADD b 10 y 20 z 30 w", ":3")
+	check(t, db, "SADD s x w", ":2")
+	check(t, db, "ZUNION 2 a b WITHSCORES", "*8 $1 x $1 1 $1 y $2 12 $1 z $2 23 $1 w $2 30")
+	check(t, db, "ZUNION 2 a b WEIGHTS 2 0.5 AGGREGATE MAX WITHSCORES", "*8 $1 x $1 2 $1 y $1 5 $1 z $2 10 $1 w $2 15")
+	check(t, db, "ZINTER 3 a b s", "*0")
+	check(t, db, "ZINTER 2 a s WITHSCORES", "*2 $1 x $1 2")
+	check(t, db, "ZINTER 2 a b AGGREGATE MIN WITHSCORES", "*4 $1 y $1 2 $1 z $1 3")
+	check(t, db, "ZDIFF 2 b a WITHSCORES", "*2 $1 w $2 30")
+	check(t, db, "ZUNIONSTORE d 3 a b s", ":4")
+	check(t, db, "ZRANGE d 0 -1 WITHSCORES", "*8 $1 x $1 2 $1 y $2 12 $1 z $2 23 $1 w $2 31")
+	check(t, db, "ZINTERSTORE d 2 a nx", ":0")
+	check(t, db, "EXISTS d", ":0")
+	check(t, db, "ZDIFFSTORE d 1 s", ":2")
+	check(t, db, "ZRANGE d 0 -1 WITHSCORES", "*4 $1 w $1 1 $1 x $1 1")
+}
+
+func TestZSetAlgebraErrors(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "ZADD a 1 x", ":1")
+	check(t, db, "ZDIFF 2 b a WEIGHTS 1 1", "-Err syntax error")
+	check(t, db, "ZINTERSTORE d 2 a b WITHSCORES", "-Err syntax error")
+	check(t, db, "ZUNION 0 a", "-ERR at least 1 input key is needed for 'zunion' command")
+	check(t, db, "ZUNION 3 a b", "-Err syntax error")
+	check(t, db, "ZUNION 2 a b WEIGHTS 1", "-Err syntax error")
+	check(t, db, "ZUNION 2 a b WEIGHTS 1 x", "-ERR weight value is not a float")
+	check(t, db, "SET str 1", "+OK")
+	check(t, db, "ZUNION 2 a str", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
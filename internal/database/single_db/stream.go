@@ -0,0 +1,1508 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pluming/aurora/datastruct/stream"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+/* ---- Stream Commands ---- */
+
+const (
+	// streamTrimLimit is the default LIMIT of approximate trimming, 100 times the max entries of stream node like redis
+	streamTrimLimit = 10000
+	// streamAutoClaimCount is the default COUNT of XAUTOCLAIM
+	streamAutoClaimCount = 100
+	// streamInfoFullCount is the default COUNT of XINFO STREAM FULL
+	streamInfoFullCount = 10
+)
+
+func (db *DB) getAsStream(key string) (*stream.Stream, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return s, nil
+}
+
+// nowMillis returns the current unix time in milliseconds, which is the time unit of stream
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+func parseStreamID(raw []byte, missingSeq uint64) (stream.ID, protocol.ErrorReply) {
+	id, err := stream.ParseID(string(raw), missingSeq)
+	if err != nil {
+		return stream.ID{}, protocol.MakeErrReply(err.Error())
+	}
+	return id, nil
+}
+
+// parseIntervalID parses an ID of interval, "-" and "+" mean the min and max ID,
+// and the ID prefixed with "(" is exclusive
+func parseIntervalID(raw []byte, missingSeq uint64, isStart bool) (stream.ID, protocol.ErrorReply) {
+	exclusive := len(raw) > 1 && raw[0] == '('
+	if exclusive {
+		raw = raw[1:]
+	}
+	var id stream.ID
+	switch string(raw) {
+	case "-":
+		id = stream.MinID
+	case "+":
+		id = stream.MaxID
+	default:
+		var errReply protocol.ErrorReply
+		id, errReply = parseStreamID(raw, missingSeq)
+		if errReply != nil {
+			return id, errReply
+		}
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		if id, ok = id.Next(); !ok {
+			return id, protocol.MakeErrReply("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.Prev(); !ok {
+		return id, protocol.MakeErrReply("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+func makeNoGroupErr(key, group string) protocol.ErrorReply {
+	return protocol.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+func makeStreamIDReply(id stream.ID) client.Reply {
+	return protocol.MakeBulkReply([]byte(id.String()))
+}
+
+func makeStreamEntryReply(entry *stream.Entry) client.Reply {
+	return protocol.MakeMultiRawReply([]client.Reply{
+		makeStreamIDReply(entry.ID),
+		protocol.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func makeStreamEntriesReply(entries []*stream.Entry) client.Reply {
+	replies := make([]client.Reply, 0, len(entries))
+	for _, entry := range entries {
+		replies = append(replies, makeStreamEntryReply(entry))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+/* ---- trimming ---- */
+
+const (
+	streamTrimNone = iota
+	streamTrimMaxLen
+	streamTrimMinID
+)
+
+// streamTrimSpec is the trimming strategy of XADD and XTRIM
+type streamTrimSpec struct {
+	strategy int
+	approx   bool
+	maxLen   int64
+	minID    stream.ID
+	limit    int64 // -1 means not specified
+}
+
+// parseOption parses the trimming option at args[i], returns the number of consumed arguments,
+// which is 0 if args[i] is not a trimming option
+func (spec *streamTrimSpec) parseOption(args [][]byte, i int) (int, protocol.ErrorReply) {
+	opt := strings.ToUpper(string(args[i]))
+	switch opt {
+	case "MAXLEN", "MINID":
+	case "LIMIT":
+		if i+1 >= len(args) {
+			return 0, protocol.MakeSyntaxErrReply()
+		}
+		limit, errReply := parseInt(args[i+1])
+		if errReply != nil {
+			return 0, errReply
+		}
+		if limit < 0 {
+			return 0, protocol.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		spec.limit = limit
+		return 2, nil
+	default:
+		return 0, nil
+	}
+	strategy := streamTrimMaxLen
+	if opt == "MINID" {
+		strategy = streamTrimMinID
+	}
+	if spec.strategy != streamTrimNone && spec.strategy != strategy {
+		return 0, protocol.MakeErrReply("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	}
+	spec.strategy = strategy
+	consumed := 1
+	if i+1 < len(args) {
+		switch string(args[i+1]) {
+		case "~":
+			spec.approx = true
+			consumed++
+		case "=":
+			spec.approx = false
+			consumed++
+		}
+	}
+	if i+consumed >= len(args) {
+		return 0, protocol.MakeSyntaxErrReply()
+	}
+	threshold := args[i+consumed]
+	consumed++
+	if strategy == streamTrimMaxLen {
+		maxLen, errReply := parseInt(threshold)
+		if errReply != nil {
+			return 0, errReply
+		}
+		if maxLen < 0 {
+			return 0, protocol.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		spec.maxLen = maxLen
+	} else {
+		minID, errReply := parseStreamID(threshold, 0)
+		if errReply != nil {
+			return 0, errReply
+		}
+		spec.minID = minID
+	}
+	return consumed, nil
+}
+
+func (spec *streamTrimSpec) validate() protocol.ErrorReply {
+	if spec.limit >= 0 && !spec.approx {
+		return protocol.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	return nil
+}
+
+// trim removes entries from stream, returns the number of removed entries
+func (spec *streamTrimSpec) trim(s *stream.Stream) int64 {
+	var limit int64
+	if spec.approx {
+		limit = spec.limit
+		if limit < 0 {
+			limit = streamTrimLimit
+		}
+	}
+	switch spec.strategy {
+	case streamTrimMaxLen:
+		return s.TrimMaxLen(spec.maxLen, spec.approx, limit)
+	case streamTrimMinID:
+		return s.TrimMinID(spec.minID, spec.approx, limit)
+	}
+	return 0
+}
+
+/* ---- basic commands ---- */
+
+// execXAdd appends an entry into stream, the ID may be generated automatically
+func execXAdd(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	trimSpec := &streamTrimSpec{limit: -1}
+	noMkStream := false
+	i := 1
+	for ; i < len(args); i++ {
+		if strings.ToUpper(string(args[i])) == "NOMKSTREAM" {
+			noMkStream = true
+			continue
+		}
+		consumed, errReply := trimSpec.parseOption(args, i)
+		if errReply != nil {
+			return errReply
+		}
+		if consumed == 0 {
+			break
+		}
+		i += consumed - 1
+	}
+	if errReply := trimSpec.validate(); errReply != nil {
+		return errReply
+	}
+	if fieldCount := len(args) - i - 1; fieldCount < 2 || fieldCount%2 != 0 {
+		return protocol.MakeArgNumErrReply(consts.CMDXAdd)
+	}
+	rawID, fields := string(args[i]), args[i+1:]
+
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil && noMkStream {
+		return protocol.MakeNullBulkReply()
+	}
+	lastID := stream.MinID
+	if s != nil {
+		lastID = s.LastID()
+	}
+	id, errReply := nextStreamID(rawID, lastID)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		s = stream.New()
+		db.PutEntity(key, &IDB.DataEntity{Data: s})
+	}
+	s.Add(id, fields)
+	trimSpec.trim(s)
+	return makeStreamIDReply(id)
+}
+
+// nextStreamID returns ID of the new entry, rawID is "*", "ms-*" or an explicit ID
+func nextStreamID(rawID string, lastID stream.ID) (stream.ID, protocol.ErrorReply) {
+	tooSmall := protocol.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	if rawID == "*" {
+		ms := uint64(nowMillis())
+		if ms > lastID.Ms {
+			return stream.ID{Ms: ms}, nil
+		}
+		id, ok := lastID.Next()
+		if !ok {
+			return id, protocol.MakeErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	}
+	if strings.HasSuffix(rawID, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(rawID, "-*"), 10, 64)
+		if err != nil {
+			return stream.ID{}, protocol.MakeErrReply(stream.ErrInvalidID.Error())
+		}
+		switch {
+		case ms > lastID.Ms:
+			return stream.ID{Ms: ms}, nil
+		case ms < lastID.Ms:
+			return stream.ID{}, tooSmall
+		}
+		id, ok := lastID.Next()
+		if !ok || id.Ms != ms {
+			return stream.ID{}, tooSmall
+		}
+		return id, nil
+	}
+	id, errReply := parseStreamID([]byte(rawID), 0)
+	if errReply != nil {
+		return id, errReply
+	}
+	if id.IsZero() {
+		return id, protocol.MakeErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !lastID.Less(id) {
+		return id, tooSmall
+	}
+	return id, nil
+}
+
+func execStreamRange(db *DB, args [][]byte, desc bool) client.Reply {
+	key := string(args[0])
+	startArg, endArg := args[1], args[2]
+	if desc {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseIntervalID(startArg, 0, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseIntervalID(endArg, stream.MaxID.Seq, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(-1)
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		count, errReply = parseInt(args[4])
+		if errReply != nil {
+			return errReply
+		}
+		if count < 0 {
+			count = 0
+		}
+	}
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || count == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return makeStreamEntriesReply(s.Range(start, end, count, desc))
+}
+
+// execXRange returns entries in the range of IDs
+func execXRange(db *DB, args [][]byte) client.Reply {
+	return execStreamRange(db, args, false)
+}
+
+// execXRevRange returns entries in the range of IDs in descending order, the end ID is given first
+func execXRevRange(db *DB, args [][]byte) client.Reply {
+	return execStreamRange(db, args, true)
+}
+
+// execXLen returns the number of entries
+func execXLen(db *DB, args [][]byte) client.Reply {
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(s.Len())
+}
+
+// execXDel removes entries, returns the number of removed entries
+func execXDel(db *DB, args [][]byte) client.Reply {
+	ids := make([]stream.ID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	var deleted int64
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	return protocol.MakeIntReply(deleted)
+}
+
+// execXTrim removes the oldest entries by MAXLEN or MINID, returns the number of removed entries
+func execXTrim(db *DB, args [][]byte) client.Reply {
+	trimSpec := &streamTrimSpec{limit: -1}
+	for i := 1; i < len(args); {
+		consumed, errReply := trimSpec.parseOption(args, i)
+		if errReply != nil {
+			return errReply
+		}
+		if consumed == 0 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		i += consumed
+	}
+	if trimSpec.strategy == streamTrimNone {
+		return protocol.MakeSyntaxErrReply()
+	}
+	if errReply := trimSpec.validate(); errReply != nil {
+		return errReply
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(trimSpec.trim(s))
+}
+
+// execXSetID sets the last ID of stream, and optionally the entries added and max deleted ID
+func execXSetID(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	lastID, errReply := parseStreamID(args[1], 0)
+	if errReply != nil {
+		return errReply
+	}
+	entriesAdded := int64(-1)
+	var maxDeletedID *stream.ID
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "ENTRIESADDED":
+			entriesAdded, errReply = parseInt(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			if entriesAdded < 0 {
+				return protocol.MakeErrReply("ERR entries_added must be positive")
+			}
+		case "MAXDELETEDID":
+			id, errReply := parseStreamID(args[i+1], 0)
+			if errReply != nil {
+				return errReply
+			}
+			if lastID.Less(id) {
+				return protocol.MakeErrReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			maxDeletedID = &id
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	if entriesAdded >= 0 && entriesAdded < s.Len() {
+		return protocol.MakeErrReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	if last, ok := s.Last(); ok && lastID.Less(last.ID) {
+		return protocol.MakeErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded < 0 {
+		entriesAdded = s.EntriesAdded()
+	}
+	if maxDeletedID == nil {
+		id := s.MaxDeletedID()
+		maxDeletedID = &id
+	}
+	s.SetMeta(lastID, entriesAdded, *maxDeletedID)
+	return protocol.MakeOkReply()
+}
+
+/* ---- XREAD and XREADGROUP ---- */
+
+// xreadSpec is the arguments of XREAD and XREADGROUP
+type xreadSpec struct {
+	group    string
+	consumer string
+	count    int64
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	ids      [][]byte
+}
+
+func parseXRead(args [][]byte, isGroup bool) (*xreadSpec, protocol.ErrorReply) {
+	cmdName := "xread"
+	if isGroup {
+		cmdName = "xreadgroup"
+	}
+	spec := &xreadSpec{}
+	hasGroup := false
+	i := 0
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if opt == "STREAMS" {
+			break
+		}
+		switch {
+		case opt == "COUNT" && i+1 < len(args):
+			count, errReply := parseInt(args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			if count < 0 {
+				count = 0
+			}
+			spec.count = count
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, protocol.MakeErrReply("ERR timeout is negative")
+			}
+			spec.block = true
+			spec.timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case opt == "GROUP" && isGroup && i+2 < len(args):
+			spec.group, spec.consumer = string(args[i+1]), string(args[i+2])
+			hasGroup = true
+			i += 2
+		case opt == "NOACK" && isGroup:
+			spec.noAck = true
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if i >= len(args) {
+		return nil, protocol.MakeSyntaxErrReply()
+	}
+	if isGroup && !hasGroup {
+		return nil, protocol.MakeErrReply("ERR Missing GROUP option for XREADGROUP")
+	}
+	rest := args[i+1:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, protocol.MakeErrReply("ERR Unbalanced '" + cmdName +
+			"' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	half := len(rest) / 2
+	spec.keys = make([]string, 0, half)
+	for _, key := range rest[:half] {
+		spec.keys = append(spec.keys, string(key))
+	}
+	spec.ids = rest[half:]
+	for _, id := range spec.ids {
+		switch string(id) {
+		case "$":
+			if isGroup {
+				return nil, protocol.MakeErrReply("ERR The $ ID is meaningless in the context of XREADGROUP: " +
+					"you want to read the history of this consumer by specifying a proper ID, or use the > ID " +
+					"to get new messages. The $ ID would just return an empty result set.")
+			}
+		case ">":
+			if !isGroup {
+				return nil, protocol.MakeErrReply("ERR The > ID can be specified only when calling XREADGROUP " +
+					"using the GROUP <group> <consumer> option.")
+			}
+		default:
+			if _, errReply := parseStreamID(id, 0); errReply != nil {
+				return nil, errReply
+			}
+		}
+	}
+	return spec, nil
+}
+
+// parseXReadOp parses XREAD which reads entries after the given IDs of streams,
+// it blocks until one of the streams has new entries if BLOCK option is given
+func parseXReadOp(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	spec, errReply := parseXRead(args, false)
+	if errReply != nil {
+		return nil, errReply
+	}
+	after := make([]stream.ID, len(spec.keys))
+	resolved := false
+	serve := func(db *DB, _ string) (client.Reply, bool) {
+		if !resolved {
+			// "$" means the last ID when the command is executed, not when the client is served
+			for i, key := range spec.keys {
+				if string(spec.ids[i]) != "$" {
+					after[i], _ = parseStreamID(spec.ids[i], 0)
+					continue
+				}
+				s, errReply := db.getAsStream(key)
+				if errReply != nil {
+					return errReply, true
+				}
+				if s != nil {
+					after[i] = s.LastID()
+				}
+			}
+			resolved = true
+		}
+		var replies []client.Reply
+		for i, key := range spec.keys {
+			s, errReply := db.getAsStream(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if s == nil {
+				continue
+			}
+			start, ok := after[i].Next()
+			if !ok {
+				continue
+			}
+			entries := s.Range(start, stream.MaxID, spec.count, false)
+			if len(entries) == 0 {
+				continue
+			}
+			replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeBulkReply([]byte(key)),
+				makeStreamEntriesReply(entries),
+			}))
+		}
+		if len(replies) == 0 {
+			return nil, false
+		}
+		return protocol.MakeMultiRawReply(replies), true
+	}
+	return &blockingOp{
+		keys:         spec.keys,
+		extraKeys:    spec.keys,
+		timeout:      spec.timeout,
+		serve:        serve,
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+		perWaiter:    true,
+		readOnly:     true,
+		noBlock:      !spec.block,
+	}, nil
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	spec, errReply := parseXRead(args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, spec.keys
+}
+
+// parseXReadGroupOp parses XREADGROUP which reads entries as a consumer of group.
+// ">" reads entries never delivered to group and may block, other IDs read the pending entries of consumer.
+func parseXReadGroupOp(args [][]byte) (*blockingOp, protocol.ErrorReply) {
+	spec, errReply := parseXRead(args, true)
+	if errReply != nil {
+		return nil, errReply
+	}
+	history := false
+	for _, id := range spec.ids {
+		if string(id) != ">" {
+			history = true
+		}
+	}
+	serve := func(db *DB, _ string) (client.Reply, bool) {
+		now := nowMillis()
+		var replies []client.Reply
+		for i, key := range spec.keys {
+			s, errReply := db.getAsStream(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			var group *stream.Group
+			if s != nil {
+				group, _ = s.Group(spec.group)
+			}
+			if group == nil {
+				return protocol.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" +
+					spec.group + "' in XREADGROUP with GROUP option"), true
+			}
+			consumer, _ := group.CreateConsumer(spec.consumer, now)
+			consumer.SeenTime = now
+			var entriesReply client.Reply
+			if string(spec.ids[i]) == ">" {
+				entries := s.ReadGroup(group, consumer, spec.count, spec.noAck, now)
+				if len(entries) == 0 {
+					continue
+				}
+				consumer.ActiveTime = now
+				entriesReply = makeStreamEntriesReply(entries)
+			} else {
+				after, _ := parseStreamID(spec.ids[i], 0)
+				entriesReply = readConsumerHistory(s, group, consumer, after, spec.count, now)
+			}
+			replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeBulkReply([]byte(key)),
+				entriesReply,
+			}))
+		}
+		if len(replies) == 0 {
+			return nil, false
+		}
+		return protocol.MakeMultiRawReply(replies), true
+	}
+	return &blockingOp{
+		keys:         spec.keys,
+		extraKeys:    spec.keys,
+		timeout:      spec.timeout,
+		serve:        serve,
+		timeoutReply: protocol.MakeNullMultiBulkReply(),
+		perWaiter:    true,
+		// reading history never blocks
+		noBlock: !spec.block || history,
+	}, nil
+}
+
+// readConsumerHistory replies pending entries of consumer after the given ID, and increases their delivery count.
+// Entries deleted from stream are replied with nil fields
+func readConsumerHistory(s *stream.Stream, group *stream.Group, consumer *stream.Consumer,
+	after stream.ID, count int64, now int64) client.Reply {
+	start, ok := after.Next()
+	if !ok {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	var replies []client.Reply
+	group.ForEachPending(start, stream.MaxID, func(pending *stream.PendingEntry) bool {
+		if pending.Consumer != consumer {
+			return true
+		}
+		pending.DeliveryTime = now
+		pending.DeliveryCount++
+		if entry, ok := s.Get(pending.ID); ok {
+			replies = append(replies, makeStreamEntryReply(entry))
+		} else {
+			replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+				makeStreamIDReply(pending.ID),
+				protocol.MakeNullMultiBulkReply(),
+			}))
+		}
+		return count <= 0 || int64(len(replies)) < count
+	})
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	spec, errReply := parseXRead(args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return spec.keys, nil
+}
+
+/* ---- consumer groups ---- */
+
+func makeXGroupSyntaxErr(subCmd string) protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" + subCmd + "'. Try XGROUP HELP.")
+}
+
+// parseGroupLastID parses the last delivered ID of group, "$" means the last ID of stream
+func parseGroupLastID(s *stream.Stream, raw []byte) (stream.ID, protocol.ErrorReply) {
+	if string(raw) == "$" {
+		if s == nil {
+			return stream.MinID, nil
+		}
+		return s.LastID(), nil
+	}
+	return parseStreamID(raw, 0)
+}
+
+func parseEntriesRead(args [][]byte, i int) (int64, protocol.ErrorReply) {
+	if i+1 >= len(args) || strings.ToUpper(string(args[i])) != "ENTRIESREAD" {
+		return 0, protocol.MakeSyntaxErrReply()
+	}
+	entriesRead, errReply := parseInt(args[i+1])
+	if errReply != nil {
+		return 0, errReply
+	}
+	if entriesRead < -1 {
+		return 0, protocol.MakeErrReply("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return entriesRead, nil
+}
+
+// execXGroup manages consumer groups by subcommands CREATE, SETID, DESTROY, CREATECONSUMER and DELCONSUMER
+func execXGroup(db *DB, args [][]byte) client.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	var minArgs, maxArgs int
+	switch subCmd {
+	case "CREATE":
+		minArgs, maxArgs = 4, 7
+	case "SETID":
+		minArgs, maxArgs = 4, 6
+	case "DESTROY":
+		minArgs, maxArgs = 3, 3
+	case "CREATECONSUMER", "DELCONSUMER":
+		minArgs, maxArgs = 4, 4
+	default:
+		return makeXGroupSyntaxErr(string(args[0]))
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		return makeXGroupSyntaxErr(string(args[0]))
+	}
+	key, groupName := string(args[1]), string(args[2])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	if subCmd == "CREATE" {
+		mkStream := false
+		entriesRead := int64(-1)
+		for i := 4; i < len(args); i++ {
+			if strings.ToUpper(string(args[i])) == "MKSTREAM" {
+				mkStream = true
+				continue
+			}
+			entriesRead, errReply = parseEntriesRead(args, i)
+			if errReply != nil {
+				return errReply
+			}
+			i++
+		}
+		lastID, errReply := parseGroupLastID(s, args[3])
+		if errReply != nil {
+			return errReply
+		}
+		if s == nil {
+			if !mkStream {
+				return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+					"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			}
+			s = stream.New()
+			db.PutEntity(key, &IDB.DataEntity{Data: s})
+		}
+		if _, ok := s.CreateGroup(groupName, lastID, entriesRead); !ok {
+			return protocol.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+		}
+		return protocol.MakeOkReply()
+	}
+
+	if s == nil {
+		return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+			"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+	if subCmd == "DESTROY" {
+		if s.DestroyGroup(groupName) {
+			return protocol.MakeIntReply(1)
+		}
+		return protocol.MakeIntReply(0)
+	}
+	group, ok := s.Group(groupName)
+	if !ok {
+		return protocol.MakeErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	switch subCmd {
+	case "SETID":
+		lastID, errReply := parseGroupLastID(s, args[3])
+		if errReply != nil {
+			return errReply
+		}
+		entriesRead := int64(-1)
+		if len(args) > 4 {
+			if entriesRead, errReply = parseEntriesRead(args, 4); errReply != nil {
+				return errReply
+			}
+		}
+		group.LastID = lastID
+		group.EntriesRead = entriesRead
+		return protocol.MakeOkReply()
+	case "CREATECONSUMER":
+		if _, created := group.CreateConsumer(string(args[3]), nowMillis()); created {
+			return protocol.MakeIntReply(1)
+		}
+		return protocol.MakeIntReply(0)
+	default: // DELCONSUMER
+		return protocol.MakeIntReply(group.DeleteConsumer(string(args[3])))
+	}
+}
+
+func prepareStreamSubCmd(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(db *DB, args [][]byte) []router.CmdLine {
+	if len(args) < 2 {
+		return nil
+	}
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+// getGroup returns the consumer group of stream, replies NOGROUP error if the stream or group does not exist
+func (db *DB) getGroup(key, groupName string) (*stream.Stream, *stream.Group, protocol.ErrorReply) {
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if s == nil {
+		return nil, nil, makeNoGroupErr(key, groupName)
+	}
+	group, ok := s.Group(groupName)
+	if !ok {
+		return nil, nil, makeNoGroupErr(key, groupName)
+	}
+	return s, group, nil
+}
+
+// execXAck removes entries from the pending entries list of group, returns the number of acknowledged entries
+func execXAck(db *DB, args [][]byte) client.Reply {
+	ids := make([]stream.ID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	group, ok := s.Group(string(args[1]))
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	var acked int64
+	for _, id := range ids {
+		if group.RemovePending(id) {
+			acked++
+		}
+	}
+	return protocol.MakeIntReply(acked)
+}
+
+// execXPending returns the summary of pending entries of group,
+// or the detail of pending entries in the range if start, end and count are given
+func execXPending(db *DB, args [][]byte) client.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	extended := len(args) > 2
+	var minIdle, count int64
+	var start, end stream.ID
+	var consumerName string
+	if extended {
+		i := 2
+		if strings.ToUpper(string(args[i])) == "IDLE" {
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply protocol.ErrorReply
+			if minIdle, errReply = parseInt(args[i+1]); errReply != nil {
+				return errReply
+			}
+			i += 2
+		}
+		if len(args)-i < 3 || len(args)-i > 4 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var errReply protocol.ErrorReply
+		if start, errReply = parseIntervalID(args[i], 0, true); errReply != nil {
+			return errReply
+		}
+		if end, errReply = parseIntervalID(args[i+1], stream.MaxID.Seq, false); errReply != nil {
+			return errReply
+		}
+		if count, errReply = parseInt(args[i+2]); errReply != nil {
+			return errReply
+		}
+		if count < 0 {
+			count = 0
+		}
+		if len(args)-i == 4 {
+			consumerName = string(args[i+3])
+		}
+	}
+	_, group, errReply := db.getGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+
+	if !extended {
+		if group.PendingLen() == 0 {
+			return protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeIntReply(0),
+				protocol.MakeNullBulkReply(),
+				protocol.MakeNullBulkReply(),
+				protocol.MakeNullMultiBulkReply(),
+			})
+		}
+		var first, last stream.ID
+		found := false
+		group.ForEachPending(stream.MinID, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			if !found {
+				first, found = pending.ID, true
+			}
+			last = pending.ID
+			return true
+		})
+		var consumerReplies []client.Reply
+		for _, consumer := range group.Consumers() {
+			if consumer.Pending == 0 {
+				continue
+			}
+			consumerReplies = append(consumerReplies, protocol.MakeMultiBulkReply([][]byte{
+				[]byte(consumer.Name),
+				[]byte(strconv.FormatInt(consumer.Pending, 10)),
+			}))
+		}
+		return protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeIntReply(int64(group.PendingLen())),
+			makeStreamIDReply(first),
+			makeStreamIDReply(last),
+			protocol.MakeMultiRawReply(consumerReplies),
+		})
+	}
+
+	var consumer *stream.Consumer
+	if consumerName != "" {
+		var ok bool
+		if consumer, ok = group.Consumer(consumerName); !ok {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+	if count == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	now := nowMillis()
+	var replies []client.Reply
+	group.ForEachPending(start, end, func(pending *stream.PendingEntry) bool {
+		if consumer != nil && pending.Consumer != consumer {
+			return true
+		}
+		idle := now - pending.DeliveryTime
+		if idle < minIdle {
+			return true
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+			makeStreamIDReply(pending.ID),
+			protocol.MakeBulkReply([]byte(pending.Consumer.Name)),
+			protocol.MakeIntReply(idle),
+			protocol.MakeIntReply(pending.DeliveryCount),
+		}))
+		return int64(len(replies)) < count
+	})
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execXClaim transfers the ownership of pending entries idle for at least min-idle-time to consumer
+func execXClaim(db *DB, args [][]byte) client.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	// IDs are followed by options
+	i := 4
+	var ids []stream.ID
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return protocol.MakeErrReply(stream.ErrInvalidID.Error())
+	}
+	now := nowMillis()
+	deliveryTime := int64(-1)
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		hasValue := i+1 < len(args)
+		var errReply protocol.ErrorReply
+		switch {
+		case opt == "FORCE":
+			force = true
+		case opt == "JUSTID":
+			justID = true
+		case opt == "IDLE" && hasValue:
+			var idle int64
+			if idle, errReply = parseInt(args[i+1]); errReply != nil {
+				return errReply
+			}
+			deliveryTime = now - idle
+			i++
+		case opt == "TIME" && hasValue:
+			if deliveryTime, errReply = parseInt(args[i+1]); errReply != nil {
+				return errReply
+			}
+			i++
+		case opt == "RETRYCOUNT" && hasValue:
+			if retryCount, errReply = parseInt(args[i+1]); errReply != nil {
+				return errReply
+			}
+			i++
+		case opt == "LASTID" && hasValue:
+			id, errReply := parseStreamID(args[i+1], 0)
+			if errReply != nil {
+				return errReply
+			}
+			lastID = &id
+			i++
+		default:
+			return protocol.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	if deliveryTime < 0 || deliveryTime > now {
+		// TIME in the future is not allowed
+		deliveryTime = now
+	}
+	s, group, errReply := db.getGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+	}
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+
+	var replies []client.Reply
+	for _, id := range ids {
+		entry, exists := s.Get(id)
+		pending, ok := group.GetPending(id)
+		if !ok {
+			if !force || !exists {
+				continue
+			}
+			pending = group.AddPending(id, consumer, now)
+		} else if !exists {
+			// the entry is deleted, clear it from pending entries list
+			group.RemovePending(id)
+			continue
+		} else if minIdle > 0 && now-pending.DeliveryTime < minIdle {
+			continue
+		}
+		group.Assign(pending, consumer)
+		pending.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pending.DeliveryCount = retryCount
+		} else if !justID {
+			pending.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		if justID {
+			replies = append(replies, makeStreamIDReply(id))
+		} else {
+			replies = append(replies, makeStreamEntryReply(entry))
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execXAutoClaim claims pending entries idle for at least min-idle-time, scanning from start like SCAN.
+// It replies the cursor for the next call, claimed entries and IDs of deleted entries removed from PEL
+func execXAutoClaim(db *DB, args [][]byte) client.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, errReply := parseIntervalID(args[4], 0, true)
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(streamAutoClaimCount)
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); {
+		case opt == "JUSTID":
+			justID = true
+		case opt == "COUNT" && i+1 < len(args):
+			if count, errReply = parseInt(args[i+1]); errReply != nil {
+				return errReply
+			}
+			if count < 1 || count > streamAutoClaimCount*1000 {
+				return protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	s, group, errReply := db.getGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	now := nowMillis()
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+
+	// collect first, pending entries list must not be modified during iterating
+	attempts := count * 10
+	next := stream.MinID
+	var claimed []*stream.PendingEntry
+	var deleted []stream.ID
+	group.ForEachPending(start, stream.MaxID, func(pending *stream.PendingEntry) bool {
+		if attempts == 0 || count == 0 {
+			next = pending.ID
+			return false
+		}
+		attempts--
+		if _, exists := s.Get(pending.ID); !exists {
+			deleted = append(deleted, pending.ID)
+			return true
+		}
+		if minIdle > 0 && now-pending.DeliveryTime < minIdle {
+			return true
+		}
+		claimed = append(claimed, pending)
+		count--
+		return true
+	})
+
+	for _, id := range deleted {
+		group.RemovePending(id)
+	}
+	entryReplies := make([]client.Reply, 0, len(claimed))
+	for _, pending := range claimed {
+		group.Assign(pending, consumer)
+		pending.DeliveryTime = now
+		if justID {
+			entryReplies = append(entryReplies, makeStreamIDReply(pending.ID))
+			continue
+		}
+		pending.DeliveryCount++
+		entry, _ := s.Get(pending.ID)
+		entryReplies = append(entryReplies, makeStreamEntryReply(entry))
+	}
+	if len(claimed) > 0 {
+		consumer.ActiveTime = now
+	}
+	deletedReplies := make([][]byte, 0, len(deleted))
+	for _, id := range deleted {
+		deletedReplies = append(deletedReplies, []byte(id.String()))
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		makeStreamIDReply(next),
+		protocol.MakeMultiRawReply(entryReplies),
+		protocol.MakeMultiBulkReply(deletedReplies),
+	})
+}
+
+/* ---- XINFO ---- */
+
+// execXInfo returns information of stream by subcommands STREAM, GROUPS and CONSUMERS
+func execXInfo(db *DB, args [][]byte) client.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	syntaxErr := protocol.MakeErrReply("ERR unknown subcommand or wrong number of arguments for '" +
+		string(args[0]) + "'. Try XINFO HELP.")
+	switch subCmd {
+	case "STREAM":
+		if len(args) < 2 {
+			return syntaxErr
+		}
+	case "GROUPS":
+		if len(args) != 2 {
+			return syntaxErr
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return syntaxErr
+		}
+	default:
+		return syntaxErr
+	}
+	key := string(args[1])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	switch subCmd {
+	case "GROUPS":
+		replies := make([]client.Reply, 0, len(s.Groups()))
+		for _, group := range s.Groups() {
+			replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeBulkReply([]byte("name")), protocol.MakeBulkReply([]byte(group.Name)),
+				protocol.MakeBulkReply([]byte("consumers")), protocol.MakeIntReply(int64(len(group.Consumers()))),
+				protocol.MakeBulkReply([]byte("pending")), protocol.MakeIntReply(int64(group.PendingLen())),
+				protocol.MakeBulkReply([]byte("last-delivered-id")), makeStreamIDReply(group.LastID),
+				protocol.MakeBulkReply([]byte("entries-read")), makeEntriesReadReply(group),
+				protocol.MakeBulkReply([]byte("lag")), makeLagReply(s, group),
+			}))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "CONSUMERS":
+		group, ok := s.Group(string(args[2]))
+		if !ok {
+			return protocol.MakeErrReply("NOGROUP No such consumer group '" + string(args[2]) +
+				"' for key name '" + key + "'")
+		}
+		now := nowMillis()
+		consumers := group.Consumers()
+		replies := make([]client.Reply, 0, len(consumers))
+		for _, consumer := range consumers {
+			inactive := int64(-1)
+			if consumer.ActiveTime >= 0 {
+				inactive = now - consumer.ActiveTime
+			}
+			replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeBulkReply([]byte("name")), protocol.MakeBulkReply([]byte(consumer.Name)),
+				protocol.MakeBulkReply([]byte("pending")), protocol.MakeIntReply(consumer.Pending),
+				protocol.MakeBulkReply([]byte("idle")), protocol.MakeIntReply(now - consumer.SeenTime),
+				protocol.MakeBulkReply([]byte("inactive")), protocol.MakeIntReply(inactive),
+			}))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	}
+
+	if len(args) == 2 {
+		return makeStreamInfoReply(s)
+	}
+	if strings.ToUpper(string(args[2])) != "FULL" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	count := int64(streamInfoFullCount)
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		if count, errReply = parseInt(args[4]); errReply != nil {
+			return errReply
+		}
+		if count < 0 {
+			count = 0
+		}
+	}
+	return makeStreamFullInfoReply(s, count)
+}
+
+func makeEntriesReadReply(group *stream.Group) client.Reply {
+	if group.EntriesRead < 0 {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeIntReply(group.EntriesRead)
+}
+
+func makeLagReply(s *stream.Stream, group *stream.Group) client.Reply {
+	lag, ok := s.Lag(group)
+	if !ok {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeIntReply(lag)
+}
+
+// makeStreamMetaReplies returns the fields shared by XINFO STREAM and XINFO STREAM FULL
+func makeStreamMetaReplies(s *stream.Stream) []client.Reply {
+	return []client.Reply{
+		protocol.MakeBulkReply([]byte("length")), protocol.MakeIntReply(s.Len()),
+		protocol.MakeBulkReply([]byte("radix-tree-keys")), protocol.MakeIntReply(int64(s.NodeCount())),
+		protocol.MakeBulkReply([]byte("radix-tree-nodes")), protocol.MakeIntReply(int64(s.NodeCount())),
+		protocol.MakeBulkReply([]byte("last-generated-id")), makeStreamIDReply(s.LastID()),
+		protocol.MakeBulkReply([]byte("max-deleted-entry-id")), makeStreamIDReply(s.MaxDeletedID()),
+		protocol.MakeBulkReply([]byte("entries-added")), protocol.MakeIntReply(s.EntriesAdded()),
+		protocol.MakeBulkReply([]byte("recorded-first-entry-id")), makeStreamIDReply(s.FirstID()),
+	}
+}
+
+func makeStreamInfoReply(s *stream.Stream) client.Reply {
+	replies := makeStreamMetaReplies(s)
+	replies = append(replies, protocol.MakeBulkReply([]byte("groups")), protocol.MakeIntReply(int64(len(s.Groups()))))
+	replies = append(replies, protocol.MakeBulkReply([]byte("first-entry")))
+	if entry, ok := s.First(); ok {
+		replies = append(replies, makeStreamEntryReply(entry))
+	} else {
+		replies = append(replies, protocol.MakeNullBulkReply())
+	}
+	replies = append(replies, protocol.MakeBulkReply([]byte("last-entry")))
+	if entry, ok := s.Last(); ok {
+		replies = append(replies, makeStreamEntryReply(entry))
+	} else {
+		replies = append(replies, protocol.MakeNullBulkReply())
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// makeStreamFullInfoReply returns entries, groups, pending entries and consumers, count limits the length of lists
+func makeStreamFullInfoReply(s *stream.Stream, count int64) client.Reply {
+	replies := makeStreamMetaReplies(s)
+	replies = append(replies, protocol.MakeBulkReply([]byte("entries")),
+		makeStreamEntriesReply(s.Range(stream.MinID, stream.MaxID, count, false)))
+	groups := s.Groups()
+	groupReplies := make([]client.Reply, 0, len(groups))
+	for _, group := range groups {
+		var pendingReplies []client.Reply
+		consumerPending := make(map[*stream.Consumer][]client.Reply)
+		group.ForEachPending(stream.MinID, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			if count == 0 || int64(len(pendingReplies)) < count {
+				pendingReplies = append(pendingReplies, protocol.MakeMultiRawReply([]client.Reply{
+					makeStreamIDReply(pending.ID),
+					protocol.MakeBulkReply([]byte(pending.Consumer.Name)),
+					protocol.MakeIntReply(pending.DeliveryTime),
+					protocol.MakeIntReply(pending.DeliveryCount),
+				}))
+			}
+			if count == 0 || int64(len(consumerPending[pending.Consumer])) < count {
+				consumerPending[pending.Consumer] = append(consumerPending[pending.Consumer],
+					protocol.MakeMultiRawReply([]client.Reply{
+						makeStreamIDReply(pending.ID),
+						protocol.MakeIntReply(pending.DeliveryTime),
+						protocol.MakeIntReply(pending.DeliveryCount),
+					}))
+			}
+			return true
+		})
+		consumers := group.Consumers()
+		consumerReplies := make([]client.Reply, 0, len(consumers))
+		for _, consumer := range consumers {
+			consumerReplies = append(consumerReplies, protocol.MakeMultiRawReply([]client.Reply{
+				protocol.MakeBulkReply([]byte("name")), protocol.MakeBulkReply([]byte(consumer.Name)),
+				protocol.MakeBulkReply([]byte("seen-time")), protocol.MakeIntReply(consumer.SeenTime),
+				protocol.MakeBulkReply([]byte("active-time")), protocol.MakeIntReply(consumer.ActiveTime),
+				protocol.MakeBulkReply([]byte("pel-count")), protocol.MakeIntReply(consumer.Pending),
+				protocol.MakeBulkReply([]byte("pending")), protocol.MakeMultiRawReply(consumerPending[consumer]),
+			}))
+		}
+		groupReplies = append(groupReplies, protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeBulkReply([]byte("name")), protocol.MakeBulkReply([]byte(group.Name)),
+			protocol.MakeBulkReply([]byte("last-delivered-id")), makeStreamIDReply(group.LastID),
+			protocol.MakeBulkReply([]byte("entries-read")), makeEntriesReadReply(group),
+			protocol.MakeBulkReply([]byte("lag")), makeLagReply(s, group),
+			protocol.MakeBulkReply([]byte("pel-count")), protocol.MakeIntReply(int64(group.PendingLen())),
+			protocol.MakeBulkReply([]byte("pending")), protocol.MakeMultiRawReply(pendingReplies),
+			protocol.MakeBulkReply([]byte("consumers")), protocol.MakeMultiRawReply(consumerReplies),
+		}))
+	}
+	replies = append(replies, protocol.MakeBulkReply([]byte("groups")), protocol.MakeMultiRawReply(groupReplies))
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func prepareXInfo(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+/* ---- serialization ---- */
+
+// streamToCmdLines serializes stream to command lines rebuilding entries, groups and pending entries.
+// Pending entries whose stream entry has been deleted can not be rebuilt by XCLAIM, they are dropped
+func streamToCmdLines(key string, s *stream.Stream) []router.CmdLine {
+	var cmdLines []router.CmdLine
+	if s.Len() == 0 {
+		// create an empty stream, its meta is set by XSETID below
+		cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDXAdd, key, "MAXLEN", "0", "0-1", "", ""))
+	}
+	s.ForEach(stream.MinID, stream.MaxID, false, func(entry *stream.Entry) bool {
+		cmdLine := make([][]byte, 0, 3+len(entry.Fields))
+		cmdLine = append(cmdLine, []byte(consts.CMDXAdd), []byte(key), []byte(entry.ID.String()))
+		cmdLine = append(cmdLine, entry.Fields...)
+		cmdLines = append(cmdLines, cmdLine)
+		return true
+	})
+	cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDXSetID, key, s.LastID().String(),
+		"ENTRIESADDED", strconv.FormatInt(s.EntriesAdded(), 10),
+		"MAXDELETEDID", s.MaxDeletedID().String()))
+	for _, group := range s.Groups() {
+		cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDXGroup, "CREATE", key, group.Name,
+			group.LastID.String(), "ENTRIESREAD", strconv.FormatInt(group.EntriesRead, 10)))
+		for _, consumer := range group.Consumers() {
+			cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDXGroup, "CREATECONSUMER", key, group.Name, consumer.Name))
+		}
+		group.ForEachPending(stream.MinID, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDXClaim, key, group.Name, pending.Consumer.Name, "0",
+				pending.ID.String(), "TIME", strconv.FormatInt(pending.DeliveryTime, 10),
+				"RETRYCOUNT", strconv.FormatInt(pending.DeliveryCount, 10), "FORCE", "JUSTID"))
+			return true
+		})
+	}
+	return cmdLines
+}
+
+func init() {
+	registerCommand(consts.CMDXAdd, execXAdd, router.WriteFirstKey, rollbackFirstKey, -5, router.FlagWrite)
+	registerCommand(consts.CMDXRange, execXRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDXRevRange, execXRevRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDXLen, execXLen, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDXDel, execXDel, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDXTrim, execXTrim, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDXSetID, execXSetID, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerReadOnlyBlockingCommand(consts.CMDXRead, parseXReadOp, prepareXRead, -4)
+	registerBlockingCommand(consts.CMDXReadGroup, parseXReadGroupOp, prepareXReadGroup, -7)
+	registerCommand(consts.CMDXGroup, execXGroup, prepareStreamSubCmd, undoXGroup, -2, router.FlagWrite)
+	registerCommand(consts.CMDXAck, execXAck, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDXPending, execXPending, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDXClaim, execXClaim, router.WriteFirstKey, rollbackFirstKey, -6, router.FlagWrite)
+	registerCommand(consts.CMDXAutoClaim, execXAutoClaim, router.WriteFirstKey, rollbackFirstKey, -6, router.FlagWrite)
+	registerCommand(consts.CMDXInfo, execXInfo, prepareXInfo, nil, -2, router.FlagReadOnly)
+}
@@ -0,0 +1,173 @@
+package single_db
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+	"github.com/pluming/aurora/internal/database/protocol"
+)
+
+// pendingIdle matches idle times in the extended reply of XPENDING
+var pendingIdle = regexp.MustCompile(`(\*4 \$\d+ \S+ \$\d+ \S+ ):\d+`)
+
+// checkPending checks the extended reply of XPENDING with idle times replaced by 0, since they depend on timing
+func checkPending(t *testing.T, db *DB, line, expect string) {
+	t.Helper()
+	if got := pendingIdle.ReplaceAllString(run(db, line), "${1}:0"); got != expect {
+		t.Errorf("%s: expect %q, got %q", line, expect, got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "XADD s 1-1 a 1", "$3 1-1")
+	check(t, db, "XADD s 1-1 a 1", "-ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	check(t, db, "XADD s 0-0 a 1", "-ERR The ID specified in XADD must be greater than 0-0")
+	check(t, db, "XADD s 1-* b 2", "$3 1-2")
+	check(t, db, "XADD s 0-* b 2", "-ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	check(t, db, "XADD s 2 a 3 b 4", "$3 2-0")
+	check(t, db, "XADD s 3-0 a", "-ERR wrong number of arguments for 'XADD' command")
+	check(t, db, "XADD s abc a 1", "-ERR Invalid stream ID specified as stream command argument")
+	check(t, db, "XADD n NOMKSTREAM * a 1", "$-1")
+	check(t, db, "TYPE s", "+stream")
+	check(t, db, "XLEN s", ":3")
+	check(t, db, "XRANGE s - +", "*3 *2 $3 1-1 *2 $1 a $1 1 *2 $3 1-2 *2 $1 b $1 2 *2 $3 2-0 *4 $1 a $1 3 $1 b $1 4")
+	check(t, db, "XRANGE s (1-1 + COUNT 1", "*1 *2 $3 1-2 *2 $1 b $1 2")
+	check(t, db, "XREVRANGE s + - COUNT 2", "*2 *2 $3 2-0 *4 $1 a $1 3 $1 b $1 4 *2 $3 1-2 *2 $1 b $1 2")
+	check(t, db, "XRANGE s 1 1", "*2 *2 $3 1-1 *2 $1 a $1 1 *2 $3 1-2 *2 $1 b $1 2")
+	check(t, db, "XRANGE s - + COUNT 0", "*0")
+	check(t, db, "XDEL s 1-2 9-9", ":1")
+	check(t, db, "XINFO STREAM s", "*20 $6 length :2 $15 radix-tree-keys :1 $16 radix-tree-nodes :1 $17 last-generated-id $3 2-0 $20 max-deleted-entry-id $3 1-2 $13 entries-added :3 $23 recorded-first-entry-id $3 1-1 $6 groups :0 $11 first-entry *2 $3 1-1 *2 $1 a $1 1 $10 last-entry *2 $3 2-0 *4 $1 a $1 3 $1 b $1 4")
+	for i := 3; i < 10; i++ {
+		run(db, "XADD s "+strconv.Itoa(i)+" f v")
+	}
+	check(t, db, "XTRIM s MAXLEN 5", ":4")
+	check(t, db, "XRANGE s - + COUNT 1", "*1 *2 $3 5-0 *2 $1 f $1 v")
+	check(t, db, "XTRIM s MINID 7", ":2")
+	check(t, db, "XTRIM s MAXLEN ~ 1", ":0")
+	check(t, db, "XTRIM s MAXLEN 1 LIMIT 1", "-ERR syntax error, LIMIT cannot be used without the special ~ option")
+	check(t, db, "XTRIM s MAXLEN 1 MINID 1", "-ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	check(t, db, "XADD s MAXLEN = 2 10-* f v", "$4 10-0")
+	check(t, db, "XLEN s", ":2")
+	check(t, db, "XSETID s 1-0", "-ERR The ID specified in XSETID is smaller than the target stream top item")
+	check(t, db, "XSETID x 1-0", "-ERR no such key")
+	check(t, db, "SET str 1", "+OK")
+	check(t, db, "XADD str * a 1", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestStreamGroup(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "XGROUP CREATE s g $", "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	check(t, db, "XGROUP CREATE s g $ MKSTREAM", "+OK")
+	check(t, db, "XGROUP CREATE s g $", "-BUSYGROUP Consumer Group name already exists")
+	for i := 1; i <= 4; i++ {
+		run(db, "XADD s "+strconv.Itoa(i)+" f "+strconv.Itoa(i))
+	}
+	check(t, db, "XREADGROUP GROUP g alice COUNT 2 STREAMS s >", "*1 *2 $1 s *2 *2 $3 1-0 *2 $1 f $1 1 *2 $3 2-0 *2 $1 f $1 2")
+	check(t, db, "XREADGROUP GROUP g bob STREAMS s >", "*1 *2 $1 s *2 *2 $3 3-0 *2 $1 f $1 3 *2 $3 4-0 *2 $1 f $1 4")
+	check(t, db, "XREADGROUP GROUP g bob STREAMS s >", "*-1")
+	check(t, db, "XREADGROUP GROUP x bob STREAMS s >", "-NOGROUP No such key 's' or consumer group 'x' in XREADGROUP with GROUP option")
+	check(t, db, "XREADGROUP GROUP g bob STREAMS s $", "-ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+	check(t, db, "XREAD STREAMS s >", "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+	check(t, db, "XREAD STREAMS s t 0", "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	check(t, db, "XPENDING s g", "*4 :4 $3 1-0 $3 4-0 *2 *2 $5 alice $1 2 *2 $3 bob $1 2")
+	check(t, db, "XACK s g 1-0 1-0 9-0", ":1")
+	check(t, db, "XDEL s 2-0", ":1")
+	check(t, db, "XREADGROUP GROUP g alice STREAMS s 0", "*1 *2 $1 s *1 *2 $3 2-0 *-1")
+	checkPending(t, db, "XPENDING s g - + 10 alice", "*1 *4 $3 2-0 $5 alice :0 :2")
+	check(t, db, "XCLAIM s g carol 0 3-0 2-0 JUSTID", "*1 $3 3-0")
+	checkPending(t, db, "XPENDING s g - + 10", "*2 *4 $3 3-0 $5 carol :0 :1 *4 $3 4-0 $3 bob :0 :1")
+	check(t, db, "XCLAIM s g carol 100000 4-0", "*0")
+	check(t, db, "XAUTOCLAIM s g dave 0 0 COUNT 1", "*3 $3 4-0 *1 *2 $3 3-0 *2 $1 f $1 3 *0")
+	check(t, db, "XAUTOCLAIM s g dave 0 (3-0 JUSTID", "*3 $3 0-0 *1 $3 4-0 *0")
+	check(t, db, "XINFO GROUPS s", "*1 *12 $4 name $1 g $9 consumers :4 $7 pending :2 $17 last-delivered-id $3 4-0 $12 entries-read :4 $3 lag :0")
+	check(t, db, "XGROUP CREATECONSUMER s g erin", ":1")
+	check(t, db, "XGROUP CREATECONSUMER s g erin", ":0")
+	check(t, db, "XGROUP DELCONSUMER s g dave", ":2")
+	check(t, db, "XPENDING s g", "*4 :0 $-1 $-1 *-1")
+	check(t, db, "XGROUP SETID s g 0", "+OK")
+	check(t, db, "XREADGROUP GROUP g erin NOACK COUNT 1 STREAMS s >", "*1 *2 $1 s *1 *2 $3 1-0 *2 $1 f $1 1")
+	check(t, db, "XINFO GROUPS s", "*1 *12 $4 name $1 g $9 consumers :4 $7 pending :0 $17 last-delivered-id $3 1-0 $12 entries-read $-1 $3 lag $-1")
+	check(t, db, "XGROUP DESTROY s g", ":1")
+	check(t, db, "XGROUP DESTROY s g", ":0")
+	check(t, db, "XGROUP SETID s g 0", "-NOGROUP No such consumer group 'g' for key name 's'")
+	check(t, db, "XGROUP FOO s g", "-ERR unknown subcommand or wrong number of arguments for 'FOO'. Try XGROUP HELP.")
+}
+
+func TestStreamUndo(t *testing.T) {
+	db := MakeDB(0)
+	run(db, "XADD s 1 a 1")
+	run(db, "XADD s 2 b 2")
+	run(db, "XADD s 3 c 3")
+	run(db, "XDEL s 3")
+	run(db, "XGROUP CREATE s g 1")
+	run(db, "XREADGROUP GROUP g alice STREAMS s >")
+	run(db, "XGROUP CREATECONSUMER s g bob")
+	stream, groups, pending := run(db, "XINFO STREAM s"), run(db, "XINFO GROUPS s"), run(db, "XPENDING s g")
+	undo := rollbackGivenKeys(db, "s")
+	run(db, "XADD s 9 x y")
+	run(db, "XGROUP DESTROY s g")
+	for _, line := range undo {
+		if r := db.ExecNormalCommand(line); protocol.IsErrorReply(r) {
+			t.Error(string(r.ToBytes()))
+		}
+	}
+	check(t, db, "XINFO STREAM s", stream)
+	check(t, db, "XINFO GROUPS s", groups)
+	check(t, db, "XPENDING s g", pending)
+	check(t, db, "XGROUP CREATECONSUMER s g bob", ":0")
+
+	// an empty stream with groups is restored too
+	run(db, "XGROUP CREATE e g $ MKSTREAM")
+	replayUndo(t, db, "e")
+	check(t, db, "XINFO GROUPS e", "*1 *12 $4 name $1 g $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 0-0 $12 entries-read $-1 $3 lag :0")
+	check(t, db, "XLEN e", ":0")
+}
+
+func TestStreamBlocking(t *testing.T) {
+	db := MakeDB(0)
+	c1, c2, c3 := &tcp.FakeConn{}, &tcp.FakeConn{}, &tcp.FakeConn{}
+	run(db, "XADD s 1 a 1")
+	checkConn(t, db, c1, "XREAD STREAMS s 0", "*1 *2 $1 s *1 *2 $3 1-0 *2 $1 a $1 1")
+	checkConn(t, db, c1, "XREAD STREAMS s $", "*-1")
+	res1 := goConn(db, c1, "XREAD BLOCK 0 STREAMS t s $ $")
+	waitBlocked(t, db, 1)
+	// c2 is served at once though c1 is waiting for s
+	checkConn(t, db, c2, "XREAD BLOCK 0 STREAMS s 0", "*1 *2 $1 s *1 *2 $3 1-0 *2 $1 a $1 1")
+
+	run(db, "XGROUP CREATE s g $")
+	res2 := goConn(db, c2, "XREADGROUP GROUP g c2 BLOCK 0 STREAMS s >")
+	waitBlocked(t, db, 2)
+	res3 := goConn(db, c3, "XREADGROUP GROUP g c3 BLOCK 0 STREAMS s >")
+	waitBlocked(t, db, 3)
+	run(db, "XADD s 2 b 2")
+	expect := "*1 *2 $1 s *1 *2 $3 2-0 *2 $1 b $1 2"
+	if got := <-res1; got != expect {
+		t.Error(got)
+	}
+	if got := <-res2; got != expect {
+		t.Error(got)
+	}
+	// c3 is still blocked since the entry is delivered to c2
+	run(db, "XADD s 3 c 3")
+	if got := <-res3; got != "*1 *2 $1 s *1 *2 $3 3-0 *2 $1 c $1 3" {
+		t.Error(got)
+	}
+
+	start := time.Now()
+	checkConn(t, db, c1, "XREAD BLOCK 100 STREAMS s $", "*-1")
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expect blocking for 100ms")
+	}
+	res1 = goConn(db, c1, "XREAD BLOCK 0 STREAMS s $")
+	waitBlocked(t, db, 1)
+	db.AfterClientClose(c1)
+	<-res1
+	if !db.getBlocking().isEmpty() {
+		t.Error("expect no blocked clients")
+	}
+	check(t, db, "XREAD BLOCK -1 STREAMS s $", "-ERR timeout is negative")
+}
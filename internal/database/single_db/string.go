@@ -0,0 +1,632 @@
+package single_db
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+// maxStringSize is the max length of a string value, same as proto-max-bulk-len of redis
+const maxStringSize = 512 * 1024 * 1024
+
+const (
+	upsertPolicy = iota // default
+	insertPolicy        // set nx
+	updatePolicy        // set xx
+)
+
+// cloneString returns a copy of string value. Bitmap commands modify string values in place,
+// so values leaving the lock of key, e.g. in replies, should be copied
+func cloneString(bytes []byte) []byte {
+	if bytes == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(bytes)), bytes...)
+}
+
+func (db *DB) getAsString(key string) ([]byte, protocol.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	bytes, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return bytes, nil
+}
+
+// parseExpireTime converts the argument of EX/PX/EXAT/PXAT option into an absolute expire time,
+// the time in milliseconds must not overflow int64
+func parseExpireTime(option string, raw []byte, cmdName string) (time.Time, protocol.ErrorReply) {
+	val, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	invalidErr := protocol.MakeErrReply("ERR invalid expire time in '" + strings.ToLower(cmdName) + "' command")
+	if val <= 0 {
+		return time.Time{}, invalidErr
+	}
+	ms := val
+	switch option {
+	case "EX", "EXAT":
+		if val > math.MaxInt64/1000 {
+			return time.Time{}, invalidErr
+		}
+		ms = val * 1000
+	case "PX", "PXAT":
+	default:
+		return time.Time{}, protocol.MakeSyntaxErrReply()
+	}
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return time.Time{}, invalidErr
+		}
+		ms += now
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// execGet returns string value bound to the given key
+func execGet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply(cloneString(bytes))
+}
+
+// execSet sets string value and time to live to the given key
+func execSet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	value := args[1]
+	policy := upsertPolicy
+	returnOld := false
+	keepTTL := false
+	hasTTL := false
+	var expireTime time.Time
+
+	// parse options
+	for i := 2; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "NX":
+			if policy == updatePolicy {
+				return protocol.MakeSyntaxErrReply()
+			}
+			policy = insertPolicy
+		case "XX":
+			if policy == insertPolicy {
+				return protocol.MakeSyntaxErrReply()
+			}
+			policy = updatePolicy
+		case "GET":
+			returnOld = true
+		case "KEEPTTL":
+			if hasTTL {
+				return protocol.MakeSyntaxErrReply()
+			}
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || keepTTL || i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply protocol.ErrorReply
+			expireTime, errReply = parseExpireTime(arg, args[i+1], consts.CMDSet)
+			if errReply != nil {
+				return errReply
+			}
+			hasTTL = true
+			i++ // skip next arg
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	var old []byte
+	if returnOld {
+		var errReply protocol.ErrorReply
+		old, errReply = db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+
+	entity := &IDB.DataEntity{
+		Data: value,
+	}
+	var result int
+	switch policy {
+	case upsertPolicy:
+		db.PutEntity(key, entity)
+		result = 1
+	case insertPolicy:
+		result = db.PutIfAbsent(key, entity)
+	case updatePolicy:
+		result = db.PutIfExists(key, entity)
+	}
+	if result > 0 {
+		if hasTTL {
+			db.Expire(key, expireTime)
+		} else if !keepTTL {
+			db.Persist(key) // override ttl
+		}
+	}
+
+	if returnOld {
+		if old == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply(cloneString(old))
+	}
+	if result > 0 {
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeNullBulkReply()
+}
+
+// execSetNX sets string if not exists
+func execSetNX(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	value := args[1]
+	entity := &IDB.DataEntity{
+		Data: value,
+	}
+	result := db.PutIfAbsent(key, entity)
+	return protocol.MakeIntReply(int64(result))
+}
+
+// execSetEX sets string and its ttl in seconds
+func execSetEX(db *DB, args [][]byte) client.Reply {
+	return setWithTTL(db, args, "EX", consts.CMDSetEX)
+}
+
+// execPSetEX sets string and its ttl in milliseconds
+func execPSetEX(db *DB, args [][]byte) client.Reply {
+	return setWithTTL(db, args, "PX", consts.CMDPSetEX)
+}
+
+func setWithTTL(db *DB, args [][]byte, option string, cmdName string) client.Reply {
+	key := string(args[0])
+	value := args[2]
+	expireTime, errReply := parseExpireTime(option, args[1], cmdName)
+	if errReply != nil {
+		return errReply
+	}
+	entity := &IDB.DataEntity{
+		Data: value,
+	}
+	db.PutEntity(key, entity)
+	db.Expire(key, expireTime)
+	return protocol.MakeOkReply()
+}
+
+// execGetSet sets value of a string-type key and returns its old value
+func execGetSet(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	value := args[1]
+
+	old, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: value})
+	db.Persist(key) // override ttl
+	if old == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply(old)
+}
+
+// execGetDel gets value of a string-type key and deletes the key
+func execGetDel(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+
+	old, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	db.Remove(key)
+	return protocol.MakeBulkReply(old)
+}
+
+// execGetEX gets value of a string-type key and optionally modifies its ttl
+func execGetEX(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	persist := false
+	hasTTL := false
+	var expireTime time.Time
+
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "PERSIST":
+			if hasTTL {
+				return protocol.MakeSyntaxErrReply()
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || persist || i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply protocol.ErrorReply
+			expireTime, errReply = parseExpireTime(arg, args[i+1], consts.CMDGetEX)
+			if errReply != nil {
+				return errReply
+			}
+			hasTTL = true
+			i++ // skip next arg
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	if hasTTL {
+		db.Expire(key, expireTime)
+	} else if persist {
+		db.Persist(key)
+	}
+	return protocol.MakeBulkReply(cloneString(bytes))
+}
+
+// execMSet sets multi key-value in database
+func execMSet(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 0 {
+		return protocol.MakeArgNumErrReply(strings.ToLower(consts.CMDMSet))
+	}
+
+	size := len(args) / 2
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		value := args[2*i+1]
+		db.PutEntity(key, &IDB.DataEntity{Data: value})
+		db.Persist(key)
+	}
+	return protocol.MakeOkReply()
+}
+
+func prepareMSet(args [][]byte) ([]string, []string) {
+	size := len(args) / 2
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+	}
+	return keys, nil
+}
+
+func undoMSet(db *DB, args [][]byte) []router.CmdLine {
+	writeKeys, _ := prepareMSet(args)
+	return rollbackGivenKeys(db, writeKeys...)
+}
+
+// execMSetNX sets multi key-value in database, only if none of the given keys exist
+func execMSetNX(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 0 {
+		return protocol.MakeArgNumErrReply(strings.ToLower(consts.CMDMSetNX))
+	}
+
+	size := len(args) / 2
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		if _, exists := db.GetEntity(key); exists {
+			return protocol.MakeIntReply(0)
+		}
+	}
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		value := args[2*i+1]
+		db.PutEntity(key, &IDB.DataEntity{Data: value})
+	}
+	return protocol.MakeIntReply(1)
+}
+
+// execMGet get multi key-value from database
+func execMGet(db *DB, args [][]byte) client.Reply {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		bytes, err := db.getAsString(string(arg))
+		if err != nil {
+			// wrong type is reported as nil
+			result[i] = nil
+			continue
+		}
+		result[i] = cloneString(bytes)
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execAppend sets string value to the given key
+func execAppend(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if len(bytes)+len(args[1]) > maxStringSize {
+		return protocol.MakeErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	value := make([]byte, 0, len(bytes)+len(args[1]))
+	value = append(value, bytes...)
+	value = append(value, args[1]...)
+	db.PutEntity(key, &IDB.DataEntity{Data: value})
+	return protocol.MakeIntReply(int64(len(value)))
+}
+
+// execStrLen returns len of string value bound to the given key
+func execStrLen(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	return protocol.MakeIntReply(int64(len(bytes)))
+}
+
+// execSetRange overwrites part of the string stored at key, starting at the specified offset
+func execSetRange(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	offset, errNative := strconv.ParseInt(string(args[1]), 10, 64)
+	if errNative != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return protocol.MakeErrReply("ERR offset is out of range")
+	}
+	value := args[2]
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		// nothing to write, neither creates the key
+		return protocol.MakeIntReply(int64(len(bytes)))
+	}
+	if offset+int64(len(value)) > maxStringSize {
+		return protocol.MakeErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	size := int64(len(bytes))
+	if end := offset + int64(len(value)); end > size {
+		size = end
+	}
+	// copy on write, replies may still hold the old slice
+	newBytes := make([]byte, size)
+	copy(newBytes, bytes)
+	copy(newBytes[offset:], value)
+	db.PutEntity(key, &IDB.DataEntity{Data: newBytes})
+	return protocol.MakeIntReply(size)
+}
+
+// execGetRange returns the substring of the string value stored at key, determined by start and end (both inclusive)
+func execGetRange(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	start, errNative := strconv.ParseInt(string(args[1]), 10, 64)
+	if errNative != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	end, errNative := strconv.ParseInt(string(args[2]), 10, 64)
+	if errNative != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	size := int64(len(bytes))
+	if start < 0 && end < 0 && start > end {
+		return protocol.MakeBulkReply([]byte{})
+	}
+	if start < 0 {
+		start = size + start
+	}
+	if end < 0 {
+		end = size + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || size == 0 {
+		return protocol.MakeBulkReply([]byte{})
+	}
+	return protocol.MakeBulkReply(cloneString(bytes[start : end+1]))
+}
+
+func (db *DB) getAsInteger(key string) (int64, protocol.ErrorReply) {
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return 0, err
+	}
+	if bytes == nil {
+		return 0, nil
+	}
+	val, errNative := strconv.ParseInt(string(bytes), 10, 64)
+	if errNative != nil {
+		return 0, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return val, nil
+}
+
+// incrBy adds delta to the integer stored at key, the ttl of key is kept
+func (db *DB) incrBy(key string, delta int64, overflowErr string) client.Reply {
+	val, err := db.getAsInteger(key)
+	if err != nil {
+		return err
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return protocol.MakeErrReply(overflowErr)
+	}
+	val += delta
+	db.PutEntity(key, &IDB.DataEntity{
+		Data: []byte(strconv.FormatInt(val, 10)),
+	})
+	return protocol.MakeIntReply(val)
+}
+
+func parseIncrement(raw []byte) (int64, protocol.ErrorReply) {
+	delta, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return delta, nil
+}
+
+// execIncr increments the integer value of a key by one
+func execIncr(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	return db.incrBy(key, 1, "ERR increment or decrement would overflow")
+}
+
+// execIncrBy increments the integer value of a key by given value
+func execIncrBy(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	delta, err := parseIncrement(args[1])
+	if err != nil {
+		return err
+	}
+	return db.incrBy(key, delta, "ERR increment or decrement would overflow")
+}
+
+// execDecr decrements the integer value of a key by one
+func execDecr(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	return db.incrBy(key, -1, "ERR increment or decrement would overflow")
+}
+
+// execDecrBy decrements the integer value of a key by given value
+func execDecrBy(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	delta, err := parseIncrement(args[1])
+	if err != nil {
+		return err
+	}
+	if delta == math.MinInt64 {
+		// -delta is not representable
+		return protocol.MakeErrReply("ERR decrement would overflow")
+	}
+	return db.incrBy(key, -delta, "ERR increment or decrement would overflow")
+}
+
+// execIncrByFloat increments the float value of a key by given value
+func execIncrByFloat(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	delta, ok := parseLongDouble(args[1])
+	if !ok {
+		return protocol.MakeErrReply("ERR value is not a valid float")
+	}
+
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	val := new(big.Float).SetPrec(longDoublePrec)
+	if bytes != nil {
+		if val, ok = parseLongDouble(bytes); !ok {
+			return protocol.MakeErrReply("ERR value is not a valid float")
+		}
+	}
+	val.Add(val, delta)
+	if !isLongDouble(val) {
+		return protocol.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(formatLongDouble(val))
+	db.PutEntity(key, &IDB.DataEntity{
+		Data: result,
+	})
+	return protocol.MakeBulkReply(result)
+}
+
+/* ---- Long Double ----
+ * Redis computes INCRBYFLOAT and HINCRBYFLOAT in long double and formats the result by "%.17Lf",
+ * so that small decimal numbers are not surprising, e.g. 0.1 + 0.2 is 0.3.
+ * It is emulated by big.Float with the 64 bits mantissa of x87 long double.
+ */
+
+const (
+	longDoublePrec = 64
+	// long double overflows to infinity at 2^16384
+	longDoubleMaxExp = 16384
+)
+
+// parseLongDouble parses a decimal float like strtold, returns false if it is invalid or out of long double range
+func parseLongDouble(raw []byte) (*big.Float, bool) {
+	val, _, err := big.ParseFloat(string(raw), 10, longDoublePrec, big.ToNearestEven)
+	if err != nil || !isLongDouble(val) {
+		return nil, false
+	}
+	return val, true
+}
+
+// isLongDouble returns whether val is finite in long double
+func isLongDouble(val *big.Float) bool {
+	return !val.IsInf() && val.MantExp(nil) <= longDoubleMaxExp
+}
+
+// formatLongDouble formats val like "%.17Lf" of redis, with trailing zeros and the decimal point removed
+func formatLongDouble(val *big.Float) string {
+	if val.Sign() == 0 {
+		return "0" // drop the sign of -0
+	}
+	s := strings.TrimRight(val.Text('f', 17), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// formatFloat formats float in the human friendly way of redis:
+// no exponent, no trailing zeros and no decimal point for integral values
+func formatFloat(val float64) string {
+	if val == 0 {
+		return "0" // drop the sign of -0
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+func init() {
+	registerCommand(consts.CMDSet, execSet, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDSetNX, execSetNX, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDSetEX, execSetEX, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDPSetEX, execPSetEX, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDGet, execGet, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDGetSet, execGetSet, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDGetDel, execGetDel, router.WriteFirstKey, rollbackFirstKey, 2, router.FlagWrite)
+	registerCommand(consts.CMDGetEX, execGetEX, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDMSet, execMSet, prepareMSet, undoMSet, -3, router.FlagWrite)
+	registerCommand(consts.CMDMSetNX, execMSetNX, prepareMSet, undoMSet, -3, router.FlagWrite)
+	registerCommand(consts.CMDMGet, execMGet, router.ReadAllKeys, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDAppend, execAppend, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDStrLen, execStrLen, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDSetRange, execSetRange, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+	registerCommand(consts.CMDGetRange, execGetRange, router.ReadFirstKey, nil, 4, router.FlagReadOnly)
+	registerCommand(consts.CMDIncr, execIncr, router.WriteFirstKey, rollbackFirstKey, 2, router.FlagWrite)
+	registerCommand(consts.CMDIncrBy, execIncrBy, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDIncrByFloat, execIncrByFloat, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+	registerCommand(consts.CMDDecr, execDecr, router.WriteFirstKey, rollbackFirstKey, 2, router.FlagWrite)
+	registerCommand(consts.CMDDecrBy, execDecrBy, router.WriteFirstKey, rollbackFirstKey, 3, router.FlagWrite)
+}
@@ -0,0 +1,95 @@
+package single_db
+
+import "testing"
+
+func TestSetGet(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET a 1", "+OK")
+	check(t, db, "GET a", "$1 1")
+	check(t, db, "SET a 2 NX", "$-1")
+	check(t, db, "SET a 2 XX GET", "$1 1")
+	check(t, db, "SET b 2 XX", "$-1")
+	check(t, db, "SET a 2 NX XX", "-Err syntax error")
+	check(t, db, "SET a 2 EX 0", "-ERR invalid expire time in 'set' command")
+	check(t, db, "GETDEL a", "$1 2")
+	check(t, db, "GET a", "$-1")
+	check(t, db, "SET y 2", "+OK")
+	check(t, db, "GETEX y EX 100", "$1 2")
+	if _, ok := db.getExpireTime("y"); !ok {
+		t.Error("GETEX should set expire time")
+	}
+	check(t, db, "GETSET y 3", "$1 2")
+	if _, ok := db.getExpireTime("y"); ok {
+		t.Error("GETSET should discard expire time")
+	}
+}
+
+func TestStringRange(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SETRANGE s 5 hi", ":7")
+	check(t, db, "GETRANGE s 0 -1", "$7 \x00\x00\x00\x00\x00hi")
+	check(t, db, "APPEND s !", ":8")
+	check(t, db, "STRLEN s", ":8")
+	check(t, db, "GETRANGE s -3 -1", "$3 hi!")
+	check(t, db, "GETRANGE s 10 20", "$0")
+	check(t, db, "STRLEN none", ":0")
+}
+
+func TestMSet(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "MSET x 1 y 2", "+OK")
+	check(t, db, "MSETNX x 1 z 2", ":0")
+	check(t, db, "MGET x y z", "*3 $1 1 $1 2 $-1")
+	check(t, db, "MSETNX z 1 w 2", ":1")
+	check(t, db, "MGET z w", "*2 $1 1 $1 2")
+	check(t, db, "MSET x", "-ERR wrong number of arguments for 'MSET' command")
+}
+
+func TestSetExpireOverflow(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET x 1 EX 9223372036854775807", "-ERR invalid expire time in 'set' command")
+	check(t, db, "SET x 1 EX 9223372036854775", "-ERR invalid expire time in 'set' command")
+	check(t, db, "SET x 1 PX 9223372036854775807", "-ERR invalid expire time in 'set' command")
+	check(t, db, "SET x 1 EXAT 9223372036854775807", "-ERR invalid expire time in 'set' command")
+	check(t, db, "SETEX x 9223372036854775807 1", "-ERR invalid expire time in 'setex' command")
+	check(t, db, "PSETEX x 9223372036854775807 1", "-ERR invalid expire time in 'psetex' command")
+	check(t, db, "GET x", "$-1")
+	check(t, db, "SET x 1 PXAT 9223372036854775807", "+OK")
+	check(t, db, "GETEX x EX 9223372036854775807", "-ERR invalid expire time in 'getex' command")
+	check(t, db, "GET x", "$1 1")
+}
+
+func TestIncr(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "INCR c", ":1")
+	check(t, db, "INCRBY c 9", ":10")
+	check(t, db, "DECR c", ":9")
+	check(t, db, "DECRBY c 20", ":-11")
+	check(t, db, "SET c 9223372036854775807", "+OK")
+	check(t, db, "INCR c", "-ERR increment or decrement would overflow")
+	check(t, db, "DECRBY c -9223372036854775808", "-ERR decrement would overflow")
+	check(t, db, "GET c", "$19 9223372036854775807")
+	check(t, db, "SET s abc", "+OK")
+	check(t, db, "INCR s", "-ERR value is not an integer or out of range")
+	check(t, db, "INCRBY s x", "-ERR value is not an integer or out of range")
+}
+
+func TestIncrByFloat(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "SET f 10.50", "+OK")
+	check(t, db, "INCRBYFLOAT f 0.1", "$4 10.6")
+	// errors of long double are shown by 17 decimals, like redis on x86
+	check(t, db, "INCRBYFLOAT f -5.0e3", "$23 -4989.39999999999999991")
+	check(t, db, "SET f 5.0e3", "+OK")
+	check(t, db, "INCRBYFLOAT f 2.0e2", "$4 5200")
+	check(t, db, "INCRBYFLOAT n 1.5", "$3 1.5")
+	// computed in long double like redis
+	check(t, db, "SET f 0.1", "+OK")
+	check(t, db, "INCRBYFLOAT f 0.2", "$3 0.3")
+	check(t, db, "INCRBYFLOAT f -0.3", "$1 0")
+	check(t, db, "INCRBYFLOAT f 1.2345678901234567", "$18 1.2345678901234567")
+	check(t, db, "INCRBYFLOAT f 1e5000", "-ERR value is not a valid float")
+	check(t, db, "INCRBYFLOAT f inf", "-ERR value is not a valid float")
+	check(t, db, "SET s abc", "+OK")
+	check(t, db, "INCRBYFLOAT s 1", "-ERR value is not a valid float")
+}
@@ -0,0 +1,301 @@
+package single_db
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/tdigest"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- t-digest Commands ----
+ * compatible with RedisBloom, a digest must be created before adding, except TDIGEST.MERGE creates the destination
+ */
+
+const (
+	tDigestDefaultCompression = 100
+	tDigestMaxCompression     = 1 << 16
+)
+
+func (db *DB) getAsTDigest(key string) (*tdigest.Digest, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	digest, ok := entity.Data.(*tdigest.Digest)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return digest, nil
+}
+
+// getExistedTDigest returns the digest of key or an error reply if it does not exist
+func (db *DB) getExistedTDigest(key string) (*tdigest.Digest, protocol.ErrorReply) {
+	digest, errReply := db.getAsTDigest(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if digest == nil {
+		return nil, protocol.MakeErrReply("ERR T-Digest: key does not exist")
+	}
+	return digest, nil
+}
+
+func (db *DB) putNewTDigest(key string, digest *tdigest.Digest) client.Reply {
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR T-Digest: key already exists")
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: digest})
+	return protocol.MakeOkReply()
+}
+
+func parseTDigestCompression(raw []byte) (float64, protocol.ErrorReply) {
+	compression, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || compression <= 0 || compression > tDigestMaxCompression {
+		return 0, protocol.MakeErrReply("ERR T-Digest: compression parameter needs to be a positive integer")
+	}
+	return float64(compression), nil
+}
+
+// parseTDigestValues parses finite float values
+func parseTDigestValues(args [][]byte, errMsg string) ([]float64, protocol.ErrorReply) {
+	values := make([]float64, len(args))
+	for i, raw := range args {
+		value, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, protocol.MakeErrReply(errMsg)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// formatTDigestValue formats estimations like RedisBloom, NaN means the digest is empty
+func formatTDigestValue(value float64) []byte {
+	if math.IsNaN(value) {
+		return []byte("nan")
+	}
+	return []byte(formatScore(value))
+}
+
+// execTDigestCreate creates an empty digest
+func execTDigestCreate(db *DB, args [][]byte) client.Reply {
+	compression := float64(tDigestDefaultCompression)
+	if len(args) > 1 {
+		if len(args) != 3 || strings.ToUpper(string(args[1])) != "COMPRESSION" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var errReply protocol.ErrorReply
+		compression, errReply = parseTDigestCompression(args[2])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	return db.putNewTDigest(string(args[0]), tdigest.New(compression))
+}
+
+// execTDigestAdd adds values into digest
+func execTDigestAdd(db *DB, args [][]byte) client.Reply {
+	values, errReply := parseTDigestValues(args[1:], "ERR T-Digest: error parsing val parameter")
+	if errReply != nil {
+		return errReply
+	}
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range values {
+		digest.Add(value)
+	}
+	return protocol.MakeOkReply()
+}
+
+// execTDigestQuantile returns the estimated values at quantiles
+func execTDigestQuantile(db *DB, args [][]byte) client.Reply {
+	quantiles, errReply := parseTDigestValues(args[1:], "ERR T-Digest: error parsing quantile")
+	if errReply != nil {
+		return errReply
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			return protocol.MakeErrReply("ERR T-Digest: quantile should be in [0,1]")
+		}
+	}
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(quantiles))
+	for i, q := range quantiles {
+		result[i] = formatTDigestValue(digest.Quantile(q))
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execTDigestCDF returns the estimated fractions of values not greater than the given values
+func execTDigestCDF(db *DB, args [][]byte) client.Reply {
+	values, errReply := parseTDigestValues(args[1:], "ERR T-Digest: error parsing cdf")
+	if errReply != nil {
+		return errReply
+	}
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(values))
+	for i, value := range values {
+		result[i] = formatTDigestValue(digest.CDF(value))
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execTDigestMerge merges sources into the destination, the destination is created if absent.
+// Values of the existing destination are kept unless OVERRIDE is given,
+// compression defaults to the max compression of merged digests.
+func execTDigestMerge(db *DB, args [][]byte) client.Reply {
+	numKeys, ok := parseNumKeys(args)
+	if !ok {
+		return protocol.MakeErrReply("ERR T-Digest: numkeys needs to be a positive integer")
+	}
+	var compression float64
+	override := false
+	for i := 2 + numKeys; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COMPRESSION":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply protocol.ErrorReply
+			compression, errReply = parseTDigestCompression(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			i++
+		case "OVERRIDE":
+			override = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	destKey := string(args[0])
+	dest, errReply := db.getAsTDigest(destKey)
+	if errReply != nil {
+		return errReply
+	}
+	if override {
+		dest = nil
+	}
+	sources := make([]*tdigest.Digest, 0, numKeys+1)
+	if dest != nil {
+		sources = append(sources, dest)
+	}
+	for _, key := range args[2 : 2+numKeys] {
+		src, errReply := db.getExistedTDigest(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		sources = append(sources, src)
+	}
+	if compression == 0 {
+		for _, src := range sources {
+			compression = math.Max(compression, src.Compression())
+		}
+	}
+	merged := tdigest.New(compression)
+	for _, src := range sources {
+		merged.Merge(src)
+	}
+	db.PutEntity(destKey, &IDB.DataEntity{Data: merged})
+	return protocol.MakeOkReply()
+}
+
+// execTDigestMin returns the min value
+func execTDigestMin(db *DB, args [][]byte) client.Reply {
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeBulkReply(formatTDigestValue(digest.Min()))
+}
+
+// execTDigestMax returns the max value
+func execTDigestMax(db *DB, args [][]byte) client.Reply {
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeBulkReply(formatTDigestValue(digest.Max()))
+}
+
+// execTDigestInfo returns parameters and statistics of digest
+func execTDigestInfo(db *DB, args [][]byte) client.Reply {
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte("Compression")), protocol.MakeIntReply(int64(digest.Compression())),
+		protocol.MakeBulkReply([]byte("Capacity")), protocol.MakeIntReply(int64(digest.Capacity())),
+		protocol.MakeBulkReply([]byte("Merged nodes")), protocol.MakeIntReply(int64(digest.MergedNodes())),
+		protocol.MakeBulkReply([]byte("Unmerged nodes")), protocol.MakeIntReply(int64(digest.UnmergedNodes())),
+		protocol.MakeBulkReply([]byte("Merged weight")), protocol.MakeIntReply(int64(digest.MergedWeight())),
+		protocol.MakeBulkReply([]byte("Unmerged weight")), protocol.MakeIntReply(int64(digest.UnmergedWeight())),
+		protocol.MakeBulkReply([]byte("Observations")), protocol.MakeIntReply(int64(digest.Count())),
+		protocol.MakeBulkReply([]byte("Total compressions")), protocol.MakeIntReply(digest.Compressions()),
+	})
+}
+
+// execTDigestScanDump dumps digest in chunks
+func execTDigestScanDump(db *DB, args [][]byte) client.Reply {
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	digest, errReply := db.getExistedTDigest(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return makeScanDumpReply(digest, iter)
+}
+
+// execTDigestLoadChunk restores digest from chunks replied by TDIGEST.SCANDUMP
+func execTDigestLoadChunk(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if iter == 1 {
+		digest, err := tdigest.FromHeader(args[2])
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return db.putNewTDigest(key, digest)
+	}
+	digest, errReply := db.getExistedTDigest(key)
+	if errReply != nil {
+		return errReply
+	}
+	if errReply := loadChunk(digest, iter, args[2]); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDTDigestCreate, execTDigestCreate, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDTDigestAdd, execTDigestAdd, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDTDigestQuantile, execTDigestQuantile, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestCDF, execTDigestCDF, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestMerge, execTDigestMerge, prepareMerge, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDTDigestMin, execTDigestMin, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestMax, execTDigestMax, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestInfo, execTDigestInfo, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestScanDump, execTDigestScanDump, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDTDigestLoadChunk, execTDigestLoadChunk, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+}
@@ -0,0 +1,56 @@
+package single_db
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTDigest(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TDIGEST.CREATE t COMPRESSION 0", "-ERR T-Digest: compression parameter needs to be a positive integer")
+	check(t, db, "TDIGEST.CREATE t", "+OK")
+	check(t, db, "TDIGEST.MIN t", "$3 nan")
+	check(t, db, "TDIGEST.QUANTILE t 0.5", "*1 $3 nan")
+	check(t, db, "TDIGEST.ADD t 1 2 3 4 5", "+OK")
+	check(t, db, "TDIGEST.ADD t x", "-ERR T-Digest: error parsing val parameter")
+	check(t, db, "TDIGEST.QUANTILE t 0 0.5 1", "*3 $1 1 $1 3 $1 5")
+	check(t, db, "TDIGEST.QUANTILE t 2", "-ERR T-Digest: quantile should be in [0,1]")
+	check(t, db, "TDIGEST.CDF t 0 3 10", "*3 $1 0 $3 0.5 $1 1")
+	check(t, db, "TDIGEST.MAX t", "$1 5")
+	check(t, db, "TYPE t", "+TDIS-TYPE")
+}
+
+func TestTDigestMerge(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TDIGEST.CREATE t", "+OK")
+	check(t, db, "TDIGEST.ADD t 1 2 3 4 5", "+OK")
+	check(t, db, "TDIGEST.CREATE u COMPRESSION 200", "+OK")
+	check(t, db, "TDIGEST.ADD u 10", "+OK")
+	// the destination takes the max compression of sources
+	check(t, db, "TDIGEST.MERGE m 2 t u", "+OK")
+	check(t, db, "TDIGEST.MAX m", "$2 10")
+	check(t, db, "TDIGEST.INFO m", "*16 $11 Compression :200 $8 Capacity :1000 $12 Merged nodes :0 $14 Unmerged nodes :6 $13 Merged weight :0 $15 Unmerged weight :6 $12 Observations :6 $18 Total compressions :0")
+	// an existing destination is merged too
+	check(t, db, "TDIGEST.MERGE m 1 u", "+OK")
+	check(t, db, "TDIGEST.INFO m", "*16 $11 Compression :200 $8 Capacity :1000 $12 Merged nodes :0 $14 Unmerged nodes :7 $13 Merged weight :0 $15 Unmerged weight :7 $12 Observations :7 $18 Total compressions :0")
+	check(t, db, "TDIGEST.MERGE m 1 u OVERRIDE COMPRESSION 50", "+OK")
+	check(t, db, "TDIGEST.INFO m", "*16 $11 Compression :50 $8 Capacity :250 $12 Merged nodes :0 $14 Unmerged nodes :1 $13 Merged weight :0 $15 Unmerged weight :1 $12 Observations :1 $18 Total compressions :0")
+	check(t, db, "TDIGEST.MIN m", "$2 10")
+	check(t, db, "TDIGEST.MERGE m 1 nokey", "-ERR T-Digest: key does not exist")
+}
+
+func TestTDigestUndo(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TDIGEST.CREATE t", "+OK")
+	for i := 0; i < 2000; i++ {
+		run(db, "TDIGEST.ADD t "+strconv.Itoa(i))
+	}
+	check(t, db, "TDIGEST.QUANTILE t 0.1 0.5 0.99", "*3 $5 199.5 $5 999.5 $6 1979.5")
+	info := run(db, "TDIGEST.INFO t")
+	replayUndo(t, db, "t")
+	check(t, db, "TDIGEST.QUANTILE t 0.1 0.5 0.99", "*3 $5 199.5 $5 999.5 $6 1979.5")
+	check(t, db, "TDIGEST.INFO t", info)
+	copyByChunks(t, db, "TDIGEST", "t", "t2")
+	check(t, db, "TDIGEST.QUANTILE t2 0.1 0.5 0.99", "*3 $5 199.5 $5 999.5 $6 1979.5")
+	check(t, db, "TDIGEST.INFO t2", info)
+}
@@ -0,0 +1,824 @@
+package single_db
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pluming/aurora/datastruct/timeseries"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/timewheel"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+/* ---- Time Series Commands ----
+ * compatible with RedisTimeSeries.
+ * Samples of compaction rules are added into destination series while only the source key is locked,
+ * which is safe since series synchronize themselves. Expired samples are removed by time wheel jobs like expired keys.
+ */
+
+// timeSeriesTrimInterval is the interval of removing expired samples
+const timeSeriesTrimInterval = 10 * time.Second
+
+func makeTSKeyNotExistErr() protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR TSDB: the key does not exist")
+}
+
+func (db *DB) getAsTimeSeries(key string) (*timeseries.Series, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	series, ok := entity.Data.(*timeseries.Series)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return series, nil
+}
+
+// genTrimTask returns the time wheel task key of removing expired samples of key
+func (db *DB) genTrimTask(key string) string {
+	return "ts-trim:" + strconv.Itoa(db.index) + ":" + key
+}
+
+// scheduleTimeSeriesTrim removes expired samples of series periodically until the key is bound to another value
+func (db *DB) scheduleTimeSeriesTrim(key string, series *timeseries.Series) {
+	if series.Retention() == 0 {
+		return
+	}
+	timewheel.Delay(timeSeriesTrimInterval, db.genTrimTask(key), func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		entity, exists := db.GetEntity(key)
+		if !exists || entity.Data != series {
+			return
+		}
+		series.Trim()
+		db.scheduleTimeSeriesTrim(key, series)
+	})
+}
+
+// putTimeSeries binds a new series to key
+func (db *DB) putTimeSeries(key string, series *timeseries.Series) {
+	db.PutEntity(key, &IDB.DataEntity{Data: series})
+	db.scheduleTimeSeriesTrim(key, series)
+}
+
+// seriesOptions is options of creating series
+type seriesOptions struct {
+	retention       int64
+	duplicatePolicy timeseries.DuplicatePolicy
+	onDuplicate     timeseries.DuplicatePolicy
+	labels          []timeseries.Label
+}
+
+// parseSeriesOptions parses `[RETENTION ms] [DUPLICATE_POLICY policy] [ON_DUPLICATE policy] [LABELS label value...]`,
+// ON_DUPLICATE is allowed by TS.ADD only
+func parseSeriesOptions(args [][]byte, allowOnDuplicate bool) (*seriesOptions, protocol.ErrorReply) {
+	opts := &seriesOptions{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "LABELS" {
+			rest := args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: wrong number of label arguments")
+			}
+			for j := 0; j < len(rest); j += 2 {
+				opts.labels = append(opts.labels, timeseries.Label{Name: string(rest[j]), Value: string(rest[j+1])})
+			}
+			break
+		}
+		if i+1 >= len(args) {
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+		i++
+		switch option {
+		case "RETENTION":
+			retention, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || retention < 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse RETENTION")
+			}
+			opts.retention = retention
+		case "DUPLICATE_POLICY":
+			policy, ok := timeseries.ParseDuplicatePolicy(string(args[i]))
+			if !ok {
+				return nil, protocol.MakeErrReply("ERR TSDB: Unknown DUPLICATE_POLICY")
+			}
+			opts.duplicatePolicy = policy
+		case "ON_DUPLICATE":
+			policy, ok := timeseries.ParseDuplicatePolicy(string(args[i]))
+			if !allowOnDuplicate || !ok {
+				return nil, protocol.MakeErrReply("ERR TSDB: Unknown ON_DUPLICATE policy")
+			}
+			opts.onDuplicate = policy
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+func parseSampleTimestamp(raw []byte) (int64, protocol.ErrorReply) {
+	if string(raw) == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	ts, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || ts < 0 {
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid timestamp, must be a nonnegative integer")
+	}
+	return ts, nil
+}
+
+func parseSampleValue(raw []byte) (float64, protocol.ErrorReply) {
+	value, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid value")
+	}
+	return value, nil
+}
+
+// execTSCreate creates an empty series
+func execTSCreate(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	opts, errReply := parseSeriesOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR TSDB: key already exists")
+	}
+	db.putTimeSeries(key, timeseries.New(opts.retention, opts.duplicatePolicy, opts.labels))
+	return protocol.MakeOkReply()
+}
+
+// addSample adds a sample into series and its compaction destinations
+func (db *DB) addSample(key string, series *timeseries.Series, ts int64, value float64, policy timeseries.DuplicatePolicy) protocol.ErrorReply {
+	compactions, err := series.AddAndCompact(ts, value, policy)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	for _, c := range compactions {
+		dest, _ := db.getAsTimeSeries(c.DestKey)
+		if dest == nil || dest.SourceKey() != key {
+			// destination is removed or replaced
+			series.DeleteRule(c.DestKey)
+			continue
+		}
+		// the bucket may be aggregated again, the latest result wins
+		_ = dest.Add(c.Sample.Timestamp, c.Sample.Value, timeseries.PolicyLast)
+		db.addVersion(c.DestKey)
+	}
+	return nil
+}
+
+// execTSAdd adds a sample, the series is created if absent
+func execTSAdd(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	ts, errReply := parseSampleTimestamp(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := parseSampleValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseSeriesOptions(args[3:], true)
+	if errReply != nil {
+		return errReply
+	}
+	series, errReply := db.getAsTimeSeries(key)
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		series = timeseries.New(opts.retention, opts.duplicatePolicy, opts.labels)
+		db.putTimeSeries(key, series)
+	}
+	if errReply := db.addSample(key, series, ts, value, opts.onDuplicate); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeIntReply(ts)
+}
+
+// execTSMAdd adds samples into existing series, replies the timestamp or an error for each sample
+func execTSMAdd(db *DB, args [][]byte) client.Reply {
+	if len(args)%3 != 0 {
+		return protocol.MakeArgNumErrReply(consts.CMDTSMAdd)
+	}
+	replies := make([]client.Reply, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		key := string(args[i])
+		ts, errReply := parseSampleTimestamp(args[i+1])
+		if errReply != nil {
+			replies = append(replies, errReply)
+			continue
+		}
+		value, errReply := parseSampleValue(args[i+2])
+		if errReply != nil {
+			replies = append(replies, errReply)
+			continue
+		}
+		series, errReply := db.getAsTimeSeries(key)
+		if errReply == nil && series == nil {
+			errReply = makeTSKeyNotExistErr()
+		}
+		if errReply == nil {
+			errReply = db.addSample(key, series, ts, value, timeseries.PolicyNone)
+		}
+		if errReply != nil {
+			replies = append(replies, errReply)
+			continue
+		}
+		replies = append(replies, protocol.MakeIntReply(ts))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func prepareTSMAdd(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+func sampleToReply(sample timeseries.Sample) client.Reply {
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeIntReply(sample.Timestamp),
+		protocol.MakeStatusReply(formatScore(sample.Value)),
+	})
+}
+
+// execTSGet returns the latest sample
+func execTSGet(db *DB, args [][]byte) client.Reply {
+	series, errReply := db.getAsTimeSeries(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		return makeTSKeyNotExistErr()
+	}
+	sample, ok := series.Last()
+	if !ok {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return sampleToReply(sample)
+}
+
+/* ---- range queries ---- */
+
+// rangeQuery is a parsed query of TS.RANGE and TS.MRANGE
+type rangeQuery struct {
+	from, to      int64
+	reverse       bool
+	filterByTS    map[int64]struct{}
+	filterByValue bool
+	minValue      float64
+	maxValue      float64
+	count         int64 // negative means unlimited
+	align         int64
+	aggregate     *timeseries.AggregateOptions
+	// options of TS.MRANGE
+	withLabels     bool
+	selectedLabels []string
+	filters        []labelFilter
+}
+
+func parseRangeBound(raw []byte, min bool) (int64, protocol.ErrorReply) {
+	switch string(raw) {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	ts, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		if min {
+			return 0, protocol.MakeErrReply("ERR TSDB: invalid fromTimestamp")
+		}
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid toTimestamp")
+	}
+	return ts, nil
+}
+
+// parseRangeQuery parses `fromTimestamp toTimestamp [options]`, multi allows options of TS.MRANGE
+func parseRangeQuery(args [][]byte, reverse, multi bool) (*rangeQuery, protocol.ErrorReply) {
+	q := &rangeQuery{reverse: reverse, count: -1}
+	var errReply protocol.ErrorReply
+	if q.from, errReply = parseRangeBound(args[0], true); errReply != nil {
+		return nil, errReply
+	}
+	if q.to, errReply = parseRangeBound(args[1], false); errReply != nil {
+		return nil, errReply
+	}
+	var alignArg []byte
+	var bucketTimestamp timeseries.BucketTimestamp
+	var empty bool
+	args = args[2:]
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "FILTER_BY_TS":
+			q.filterByTS = make(map[int64]struct{})
+			for ; i+1 < len(args); i++ {
+				ts, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+				if err != nil {
+					break
+				}
+				q.filterByTS[ts] = struct{}{}
+			}
+			if len(q.filterByTS) == 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: FILTER_BY_TS one or more arguments are missing")
+			}
+		case option == "FILTER_BY_VALUE" && i+2 < len(args):
+			min, err1 := strconv.ParseFloat(string(args[i+1]), 64)
+			max, err2 := strconv.ParseFloat(string(args[i+2]), 64)
+			if err1 != nil || err2 != nil {
+				return nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse MIN or MAX")
+			}
+			q.filterByValue, q.minValue, q.maxValue = true, min, max
+			i += 2
+		case option == "COUNT" && i+1 < len(args):
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || count < 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: Couldn't parse COUNT")
+			}
+			q.count = count
+			i++
+		case option == "ALIGN" && i+1 < len(args):
+			alignArg = args[i+1]
+			i++
+		case option == "AGGREGATION" && i+2 < len(args):
+			agg, ok := timeseries.ParseAggregation(string(args[i+1]))
+			if !ok {
+				return nil, protocol.MakeErrReply("ERR TSDB: Unknown aggregation type")
+			}
+			duration, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil || duration <= 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: bucketDuration must be greater than zero")
+			}
+			q.aggregate = &timeseries.AggregateOptions{Aggregation: agg, BucketDuration: duration}
+			i += 2
+		case option == "BUCKETTIMESTAMP" && i+1 < len(args):
+			switch strings.ToLower(string(args[i+1])) {
+			case "-", "start":
+				bucketTimestamp = timeseries.BucketStart
+			case "+", "end":
+				bucketTimestamp = timeseries.BucketEnd
+			case "~", "mid":
+				bucketTimestamp = timeseries.BucketMid
+			default:
+				return nil, protocol.MakeErrReply("ERR TSDB: unknown BUCKETTIMESTAMP parameter")
+			}
+			i++
+		case option == "EMPTY":
+			empty = true
+		case multi && option == "WITHLABELS":
+			q.withLabels = true
+		case multi && option == "SELECTED_LABELS" && i+1 < len(args):
+			for ; i+1 < len(args) && !isRangeKeyword(args[i+1]); i++ {
+				q.selectedLabels = append(q.selectedLabels, string(args[i+1]))
+			}
+		case multi && option == "FILTER" && i+1 < len(args):
+			for ; i+1 < len(args); i++ {
+				filter, errReply := parseLabelFilter(string(args[i+1]))
+				if errReply != nil {
+					return nil, errReply
+				}
+				q.filters = append(q.filters, filter)
+			}
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if q.withLabels && len(q.selectedLabels) > 0 {
+		return nil, protocol.MakeErrReply("ERR TSDB: cannot accept WITHLABELS and SELECTED_LABELS together")
+	}
+	if q.aggregate == nil {
+		if alignArg != nil || empty {
+			return nil, protocol.MakeErrReply("ERR TSDB: ALIGN, BUCKETTIMESTAMP and EMPTY require AGGREGATION")
+		}
+		return q, nil
+	}
+	q.aggregate.BucketTimestamp = bucketTimestamp
+	q.aggregate.Empty = empty
+	if alignArg != nil {
+		switch strings.ToLower(string(alignArg)) {
+		case "-", "start":
+			q.aggregate.Align = q.from
+		case "+", "end":
+			q.aggregate.Align = q.to
+		default:
+			align, err := strconv.ParseInt(string(alignArg), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR TSDB: unknown ALIGN parameter")
+			}
+			q.aggregate.Align = align
+		}
+	}
+	return q, nil
+}
+
+func isRangeKeyword(arg []byte) bool {
+	switch strings.ToUpper(string(arg)) {
+	case "FILTER_BY_TS", "FILTER_BY_VALUE", "COUNT", "ALIGN", "AGGREGATION", "BUCKETTIMESTAMP", "EMPTY",
+		"WITHLABELS", "SELECTED_LABELS", "FILTER":
+		return true
+	}
+	return false
+}
+
+// query returns samples of series matching query
+func (q *rangeQuery) query(series *timeseries.Series) []timeseries.Sample {
+	samples := series.Range(q.from, q.to)
+	if q.filterByTS != nil || q.filterByValue {
+		filtered := samples[:0]
+		for _, sample := range samples {
+			if q.filterByTS != nil {
+				if _, ok := q.filterByTS[sample.Timestamp]; !ok {
+					continue
+				}
+			}
+			if q.filterByValue && (sample.Value < q.minValue || sample.Value > q.maxValue) {
+				continue
+			}
+			filtered = append(filtered, sample)
+		}
+		samples = filtered
+	}
+	if q.aggregate != nil {
+		samples = timeseries.Aggregate(samples, q.aggregate)
+	}
+	if q.reverse {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if q.count >= 0 && int64(len(samples)) > q.count {
+		samples = samples[:q.count]
+	}
+	return samples
+}
+
+func samplesToReply(samples []timeseries.Sample) client.Reply {
+	replies := make([]client.Reply, len(samples))
+	for i, sample := range samples {
+		replies[i] = sampleToReply(sample)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func execTSRangeGeneric(db *DB, args [][]byte, reverse bool) client.Reply {
+	q, errReply := parseRangeQuery(args[1:], reverse, false)
+	if errReply != nil {
+		return errReply
+	}
+	series, errReply := db.getAsTimeSeries(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		return makeTSKeyNotExistErr()
+	}
+	return samplesToReply(q.query(series))
+}
+
+// execTSRange returns samples in time range in ascending order
+func execTSRange(db *DB, args [][]byte) client.Reply {
+	return execTSRangeGeneric(db, args, false)
+}
+
+// execTSRevRange returns samples in time range in descending order
+func execTSRevRange(db *DB, args [][]byte) client.Reply {
+	return execTSRangeGeneric(db, args, true)
+}
+
+// labelFilter is a label matcher of TS.MRANGE like `label=value`, `label!=(v1,v2)` or `label=`
+type labelFilter struct {
+	name   string
+	equal  bool
+	values []string // empty means the label is absent
+}
+
+func parseLabelFilter(expr string) (labelFilter, protocol.ErrorReply) {
+	filter := labelFilter{equal: true}
+	pos := strings.Index(expr, "=")
+	if pos <= 0 {
+		return filter, protocol.MakeErrReply("ERR TSDB: failed parsing labels")
+	}
+	filter.name = expr[:pos]
+	if strings.HasSuffix(filter.name, "!") {
+		filter.equal = false
+		filter.name = filter.name[:len(filter.name)-1]
+	}
+	value := expr[pos+1:]
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		filter.values = strings.Split(value[1:len(value)-1], ",")
+	} else if value != "" {
+		filter.values = []string{value}
+	}
+	if filter.name == "" {
+		return filter, protocol.MakeErrReply("ERR TSDB: failed parsing labels")
+	}
+	return filter, nil
+}
+
+func (f *labelFilter) match(series *timeseries.Series) bool {
+	value, ok := series.Label(f.name)
+	if len(f.values) == 0 {
+		// `label=` matches series without label, `label!=` matches series with label
+		return ok != f.equal
+	}
+	in := false
+	if ok {
+		for _, v := range f.values {
+			if v == value {
+				in = true
+				break
+			}
+		}
+	}
+	return in == f.equal
+}
+
+func labelsToReply(series *timeseries.Series, q *rangeQuery) client.Reply {
+	var replies []client.Reply
+	if q.withLabels {
+		for _, label := range series.Labels() {
+			replies = append(replies, protocol.MakeMultiBulkReply([][]byte{[]byte(label.Name), []byte(label.Value)}))
+		}
+	}
+	for _, name := range q.selectedLabels {
+		value, ok := series.Label(name)
+		var valueReply client.Reply = protocol.MakeNullBulkReply()
+		if ok {
+			valueReply = protocol.MakeBulkReply([]byte(value))
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeBulkReply([]byte(name)), valueReply,
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func execTSMRangeGeneric(db *DB, args [][]byte, reverse bool) client.Reply {
+	q, errReply := parseRangeQuery(args, reverse, true)
+	if errReply != nil {
+		return errReply
+	}
+	positive := false
+	for _, f := range q.filters {
+		positive = positive || (f.equal && len(f.values) > 0)
+	}
+	if !positive {
+		return protocol.MakeErrReply("ERR TSDB: please provide at least one matcher")
+	}
+	// series are safe for concurrent use, so keys are not locked
+	keys := db.data.Keys()
+	sort.Strings(keys)
+	var replies []client.Reply
+	for _, key := range keys {
+		series, _ := db.getAsTimeSeries(key)
+		if series == nil {
+			continue
+		}
+		matched := true
+		for i := range q.filters {
+			if !q.filters[i].match(series) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			labelsToReply(series, q),
+			samplesToReply(q.query(series)),
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTSMRange returns samples in time range of series matching label filters
+func execTSMRange(db *DB, args [][]byte) client.Reply {
+	return execTSMRangeGeneric(db, args, false)
+}
+
+// execTSMRevRange returns samples in time range of series matching label filters in descending order
+func execTSMRevRange(db *DB, args [][]byte) client.Reply {
+	return execTSMRangeGeneric(db, args, true)
+}
+
+/* ---- compaction rules ---- */
+
+// hasValidSource returns whether series is the destination of a rule
+func (db *DB) hasValidSource(key string, series *timeseries.Series) bool {
+	sourceKey := series.SourceKey()
+	if sourceKey == "" {
+		return false
+	}
+	source, _ := db.getAsTimeSeries(sourceKey)
+	return source != nil && source.HasRule(key)
+}
+
+// getRuleSeries returns the source and destination series of a rule which must exist
+func (db *DB) getRuleSeries(sourceKey, destKey string) (*timeseries.Series, *timeseries.Series, protocol.ErrorReply) {
+	source, errReply := db.getAsTimeSeries(sourceKey)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	dest, errReply := db.getAsTimeSeries(destKey)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if source == nil || dest == nil {
+		return nil, nil, makeTSKeyNotExistErr()
+	}
+	return source, dest, nil
+}
+
+// execTSCreateRule creates a compaction rule
+func execTSCreateRule(db *DB, args [][]byte) client.Reply {
+	sourceKey, destKey := string(args[0]), string(args[1])
+	if strings.ToUpper(string(args[2])) != "AGGREGATION" || len(args) > 6 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	agg, ok := timeseries.ParseAggregation(string(args[3]))
+	if !ok {
+		return protocol.MakeErrReply("ERR TSDB: Unknown aggregation type")
+	}
+	duration, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil || duration <= 0 {
+		return protocol.MakeErrReply("ERR TSDB: bucketDuration must be greater than zero")
+	}
+	var align int64
+	if len(args) == 6 {
+		if align, err = strconv.ParseInt(string(args[5]), 10, 64); err != nil {
+			return protocol.MakeErrReply("ERR TSDB: Couldn't parse alignTimestamp")
+		}
+	}
+	if sourceKey == destKey {
+		return protocol.MakeErrReply("ERR TSDB: the source key and destination key should be different")
+	}
+	source, dest, errReply := db.getRuleSeries(sourceKey, destKey)
+	if errReply != nil {
+		return errReply
+	}
+	if db.hasValidSource(sourceKey, source) {
+		return protocol.MakeErrReply("ERR TSDB: the source key already has a source rule")
+	}
+	if db.hasValidSource(destKey, dest) {
+		return protocol.MakeErrReply("ERR TSDB: the destination key already has a src rule")
+	}
+	if len(dest.Rules()) > 0 {
+		return protocol.MakeErrReply("ERR TSDB: the destination key already has a dst rule")
+	}
+	source.AddRule(destKey, agg, duration, align)
+	dest.SetSourceKey(sourceKey)
+	return protocol.MakeOkReply()
+}
+
+// execTSDeleteRule removes a compaction rule
+func execTSDeleteRule(db *DB, args [][]byte) client.Reply {
+	sourceKey, destKey := string(args[0]), string(args[1])
+	source, dest, errReply := db.getRuleSeries(sourceKey, destKey)
+	if errReply != nil {
+		return errReply
+	}
+	if !source.DeleteRule(destKey) {
+		return protocol.MakeErrReply("ERR TSDB: compaction rule does not exist")
+	}
+	dest.SetSourceKey("")
+	return protocol.MakeOkReply()
+}
+
+func prepareTSRule(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// execTSInfo returns information of series
+func execTSInfo(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	series, errReply := db.getAsTimeSeries(key)
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		return makeTSKeyNotExistErr()
+	}
+	var lastTimestamp int64
+	if last, ok := series.Last(); ok {
+		lastTimestamp = last.Timestamp
+	}
+	labels := make([]client.Reply, 0, len(series.Labels()))
+	for _, label := range series.Labels() {
+		labels = append(labels, protocol.MakeMultiBulkReply([][]byte{[]byte(label.Name), []byte(label.Value)}))
+	}
+	var sourceKey client.Reply = protocol.MakeNullBulkReply()
+	if db.hasValidSource(key, series) {
+		sourceKey = protocol.MakeBulkReply([]byte(series.SourceKey()))
+	}
+	var rules []client.Reply
+	for _, rule := range series.Rules() {
+		rules = append(rules, protocol.MakeMultiRawReply([]client.Reply{
+			protocol.MakeBulkReply([]byte(rule.DestKey)),
+			protocol.MakeIntReply(rule.BucketDuration),
+			protocol.MakeStatusReply(strings.ToUpper(rule.Aggregation.String())),
+			protocol.MakeIntReply(rule.AlignTimestamp),
+		}))
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte("totalSamples")), protocol.MakeIntReply(int64(series.Len())),
+		protocol.MakeBulkReply([]byte("firstTimestamp")), protocol.MakeIntReply(series.FirstTimestamp()),
+		protocol.MakeBulkReply([]byte("lastTimestamp")), protocol.MakeIntReply(lastTimestamp),
+		protocol.MakeBulkReply([]byte("retentionTime")), protocol.MakeIntReply(series.Retention()),
+		protocol.MakeBulkReply([]byte("chunkCount")), protocol.MakeIntReply(int64(series.ChunkCount())),
+		protocol.MakeBulkReply([]byte("duplicatePolicy")), protocol.MakeBulkReply([]byte(series.DuplicatePolicy().String())),
+		protocol.MakeBulkReply([]byte("labels")), protocol.MakeMultiRawReply(labels),
+		protocol.MakeBulkReply([]byte("sourceKey")), sourceKey,
+		protocol.MakeBulkReply([]byte("rules")), protocol.MakeMultiRawReply(rules),
+	})
+}
+
+/* ---- undo ---- */
+
+// rollbackTimeSeries restores series and their compaction destinations,
+// destinations are restored first so that rules of sources are rebuilt on them
+func rollbackTimeSeries(db *DB, keys []string) []router.CmdLine {
+	var destKeys []string
+	for _, key := range keys {
+		series, _ := db.getAsTimeSeries(key)
+		if series == nil {
+			continue
+		}
+		for _, rule := range series.Rules() {
+			destKeys = append(destKeys, rule.DestKey)
+		}
+	}
+	return rollbackGivenKeys(db, append(destKeys, keys...)...)
+}
+
+func rollbackTSAdd(db *DB, args [][]byte) []router.CmdLine {
+	return rollbackTimeSeries(db, []string{string(args[0])})
+}
+
+func rollbackTSMAdd(db *DB, args [][]byte) []router.CmdLine {
+	keys, _ := prepareTSMAdd(args)
+	return rollbackTimeSeries(db, keys)
+}
+
+func rollbackTSRule(db *DB, args [][]byte) []router.CmdLine {
+	return rollbackGivenKeys(db, string(args[1]), string(args[0]))
+}
+
+// timeSeriesToCmdLines serializes series into TS.CREATE, TS.MADD and TS.CREATERULE
+func timeSeriesToCmdLines(key string, series *timeseries.Series) []router.CmdLine {
+	create := utils.ToCmdLine(consts.CMDTSCreate, key,
+		"RETENTION", strconv.FormatInt(series.Retention(), 10),
+		"DUPLICATE_POLICY", series.DuplicatePolicy().String())
+	if labels := series.Labels(); len(labels) > 0 {
+		create = append(create, []byte("LABELS"))
+		for _, label := range labels {
+			create = append(create, []byte(label.Name), []byte(label.Value))
+		}
+	}
+	cmdLines := []router.CmdLine{create}
+	if samples := series.Range(0, math.MaxInt64); len(samples) > 0 {
+		madd := make(router.CmdLine, 0, 1+3*len(samples))
+		madd = append(madd, []byte(consts.CMDTSMAdd))
+		for _, sample := range samples {
+			madd = append(madd, []byte(key), []byte(strconv.FormatInt(sample.Timestamp, 10)),
+				[]byte(formatScore(sample.Value)))
+		}
+		cmdLines = append(cmdLines, madd)
+	}
+	for _, rule := range series.Rules() {
+		cmdLines = append(cmdLines, utils.ToCmdLine(consts.CMDTSCreateRule, key, rule.DestKey,
+			"AGGREGATION", rule.Aggregation.String(),
+			strconv.FormatInt(rule.BucketDuration, 10), strconv.FormatInt(rule.AlignTimestamp, 10)))
+	}
+	return cmdLines
+}
+
+func init() {
+	registerCommand(consts.CMDTSCreate, execTSCreate, router.WriteFirstKey, rollbackFirstKey, -2, router.FlagWrite)
+	registerCommand(consts.CMDTSAdd, execTSAdd, router.WriteFirstKey, rollbackTSAdd, -4, router.FlagWrite)
+	registerCommand(consts.CMDTSMAdd, execTSMAdd, prepareTSMAdd, rollbackTSMAdd, -4, router.FlagWrite)
+	registerCommand(consts.CMDTSGet, execTSGet, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTSRange, execTSRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDTSRevRange, execTSRevRange, router.ReadFirstKey, nil, -4, router.FlagReadOnly)
+	registerCommand(consts.CMDTSMRange, execTSMRange, router.NoPrepare, nil, -5, router.FlagReadOnly)
+	registerCommand(consts.CMDTSMRevRange, execTSMRevRange, router.NoPrepare, nil, -5, router.FlagReadOnly)
+	registerCommand(consts.CMDTSCreateRule, execTSCreateRule, prepareTSRule, rollbackTSRule, -6, router.FlagWrite)
+	registerCommand(consts.CMDTSDeleteRule, execTSDeleteRule, prepareTSRule, rollbackTSRule, 3, router.FlagWrite)
+	registerCommand(consts.CMDTSInfo, execTSInfo, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+}
@@ -0,0 +1,82 @@
+package single_db
+
+import (
+	"testing"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+func TestTimeSeries(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TS.CREATE t RETENTION 1000 DUPLICATE_POLICY min LABELS host a metric cpu", "+OK")
+	check(t, db, "TS.CREATE t", "-ERR TSDB: key already exists")
+	check(t, db, "TS.CREATE x DUPLICATE_POLICY foo", "-ERR TSDB: Unknown DUPLICATE_POLICY")
+	check(t, db, "TYPE t", "+TSDB-TYPE")
+	check(t, db, "TS.ADD t 10 5", ":10")
+	check(t, db, "TS.ADD t 10 7", ":10")
+	check(t, db, "TS.ADD t 10 9 ON_DUPLICATE last", ":10")
+	check(t, db, "TS.GET t", "*2 :10 +9")
+	check(t, db, "TS.MADD t 20 1 t 30 2.5 nokey 1 1 t 40 x", "*4 :20 :30 -ERR TSDB: the key does not exist -ERR TSDB: invalid value")
+	check(t, db, "TS.RANGE t - +", "*3 *2 :10 +9 *2 :20 +1 *2 :30 +2.5")
+	check(t, db, "TS.REVRANGE t - + COUNT 2", "*2 *2 :30 +2.5 *2 :20 +1")
+	check(t, db, "TS.RANGE t 0 100 AGGREGATION avg 20", "*2 *2 :0 +9 *2 :20 +1.75")
+	check(t, db, "TS.RANGE t 0 100 AGGREGATION count 10 ALIGN 5 BUCKETTIMESTAMP end", "*3 *2 :15 +1 *2 :25 +1 *2 :35 +1")
+	check(t, db, "TS.RANGE t 0 100 FILTER_BY_VALUE 2 10 AGGREGATION sum 100", "*1 *2 :0 +11.5")
+	check(t, db, "TS.RANGE t 0 100 FILTER_BY_TS 10 30", "*2 *2 :10 +9 *2 :30 +2.5")
+	check(t, db, "TS.RANGE t 0 100 AGGREGATION max 10 EMPTY", "*3 *2 :10 +9 *2 :20 +1 *2 :30 +2.5")
+	check(t, db, "TS.ADD t 2000 1", ":2000")
+	check(t, db, "TS.ADD t 500 1", "-ERR TSDB: Timestamp is older than retention")
+	check(t, db, "TS.RANGE t - +", "*1 *2 :2000 +1")
+
+	check(t, db, "TS.ADD u 1 1 LABELS host b metric cpu", ":1")
+	check(t, db, "TS.ADD v 1 1 LABELS host c metric mem", ":1")
+	check(t, db, "TS.MRANGE - + FILTER metric=cpu", "*2 *3 $1 t *0 *1 *2 :2000 +1 *3 $1 u *0 *1 *2 :1 +1")
+	check(t, db, "TS.MRANGE - + WITHLABELS FILTER metric=cpu host!=a", "*1 *3 $1 u *2 *2 $4 host $1 b *2 $6 metric $3 cpu *1 *2 :1 +1")
+	check(t, db, "TS.MREVRANGE - + SELECTED_LABELS host nope FILTER host=(a,c) metric=", "*0")
+	check(t, db, "TS.MRANGE - + SELECTED_LABELS host nope FILTER host=(a,c)", "*2 *3 $1 t *2 *2 $4 host $1 a *2 $4 nope $-1 *1 *2 :2000 +1 *3 $1 v *2 *2 $4 host $1 c *2 $4 nope $-1 *1 *2 :1 +1")
+	check(t, db, "TS.MRANGE - + FILTER host!=a", "-ERR TSDB: please provide at least one matcher")
+}
+
+func TestTimeSeriesRule(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TS.CREATE u", "+OK")
+	check(t, db, "TS.CREATE src", "+OK")
+	check(t, db, "TS.CREATE dst", "+OK")
+	check(t, db, "TS.CREATERULE src dst AGGREGATION sum 10", "+OK")
+	check(t, db, "TS.CREATERULE u dst AGGREGATION sum 10", "-ERR TSDB: the destination key already has a src rule")
+	check(t, db, "TS.CREATERULE dst u AGGREGATION sum 10", "-ERR TSDB: the source key already has a source rule")
+	check(t, db, "TS.MADD src 1 1 src 2 2 src 11 3 src 25 4", "*4 :1 :2 :11 :25")
+	check(t, db, "TS.RANGE dst - +", "*2 *2 :0 +3 *2 :10 +3")
+	undo := rollbackTSAdd(db, utils.ToCmdLine("src", "31", "1"))
+	check(t, db, "TS.ADD src 31 1", ":31")
+	check(t, db, "TS.RANGE dst - +", "*3 *2 :0 +3 *2 :10 +3 *2 :20 +4")
+	for _, line := range undo {
+		if r := db.ExecNormalCommand(line); protocol.IsErrorReply(r) {
+			t.Error(string(r.ToBytes()))
+		}
+	}
+	check(t, db, "TS.RANGE dst - +", "*2 *2 :0 +3 *2 :10 +3")
+	check(t, db, "TS.ADD src 42 1", ":42")
+	check(t, db, "TS.RANGE dst - +", "*3 *2 :0 +3 *2 :10 +3 *2 :20 +4")
+	check(t, db, "TS.INFO src", "*18 $12 totalSamples :5 $14 firstTimestamp :1 $13 lastTimestamp :42 $13 retentionTime :0 $10 chunkCount :1 $15 duplicatePolicy $5 block $6 labels *0 $9 sourceKey $-1 $5 rules *1 *4 $3 dst :10 +SUM :0")
+	check(t, db, "TS.INFO dst", "*18 $12 totalSamples :3 $14 firstTimestamp :0 $13 lastTimestamp :20 $13 retentionTime :0 $10 chunkCount :1 $15 duplicatePolicy $5 block $6 labels *0 $9 sourceKey $3 src $5 rules *0")
+	check(t, db, "TS.DELETERULE src dst", "+OK")
+	check(t, db, "TS.DELETERULE src dst", "-ERR TSDB: compaction rule does not exist")
+	check(t, db, "DEL dst", ":1")
+	check(t, db, "TS.CREATE dst", "+OK")
+	check(t, db, "TS.ADD src 55 1", ":55")
+	check(t, db, "TS.RANGE dst - +", "*0")
+}
+
+func TestTimeSeriesRuleRetention(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TS.CREATE t RETENTION 1000", "+OK")
+	check(t, db, "TS.CREATE t2", "+OK")
+	check(t, db, "TS.CREATERULE t t2 AGGREGATION sum 1000", "+OK")
+	check(t, db, "TS.ADD t 3000 1", ":3000")
+	// the bucket of 3000 is out of retention after adding 4100, but it is compacted
+	check(t, db, "TS.ADD t 4100 1", ":4100")
+	check(t, db, "TS.RANGE t - +", "*1 *2 :4100 +1")
+	check(t, db, "TS.RANGE t2 - +", "*1 *2 :3000 +1")
+}
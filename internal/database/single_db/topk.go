@@ -0,0 +1,255 @@
+package single_db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/datastruct/topk"
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+)
+
+/* ---- Top-K Commands ----
+ * compatible with RedisBloom, a top-k must be reserved before adding
+ */
+
+const (
+	topKDefaultWidth = 8
+	topKDefaultDepth = 7
+	topKDefaultDecay = 0.9
+
+	// topKMaxBuckets limits the memory of a top-k
+	topKMaxBuckets = 1 << 27
+	// topKMaxIncrement limits the increment of TOPK.INCRBY, since a counter is decayed once per unit
+	topKMaxIncrement = 100000
+)
+
+func (db *DB) getAsTopK(key string) (*topk.TopK, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	tk, ok := entity.Data.(*topk.TopK)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return tk, nil
+}
+
+// getExistedTopK returns the top-k of key or an error reply if it does not exist
+func (db *DB) getExistedTopK(key string) (*topk.TopK, protocol.ErrorReply) {
+	tk, errReply := db.getAsTopK(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if tk == nil {
+		return nil, protocol.MakeErrReply("ERR TopK: key does not exist")
+	}
+	return tk, nil
+}
+
+func (db *DB) putNewTopK(key string, tk *topk.TopK) client.Reply {
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR TopK: key already exists")
+	}
+	db.PutEntity(key, &IDB.DataEntity{Data: tk})
+	return protocol.MakeOkReply()
+}
+
+// execTopKReserve creates an empty top-k
+func execTopKReserve(db *DB, args [][]byte) client.Reply {
+	if len(args) != 2 && len(args) != 5 {
+		return protocol.MakeArgNumErrReply(consts.CMDTopKReserve)
+	}
+	k, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil || k == 0 {
+		return protocol.MakeErrReply("ERR TopK: invalid k")
+	}
+	width, depth, decay := uint64(topKDefaultWidth), uint64(topKDefaultDepth), topKDefaultDecay
+	if len(args) == 5 {
+		width, err = strconv.ParseUint(string(args[2]), 10, 32)
+		if err != nil || width == 0 {
+			return protocol.MakeErrReply("ERR TopK: invalid width")
+		}
+		depth, err = strconv.ParseUint(string(args[3]), 10, 32)
+		if err != nil || depth == 0 {
+			return protocol.MakeErrReply("ERR TopK: invalid depth")
+		}
+		decay, err = strconv.ParseFloat(string(args[4]), 64)
+		if err != nil || !(decay > 0 && decay <= 1) {
+			return protocol.MakeErrReply("ERR TopK: invalid decay value. must be '<= 1' & '> 0'")
+		}
+	}
+	if width*depth > topKMaxBuckets || k > topKMaxBuckets {
+		return protocol.MakeErrReply("ERR TopK: width * depth or k is too large")
+	}
+	return db.putNewTopK(string(args[0]), topk.New(uint32(k), uint32(width), uint32(depth), decay))
+}
+
+// addIntoTopK adds items with increments, replies items expelled from top k, nil if none
+func addIntoTopK(tk *topk.TopK, items [][]byte, increments []uint32) client.Reply {
+	replies := make([]client.Reply, len(items))
+	for i, item := range items {
+		if expelled, ok := tk.Add(item, increments[i]); ok {
+			replies[i] = protocol.MakeBulkReply([]byte(expelled))
+		} else {
+			replies[i] = protocol.MakeNullBulkReply()
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTopKAdd adds items into top-k
+func execTopKAdd(db *DB, args [][]byte) client.Reply {
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	increments := make([]uint32, len(args)-1)
+	for i := range increments {
+		increments[i] = 1
+	}
+	return addIntoTopK(tk, args[1:], increments)
+}
+
+// execTopKIncrBy increases counts of items in top-k
+func execTopKIncrBy(db *DB, args [][]byte) client.Reply {
+	if len(args)%2 != 1 {
+		return protocol.MakeArgNumErrReply(consts.CMDTopKIncrBy)
+	}
+	items := make([][]byte, 0, len(args)/2)
+	increments := make([]uint32, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		increment, err := strconv.ParseUint(string(args[i+1]), 10, 32)
+		if err != nil || increment == 0 || increment > topKMaxIncrement {
+			return protocol.MakeErrReply("ERR TopK: increment must be an integer between 1 and 100000")
+		}
+		items = append(items, args[i])
+		increments = append(increments, uint32(increment))
+	}
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return addIntoTopK(tk, items, increments)
+}
+
+// execTopKQuery returns whether items are in top k
+func execTopKQuery(db *DB, args [][]byte) client.Reply {
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		if tk.Query(item) {
+			replies[i] = protocol.MakeIntReply(1)
+		} else {
+			replies[i] = protocol.MakeIntReply(0)
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTopKCount returns the estimated counts of items
+func execTopKCount(db *DB, args [][]byte) client.Reply {
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]client.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		replies[i] = protocol.MakeIntReply(int64(tk.Count(item)))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTopKList returns top k items in descending order of count
+func execTopKList(db *DB, args [][]byte) client.Reply {
+	withCount := false
+	if len(args) > 1 {
+		if len(args) > 2 || strings.ToUpper(string(args[1])) != "WITHCOUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		withCount = true
+	}
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	items := tk.List()
+	replies := make([]client.Reply, 0, 2*len(items))
+	for _, item := range items {
+		replies = append(replies, protocol.MakeBulkReply([]byte(item.Item)))
+		if withCount {
+			replies = append(replies, protocol.MakeIntReply(int64(item.Count)))
+		}
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTopKInfo returns parameters of top-k
+func execTopKInfo(db *DB, args [][]byte) client.Reply {
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeMultiRawReply([]client.Reply{
+		protocol.MakeBulkReply([]byte("k")), protocol.MakeIntReply(int64(tk.K())),
+		protocol.MakeBulkReply([]byte("width")), protocol.MakeIntReply(int64(tk.Width())),
+		protocol.MakeBulkReply([]byte("depth")), protocol.MakeIntReply(int64(tk.Depth())),
+		protocol.MakeBulkReply([]byte("decay")), protocol.MakeBulkReply([]byte(formatScore(tk.Decay()))),
+	})
+}
+
+// execTopKScanDump dumps top-k in chunks
+func execTopKScanDump(db *DB, args [][]byte) client.Reply {
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	tk, errReply := db.getExistedTopK(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return makeScanDumpReply(tk, iter)
+}
+
+// execTopKLoadChunk restores top-k from chunks replied by TOPK.SCANDUMP
+func execTopKLoadChunk(db *DB, args [][]byte) client.Reply {
+	key := string(args[0])
+	iter, errReply := parseChunkIterator(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if iter == 1 {
+		tk, err := topk.FromHeader(args[2])
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return db.putNewTopK(key, tk)
+	}
+	tk, errReply := db.getExistedTopK(key)
+	if errReply != nil {
+		return errReply
+	}
+	if errReply := loadChunk(tk, iter, args[2]); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	registerCommand(consts.CMDTopKReserve, execTopKReserve, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDTopKAdd, execTopKAdd, router.WriteFirstKey, rollbackFirstKey, -3, router.FlagWrite)
+	registerCommand(consts.CMDTopKIncrBy, execTopKIncrBy, router.WriteFirstKey, rollbackFirstKey, -4, router.FlagWrite)
+	registerCommand(consts.CMDTopKQuery, execTopKQuery, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDTopKCount, execTopKCount, router.ReadFirstKey, nil, -3, router.FlagReadOnly)
+	registerCommand(consts.CMDTopKList, execTopKList, router.ReadFirstKey, nil, -2, router.FlagReadOnly)
+	registerCommand(consts.CMDTopKInfo, execTopKInfo, router.ReadFirstKey, nil, 2, router.FlagReadOnly)
+	registerCommand(consts.CMDTopKScanDump, execTopKScanDump, router.ReadFirstKey, nil, 3, router.FlagReadOnly)
+	registerCommand(consts.CMDTopKLoadChunk, execTopKLoadChunk, router.WriteFirstKey, rollbackFirstKey, 4, router.FlagWrite)
+}
@@ -0,0 +1,28 @@
+package single_db
+
+import "testing"
+
+func TestTopK(t *testing.T) {
+	db := MakeDB(0)
+	check(t, db, "TOPK.RESERVE k 2 10 4", "-ERR wrong number of arguments for 'TOPK.RESERVE' command")
+	check(t, db, "TOPK.RESERVE k 2 10 4 1.5", "-ERR TopK: invalid decay value. must be '<= 1' & '> 0'")
+	check(t, db, "TOPK.RESERVE k 2", "+OK")
+	check(t, db, "TOPK.INFO k", "*8 $1 k :2 $5 width :8 $5 depth :7 $5 decay $3 0.9")
+	check(t, db, "TOPK.ADD k a b a", "*3 $-1 $-1 $-1")
+	// b is expelled by c
+	check(t, db, "TOPK.INCRBY k c 10", "*1 $1 b")
+	check(t, db, "TOPK.INCRBY k c 0", "-ERR TopK: increment must be an integer between 1 and 100000")
+	check(t, db, "TOPK.LIST k WITHCOUNT", "*4 $1 c :10 $1 a :2")
+	check(t, db, "TOPK.LIST k", "*2 $1 c $1 a")
+	check(t, db, "TOPK.QUERY k a b", "*2 :1 :0")
+	check(t, db, "TOPK.COUNT k a b", "*2 :2 :1")
+	check(t, db, "TOPK.ADD nokey a", "-ERR TopK: key does not exist")
+	check(t, db, "TYPE k", "+TopK-TYPE")
+
+	replayUndo(t, db, "k")
+	check(t, db, "TOPK.LIST k WITHCOUNT", "*4 $1 c :10 $1 a :2")
+	check(t, db, "TOPK.COUNT k a b", "*2 :2 :1")
+	copyByChunks(t, db, "TOPK", "k", "k2")
+	check(t, db, "TOPK.LIST k2 WITHCOUNT", "*4 $1 c :10 $1 a :2")
+	check(t, db, "TOPK.COUNT k2 a b", "*2 :2 :1")
+}
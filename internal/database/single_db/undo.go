@@ -0,0 +1,148 @@
+package single_db
+
+import (
+	"strconv"
+
+	"github.com/pluming/aurora/datastruct/bloom"
+	"github.com/pluming/aurora/datastruct/cms"
+	"github.com/pluming/aurora/datastruct/cuckoo"
+	"github.com/pluming/aurora/datastruct/dict"
+	"github.com/pluming/aurora/datastruct/jsondoc"
+	"github.com/pluming/aurora/datastruct/list"
+	"github.com/pluming/aurora/datastruct/set"
+	"github.com/pluming/aurora/datastruct/skiplist"
+	"github.com/pluming/aurora/datastruct/stream"
+	"github.com/pluming/aurora/datastruct/tdigest"
+	"github.com/pluming/aurora/datastruct/timeseries"
+	"github.com/pluming/aurora/datastruct/topk"
+	"github.com/pluming/aurora/datastruct/zset"
+	"github.com/pluming/aurora/internal/database/IDB"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+/* ---- Undo Logs ---- */
+
+// rollbackFirstKey returns undo logs restoring the first key of args
+func rollbackFirstKey(db *DB, args [][]byte) []router.CmdLine {
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+// rollbackWriteKeys returns an undo function restoring all write keys reported by prepare
+func rollbackWriteKeys(prepare router.PreFunc) undoFunc {
+	return func(db *DB, args [][]byte) []router.CmdLine {
+		write, _ := prepare(args)
+		return rollbackGivenKeys(db, write...)
+	}
+}
+
+// rollbackGivenKeys returns undo logs restoring the whole value and ttl of given keys
+func rollbackGivenKeys(db *DB, keys ...string) []router.CmdLine {
+	var undoCmdLines []router.CmdLine
+	for _, key := range keys {
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine(consts.CMDDel, key),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine(consts.CMDDel, key)) // clean existed first
+			undoCmdLines = append(undoCmdLines, entityToCmdLines(key, entity)...)
+			if expireTime, hasTTL := db.getExpireTime(key); hasTTL {
+				undoCmdLines = append(undoCmdLines, utils.ToCmdLine(consts.CMDPExpireAt, key,
+					strconv.FormatInt(expireTime.UnixMilli(), 10)))
+			}
+		}
+	}
+	return undoCmdLines
+}
+
+// entityToCmdLines serializes data entity to command lines which rebuild it,
+// types which can not be rebuilt by a single command like stream, filters, sketches and time series take multiple lines
+func entityToCmdLines(key string, entity *IDB.DataEntity) []router.CmdLine {
+	switch val := entity.Data.(type) {
+	case *stream.Stream:
+		return streamToCmdLines(key, val)
+	case *bloom.Filter:
+		return dumpToCmdLines(consts.CMDBFLoadChunk, key, val)
+	case *cuckoo.Filter:
+		return dumpToCmdLines(consts.CMDCFLoadChunk, key, val)
+	case *timeseries.Series:
+		return timeSeriesToCmdLines(key, val)
+	case *cms.Sketch:
+		return dumpToCmdLines(consts.CMDCMSLoadChunk, key, val)
+	case *topk.TopK:
+		return dumpToCmdLines(consts.CMDTopKLoadChunk, key, val)
+	case *tdigest.Digest:
+		return dumpToCmdLines(consts.CMDTDigestLoadChunk, key, val)
+	}
+	return []router.CmdLine{entityToCmd(key, entity)}
+}
+
+// entityToCmd serializes data entity to a command line which rebuilds it
+func entityToCmd(key string, entity *IDB.DataEntity) router.CmdLine {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		// string values may be modified in place by bitmap commands
+		return utils.ToCmdLine3(consts.CMDSet, []byte(key), cloneString(val))
+	case list.List:
+		return listToCmd(key, val)
+	case dict.Dict:
+		return hashToCmd(key, val)
+	case *set.Set:
+		return setToCmd(key, val)
+	case *zset.ZSet:
+		return zSetToCmd(key, val)
+	case *jsondoc.Document:
+		return utils.ToCmdLine3(consts.CMDJSONSet, []byte(key), []byte("$"), jsondoc.Marshal(val.Root()))
+	}
+	return nil
+}
+
+func listToCmd(key string, l list.List) router.CmdLine {
+	cmdLine := make([][]byte, 0, 2+l.Len())
+	cmdLine = append(cmdLine, []byte(consts.CMDRPush), []byte(key))
+	l.ForEach(func(i int, val interface{}) bool {
+		cmdLine = append(cmdLine, val.([]byte))
+		return true
+	})
+	return cmdLine
+}
+
+func hashToCmd(key string, hash dict.Dict) router.CmdLine {
+	cmdLine := make([][]byte, 0, 2+2*hash.Len())
+	cmdLine = append(cmdLine, []byte(consts.CMDHSet), []byte(key))
+	hash.ForEach(func(field string, val interface{}) bool {
+		cmdLine = append(cmdLine, []byte(field), val.([]byte))
+		return true
+	})
+	return cmdLine
+}
+
+func setToCmd(key string, set *set.Set) router.CmdLine {
+	cmdLine := make([][]byte, 0, 2+set.Len())
+	cmdLine = append(cmdLine, []byte(consts.CMDSAdd), []byte(key))
+	set.ForEach(func(member string) bool {
+		cmdLine = append(cmdLine, []byte(member))
+		return true
+	})
+	return cmdLine
+}
+
+func zSetToCmd(key string, zs *zset.ZSet) router.CmdLine {
+	cmdLine := make([][]byte, 0, 2+2*zs.Len())
+	cmdLine = append(cmdLine, []byte(consts.CMDZAdd), []byte(key))
+	if zs.Len() == 0 {
+		return cmdLine
+	}
+	zs.ForEach(0, zs.Len(), false, func(element *skiplist.Element) bool {
+		cmdLine = append(cmdLine, []byte(formatScore(element.Score)), []byte(element.Member))
+		return true
+	})
+	return cmdLine
+}
@@ -0,0 +1,45 @@
+package single_db
+
+import (
+	"strconv"
+
+	"github.com/pluming/aurora/internal/database/protocol"
+)
+
+// parseInt parses an integer argument of command
+func parseInt(raw []byte) (int64, protocol.ErrorReply) {
+	val, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return val, nil
+}
+
+// normalizeRange converts redis style index range [start, stop] (both inclusive, negative means counting from tail)
+// into go style [start, stop), ok is false when the range is empty
+func normalizeRange(start, stop, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+func toBytesSlice(vals []interface{}) [][]byte {
+	result := make([][]byte, len(vals))
+	for i, v := range vals {
+		result[i], _ = v.([]byte)
+	}
+	return result
+}
@@ -1,16 +1,23 @@
 package single_db
 
+import "sync/atomic"
+
 /* --- add version --- */
 
 func (db *DB) addVersion(keys ...string) {
 	for _, key := range keys {
-		versionCode := db.GetVersion(key)
-		db.versionMap.Put(key, versionCode+1)
+		db.versionMap.Put(key, db.keyVersion(key)+1)
 	}
 }
 
-// GetVersion returns version code for given key
-func (db *DB) GetVersion(key string) uint32 {
+// GetVersion returns version code for given key.
+// The high bits are the index db was made with, so that versions of databases swapped by SWAPDB never equal.
+func (db *DB) GetVersion(key string) uint64 {
+	return uint64(db.index)<<32 | uint64(db.keyVersion(key)+atomic.LoadUint32(&db.epoch))
+}
+
+// keyVersion returns the number of modifications of key, excluding flushes and swaps
+func (db *DB) keyVersion(key string) uint32 {
 	entity, ok := db.versionMap.Get(key)
 	if !ok {
 		return 0
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/pluming/aurora/config"
@@ -13,11 +14,14 @@ import (
 	"github.com/pluming/aurora/internal/database/consts"
 	"github.com/pluming/aurora/internal/database/protocol"
 	"github.com/pluming/aurora/internal/database/single_db"
+	"github.com/pluming/aurora/internal/database/transaction"
 	"github.com/pluming/aurora/lib/logger"
 )
 
 type MultiDB struct {
 	dbSet []*atomic.Value // *DB
+	// swapMu guards swapping holders in dbSet, so that commands across databases load them consistently
+	swapMu sync.RWMutex
 }
 
 func NewServer() *MultiDB {
@@ -61,6 +65,18 @@ func (mdb *MultiDB) Exec(c client.Connection, cmdLine [][]byte) (result client.R
 	default:
 	}
 
+	// commands across databases are queued by MultiDB, transactions containing them or watching keys of
+	// databases other than the selected one are executed by MultiDB
+	if c.InMultiState() {
+		if _, ok := crossDBArity[cmdName]; ok {
+			return enqueueCrossDB(c, cmdLine)
+		}
+		if cmdName == consts.CMDExec && len(cmdLine) == 1 &&
+			(hasCrossDB(c.GetQueuedCmdLine()) || transaction.WatchesOtherDB(c.GetWatching(), c.GetDBIndex())) {
+			return mdb.execMulti(c)
+		}
+	}
+
 	switch cmdName {
 	case consts.CMDSubscribe:
 		return nil
@@ -73,21 +89,23 @@ func (mdb *MultiDB) Exec(c client.Connection, cmdLine [][]byte) (result client.R
 	case consts.CMDRewriteAof:
 		return nil
 	case consts.CMDFlushAll:
-		return nil
-	case consts.CMDFlushBb:
-		return nil
+		return mdb.execFlushAll(cmdLine[1:])
+	case consts.CMDFlushDB:
+		return mdb.execFlushDB(c, cmdLine[1:])
 	case consts.CMDSave:
 		return nil
 	case consts.CMDBgSave:
 		return nil
 	case consts.CMDSelect:
-		return nil
+		return mdb.execSelect(c, cmdLine[1:])
+	case consts.CMDSwapDB:
+		return mdb.execSwapDB(cmdLine[1:])
+	case consts.CMDMove:
+		return mdb.execMove(c, cmdLine[1:])
 	case consts.CMDCopy:
-		return nil
+		return mdb.execCopy(c, cmdLine[1:])
 	default:
 	}
-	// todo: support multi database transaction
-
 	// normal commands
 	dbIndex := c.GetDBIndex()
 	selectedDB, errReply := mdb.selectDB(dbIndex)
@@ -99,6 +117,12 @@ func (mdb *MultiDB) Exec(c client.Connection, cmdLine [][]byte) (result client.R
 
 // AfterClientClose does some clean after client close connection
 func (mdb *MultiDB) AfterClientClose(c client.Connection) {
+	// blocked clients are moved by SWAPDB
+	mdb.swapMu.RLock()
+	defer mdb.swapMu.RUnlock()
+	for _, holder := range mdb.dbSet {
+		holder.Load().(IDB.DBInstance).AfterClientClose(c)
+	}
 	//pubsub.UnsubscribeAll(mdb.hub, c)
 }
 
@@ -0,0 +1,206 @@
+package standalone
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/single_db"
+)
+
+/* ---- Commands Across Databases ---- */
+
+// parseDBIndex parses a db index which must be in range
+func (mdb *MultiDB) parseDBIndex(raw []byte, errMsg string) (int, protocol.ErrorReply) {
+	index, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return 0, protocol.MakeErrReply(errMsg)
+	}
+	if index >= len(mdb.dbSet) || index < 0 {
+		return 0, protocol.MakeErrReply("ERR DB index is out of range")
+	}
+	return index, nil
+}
+
+// loadDBs returns databases of the given indices, which are not swapped in the middle
+func (mdb *MultiDB) loadDBs(indices ...int) []*single_db.DB {
+	mdb.swapMu.RLock()
+	defer mdb.swapMu.RUnlock()
+	dbs := make([]*single_db.DB, len(indices))
+	for i, index := range indices {
+		dbs[i] = mdb.dbSet[index].Load().(*single_db.DB)
+	}
+	return dbs
+}
+
+// execSelect selects the database of connection
+func (mdb *MultiDB) execSelect(c client.Connection, args [][]byte) client.Reply {
+	if len(args) != 1 {
+		return protocol.MakeArgNumErrReply(consts.CMDSelect)
+	}
+	index, errReply := mdb.parseDBIndex(args[0], "ERR value is not an integer or out of range")
+	if errReply != nil {
+		return errReply
+	}
+	c.SelectDB(index)
+	return protocol.MakeOkReply()
+}
+
+// parseSwapDB parses the two database indices of SWAPDB
+func (mdb *MultiDB) parseSwapDB(args [][]byte) (int, int, protocol.ErrorReply) {
+	if len(args) != 2 {
+		return 0, 0, protocol.MakeArgNumErrReply(consts.CMDSwapDB)
+	}
+	index1, errReply := mdb.parseDBIndex(args[0], "ERR invalid first DB index")
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	index2, errReply := mdb.parseDBIndex(args[1], "ERR invalid second DB index")
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	return index1, index2, nil
+}
+
+// execSwapDB swaps two databases atomically, clients selecting one of them see the data of the other at once.
+// Blocked clients stay with the index they selected as well, and wait for keys in the data swapped in.
+func (mdb *MultiDB) execSwapDB(args [][]byte) client.Reply {
+	index1, index2, errReply := mdb.parseSwapDB(args)
+	if errReply != nil {
+		return errReply
+	}
+	mdb.swapMu.Lock()
+	defer mdb.swapMu.Unlock()
+	holder1, holder2 := mdb.dbSet[index1], mdb.dbSet[index2]
+	db1, db2 := holder1.Load().(*single_db.DB), holder2.Load().(*single_db.DB)
+	holder1.Store(db2)
+	holder2.Store(db1)
+	if index1 != index2 {
+		db1.Swap(db2)
+	}
+	return protocol.MakeOkReply()
+}
+
+// parseMove parses MOVE executed in the database of srcIndex, returns the destination index
+func (mdb *MultiDB) parseMove(srcIndex int, args [][]byte) (int, protocol.ErrorReply) {
+	if len(args) != 2 {
+		return 0, protocol.MakeArgNumErrReply(consts.CMDMove)
+	}
+	destIndex, errReply := mdb.parseDBIndex(args[1], "ERR value is not an integer or out of range")
+	if errReply != nil {
+		return 0, errReply
+	}
+	if srcIndex == destIndex {
+		return 0, protocol.MakeErrReply("ERR source and destination objects are the same")
+	}
+	return destIndex, nil
+}
+
+// execMove moves a key from the selected database into another one
+func (mdb *MultiDB) execMove(c client.Connection, args [][]byte) client.Reply {
+	srcIndex := c.GetDBIndex()
+	destIndex, errReply := mdb.parseMove(srcIndex, args)
+	if errReply != nil {
+		return errReply
+	}
+	if _, errReply := mdb.selectDB(srcIndex); errReply != nil {
+		return errReply
+	}
+	dbs := mdb.loadDBs(srcIndex, destIndex)
+	if dbs[0].MoveKey(dbs[1], string(args[0])) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// parseCopy parses COPY executed in the database of srcIndex, returns the destination index and whether to replace
+func (mdb *MultiDB) parseCopy(srcIndex int, args [][]byte) (int, bool, protocol.ErrorReply) {
+	if len(args) < 2 {
+		return 0, false, protocol.MakeArgNumErrReply(consts.CMDCopy)
+	}
+	destIndex := srcIndex
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return 0, false, protocol.MakeSyntaxErrReply()
+			}
+			index, errReply := mdb.parseDBIndex(args[i+1], "ERR value is not an integer or out of range")
+			if errReply != nil {
+				return 0, false, errReply
+			}
+			destIndex = index
+			i++
+		default:
+			return 0, false, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if srcIndex == destIndex && string(args[0]) == string(args[1]) {
+		return 0, false, protocol.MakeErrReply("ERR source and destination objects are the same")
+	}
+	return destIndex, replace, nil
+}
+
+// execCopy copies the value of source key to destination key in the selected database or the database given by DB option
+func (mdb *MultiDB) execCopy(c client.Connection, args [][]byte) client.Reply {
+	srcIndex := c.GetDBIndex()
+	destIndex, replace, errReply := mdb.parseCopy(srcIndex, args)
+	if errReply != nil {
+		return errReply
+	}
+	if _, errReply := mdb.selectDB(srcIndex); errReply != nil {
+		return errReply
+	}
+	dbs := mdb.loadDBs(srcIndex, destIndex)
+	if dbs[0].CopyKey(dbs[1], string(args[0]), string(args[1]), replace) {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// parseFlushMode parses the optional ASYNC or SYNC of FLUSHDB and FLUSHALL, returns whether it is ASYNC
+func parseFlushMode(cmdName string, args [][]byte) (bool, protocol.ErrorReply) {
+	if len(args) > 1 {
+		return false, protocol.MakeArgNumErrReply(cmdName)
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "SYNC":
+		return false, nil
+	case "ASYNC":
+		return true, nil
+	}
+	return false, protocol.MakeSyntaxErrReply()
+}
+
+// execFlushDB removes all keys in the selected database
+func (mdb *MultiDB) execFlushDB(c client.Connection, args [][]byte) client.Reply {
+	async, errReply := parseFlushMode(consts.CMDFlushDB, args)
+	if errReply != nil {
+		return errReply
+	}
+	if _, errReply := mdb.selectDB(c.GetDBIndex()); errReply != nil {
+		return errReply
+	}
+	mdb.loadDBs(c.GetDBIndex())[0].Flush(async)
+	return protocol.MakeOkReply()
+}
+
+// execFlushAll removes all keys in all databases
+func (mdb *MultiDB) execFlushAll(args [][]byte) client.Reply {
+	async, errReply := parseFlushMode(consts.CMDFlushAll, args)
+	if errReply != nil {
+		return errReply
+	}
+	for i := range mdb.dbSet {
+		mdb.loadDBs(i)[0].Flush(async)
+	}
+	return protocol.MakeOkReply()
+}
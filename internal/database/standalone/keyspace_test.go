@@ -0,0 +1,222 @@
+package standalone
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+)
+
+func TestSelectAndSwapDB(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "SET a 1", "+OK")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "GET a", "$-1")
+	check(t, mdb, c, "SELECT 16", "-ERR DB index is out of range")
+	check(t, mdb, c, "SELECT x", "-ERR value is not an integer or out of range")
+	check(t, mdb, c, "SELECT", "-ERR wrong number of arguments for 'SELECT' command")
+	check(t, mdb, c, "SET b 2", "+OK")
+	check(t, mdb, c, "SWAPDB 0 1", "+OK")
+	check(t, mdb, c, "GET a", "$1 1")
+	check(t, mdb, c, "GET b", "$-1")
+	check(t, mdb, c, "SWAPDB 0 x", "-ERR invalid second DB index")
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "GET b", "$1 2")
+}
+
+func TestMove(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "SET b 2", "+OK")
+	check(t, mdb, c, "MOVE b 0", "-ERR source and destination objects are the same")
+	check(t, mdb, c, "PEXPIRE b 100000", ":1")
+	check(t, mdb, c, "MOVE b 2", ":1")
+	check(t, mdb, c, "MOVE b 2", ":0")
+	check(t, mdb, c, "EXISTS b", ":0")
+	check(t, mdb, c, "SELECT 2", "+OK")
+	check(t, mdb, c, "GET b", "$1 2")
+	if ttl := run(mdb, c, "PTTL b"); ttl == ":-1" || ttl == ":-2" {
+		t.Errorf("ttl is lost: %s", ttl)
+	}
+	// an existing key in the destination is not overwritten
+	check(t, mdb, c, "SET c 3", "+OK")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "SET c 4", "+OK")
+	check(t, mdb, c, "MOVE c 2", ":0")
+	check(t, mdb, c, "GET c", "$1 4")
+}
+
+func TestCopy(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "RPUSH l a b c", ":3")
+	check(t, mdb, c, "COPY l l", "-ERR source and destination objects are the same")
+	check(t, mdb, c, "COPY l l2", ":1")
+	check(t, mdb, c, "COPY l l2", ":0")
+	check(t, mdb, c, "RPUSH l d", ":4")
+	check(t, mdb, c, "LRANGE l2 0 -1", "*3 $1 a $1 b $1 c")
+	check(t, mdb, c, "COPY l l2 REPLACE", ":1")
+	check(t, mdb, c, "LRANGE l2 0 -1", "*4 $1 a $1 b $1 c $1 d")
+	check(t, mdb, c, "COPY l l DB 3", ":1")
+	check(t, mdb, c, "COPY l l DB 3 FOO", "-Err syntax error")
+	check(t, mdb, c, "COPY l l DB", "-Err syntax error")
+	check(t, mdb, c, "XADD s 1-1 f v", "$3 1-1")
+	check(t, mdb, c, "COPY s s2 DB 3", ":1")
+	check(t, mdb, c, "SELECT 3", "+OK")
+	check(t, mdb, c, "LRANGE l 0 -1", "*4 $1 a $1 b $1 c $1 d")
+	check(t, mdb, c, "XRANGE s2 - +", "*1 *2 $3 1-1 *2 $1 f $1 v")
+}
+
+func TestMoveServesBlocked(t *testing.T) {
+	mdb := NewServer()
+	c, c2 := &tcp.FakeConn{}, &tcp.FakeConn{}
+	c2.SelectDB(3)
+	res := goRun(mdb, c2, "BLPOP q 0")
+	time.Sleep(50 * time.Millisecond)
+	check(t, mdb, c, "SELECT 4", "+OK")
+	check(t, mdb, c, "RPUSH q x", ":1")
+	check(t, mdb, c, "MOVE q 3", ":1")
+	select {
+	case got := <-res:
+		if got != "*2 $1 q $1 x" {
+			t.Errorf("unexpected BLPOP reply %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked client is not served")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "SET a 1", "+OK")
+	check(t, mdb, c, "SET b 1 PX 100000", "+OK")
+	check(t, mdb, c, "SELECT 3", "+OK")
+	check(t, mdb, c, "MSET a 1 b 2", "+OK")
+	check(t, mdb, c, "FLUSHDB FOO", "-Err syntax error")
+	check(t, mdb, c, "FLUSHDB SYNC ASYNC", "-ERR wrong number of arguments for 'FLUSHDB' command")
+	check(t, mdb, c, "DBSIZE", ":2")
+	check(t, mdb, c, "FLUSHDB ASYNC", "+OK")
+	check(t, mdb, c, "DBSIZE", ":0")
+	check(t, mdb, c, "SET c 3", "+OK")
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "DBSIZE", ":2")
+	check(t, mdb, c, "FLUSHALL", "+OK")
+	check(t, mdb, c, "DBSIZE", ":0")
+	check(t, mdb, c, "PTTL b", ":-2")
+	check(t, mdb, c, "SELECT 3", "+OK")
+	check(t, mdb, c, "DBSIZE", ":0")
+}
+
+func TestFlushAsync(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	for i := 0; i < 100; i++ {
+		check(t, mdb, c, "SET k"+strconv.Itoa(i)+" v PX 100000", "+OK")
+	}
+	check(t, mdb, c, "WATCH k0 missing", "+OK")
+	check(t, mdb, other, "FLUSHDB ASYNC", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET k0 v", "+QUEUED")
+	// a flush modifies every watched key, even if it does not exist
+	check(t, mdb, c, "EXEC", "*-1")
+	check(t, mdb, c, "DBSIZE", ":0")
+	check(t, mdb, c, "SCAN 0", "*2 $1 0 *0")
+	// expire jobs of keys set again after flushing are not cancelled, DBSIZE does not remove expired keys lazily
+	check(t, mdb, c, "SET k1 v PX 200", "+OK")
+	check(t, mdb, c, "SET k2 v", "+OK")
+	time.Sleep(1500 * time.Millisecond)
+	check(t, mdb, c, "DBSIZE", ":1")
+}
+
+func TestFlushConcurrent(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			run(mdb, other, "FLUSHDB ASYNC")
+			run(mdb, other, "SCAN 0 COUNT 1000")
+		}
+		close(done)
+	}()
+	for i := 0; i < 2000; i++ {
+		run(mdb, c, "SET k"+strconv.Itoa(i%50)+" v EX 100")
+	}
+	<-done
+	check(t, mdb, c, "FLUSHDB", "+OK")
+	check(t, mdb, c, "DBSIZE", ":0")
+}
+
+func TestCrossDBDeadlock(t *testing.T) {
+	mdb := NewServer()
+	c0, c1 := &tcp.FakeConn{}, &tcp.FakeConn{}
+	c1.SelectDB(1)
+	run(mdb, c0, "SET k v")
+	done := make(chan struct{})
+	for _, c := range []*tcp.FakeConn{c0, c1} {
+		go func(c *tcp.FakeConn) {
+			dest := "1"
+			if c == c1 {
+				dest = "0"
+			}
+			for i := 0; i < 2000; i++ {
+				run(mdb, c, "MOVE k "+dest)
+				run(mdb, c, "COPY k k DB "+dest)
+				run(mdb, c, "SWAPDB 2 3")
+				// transactions across databases lock all databases, they are slow
+				if i%10 == 0 {
+					run(mdb, c, "MULTI")
+					run(mdb, c, "MOVE k "+dest)
+					run(mdb, c, "SWAPDB 2 3")
+					run(mdb, c, "EXEC")
+				}
+			}
+			done <- struct{}{}
+		}(c)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(30 * time.Second):
+			t.Fatal("dead lock")
+		}
+	}
+}
+
+func TestSwapDBServesBlocked(t *testing.T) {
+	mdb := NewServer()
+	c, c2 := &tcp.FakeConn{}, &tcp.FakeConn{}
+	res := goRun(mdb, c2, "BLPOP q 2")
+	time.Sleep(50 * time.Millisecond)
+	check(t, mdb, c, "SWAPDB 0 1", "+OK")
+	// the blocked client waits for q in db 0 which is swapped in
+	check(t, mdb, c, "RPUSH q v", ":1")
+	select {
+	case got := <-res:
+		if got != "*2 $1 q $1 v" {
+			t.Errorf("unexpected BLPOP reply %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked client is not served")
+	}
+
+	// a ready key in the database swapped in serves blocked clients at once
+	res = goRun(mdb, c2, "BLPOP r 2")
+	time.Sleep(50 * time.Millisecond)
+	check(t, mdb, c, "SELECT 5", "+OK")
+	check(t, mdb, c, "RPUSH r w", ":1")
+	check(t, mdb, c, "SWAPDB 5 0", "+OK")
+	select {
+	case got := <-res:
+		if got != "*2 $1 r $1 w" {
+			t.Errorf("unexpected BLPOP reply %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked client is not served")
+	}
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "EXISTS r", ":0")
+}
@@ -0,0 +1,214 @@
+package standalone
+
+import (
+	"strings"
+
+	"github.com/pluming/aurora/internal/client"
+	"github.com/pluming/aurora/internal/database/consts"
+	"github.com/pluming/aurora/internal/database/protocol"
+	"github.com/pluming/aurora/internal/database/router"
+	"github.com/pluming/aurora/internal/database/single_db"
+	"github.com/pluming/aurora/internal/database/transaction"
+)
+
+/* ---- Transaction Across Databases ----
+ * Commands across databases are unknown to a single database, so MultiDB queues them itself.
+ * A transaction containing them, or watching keys of databases other than the selected one, is executed by
+ * MultiDB instead of the selected database: it stops swapping and locks all keys of all databases,
+ * queued commands run in the database selected by SELECT before them.
+ * If a command fails, commands executed before it are rolled back like single_db.ExecMulti.
+ */
+
+// crossDBArity is the arity of commands across databases which can be queued in MULTI
+var crossDBArity = map[string]int{
+	consts.CMDSelect:   2,
+	consts.CMDSwapDB:   3,
+	consts.CMDMove:     3,
+	consts.CMDCopy:     -3,
+	consts.CMDFlushDB:  -1,
+	consts.CMDFlushAll: -1,
+}
+
+// enqueueCrossDB puts a command across databases into the pending queue of conn
+func enqueueCrossDB(c client.Connection, cmdLine [][]byte) client.Reply {
+	cmdName := strings.ToUpper(string(cmdLine[0]))
+	if !router.ValidateArity(crossDBArity[cmdName], cmdLine) {
+		return transaction.Reject(c, protocol.MakeArgNumErrReply(cmdName))
+	}
+	c.EnqueueCmd(cmdLine)
+	return protocol.MakeQueuedReply()
+}
+
+// hasCrossDB returns whether any queued command works across databases
+func hasCrossDB(cmdLines [][][]byte) bool {
+	for _, cmdLine := range cmdLines {
+		if _, ok := crossDBArity[strings.ToUpper(string(cmdLine[0]))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// multiTx is a transaction across databases, it is executed holding locks of all keys
+type multiTx struct {
+	mdb *MultiDB
+	// index of the database selected by SELECT in the transaction
+	index int
+	// undo functions of executed commands
+	undos []func()
+	// releases runs after unlocking if the transaction is committed
+	releases []func()
+}
+
+// execMulti executes the queued commands of conn across databases
+func (mdb *MultiDB) execMulti(c client.Connection) client.Reply {
+	defer c.SetMultiState(false)
+	if len(c.GetTxErrors()) > 0 {
+		return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	if _, errReply := mdb.selectDB(c.GetDBIndex()); errReply != nil {
+		return errReply
+	}
+	mdb.swapMu.Lock()
+	dbs := make([]*single_db.DB, len(mdb.dbSet))
+	for i, holder := range mdb.dbSet {
+		dbs[i] = holder.Load().(*single_db.DB)
+	}
+	unlock := single_db.LockAll(dbs)
+	tx := &multiTx{mdb: mdb, index: c.GetDBIndex()}
+	reply, committed := tx.exec(c.GetWatching(), c.GetQueuedCmdLine())
+	unlock()
+	mdb.swapMu.Unlock()
+	if !committed {
+		return reply
+	}
+	c.SelectDB(tx.index)
+	for _, release := range tx.releases {
+		release()
+	}
+	// keys waited by blocked clients may be written, moved or swapped in
+	for _, db := range dbs {
+		db.ServeAllBlocked()
+	}
+	return reply
+}
+
+// db returns the database selected in the transaction
+func (tx *multiTx) db() *single_db.DB {
+	return tx.mdb.dbSet[tx.index].Load().(*single_db.DB)
+}
+
+// exec executes command lines, it replies null if any watching key has been modified
+func (tx *multiTx) exec(watching map[client.WatchedKey]uint64, cmdLines [][][]byte) (client.Reply, bool) {
+	getDB := func(dbIndex int) transaction.Versioned {
+		return tx.mdb.dbSet[dbIndex].Load().(*single_db.DB)
+	}
+	if transaction.IsWatchingChanged(getDB, watching) {
+		return protocol.MakeNullMultiBulkReply(), false
+	}
+	results := make([]client.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		result := tx.execCmd(cmdLine)
+		if errReply, ok := result.(protocol.ErrorReply); ok {
+			for i := len(tx.undos) - 1; i >= 0; i-- {
+				tx.undos[i]()
+			}
+			return protocol.MakeErrReply("EXECABORT Transaction rolled back because of error: " + errReply.Error()), false
+		}
+		results = append(results, result)
+	}
+	return protocol.MakeMultiRawReply(results), true
+}
+
+// execCmd executes a queued command line and records its undo function
+func (tx *multiTx) execCmd(cmdLine [][]byte) client.Reply {
+	cmdName, args := strings.ToUpper(string(cmdLine[0])), cmdLine[1:]
+	switch cmdName {
+	case consts.CMDSelect:
+		index, errReply := tx.mdb.parseDBIndex(args[0], "ERR value is not an integer or out of range")
+		if errReply != nil {
+			return errReply
+		}
+		tx.index = index
+		return protocol.MakeOkReply()
+	case consts.CMDSwapDB:
+		index1, index2, errReply := tx.mdb.parseSwapDB(args)
+		if errReply != nil {
+			return errReply
+		}
+		tx.swapDB(index1, index2)
+		tx.undos = append(tx.undos, func() {
+			tx.swapDB(index1, index2)
+		})
+		return protocol.MakeOkReply()
+	case consts.CMDMove:
+		destIndex, errReply := tx.mdb.parseMove(tx.index, args)
+		if errReply != nil {
+			return errReply
+		}
+		src, dest, key := tx.db(), tx.mdb.dbSet[destIndex].Load().(*single_db.DB), string(args[0])
+		if !src.MoveKeyLocked(dest, key) {
+			return protocol.MakeIntReply(0)
+		}
+		tx.undos = append(tx.undos, func() {
+			dest.MoveKeyLocked(src, key)
+		})
+		return protocol.MakeIntReply(1)
+	case consts.CMDCopy:
+		destIndex, replace, errReply := tx.mdb.parseCopy(tx.index, args)
+		if errReply != nil {
+			return errReply
+		}
+		src, dest, destKey := tx.db(), tx.mdb.dbSet[destIndex].Load().(*single_db.DB), string(args[1])
+		undoLog := dest.UndoKeys(destKey)
+		if !src.CopyKeyLocked(dest, string(args[0]), destKey, replace) {
+			return protocol.MakeIntReply(0)
+		}
+		tx.undos = append(tx.undos, func() {
+			dest.Rollback([][]router.CmdLine{undoLog})
+		})
+		return protocol.MakeIntReply(1)
+	case consts.CMDFlushDB:
+		async, errReply := parseFlushMode(cmdName, args)
+		if errReply != nil {
+			return errReply
+		}
+		tx.flush(tx.db(), async)
+		return protocol.MakeOkReply()
+	case consts.CMDFlushAll:
+		async, errReply := parseFlushMode(cmdName, args)
+		if errReply != nil {
+			return errReply
+		}
+		for _, holder := range tx.mdb.dbSet {
+			tx.flush(holder.Load().(*single_db.DB), async)
+		}
+		return protocol.MakeOkReply()
+	}
+	db := tx.db()
+	result, undoLog := db.ExecQueued(cmdLine)
+	tx.undos = append(tx.undos, func() {
+		db.Rollback([][]router.CmdLine{undoLog})
+	})
+	return result
+}
+
+// swapDB swaps two databases like execSwapDB, the swapping is excluded by execMulti already
+func (tx *multiTx) swapDB(index1, index2 int) {
+	holder1, holder2 := tx.mdb.dbSet[index1], tx.mdb.dbSet[index2]
+	db1, db2 := holder1.Load().(*single_db.DB), holder2.Load().(*single_db.DB)
+	holder1.Store(db2)
+	holder2.Store(db1)
+	if index1 != index2 {
+		db1.SwapLocked(db2)
+	}
+}
+
+// flush removes all keys of db, which are restored by rollback or released after committing
+func (tx *multiTx) flush(db *single_db.DB, async bool) {
+	flushed := db.FlushLocked()
+	tx.undos = append(tx.undos, flushed.Restore)
+	tx.releases = append(tx.releases, func() {
+		flushed.Release(async)
+	})
+}
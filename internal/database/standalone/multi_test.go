@@ -0,0 +1,266 @@
+package standalone
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+)
+
+func TestMulti(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "EXEC", "-ERR EXEC without MULTI")
+	check(t, mdb, c, "DISCARD", "-ERR DISCARD without MULTI")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "MULTI", "-ERR MULTI calls can not be nested")
+	check(t, mdb, c, "SET a 1", "+QUEUED")
+	check(t, mdb, c, "INCR a", "+QUEUED")
+	check(t, mdb, c, "LPUSH l x y", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*3 +OK :2 :2")
+	check(t, mdb, c, "GET a", "$1 2")
+
+	// a command failed to be queued discards the transaction
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 5", "+QUEUED")
+	check(t, mdb, c, "NOPE a", "-ERR unknown command 'NOPE'")
+	check(t, mdb, c, "GET", "-ERR wrong number of arguments for 'GET' command")
+	check(t, mdb, c, "SELECT", "-ERR wrong number of arguments for 'SELECT' command")
+	check(t, mdb, c, "EXEC", "-EXECABORT Transaction discarded because of previous errors.")
+	check(t, mdb, c, "GET a", "$1 2")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "EXEC", "*0")
+
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 7", "+QUEUED")
+	check(t, mdb, c, "DISCARD", "+OK")
+	check(t, mdb, c, "GET a", "$1 2")
+
+	// a failed command rolls back commands executed before it
+	check(t, mdb, c, "PEXPIRE a 100000", ":1")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 9", "+QUEUED")
+	check(t, mdb, c, "RPUSH l z", "+QUEUED")
+	check(t, mdb, c, "DEL nokey", "+QUEUED")
+	check(t, mdb, c, "INCR l", "+QUEUED")
+	check(t, mdb, c, "SET b 1", "+QUEUED")
+	if got := run(mdb, c, "EXEC"); !strings.HasPrefix(got, "-EXECABORT Transaction rolled back because of error: WRONGTYPE") {
+		t.Errorf("unexpected EXEC reply: %s", got)
+	}
+	check(t, mdb, c, "GET a", "$1 2")
+	check(t, mdb, c, "LRANGE l 0 -1", "*2 $1 y $1 x")
+	check(t, mdb, c, "EXISTS b", ":0")
+	if ttl := run(mdb, c, "PTTL a"); ttl == ":-1" || ttl == ":-2" {
+		t.Errorf("ttl is lost: %s", ttl)
+	}
+}
+
+func TestMultiWatch(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, mdb, c, "SET a 1", "+OK")
+	check(t, mdb, c, "WATCH a", "+OK")
+	check(t, mdb, other, "SET a 3", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "WATCH a", "-ERR WATCH inside MULTI is not allowed")
+	check(t, mdb, c, "SET a 4", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*-1")
+	check(t, mdb, c, "GET a", "$1 3")
+
+	check(t, mdb, c, "WATCH a", "+OK")
+	check(t, mdb, other, "GET a", "$1 3")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 4", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 +OK")
+	// watching is cleared by EXEC
+	check(t, mdb, other, "SET a 5", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 6", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 +OK")
+}
+
+func TestMultiServesBlocked(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, mdb, c, "RPUSH src 2 1", ":2")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SORT src STORE dst", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 :2")
+	check(t, mdb, c, "LRANGE dst 0 -1", "*2 $1 1 $1 2")
+
+	blocked := goRun(mdb, other, "BLPOP q 5")
+	time.Sleep(100 * time.Millisecond)
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "RPUSH q v", "+QUEUED")
+	// blocking commands do not block in transactions
+	check(t, mdb, c, "BLPOP q 0", "+QUEUED")
+	check(t, mdb, c, "RPUSH q w", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*3 :1 *2 $1 q $1 v :1")
+	select {
+	case got := <-blocked:
+		if got != "*2 $1 q $1 w" {
+			t.Errorf("unexpected BLPOP reply: %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked client is not served")
+	}
+}
+
+func TestMultiAcrossDBs(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "SET a 0", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET a 1", "+QUEUED")
+	check(t, mdb, c, "SELECT 1", "+QUEUED")
+	check(t, mdb, c, "SET a 2", "+QUEUED")
+	check(t, mdb, c, "COPY a b DB 2", "+QUEUED")
+	check(t, mdb, c, "MOVE a 3", "+QUEUED")
+	check(t, mdb, c, "SWAPDB 2 3", "+QUEUED")
+	check(t, mdb, c, "SELECT 2", "+QUEUED")
+	check(t, mdb, c, "GET a", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*8 +OK +OK +OK :1 :1 +OK +OK $1 2")
+	// SELECT in the transaction changes the selected database
+	check(t, mdb, c, "GET b", "$-1")
+	check(t, mdb, c, "SELECT 3", "+OK")
+	check(t, mdb, c, "GET b", "$1 2")
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "GET a", "$1 1")
+
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "FLUSHDB", "+QUEUED")
+	check(t, mdb, c, "DBSIZE", "+QUEUED")
+	check(t, mdb, c, "SET c 3", "+QUEUED")
+	check(t, mdb, c, "FLUSHALL ASYNC", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*4 +OK :0 +OK +OK")
+	for i := 0; i < 4; i++ {
+		check(t, mdb, c, "SELECT "+strconv.Itoa(i), "+OK")
+		check(t, mdb, c, "DBSIZE", ":0")
+	}
+}
+
+func TestMultiAcrossDBsRollback(t *testing.T) {
+	mdb := NewServer()
+	c := &tcp.FakeConn{}
+	check(t, mdb, c, "SET a 1", "+OK")
+	check(t, mdb, c, "SET t 1 PX 100000", "+OK")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "SET b 2", "+OK")
+	check(t, mdb, c, "SET d 4", "+OK")
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "MOVE a 1", "+QUEUED")
+	check(t, mdb, c, "COPY t d DB 1 REPLACE", "+QUEUED")
+	check(t, mdb, c, "SWAPDB 0 2", "+QUEUED")
+	check(t, mdb, c, "SELECT 1", "+QUEUED")
+	check(t, mdb, c, "FLUSHDB", "+QUEUED")
+	check(t, mdb, c, "SET b 3", "+QUEUED")
+	check(t, mdb, c, "FLUSHALL", "+QUEUED")
+	check(t, mdb, c, "MOVE b 1", "+QUEUED")
+	check(t, mdb, c, "EXEC", "-EXECABORT Transaction rolled back because of error: ERR source and destination objects are the same")
+	check(t, mdb, c, "GET a", "$1 1")
+	if ttl := run(mdb, c, "PTTL t"); ttl == ":-1" || ttl == ":-2" {
+		t.Errorf("ttl is lost: %s", ttl)
+	}
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "DBSIZE", ":2")
+	check(t, mdb, c, "GET b", "$1 2")
+	check(t, mdb, c, "GET d", "$1 4")
+	check(t, mdb, c, "PTTL d", ":-1")
+	check(t, mdb, c, "SELECT 2", "+OK")
+	check(t, mdb, c, "DBSIZE", ":0")
+}
+
+func TestMultiAcrossDBsWatch(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, mdb, c, "WATCH a", "+OK")
+	check(t, mdb, other, "SET a 1", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SELECT 1", "+QUEUED")
+	check(t, mdb, c, "SET a 2", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*-1")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "EXISTS a", ":0")
+
+	// keys are watched in the database selected by WATCH
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, c, "WATCH k", "+OK")
+	check(t, mdb, other, "SET k 1", "+OK")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET z 1", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*-1")
+	check(t, mdb, c, "EXISTS z", ":0")
+
+	// a key of the same name in the selected database is not watched
+	check(t, mdb, c, "WATCH k", "+OK")
+	check(t, mdb, c, "SELECT 0", "+OK")
+	check(t, mdb, other, "SET k 2", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET z 1", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 +OK")
+
+	// swapping modifies keys watched in both databases
+	for _, swap := range []string{"SWAPDB 0 2", "SWAPDB 2 0"} {
+		check(t, mdb, c, "WATCH k", "+OK")
+		check(t, mdb, other, swap, "+OK")
+		check(t, mdb, c, "MULTI", "+OK")
+		check(t, mdb, c, "SET z 2", "+QUEUED")
+		check(t, mdb, c, "EXEC", "*-1")
+	}
+	check(t, mdb, c, "WATCH k", "+OK")
+	check(t, mdb, other, "SWAPDB 0 2", "+OK")
+	check(t, mdb, other, "SWAPDB 0 2", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET z 2", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*-1")
+}
+
+func TestUnwatch(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	check(t, mdb, c, "UNWATCH", "+OK")
+	check(t, mdb, c, "UNWATCH a", "-ERR wrong number of arguments for 'UNWATCH' command")
+	check(t, mdb, c, "WATCH a", "+OK")
+	check(t, mdb, c, "SELECT 1", "+OK")
+	check(t, mdb, c, "WATCH b", "+OK")
+	check(t, mdb, c, "UNWATCH", "+OK")
+	check(t, mdb, other, "SET a 1", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "SET b 1", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 +OK")
+
+	// UNWATCH in MULTI is queued, keys are still checked by EXEC
+	check(t, mdb, c, "WATCH b", "+OK")
+	check(t, mdb, other, "SELECT 1", "+OK")
+	check(t, mdb, other, "SET b 2", "+OK")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "UNWATCH", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*-1")
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "UNWATCH", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*1 +OK")
+}
+
+func TestMultiAcrossDBsServesBlocked(t *testing.T) {
+	mdb := NewServer()
+	c, other := &tcp.FakeConn{}, &tcp.FakeConn{}
+	other.SelectDB(1)
+	blocked := goRun(mdb, other, "BLPOP q 5")
+	time.Sleep(100 * time.Millisecond)
+	check(t, mdb, c, "MULTI", "+OK")
+	check(t, mdb, c, "RPUSH q v", "+QUEUED")
+	check(t, mdb, c, "MOVE q 1", "+QUEUED")
+	check(t, mdb, c, "EXEC", "*2 :1 :1")
+	select {
+	case got := <-blocked:
+		if got != "*2 $1 q $1 v" {
+			t.Errorf("unexpected BLPOP reply: %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked client is not served")
+	}
+}
@@ -0,0 +1,31 @@
+package standalone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pluming/aurora/internal/client/tcp"
+	"github.com/pluming/aurora/lib/utils"
+)
+
+// run executes a command line separated by spaces from c, and returns the reply with CRLF replaced by spaces
+func run(mdb *MultiDB, c *tcp.FakeConn, line string) string {
+	r := mdb.Exec(c, utils.ToCmdLine(strings.Fields(line)...))
+	return strings.TrimSpace(strings.ReplaceAll(string(r.ToBytes()), "\r\n", " "))
+}
+
+func check(t *testing.T, mdb *MultiDB, c *tcp.FakeConn, line, expect string) {
+	t.Helper()
+	if got := run(mdb, c, line); got != expect {
+		t.Errorf("%s: expect %q, got %q", line, expect, got)
+	}
+}
+
+// goRun executes line from c in another goroutine, and returns the channel of its reply
+func goRun(mdb *MultiDB, c *tcp.FakeConn, line string) <-chan string {
+	result := make(chan string, 1)
+	go func() {
+		result <- run(mdb, c, line)
+	}()
+	return result
+}
@@ -44,7 +44,12 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	cli := tcp.NewConn(conn)
 	h.activeConn.Store(cli, 1)
 
-	ch := parser.ParseStream(conn)
+	// the reader notifies db server as soon as the connection is gone,
+	// so that the command blocking this goroutine can be released
+	ch := parser.ParseStream(&closeNotifyReader{
+		reader:  conn,
+		onClose: func() { h.dbServer.AfterClientClose(cli) },
+	})
 	for payload := range ch {
 		if payload.Err != nil {
 			if payload.Err == io.EOF ||
@@ -84,6 +89,21 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 
 }
 
+// closeNotifyReader invokes onClose once reading from the underlying reader fails
+type closeNotifyReader struct {
+	reader  io.Reader
+	once    sync.Once
+	onClose func()
+}
+
+func (r *closeNotifyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil {
+		r.once.Do(r.onClose)
+	}
+	return n, err
+}
+
 // Close stops handler
 func (h *Handler) Close() error {
 	logger.Info("handler shutting down...")
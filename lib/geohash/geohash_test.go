@@ -37,3 +37,12 @@ func TestGetNeighbours(t *testing.T) {
 	ranges := GetNeighbours(90, 180, 630*1000)
 	fmt.Printf("%#v", ranges)
 }
+
+func TestEstimatePrecisionByRadius(t *testing.T) {
+	if precision := estimatePrecisionByRadius(mercatorMax*4, 0); precision != 1 {
+		t.Errorf("expect precision 1 for huge radius, actual %d", precision)
+	}
+	if precision := estimatePrecisionByRadius(1000, 0); precision != 27 {
+		t.Errorf("expect precision 27, actual %d", precision)
+	}
+}
@@ -21,7 +21,8 @@ func estimatePrecisionByRadius(radiusMeters float64, latitude float64) uint {
 	if radiusMeters == 0 {
 		return defaultBitSize - 1
 	}
-	var precision uint = 1
+	// signed, the precision may drop below 1 for huge radius
+	precision := 1
 	for radiusMeters < mercatorMax {
 		radiusMeters *= 2
 		precision++
@@ -40,7 +41,7 @@ func estimatePrecisionByRadius(radiusMeters float64, latitude float64) uint {
 	if precision > 32 {
 		precision = 32
 	}
-	return precision*2 - 1
+	return uint(precision*2 - 1)
 }
 
 // Distance computes the distance between two given coordinates in meter
@@ -0,0 +1,25 @@
+package murmur
+
+import "testing"
+
+func TestHash64A(t *testing.T) {
+	if Hash64A(nil, 0) != 0 {
+		t.Error("hash of empty key with seed 0 should be 0")
+	}
+	key := []byte("0123456789abcdef")
+	seen := make(map[uint64]bool)
+	// covers every length of tail
+	for i := 0; i <= len(key); i++ {
+		hash := Hash64A(key[:i], 0xadc83b19)
+		if seen[hash] {
+			t.Errorf("collision at length %d", i)
+		}
+		seen[hash] = true
+		if Hash64A(key[:i], 0xadc83b19) != hash {
+			t.Error("hash is not stable")
+		}
+	}
+	if Hash64A(key, 1) == Hash64A(key, 2) {
+		t.Error("seed is ignored")
+	}
+}
@@ -109,7 +109,8 @@ func (tw *TimeWheel) tickHandler() {
 	} else {
 		tw.currentPos++
 	}
-	go tw.scanAndRunTask(l)
+	// scan in the wheel goroutine, slots and timer are not safe for concurrent access
+	tw.scanAndRunTask(l)
 }
 
 func (tw *TimeWheel) scanAndRunTask(l *list.List) {
@@ -158,10 +159,10 @@ func (tw *TimeWheel) addTask(task *task) {
 }
 
 func (tw *TimeWheel) getPositionAndCircle(d time.Duration) (pos int, circle int) {
-	delaySeconds := int(d.Seconds())
-	intervalSeconds := int(tw.interval.Seconds())
-	circle = int(delaySeconds / intervalSeconds / tw.slotNum)
-	pos = int(tw.currentPos+delaySeconds/intervalSeconds) % tw.slotNum
+	// ticks are counted in intervals rather than seconds, so that a wheel may tick faster than once a second
+	ticks := int(d / tw.interval)
+	circle = ticks / tw.slotNum
+	pos = (tw.currentPos + ticks) % tw.slotNum
 
 	return
 }
@@ -0,0 +1,22 @@
+package timewheel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubSecondInterval(t *testing.T) {
+	tw := New(10*time.Millisecond, 100)
+	tw.Start()
+	defer tw.Stop()
+	ch := make(chan time.Time)
+	beginTime := time.Now()
+	// longer than a round of the wheel
+	tw.AddJob(1500*time.Millisecond, "", func() {
+		ch <- time.Now()
+	})
+	delayDuration := (<-ch).Sub(beginTime)
+	if delayDuration < 1500*time.Millisecond || delayDuration > 1600*time.Millisecond {
+		t.Errorf("wrong execute time %s", delayDuration)
+	}
+}